@@ -14,10 +14,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -29,9 +33,13 @@ import (
 	"tempo/internal/auth"
 	"tempo/internal/config"
 	"tempo/internal/database"
+	"tempo/internal/effects"
 	"tempo/internal/handler"
+	"tempo/internal/media"
 	"tempo/internal/middleware"
+	"tempo/internal/models"
 	"tempo/internal/repository"
+	"tempo/internal/storage"
 )
 
 func main() {
@@ -68,10 +76,93 @@ func main() {
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db.Pool)
 	projectRepo := repository.NewProjectRepository(db.Pool)
+	folderRepo := repository.NewFolderRepository(db.Pool)
+	tagRepo := repository.NewTagRepository(db.Pool)
+	shareLinkRepo := repository.NewShareLinkRepository(db.Pool)
+	mediaRepo := repository.NewMediaRepository(db.Pool)
+	uploadRepo := repository.NewUploadRepository(db.Pool)
+	mediaJobRepo := repository.NewMediaJobRepository(db.Pool)
+	blobGCRepo := repository.NewBlobGCRepository(db.Pool)
+	presetRepo := repository.NewEffectPresetRepository(db.Pool)
+	exportRepo := repository.NewExportRepository(db.Pool)
+
+	// Bring old project settings documents up to the current schema version
+	if n, skipped, err := projectRepo.MigrateSettings(context.Background()); err != nil {
+		log.Printf("Failed to migrate project settings: %v", err)
+	} else {
+		for id, err := range skipped {
+			log.Printf("Skipped settings migration for project %s: %v", id, err)
+		}
+		if n > 0 {
+			log.Printf("Migrated settings for %d projects", n)
+		}
+	}
+
+	// Initialize blob storage (local disk or S3)
+	signingKey := storageSigningKey(cfg.Storage, cfg.JWT.SecretKey)
+	blobs, err := newBlobStore(cfg.Storage, signingKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	log.Printf("Using %s blob storage", cfg.Storage.Backend)
+
+	// Initialize media ingest
+	// ffprobe is optional: without it uploads are stored but not probed
+	var prober media.Prober
+	if ffprobe, err := media.NewFFprobe(cfg.Media.FFprobePath); err != nil {
+		log.Printf("Media probing disabled: %v", err)
+	} else {
+		prober = ffprobe
+	}
+
+	// Background jobs need ffmpeg; without it videos just don't get them
+	// (nor still frames on request, though cached ones are still served)
+	worker := media.NewWorker(mediaJobRepo, mediaRepo, cfg.Media.Workers)
+	var frames *media.FrameExtractor
+	if ffmpeg, err := media.NewFFmpeg(cfg.Media.FFmpegPath); err != nil {
+		log.Printf("Media jobs disabled: %v", err)
+	} else {
+		worker.Register(media.NewThumbnailer(ffmpeg, blobs, mediaRepo, projectRepo))
+		worker.Register(media.NewWaveformer(ffmpeg, blobs, mediaRepo))
+		worker.Register(media.NewProxier(ffmpeg, blobs, mediaRepo))
+		worker.Register(media.NewSceneDetector(ffmpeg, blobs, mediaRepo))
+		if cfg.Media.HLS {
+			worker.Register(media.NewHLSPackager(ffmpeg, blobs, mediaRepo))
+		}
+		frames = media.NewFrameExtractor(ffmpeg, blobs, mediaRepo)
+	}
+	quotas := media.NewQuotas(mediaRepo, int64(cfg.Quota.UserMB)<<20, int64(cfg.Quota.ProjectMB)<<20)
+	ingestor := media.NewIngestor(blobs, prober, mediaRepo, projectRepo, worker, quotas)
+	gc := media.NewGC(blobs, mediaRepo, uploadRepo, blobGCRepo, exportRepo, media.GCOptions{
+		Interval:    cfg.GC.Interval,
+		GracePeriod: cfg.GC.GracePeriod,
+		DryRun:      cfg.GC.DryRun,
+	})
+
+	// Load the effect catalog: a bad definition file is a deploy mistake,
+	// better caught here than by projects rendering wrong
+	catalog, err := effects.Load(cfg.Effects.Dir)
+	if err != nil {
+		log.Fatalf("Failed to load effect catalog: %v", err)
+	}
+	log.Printf("Loaded %d effects", len(catalog.List()))
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(userRepo, jwtManager)
-	projectHandler := handler.NewProjectHandler(projectRepo)
+	projectHandler := handler.NewProjectHandler(projectRepo, blobs, catalog)
+	folderHandler := handler.NewFolderHandler(folderRepo)
+	tagHandler := handler.NewTagHandler(tagRepo)
+	bundleHandler := handler.NewBundleHandler(projectRepo, mediaRepo, blobs, ingestor, presetRepo, catalog)
+	mediaHandler := handler.NewMediaHandler(mediaRepo, projectRepo, blobs, ingestor)
+	usageHandler := handler.NewUsageHandler(quotas)
+	exportHandler := handler.NewExportHandler(exportRepo, projectRepo, blobs, quotas, catalog)
+	sceneHandler := handler.NewSceneHandler(mediaRepo, projectRepo, cfg.Media.SceneThreshold)
+	frameHandler := handler.NewFrameHandler(mediaRepo, blobs, frames)
+	effectHandler := handler.NewEffectHandler(catalog, projectRepo)
+	presetHandler := handler.NewPresetHandler(presetRepo, catalog)
+	hlsHandler := handler.NewHLSHandler(mediaRepo, blobs, signingKey, cfg.Server.PublicURL)
+	uploadHandler := handler.NewUploadHandler(uploadRepo, projectRepo, blobs, ingestor)
+	shareHandler := handler.NewShareHandler(shareLinkRepo, projectRepo, mediaRepo, blobs, cfg.Server.FrontendURL)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(jwtManager)
@@ -93,8 +184,8 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "https://*.vercel.app"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   append([]string{"Accept", "Authorization", "Content-Type", handler.SharePasswordHeader, handler.ContentSHA256Header}, handler.TusHeaders...),
+		ExposedHeaders:   append([]string{"Link"}, handler.TusExposedHeaders...),
 		AllowCredentials: true,
 		MaxAge:           300, // Cache preflight for 5 minutes
 	}))
@@ -109,6 +200,20 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Signed download URLs for the local storage backend
+	// (with S3 the URLs point at the bucket and never reach us)
+	if local, ok := blobs.(*storage.LocalStore); ok {
+		prefix := "/blobs/"
+		if u, err := url.Parse(cfg.Storage.PublicURL); err == nil && u.Path != "" {
+			prefix = strings.TrimRight(u.Path, "/") + "/"
+		}
+		r.Handle(prefix+"*", http.StripPrefix(prefix, local))
+	}
+
+	// HLS streams, signed per package (see handler.HLSHandler)
+	r.Get("/hls/{id}/{expires}/{signature}/*", hlsHandler.Serve)
+	r.Head("/hls/{id}/{expires}/{signature}/*", hlsHandler.Serve)
+
 	// API routes
 	r.Route("/api", func(r chi.Router) {
 		// Auth routes (public)
@@ -124,16 +229,125 @@ func main() {
 			})
 		})
 
+		// Current user routes (protected)
+		r.Route("/me", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Get("/usage", usageHandler.Get)
+		})
+
 		// Project routes (protected)
 		r.Route("/projects", func(r chi.Router) {
 			r.Use(authMiddleware.RequireAuth)
 			
 			r.Post("/", projectHandler.Create)
 			r.Get("/", projectHandler.List)
+			r.Post("/import", bundleHandler.Import)
 			r.Get("/{id}", projectHandler.Get)
 			r.Patch("/{id}", projectHandler.Update)
+			r.Patch("/{id}/settings", projectHandler.UpdateSettings)
+			r.Get("/{id}/timeline", projectHandler.GetTimeline)
+			r.Put("/{id}/timeline", projectHandler.UpdateTimeline)
+			r.Get("/{id}/timeline/effects", effectHandler.StatesAt)
+			r.Get("/{id}/scenes", sceneHandler.ForProject)
+			r.Get("/{id}/effects", effectHandler.ForProject)
+			r.Put("/{id}/effects/{effectID}/version", effectHandler.PinVersion)
+			r.Get("/{id}/bundle", bundleHandler.Export)
+			r.Get("/{id}/share-links", shareHandler.List)
+			r.Post("/{id}/share-links", shareHandler.Create)
+			r.Delete("/{id}/share-links/{linkID}", shareHandler.Revoke)
 			r.Delete("/{id}", projectHandler.Delete)
 			r.Get("/{id}/collaborators", projectHandler.GetCollaborators)
+			r.Put("/{id}/folder", folderHandler.MoveProject)
+			r.Post("/{id}/tags", tagHandler.AddToProject)
+			r.Delete("/{id}/tags/{tagID}", tagHandler.RemoveFromProject)
+		})
+
+		// Effect catalog (public, read-only)
+		r.Route("/effects", func(r chi.Router) {
+			r.Get("/", effectHandler.ListEffects)
+			r.Get("/{effectID}", effectHandler.GetEffect)
+			r.Get("/{effectID}/versions", effectHandler.ListVersions)
+			r.With(authMiddleware.OptionalAuth).Get("/{effectID}/presets", presetHandler.ForEffect)
+		})
+
+		// Effect preset routes (protected)
+		r.Route("/presets", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Get("/", presetHandler.List)
+			r.Post("/", presetHandler.Create)
+			r.Get("/{id}", presetHandler.Get)
+			r.Patch("/{id}", presetHandler.Update)
+			r.Delete("/{id}", presetHandler.Delete)
+		})
+
+		// Share link routes (public, read-only)
+		// Rate limited per IP so link passwords can't be brute forced
+		r.Route("/share", func(r chi.Router) {
+			r.Use(middleware.RateLimit)
+			r.Use(authMiddleware.OptionalAuth)
+
+			r.Get("/{token}", shareHandler.View)
+		})
+
+		// Video library routes (protected)
+		// Access is checked per video: uploader or project collaborators
+		r.Route("/videos", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/", mediaHandler.Upload)
+			r.Post("/from-hash", mediaHandler.FromHash)
+			r.Get("/", mediaHandler.List)
+			r.Get("/{id}", mediaHandler.Get)
+			r.Get("/{id}/thumbnails.vtt", mediaHandler.ThumbnailsVTT)
+			r.Get("/{id}/waveform", mediaHandler.Waveform)
+			r.Get("/{id}/source", mediaHandler.Source)
+			r.Get("/{id}/hls", hlsHandler.Get)
+			r.Get("/{id}/scenes", sceneHandler.Get)
+			r.Get("/{id}/frame", frameHandler.Get)
+			r.Delete("/{id}", mediaHandler.Delete)
+		})
+
+		// Resumable upload routes (tus protocol)
+		// OPTIONS is public so clients can discover capabilities
+		r.Options("/uploads", uploadHandler.Options)
+		r.Group(func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/uploads", uploadHandler.Create)
+			r.Head("/uploads/{id}", uploadHandler.Head)
+			r.Patch("/uploads/{id}", uploadHandler.Patch)
+			r.Delete("/uploads/{id}", uploadHandler.Delete)
+		})
+
+		// Export routes (protected, scoped to who started the export)
+		r.Route("/exports", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/", exportHandler.StartExport)
+			r.Get("/{exportID}", exportHandler.GetExportStatus)
+			r.Get("/{exportID}/download", exportHandler.DownloadExport)
+		})
+
+		// Folder routes (protected, always scoped to the current user)
+		r.Route("/folders", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Get("/", folderHandler.List)
+			r.Post("/", folderHandler.Create)
+			r.Patch("/{id}", folderHandler.Update)
+			r.Delete("/{id}", folderHandler.Delete)
+		})
+
+		// Tag routes (protected)
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Get("/", tagHandler.List)
+			r.Post("/", tagHandler.Create)
+			r.Patch("/{id}", tagHandler.Update)
+			r.Delete("/{id}", tagHandler.Delete)
 		})
 	})
 
@@ -153,6 +367,39 @@ func main() {
 		}
 	}()
 
+	// Clean up abandoned resumable uploads once an hour
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := uploadHandler.PurgeExpired(context.Background()); err != nil {
+				log.Printf("Failed to purge expired uploads: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired uploads", n)
+			}
+		}
+	}()
+
+	// Delete blobs nothing references anymore (see media.GC)
+	// Every server checks hourly; only one pass runs per interval
+	if cfg.GC.Interval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for ; ; <-ticker.C {
+				logGCRun(gc.Run(context.Background()))
+			}
+		}()
+	}
+
+	// Run background media jobs until shutdown
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker.Run(workerCtx)
+	}()
+
 	// Graceful shutdown
 	// This ensures in-flight requests complete before shutting down
 	// SIGINT = Ctrl+C, SIGTERM = kill command / container orchestrator
@@ -170,5 +417,57 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Interrupted jobs go back in the queue for the next start
+	stopWorker()
+	<-workerDone
+
 	log.Println("Server stopped")
 }
+
+// newBlobStore creates the storage backend picked by STORAGE_BACKEND
+func newBlobStore(cfg config.StorageConfig, signingKey []byte) (storage.BlobStore, error) {
+	switch cfg.Backend {
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKey,
+			SecretAccessKey: cfg.S3SecretKey,
+			UsePathStyle:    cfg.S3UsePathStyle,
+		})
+	case "local", "":
+		return storage.NewLocalStore(cfg.LocalDir, cfg.PublicURL, signingKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// storageSigningKey is the key for our own signed URLs (local blobs, HLS)
+// Falls back to the JWT secret so development needs no extra setup
+func storageSigningKey(cfg config.StorageConfig, jwtSecret string) []byte {
+	if cfg.SigningKey != "" {
+		return []byte(cfg.SigningKey)
+	}
+	return []byte(jwtSecret)
+}
+
+// logGCRun logs the outcome of a blob cleanup pass
+func logGCRun(run *models.GCRun, err error) {
+	if errors.Is(err, repository.ErrGCRecentlyRun) {
+		return
+	}
+	if err != nil {
+		log.Printf("Blob cleanup failed: %v", err)
+	}
+	if run == nil {
+		return
+	}
+	if run.DryRun {
+		log.Printf("Blob cleanup (dry run): %d orphans (%s) would be deleted, %d within the grace period, %d unused blob records",
+			run.Orphans, media.FormatBytes(run.OrphanBytes), run.Pending, run.BlobRecords)
+		return
+	}
+	log.Printf("Blob cleanup: deleted %d orphans, reclaimed %s, %d failed, %d within the grace period, %d unused blob records",
+		run.Deleted, media.FormatBytes(run.ReclaimedBytes), run.Failed, run.Pending, run.BlobRecords)
+}
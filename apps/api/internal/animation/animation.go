@@ -0,0 +1,232 @@
+// Package animation evaluates keyframed effect parameters
+//
+// An effect param either has one value for the whole clip or a Track:
+// keyframes at times from the start of the clip, each with the easing
+// used on the way to the next one. Everything that needs the value of a
+// param at some time - validation, the API, rendering - evaluates tracks
+// here, so they all agree on what a clip looks like at any frame.
+//
+// The package only deals in numbers. Which params can be animated and
+// how values are checked against their definition is up to the caller
+// (see models.ParamDefinition).
+package animation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Easing is how a value moves from one keyframe to the next
+//
+// The named curves are the CSS ones, so the editor can preview with the
+// browser's own easing functions and get the same result.
+type Easing string
+
+const (
+	Linear    Easing = "linear"
+	Hold      Easing = "hold"        // Keep the value until the next keyframe, then jump
+	EaseIn    Easing = "ease-in"     // cubic-bezier(0.42, 0, 1, 1)
+	EaseOut   Easing = "ease-out"    // cubic-bezier(0, 0, 0.58, 1)
+	EaseInOut Easing = "ease-in-out" // cubic-bezier(0.42, 0, 0.58, 1)
+	Bezier    Easing = "bezier"      // Keyframe.Bezier control points
+)
+
+// MaxKeyframes caps the keyframes of one track
+const MaxKeyframes = 256
+
+// namedCurves are the control points of the named easings
+var namedCurves = map[Easing][4]float64{
+	EaseIn:    {0.42, 0, 1, 1},
+	EaseOut:   {0, 0, 0.58, 1},
+	EaseInOut: {0.42, 0, 0.58, 1},
+}
+
+// Value is a keyframe value: a number, or [x, y] for a vec2 param
+type Value []float64
+
+// UnmarshalJSON accepts a number or an array of numbers
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err == nil {
+		*v = Value{f}
+		return nil
+	}
+	var fs []float64
+	if err := json.Unmarshal(data, &fs); err != nil || len(fs) == 0 {
+		return errors.New("value must be a number or a list of numbers")
+	}
+	*v = fs
+	return nil
+}
+
+// MarshalJSON writes a single number as a number
+func (v Value) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]float64(v))
+}
+
+// Keyframe is a value at a time, and how to get to the next keyframe
+type Keyframe struct {
+	Time   float64   `json:"time"` // Seconds from the start of the clip
+	Value  Value     `json:"value"`
+	Easing Easing    `json:"easing,omitempty"` // "" = linear
+	Bezier []float64 `json:"bezier,omitempty"` // x1, y1, x2, y2 for Easing "bezier", as in CSS cubic-bezier()
+}
+
+// Track is an animated param
+// Before the first keyframe the value is the first one's, after the last
+// the last one's.
+type Track struct {
+	Keyframes []Keyframe `json:"keyframes"`
+}
+
+// IsTrack reports whether a param value is a track rather than a plain
+// value: tracks are the only values that are JSON objects
+func IsTrack(v json.RawMessage) bool {
+	v = bytes.TrimSpace(v)
+	return len(v) > 0 && v[0] == '{'
+}
+
+// Parse decodes and checks a track
+func Parse(v json.RawMessage) (*Track, error) {
+	var t Track
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, errors.New(`must be {"keyframes": [...]}`)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate checks the structure of the track (not the values themselves)
+func (t *Track) Validate() error {
+	if len(t.Keyframes) == 0 || len(t.Keyframes) > MaxKeyframes {
+		return fmt.Errorf("must have 1 to %d keyframes", MaxKeyframes)
+	}
+	for i, k := range t.Keyframes {
+		if k.Time < 0 || (i > 0 && k.Time <= t.Keyframes[i-1].Time) {
+			return errors.New("keyframe times must go up from 0")
+		}
+		if len(k.Value) != len(t.Keyframes[0].Value) {
+			return errors.New("keyframe values must all have the same shape")
+		}
+		if err := k.validateEasing(); err != nil {
+			return fmt.Errorf("keyframe %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateEasing checks the easing and its control points
+func (k Keyframe) validateEasing() error {
+	switch k.Easing {
+	case "", Linear, Hold, EaseIn, EaseOut, EaseInOut:
+		if k.Bezier != nil {
+			return errors.New("bezier points are only for easing \"bezier\"")
+		}
+	case Bezier:
+		// x must stay within 0-1 for the curve to be a function of time;
+		// y may overshoot (values are clamped to the param's range)
+		if len(k.Bezier) != 4 || k.Bezier[0] < 0 || k.Bezier[0] > 1 || k.Bezier[2] < 0 || k.Bezier[2] > 1 {
+			return errors.New("bezier needs [x1, y1, x2, y2] with x1 and x2 between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown easing %q", k.Easing)
+	}
+	return nil
+}
+
+// Evaluate returns the value of the track at time at (seconds from the
+// start of the clip)
+// The track must be valid. The result is the caller's to change.
+func (t *Track) Evaluate(at float64) Value {
+	keys := t.Keyframes
+	if at <= keys[0].Time {
+		return append(Value(nil), keys[0].Value...)
+	}
+	last := keys[len(keys)-1]
+	if at >= last.Time {
+		return append(Value(nil), last.Value...)
+	}
+
+	// The segment at falls in: keys[i] <= at < keys[i+1]
+	i := 0
+	for at >= keys[i+1].Time {
+		i++
+	}
+	from, to := keys[i], keys[i+1]
+	p := from.ease((at - from.Time) / (to.Time - from.Time))
+
+	v := make(Value, len(from.Value))
+	for c := range v {
+		v[c] = from.Value[c] + (to.Value[c]-from.Value[c])*p
+	}
+	return v
+}
+
+// ease maps progress through a segment (0-1) to progress of the value
+func (k Keyframe) ease(x float64) float64 {
+	switch k.Easing {
+	case Hold:
+		return 0
+	case Bezier:
+		return cubicBezier(k.Bezier[0], k.Bezier[1], k.Bezier[2], k.Bezier[3], x)
+	case EaseIn, EaseOut, EaseInOut:
+		c := namedCurves[k.Easing]
+		return cubicBezier(c[0], c[1], c[2], c[3], x)
+	}
+	return x
+}
+
+// cubicBezier evaluates a CSS-style timing curve from (0,0) to (1,1) with
+// control points (x1,y1) and (x2,y2) at x
+//
+// The curve is given in terms of a parameter s, not x, so s is found
+// first: Newton's method converges in a few steps for ordinary curves,
+// bisection takes over for steep ones where it doesn't.
+func cubicBezier(x1, y1, x2, y2, x float64) float64 {
+	// B(s) = 3(1-s)²s·p1 + 3(1-s)s²·p2 + s³, as a polynomial in s
+	bez := func(p1, p2, s float64) float64 {
+		return ((1+3*p1-3*p2)*s+(3*p2-6*p1))*s*s + 3*p1*s
+	}
+	slope := func(p1, p2, s float64) float64 {
+		return 3*(1+3*p1-3*p2)*s*s + 2*(3*p2-6*p1)*s + 3*p1
+	}
+
+	s := x
+	for i := 0; i < 8; i++ {
+		err := bez(x1, x2, s) - x
+		if math.Abs(err) < 1e-7 {
+			return bez(y1, y2, s)
+		}
+		d := slope(x1, x2, s)
+		if math.Abs(d) < 1e-6 {
+			break
+		}
+		s -= err / d
+	}
+
+	lo, hi := 0.0, 1.0
+	s = x
+	for i := 0; i < 50; i++ {
+		v := bez(x1, x2, s)
+		if math.Abs(v-x) < 1e-7 {
+			break
+		}
+		if v < x {
+			lo = s
+		} else {
+			hi = s
+		}
+		s = (lo + hi) / 2
+	}
+	return bez(y1, y2, s)
+}
@@ -0,0 +1,164 @@
+package animation
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// tolerance is how close an evaluated curve must be to the reference
+// values, which were worked out independently by bisection
+const tolerance = 1e-5
+
+func TestCubicBezierNamedCurves(t *testing.T) {
+	tests := []struct {
+		easing Easing
+		want   map[float64]float64 // x → y
+	}{
+		{EaseIn, map[float64]float64{0.1: 0.017027, 0.25: 0.093465, 0.5: 0.315357, 0.75: 0.621862, 0.9: 0.839428}},
+		{EaseOut, map[float64]float64{0.1: 0.160572, 0.25: 0.378138, 0.5: 0.684643, 0.75: 0.906535, 0.9: 0.982973}},
+		{EaseInOut, map[float64]float64{0.1: 0.019722, 0.25: 0.129162, 0.5: 0.5, 0.75: 0.870838, 0.9: 0.980278}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.easing), func(t *testing.T) {
+			k := Keyframe{Easing: tt.easing}
+			for _, x := range []float64{0, 1} {
+				if got := k.ease(x); math.Abs(got-x) > tolerance {
+					t.Errorf("ease(%v) = %v, want %v", x, got, x)
+				}
+			}
+			for x, want := range tt.want {
+				if got := k.ease(x); math.Abs(got-want) > tolerance {
+					t.Errorf("ease(%v) = %v, want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCubicBezier(t *testing.T) {
+	tests := []struct {
+		name   string
+		points [4]float64
+		want   map[float64]float64
+	}{
+		{
+			// x(s) = s³ is flat at 0, where Newton's method gets nowhere
+			name:   "steep start falls back to bisection",
+			points: [4]float64{0, 1, 0, 1},
+			want:   map[float64]float64{0.001: 0.271, 0.1: 0.846146, 0.5: 0.99122},
+		},
+		{
+			name:   "overshoot both ends",
+			points: [4]float64{0.5, -0.5, 0.5, 1.5},
+			want:   map[float64]float64{0.1: -0.070756, 0.25: -0.038215, 0.5: 0.5, 0.9: 1.070756},
+		},
+		{
+			name:   "straight line",
+			points: [4]float64{0.25, 0.25, 0.75, 0.75},
+			want:   map[float64]float64{0.1: 0.1, 0.5: 0.5, 0.9: 0.9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.points
+			for x, want := range tt.want {
+				if got := cubicBezier(p[0], p[1], p[2], p[3], x); math.Abs(got-want) > tolerance {
+					t.Errorf("cubicBezier(%v) = %v, want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	track := &Track{Keyframes: []Keyframe{
+		{Time: 1, Value: Value{10}},
+		{Time: 2, Value: Value{20}, Easing: Hold},
+		{Time: 4, Value: Value{0}, Easing: EaseInOut},
+		{Time: 6, Value: Value{100}},
+	}}
+
+	tests := []struct {
+		name string
+		at   float64
+		want float64
+	}{
+		{"before the first keyframe", 0, 10},
+		{"on the first keyframe", 1, 10},
+		{"linear", 1.5, 15},
+		{"linear just before the next keyframe", 1.999, 19.99},
+		{"on a hold keyframe", 2, 20},
+		{"hold keeps the value", 3.999, 20},
+		{"hold jumps at the next keyframe", 4, 0},
+		{"ease-in-out half way", 5, 50},
+		{"ease-in-out a quarter of the way", 4.5, 12.9162},
+		{"on the last keyframe", 6, 100},
+		{"after the last keyframe", 60, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := track.Evaluate(tt.at)
+			if len(got) != 1 || math.Abs(got[0]-tt.want) > 1e-3 {
+				t.Errorf("Evaluate(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateVec2(t *testing.T) {
+	track := &Track{Keyframes: []Keyframe{
+		{Time: 0, Value: Value{0, 100}},
+		{Time: 2, Value: Value{10, 0}},
+	}}
+	got := track.Evaluate(0.5)
+	if len(got) != 2 || math.Abs(got[0]-2.5) > 1e-9 || math.Abs(got[1]-75) > 1e-9 {
+		t.Errorf("Evaluate(0.5) = %v, want [2.5 75]", got)
+	}
+}
+
+func TestEvaluateReturnsCopy(t *testing.T) {
+	track := &Track{Keyframes: []Keyframe{
+		{Time: 0, Value: Value{1}},
+		{Time: 1, Value: Value{2}},
+	}}
+	for _, at := range []float64{-1, 5} {
+		v := track.Evaluate(at)
+		v[0] = 99
+	}
+	if track.Keyframes[0].Value[0] != 1 || track.Keyframes[1].Value[0] != 2 {
+		t.Errorf("changing a result changed the track: %+v", track.Keyframes)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+	}{
+		{"one keyframe", `{"keyframes": [{"time": 0, "value": 1}]}`, true},
+		{"vec2 with bezier", `{"keyframes": [{"time": 0, "value": [0, 0], "easing": "bezier", "bezier": [0.3, -1, 0.7, 2]}, {"time": 1, "value": [1, 1]}]}`, true},
+		{"no keyframes", `{"keyframes": []}`, false},
+		{"unknown field", `{"keyframes": [{"time": 0, "value": 1}], "loop": true}`, false},
+		{"negative time", `{"keyframes": [{"time": -1, "value": 1}]}`, false},
+		{"times out of order", `{"keyframes": [{"time": 1, "value": 1}, {"time": 1, "value": 2}]}`, false},
+		{"mixed shapes", `{"keyframes": [{"time": 0, "value": 1}, {"time": 1, "value": [1, 2]}]}`, false},
+		{"unknown easing", `{"keyframes": [{"time": 0, "value": 1, "easing": "bounce"}]}`, false},
+		{"bezier x out of range", `{"keyframes": [{"time": 0, "value": 1, "easing": "bezier", "bezier": [1.5, 0, 0.5, 1]}]}`, false},
+		{"bezier points on a named easing", `{"keyframes": [{"time": 0, "value": 1, "easing": "linear", "bezier": [0, 0, 1, 1]}]}`, false},
+		{"value not a number", `{"keyframes": [{"time": 0, "value": "1"}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(json.RawMessage(tt.input))
+			if (err == nil) != tt.ok {
+				t.Errorf("Parse() error = %v, want ok: %v", err, tt.ok)
+			}
+		})
+	}
+}
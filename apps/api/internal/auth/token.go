@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// opaqueTokenBytes is the amount of randomness in an opaque token
+// 32 bytes = 256 bits, impossible to guess
+const opaqueTokenBytes = 32
+
+// GenerateOpaqueToken creates a random, URL-safe token (e.g. for share links)
+//
+// Unlike JWTs these carry no data - they're just unguessable keys.
+// Returns the token to give to the user and the hash to store.
+// We only ever store the hash, same idea as passwords: a database leak
+// doesn't hand out working links.
+func GenerateOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hex SHA-256 of a token, for database lookups
+// A fast hash is fine here (unlike passwords): the token is 256 random bits,
+// so there's nothing to brute force.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
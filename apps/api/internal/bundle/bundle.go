@@ -0,0 +1,253 @@
+// Package bundle reads and writes .tempo project archives
+//
+// A .tempo file is a plain zip so it can be inspected with any archive tool:
+//
+//	manifest.json   - what's inside, always the first entry
+//	timeline.json   - the project timeline (models.Timeline)
+//	effects.json    - definitions of the effects the timeline uses, at the
+//	                  versions the project is pinned to
+//	presets.json    - effect presets shared with the project (optional)
+//	yjs.bin         - collaboration document snapshot (optional)
+//	media/<id><ext> - source media files (optional)
+//
+// FORWARD COMPATIBILITY:
+// The manifest carries two numbers. FormatVersion is the version of the
+// writer. MinReaderVersion is the oldest reader that can still import the
+// bundle correctly. Additive changes (a new optional file, a new manifest
+// field) bump FormatVersion only, so older servers keep importing and just
+// ignore what they don't know. Breaking changes bump MinReaderVersion too.
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+)
+
+// FormatVersion is the bundle format this code writes
+// 2: media entries carry their kind
+// 3: effects.json entries carry the version the project is pinned to
+// 4: presets.json
+const FormatVersion = 4
+
+// formatName identifies the zip as a Tempo bundle
+const formatName = "tempo-bundle"
+
+// Well-known entry names inside the archive
+const (
+	ManifestFile = "manifest.json"
+	TimelineFile = "timeline.json"
+	EffectsFile  = "effects.json"
+	PresetsFile  = "presets.json"
+	YjsFile      = "yjs.bin"
+	MediaDir     = "media/"
+)
+
+// maxJSONSize caps how much we'll decode from one JSON entry
+// A hostile bundle could otherwise claim a tiny size and inflate to gigabytes
+const maxJSONSize = 32 << 20
+
+var (
+	ErrNotABundle       = errors.New("not a Tempo bundle")
+	ErrTooNew           = errors.New("bundle requires a newer version of Tempo")
+	ErrMissingFile      = errors.New("bundle is missing a required file")
+	ErrMediaNotInBundle = errors.New("media file not included in bundle")
+)
+
+// Manifest describes the bundle contents
+type Manifest struct {
+	Format           string          `json:"format"`
+	FormatVersion    int             `json:"format_version"`
+	MinReaderVersion int             `json:"min_reader_version"`
+	ExportedAt       time.Time       `json:"exported_at"`
+	Project          ManifestProject `json:"project"`
+	Media            []MediaEntry    `json:"media"`
+	HasYjsState      bool            `json:"has_yjs_state"`
+}
+
+// ManifestProject is the project metadata
+// IDs are informational only - imports always get fresh IDs
+type ManifestProject struct {
+	ID          uuid.UUID              `json:"id"`
+	Name        string                 `json:"name"`
+	Description *string                `json:"description,omitempty"`
+	Settings    models.ProjectSettings `json:"settings"`
+}
+
+// MediaEntry describes one media file referenced by the timeline
+// Path is empty when the bundle was exported without media
+type MediaEntry struct {
+	ID          uuid.UUID `json:"id"`
+	Kind        string    `json:"kind,omitempty"` // Informational: the importer sniffs the content again
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Path        string    `json:"path,omitempty"`
+}
+
+// PresetEntry is one effect preset shared with the project (team scope)
+// Who made it isn't carried over: imported presets belong to the importer.
+type PresetEntry struct {
+	EffectID      string                     `json:"effect_id"`
+	EffectVersion int                        `json:"effect_version"`
+	Name          string                     `json:"name"`
+	Description   *string                    `json:"description,omitempty"`
+	Tags          []string                   `json:"tags"`
+	Params        map[string]json.RawMessage `json:"params"`
+}
+
+// NewManifest returns a manifest stamped with the current format version
+func NewManifest() Manifest {
+	return Manifest{
+		Format:           formatName,
+		FormatVersion:    FormatVersion,
+		MinReaderVersion: 1,
+		ExportedAt:       time.Now().UTC(),
+		Media:            []MediaEntry{},
+	}
+}
+
+// Writer streams a bundle
+// Entries are written one after another straight to the underlying writer,
+// so even bundles with gigabytes of media never sit in memory.
+type Writer struct {
+	zw *zip.Writer
+}
+
+// NewWriter starts a bundle on w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// WriteJSON adds a compressed JSON entry
+func (bw *Writer) WriteJSON(name string, v interface{}) error {
+	f, err := bw.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// WriteBytes adds a compressed binary entry
+func (bw *Writer) WriteBytes(name string, data []byte) error {
+	f, err := bw.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// WriteMedia adds an entry without compression
+// Media is already compressed - deflating it again burns CPU for nothing
+func (bw *Writer) WriteMedia(name string, r io.Reader) error {
+	f, err := bw.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// Close finishes the archive (writes the zip central directory)
+func (bw *Writer) Close() error {
+	return bw.zw.Close()
+}
+
+// Reader reads an uploaded bundle
+type Reader struct {
+	files    map[string]*zip.File
+	Manifest Manifest
+}
+
+// NewReader opens a bundle and checks its manifest
+// A zip needs random access (its index is at the end), hence io.ReaderAt
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotABundle
+	}
+
+	br := &Reader{files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		br.files[f.Name] = f
+	}
+
+	if err := br.ReadJSON(ManifestFile, &br.Manifest); err != nil {
+		if errors.Is(err, ErrMissingFile) {
+			return nil, ErrNotABundle
+		}
+		return nil, err
+	}
+	if br.Manifest.Format != formatName {
+		return nil, ErrNotABundle
+	}
+	if br.Manifest.MinReaderVersion > FormatVersion {
+		return nil, fmt.Errorf("%w (needs format %d, this server reads %d)",
+			ErrTooNew, br.Manifest.MinReaderVersion, FormatVersion)
+	}
+
+	return br, nil
+}
+
+// Has reports whether the bundle contains an entry
+func (br *Reader) Has(name string) bool {
+	_, ok := br.files[name]
+	return ok
+}
+
+// ReadJSON decodes a JSON entry into v
+func (br *Reader) ReadJSON(name string, v interface{}) error {
+	rc, err := br.Open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(io.LimitReader(rc, maxJSONSize)).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReadBytes returns a binary entry
+func (br *Reader) ReadBytes(name string, limit int64) ([]byte, error) {
+	rc, err := br.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, limit))
+}
+
+// Open returns a reader for an entry
+// We only ever look entries up by exact name and never extract paths to
+// disk, so "../../etc/passwd" style entries (zip slip) can't hurt us.
+func (br *Reader) Open(name string) (io.ReadCloser, error) {
+	f, ok := br.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMissingFile, name)
+	}
+	return f.Open()
+}
+
+// OpenMedia returns a reader for a media entry from the manifest
+func (br *Reader) OpenMedia(entry MediaEntry) (io.ReadCloser, error) {
+	if entry.Path == "" {
+		return nil, ErrMediaNotInBundle
+	}
+	return br.Open(entry.Path)
+}
@@ -29,6 +29,21 @@ type Config struct {
 
 	// External services
 	Redis RedisConfig
+
+	// Where uploaded media and generated files are stored
+	Storage StorageConfig
+
+	// External media tools (ffprobe, ffmpeg)
+	Media MediaConfig
+
+	// Storage limits per user and per project
+	Quota QuotaConfig
+
+	// Cleanup of blobs nothing references anymore
+	GC GCConfig
+
+	// Effect catalog
+	Effects EffectsConfig
 }
 
 // ServerConfig holds HTTP server settings
@@ -37,6 +52,8 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration // Max time to read request
 	WriteTimeout time.Duration // Max time to write response
 	Environment  string        // "development", "staging", "production"
+	FrontendURL  string        // Base URL of the web app, used to build share links
+	PublicURL    string        // Base URL clients reach this API at, used in stream links
 }
 
 // DatabaseConfig holds PostgreSQL connection settings
@@ -80,6 +97,72 @@ type RedisConfig struct {
 	URL string
 }
 
+// StorageConfig holds blob storage settings
+// Backend "local" keeps files on disk (development), "s3" uses any
+// S3-compatible service (AWS S3, MinIO, Cloudflare R2)
+type StorageConfig struct {
+	Backend string
+
+	// Local backend
+	LocalDir   string // Directory files are written to
+	PublicURL  string // Where the server serves them, e.g. http://localhost:8080/blobs
+	SigningKey string // HMAC key for download URLs (defaults to the JWT secret)
+
+	// S3 backend
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool // Required for MinIO
+}
+
+// MediaConfig holds settings for the media processing tools
+type MediaConfig struct {
+	// ffprobe binary, a name on $PATH or an absolute path
+	// If it can't be found, uploads still work but aren't probed
+	FFprobePath string
+
+	// ffmpeg binary, used by background jobs (thumbnails, ...)
+	// If it can't be found, those jobs don't run
+	FFmpegPath string
+
+	// How many background jobs this server runs at once
+	// Each one is an ffmpeg process using a CPU core or more
+	Workers int
+
+	// Default sensitivity of scene detection, 0.1-1: how different a frame
+	// must be from the previous one to count as a cut
+	SceneThreshold float64
+
+	// Package videos for HLS streaming (one encode per quality level)
+	// Off by default: it's the most CPU-hungry job by far
+	HLS bool
+}
+
+// QuotaConfig holds storage limits, in megabytes (0 = unlimited)
+// Uploads, proxies and HLS renditions count; a file shared by several
+// videos counts once.
+type QuotaConfig struct {
+	UserMB    int // Everything a user uploaded
+	ProjectMB int // Everything in a project, whoever uploaded it
+}
+
+// GCConfig controls the orphaned blob cleanup (see media.GC)
+type GCConfig struct {
+	Interval    time.Duration // Least time between passes (across servers); 0 turns the cleanup off
+	GracePeriod time.Duration // Unreferenced blobs younger than this are left alone
+	DryRun      bool          // Only report orphans (in the log and blob_gc_runs), delete nothing
+}
+
+// EffectsConfig controls where effect definitions come from
+// The built-in ones are compiled in (see internal/effects)
+type EffectsConfig struct {
+	// Directory of extra definition files, loaded over the built-in ones
+	// Lets an effect ship with a web app deploy, without a new API build
+	Dir string
+}
+
 // Load reads configuration from environment variables
 // This is called once at startup
 func Load() *Config {
@@ -89,6 +172,8 @@ func Load() *Config {
 			ReadTimeout:  getDurationEnv("SERVER_READ_TIMEOUT", 10*time.Second),
 			WriteTimeout: getDurationEnv("SERVER_WRITE_TIMEOUT", 10*time.Second),
 			Environment:  getEnv("ENVIRONMENT", "development"),
+			FrontendURL:  getEnv("FRONTEND_URL", "http://localhost:3000"),
+			PublicURL:    getEnv("API_PUBLIC_URL", "http://localhost:8080"),
 		},
 		Database: DatabaseConfig{
 			URL:             getEnv("DATABASE_URL", "postgres://localhost:5432/tempo?sslmode=disable"),
@@ -104,6 +189,37 @@ func Load() *Config {
 		Redis: RedisConfig{
 			URL: getEnv("REDIS_URL", "redis://localhost:6379"),
 		},
+		Storage: StorageConfig{
+			Backend:        getEnv("STORAGE_BACKEND", "local"),
+			LocalDir:       getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+			PublicURL:      getEnv("STORAGE_PUBLIC_URL", "http://localhost:8080/blobs"),
+			SigningKey:     getEnv("STORAGE_SIGNING_KEY", ""),
+			S3Endpoint:     getEnv("S3_ENDPOINT", "https://s3.us-east-1.amazonaws.com"),
+			S3Region:       getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:       getEnv("S3_BUCKET", ""),
+			S3AccessKey:    getEnv("S3_ACCESS_KEY_ID", ""),
+			S3SecretKey:    getEnv("S3_SECRET_ACCESS_KEY", ""),
+			S3UsePathStyle: getBoolEnv("S3_USE_PATH_STYLE", false),
+		},
+		Media: MediaConfig{
+			FFprobePath:    getEnv("FFPROBE_PATH", "ffprobe"),
+			FFmpegPath:     getEnv("FFMPEG_PATH", "ffmpeg"),
+			Workers:        getIntEnv("MEDIA_WORKERS", 2),
+			SceneThreshold: getFloatEnv("MEDIA_SCENE_THRESHOLD", 0.3),
+			HLS:            getBoolEnv("MEDIA_HLS", false),
+		},
+		Quota: QuotaConfig{
+			UserMB:    getIntEnv("QUOTA_USER_MB", 10240), // 10GB
+			ProjectMB: getIntEnv("QUOTA_PROJECT_MB", 0),
+		},
+		GC: GCConfig{
+			Interval:    getDurationEnv("BLOB_GC_INTERVAL", 24*time.Hour),
+			GracePeriod: getDurationEnv("BLOB_GC_GRACE_PERIOD", 24*time.Hour),
+			DryRun:      getBoolEnv("BLOB_GC_DRY_RUN", false),
+		},
+		Effects: EffectsConfig{
+			Dir: getEnv("EFFECTS_DIR", ""),
+		},
 	}
 }
 
@@ -125,6 +241,26 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// Helper function: Get float env var
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+// Helper function: Get boolean env var
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
 // Helper function: Get duration env var
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
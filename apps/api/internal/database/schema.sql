@@ -193,3 +193,573 @@ CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(email);
 -- Find refresh tokens by user (used in logout all devices)
 CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
 
+
+-- ============================================
+-- PROJECT SEARCH
+-- ============================================
+-- Full-text search over project name and description
+-- A GENERATED column keeps the tsvector in sync automatically,
+-- so no application code (or trigger) has to remember to update it.
+-- 'simple' config = no stemming, works for any language and for
+-- prefix matching while the user is still typing.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+    ) STORED;
+
+-- GIN index: the standard index type for tsvector lookups
+CREATE INDEX IF NOT EXISTS idx_projects_search ON projects USING GIN(search_vector);
+
+-- Keyset pagination indexes
+-- (sort column, id) matches the ORDER BY used by the dashboard
+CREATE INDEX IF NOT EXISTS idx_projects_updated_id ON projects(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_projects_created_id ON projects(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_projects_name_id ON projects(name, id);
+
+-- ============================================
+-- FOLDERS TABLE
+-- ============================================
+-- Per-user folders for organizing the dashboard
+-- Folders nest via parent_id (a "self-referencing" foreign key)
+-- They're private: collaborators each file a shared project their own way
+CREATE TABLE IF NOT EXISTS folders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    -- NULL = top-level folder
+    -- ON DELETE CASCADE: deleting a folder deletes its subfolders too
+    parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    
+    name VARCHAR(255) NOT NULL,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- No two folders with the same name side by side
+-- A plain UNIQUE(user_id, parent_id, name) wouldn't work for top-level
+-- folders because NULL never equals NULL, so we index on COALESCE instead
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_unique_name ON folders(
+    user_id,
+    COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'),
+    name
+);
+
+-- ============================================
+-- PROJECT FOLDERS TABLE
+-- ============================================
+-- Which folder a project is in, FOR EACH USER
+-- Primary key (user_id, project_id): a project is in at most one
+-- folder per user. No row = "unfiled".
+CREATE TABLE IF NOT EXISTS project_folders (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    
+    -- Deleting the folder un-files the project (the project itself stays)
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    PRIMARY KEY (user_id, project_id)
+);
+
+-- ============================================
+-- TAGS TABLE
+-- ============================================
+-- Labels like "client-review" or "final"
+-- Created by one user, but visible to everyone on a tagged project
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    name VARCHAR(50) NOT NULL,
+    
+    -- Hex color for the UI chip, e.g. '#2f81f7'
+    color VARCHAR(7),
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    UNIQUE(created_by, name)
+);
+
+-- ============================================
+-- PROJECT TAGS TABLE
+-- ============================================
+-- Junction table: many-to-many between projects and tags
+CREATE TABLE IF NOT EXISTS project_tags (
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    
+    -- Who put the tag on the project
+    added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    PRIMARY KEY (project_id, tag_id)
+);
+
+-- Find a user's folders / the children of a folder
+CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_id);
+
+-- Filter the dashboard by folder
+CREATE INDEX IF NOT EXISTS idx_project_folders_folder ON project_folders(folder_id);
+
+-- Filter the dashboard by tag
+CREATE INDEX IF NOT EXISTS idx_project_tags_tag ON project_tags(tag_id);
+
+-- ============================================
+-- PROJECT SETTINGS
+-- ============================================
+-- Settings are now a typed, versioned document (see models/settings.go)
+-- The API can't read NULL into a typed struct, so backfill and forbid it.
+-- Old documents without a "version" key are upgraded by the API at startup.
+UPDATE projects SET settings = '{}' WHERE settings IS NULL;
+ALTER TABLE projects ALTER COLUMN settings SET NOT NULL;
+
+-- ============================================
+-- PROJECT TIMELINE
+-- ============================================
+-- Server-side copy of the edit (media clips + effect clips)
+-- Shape is models.Timeline. Stored as one JSONB document because it's
+-- always read and written as a whole.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS timeline JSONB NOT NULL DEFAULT '{}';
+
+-- ============================================
+-- SHARE LINKS TABLE
+-- ============================================
+-- Public read-only links for people without an account (e.g. clients)
+CREATE TABLE IF NOT EXISTS share_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    
+    -- Who created the link
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    -- SHA-256 of the token (hex). Like passwords, we never store the
+    -- token itself - a leaked database doesn't leak working links
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    
+    -- First characters of the token so owners can tell links apart
+    token_prefix VARCHAR(16) NOT NULL,
+    
+    -- Optional bcrypt hash - NULL means no password
+    password_hash VARCHAR(255),
+    
+    -- NULL = never expires
+    expires_at TIMESTAMP WITH TIME ZONE,
+    
+    -- Set when the owner revokes the link (kept for the view history)
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    
+    view_count BIGINT NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMP WITH TIME ZONE,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- List a project's links on the share dialog
+CREATE INDEX IF NOT EXISTS idx_share_links_project ON share_links(project_id);
+
+-- ============================================
+-- MEDIA ASSETS TABLE
+-- ============================================
+-- Uploaded source files (the video library)
+-- The bytes live in storage (./uploads); this table is the only record of
+-- who owns them, so a restart no longer orphans every file.
+CREATE TABLE IF NOT EXISTS media_assets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    -- The uploader - always has access
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    -- Optional project: its collaborators can see the file too
+    -- SET NULL so deleting a project doesn't take the uploader's files with it
+    project_id UUID REFERENCES projects(id) ON DELETE SET NULL,
+    
+    -- Original name on the uploader's machine (display only)
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    
+    -- Where the file is stored - never derived from user input
+    storage_key VARCHAR(500) NOT NULL,
+    
+    -- Filled in once the file has been probed (0 = unknown)
+    duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- "My uploads" and "this project's videos"
+CREATE INDEX IF NOT EXISTS idx_media_assets_owner ON media_assets(owner_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_media_assets_project ON media_assets(project_id, created_at);
+
+-- ============================================
+-- RESUMABLE UPLOADS TABLE
+-- ============================================
+-- tus protocol uploads that haven't been turned into media yet
+-- Each PATCH request stores its bytes as a separate blob; part_keys lists
+-- them in order so they can be stitched together at the end.
+CREATE TABLE IF NOT EXISTS uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id UUID REFERENCES projects(id) ON DELETE SET NULL,
+    
+    -- From the client's Upload-Metadata header
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    
+    -- tus Upload-Length / Upload-Offset
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    
+    part_keys TEXT[] NOT NULL DEFAULT '{}',
+    
+    -- The finished media file (NULL while in progress)
+    media_id UUID REFERENCES media_assets(id) ON DELETE SET NULL,
+    
+    -- Abandoned uploads are cleaned up after this
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Cleanup job scans by expiry
+CREATE INDEX IF NOT EXISTS idx_uploads_expires ON uploads(expires_at);
+
+-- ============================================
+-- MEDIA PROBE RESULTS
+-- ============================================
+-- Technical metadata read from the file itself by ffprobe
+-- (duration, width and height already exist on media_assets)
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS frame_rate DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS rotation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS video_codec VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS audio_codec VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS audio_channels INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS bit_rate BIGINT NOT NULL DEFAULT 0;
+
+-- NULL = never probed (e.g. uploaded while ffprobe wasn't installed)
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS probed_at TIMESTAMP WITH TIME ZONE;
+
+-- ============================================
+-- MEDIA JOBS TABLE
+-- ============================================
+-- Background work on uploaded files (thumbnails, ...)
+-- Workers claim rows with SELECT ... FOR UPDATE SKIP LOCKED, so any
+-- number of API servers can share the queue without a separate broker.
+CREATE TABLE IF NOT EXISTS media_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    media_id UUID NOT NULL REFERENCES media_assets(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    
+    -- 'queued', 'running', 'done', 'failed'
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    
+    -- Retries wait a little before running again
+    run_after TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    -- Re-running a kind resets its row
+    UNIQUE(media_id, kind)
+);
+
+-- Workers look for the oldest runnable job
+CREATE INDEX IF NOT EXISTS idx_media_jobs_runnable ON media_jobs(status, run_after);
+
+-- ============================================
+-- THUMBNAILS
+-- ============================================
+-- Poster frame and scrubbing sprite sheets, written by the thumbnails job
+-- sprite_sheet holds the layout (see models.SpriteSheet); the images live
+-- in the blob store under thumbnails/<media id>/
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS poster_key VARCHAR(500);
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS sprite_sheet JSONB;
+
+-- Projects without an explicit thumbnail_url show the poster frame of
+-- their first video. A media ID rather than a URL: blob store links expire.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS thumbnail_media_id UUID REFERENCES media_assets(id) ON DELETE SET NULL;
+
+-- ============================================
+-- WAVEFORMS
+-- ============================================
+-- Audio peaks for the timeline, written by the waveform job
+-- Zoom levels (see models.Waveform); the peak files themselves live in
+-- the blob store under waveforms/<media id>/
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS waveform JSONB;
+
+-- ============================================
+-- PREVIEW PROXIES
+-- ============================================
+-- Low-resolution copies for preview, written by the proxy job
+-- (see models.Proxy); the files live under proxies/<media id>/
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS proxies JSONB;
+
+-- ============================================
+-- HLS PACKAGING
+-- ============================================
+-- Segmented renditions for streaming, written by the optional hls job
+-- (see models.HLSPackage); the playlists and segments live under
+-- hls/<media id>/
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS hls JSONB;
+
+-- ============================================
+-- CONTENT-ADDRESSED MEDIA BLOBS
+-- ============================================
+-- Uploads are stored by the SHA-256 of their bytes, so the same file
+-- uploaded into twenty projects is stored once. Each media record points
+-- at its blob; the bytes are deleted with the last reference.
+CREATE TABLE IF NOT EXISTS media_blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    
+    storage_key VARCHAR(500) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    
+    -- Media records using this blob (kept by the trigger below)
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- NULL for files stored before deduplication (under media/<media id>)
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS content_hash CHAR(64) REFERENCES media_blobs(sha256);
+CREATE INDEX IF NOT EXISTS idx_media_assets_content_hash ON media_assets(content_hash);
+
+-- WHY A TRIGGER?
+-- Media rows also disappear through ON DELETE CASCADE (deleting a user),
+-- which application code never sees. Counting in the database keeps
+-- ref_count right however a row goes. Blobs whose count drops to 0 that
+-- way keep their bytes until a cleanup pass removes them.
+CREATE OR REPLACE FUNCTION media_blobs_count_refs() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' AND NEW.content_hash IS NOT NULL THEN
+        UPDATE media_blobs SET ref_count = ref_count + 1 WHERE sha256 = NEW.content_hash;
+    ELSIF TG_OP = 'DELETE' AND OLD.content_hash IS NOT NULL THEN
+        UPDATE media_blobs SET ref_count = ref_count - 1 WHERE sha256 = OLD.content_hash;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS media_assets_count_refs ON media_assets;
+CREATE TRIGGER media_assets_count_refs
+    AFTER INSERT OR DELETE ON media_assets
+    FOR EACH ROW EXECUTE FUNCTION media_blobs_count_refs();
+
+-- ============================================
+-- ORPHANED BLOB CLEANUP
+-- ============================================
+-- One row per pass of the garbage collector (see media.GC), so what it
+-- found and the space it gave back can be followed over time, e.g.
+--   SELECT date_trunc('week', started_at), SUM(reclaimed_bytes)
+--   FROM blob_gc_runs WHERE NOT dry_run GROUP BY 1;
+CREATE TABLE IF NOT EXISTS blob_gc_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    -- Dry runs report orphans without deleting them
+    dry_run BOOLEAN NOT NULL,
+    
+    -- Totals (see models.GCStats); by_prefix has the same per key prefix
+    scanned INTEGER NOT NULL DEFAULT 0,
+    scanned_bytes BIGINT NOT NULL DEFAULT 0,
+    orphans INTEGER NOT NULL DEFAULT 0,
+    orphan_bytes BIGINT NOT NULL DEFAULT 0,
+    pending INTEGER NOT NULL DEFAULT 0,
+    pending_bytes BIGINT NOT NULL DEFAULT 0,
+    deleted INTEGER NOT NULL DEFAULT 0,
+    reclaimed_bytes BIGINT NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    blob_records INTEGER NOT NULL DEFAULT 0,
+    by_prefix JSONB,
+    
+    -- Set if the pass stopped early
+    error TEXT,
+    
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    -- NULL while running (or if the server died mid-pass)
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Servers check when the last pass started before running another
+CREATE INDEX IF NOT EXISTS idx_blob_gc_runs_started ON blob_gc_runs(started_at);
+
+-- The cleanup looks up every stored file by its key
+CREATE INDEX IF NOT EXISTS idx_media_assets_storage_key ON media_assets(storage_key);
+
+-- ============================================
+-- SCENE DETECTION
+-- ============================================
+-- Shot boundaries found by the scenes job, so effects and edits can snap
+-- to cuts. Every candidate above the detection floor is kept with its
+-- score; the API filters them by a threshold at read time.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS scenes JSONB;
+
+CREATE TABLE IF NOT EXISTS media_scene_markers (
+    media_id UUID NOT NULL REFERENCES media_assets(id) ON DELETE CASCADE,
+    
+    -- Seconds into the source file
+    time DOUBLE PRECISION NOT NULL,
+    
+    -- Frame difference from the previous frame, 0-1
+    score DOUBLE PRECISION NOT NULL,
+    
+    PRIMARY KEY (media_id, time)
+);
+
+-- ============================================
+-- MEDIA KINDS
+-- ============================================
+-- Besides videos the library holds still images (overlays, title cards)
+-- and standalone audio (music, voice-over). The kind decides validation
+-- and which background jobs run; existing rows are all videos.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'video'
+    CHECK (kind IN ('video', 'image', 'audio'));
+
+-- Hz of the first audio stream (0 = no audio / not probed)
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS sample_rate INTEGER NOT NULL DEFAULT 0;
+
+-- "This project's images", "my music"
+CREATE INDEX IF NOT EXISTS idx_media_assets_owner_kind ON media_assets(owner_id, kind, created_at);
+
+-- ============================================
+-- EFFECT VERSIONS
+-- ============================================
+-- The effect catalog (internal/effects) keeps every version of every
+-- effect. A project records the version of each effect it was authored
+-- against, e.g. {"time-smear": 1}, so a new version of a shader doesn't
+-- change how existing projects look. Effects a project hasn't used yet
+-- aren't pinned: they resolve to the latest version.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS effect_versions JSONB NOT NULL DEFAULT '{}';
+
+-- ============================================
+-- EFFECT PRESETS
+-- ============================================
+-- Saved param values for an effect ("nostalgic memory-fade"), so they
+-- don't have to be dialed in again on every project
+CREATE TABLE IF NOT EXISTS effect_presets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    -- Only the creator can change or delete a preset
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    -- Catalog effect and the version params were saved against; reading
+    -- a preset for another version maps them (see effects.Catalog.MapParams)
+    effect_id VARCHAR(100) NOT NULL,
+    effect_version INTEGER NOT NULL,
+    
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    params JSONB NOT NULL DEFAULT '{}',
+    
+    -- 'user'   - the creator only
+    -- 'team'   - everyone on project_id
+    -- 'public' - everyone
+    scope VARCHAR(10) NOT NULL DEFAULT 'user' CHECK (scope IN ('user', 'team', 'public')),
+    project_id UUID REFERENCES projects(id) ON DELETE CASCADE,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    -- A team preset belongs to exactly one project, other scopes to none
+    CHECK ((scope = 'team') = (project_id IS NOT NULL))
+);
+
+-- "Presets for memory-fade"
+CREATE INDEX IF NOT EXISTS idx_effect_presets_effect ON effect_presets(effect_id, scope);
+CREATE INDEX IF NOT EXISTS idx_effect_presets_created_by ON effect_presets(created_by);
+CREATE INDEX IF NOT EXISTS idx_effect_presets_project ON effect_presets(project_id) WHERE project_id IS NOT NULL;
+
+-- ============================================
+-- EXPORTS
+-- ============================================
+-- Rendered videos of a project, one row per export job
+-- Kept here rather than in the server that runs the job: any server can
+-- report progress or hand out the download, and the orphaned blob cleanup
+-- (which one server runs for all of them) knows which files under
+-- exports/ are still wanted.
+CREATE TABLE IF NOT EXISTS exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    -- Who started it; the render counts against their storage quota
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    
+    format VARCHAR(10) NOT NULL,
+    quality VARCHAR(10) NOT NULL,
+    
+    -- 'pending', 'processing', 'completed', 'failed'
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    progress INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    
+    -- Where the rendered file goes in the blob store, and its size once
+    -- it's there
+    output_key VARCHAR(500) NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_exports_output_key ON exports(output_key);
+CREATE INDEX IF NOT EXISTS idx_exports_user ON exports(user_id);
+CREATE INDEX IF NOT EXISTS idx_exports_project ON exports(project_id);
+
+-- ============================================
+-- MEDIA JOB RUNS
+-- ============================================
+-- Every claim of a job gets a new run number, and workers report back
+-- against it. attempts can't serve for this: it starts over when a job
+-- is enqueued again, so a stale worker from before could match the new
+-- run's count and have its result accepted.
+ALTER TABLE media_jobs ADD COLUMN IF NOT EXISTS run INTEGER NOT NULL DEFAULT 0;
+
+-- ============================================
+-- SHARED DERIVED FILES
+-- ============================================
+-- Records with the same content (see media_blobs) share thumbnails,
+-- waveform, proxies, HLS package and scene markers instead of each
+-- running the jobs again. derived_from is the record the files were made
+-- for and whose ID is in their keys; NULL means the record itself.
+-- No foreign key: the files stay in use after that record is deleted, as
+-- long as another one points at it.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS derived_from UUID;
+CREATE INDEX IF NOT EXISTS idx_media_assets_derived_from ON media_assets(derived_from) WHERE derived_from IS NOT NULL;
+
+-- ============================================
+-- STORAGE OF GENERATED FILES
+-- ============================================
+-- Bytes of the poster frame and sprite sheets, and of the waveform
+-- levels, so quotas count them like proxies and HLS renditions (whose
+-- sizes are in their JSON). Shared like the files (see derived_from).
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS thumbnail_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS waveform_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- Cached still frames (frames/ in the blob store), one row per file
+-- The blob cleanup deletes the files after a week, and the rows with them.
+CREATE TABLE IF NOT EXISTS media_frames (
+    key VARCHAR(500) PRIMARY KEY,
+    media_id UUID NOT NULL REFERENCES media_assets(id) ON DELETE CASCADE,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_frames_media ON media_frames(media_id);
+CREATE INDEX IF NOT EXISTS idx_media_frames_created ON media_frames(created_at);
@@ -0,0 +1,589 @@
+// Package effects is the catalog of effects projects can use
+//
+// WHY FILES, NOT A HARD-CODED LIST?
+// An effect is a shader in the web app plus a definition here (name,
+// parameters, ranges). Keeping the definitions as one JSON file per
+// effect in definitions/ means adding or changing an effect is a data
+// change reviewed next to its shader, not an edit of Go code. The files
+// are embedded in the binary, so a deploy always has a consistent set;
+// a directory (EFFECTS_DIR) can add or replace effects without a rebuild.
+//
+// Every file lists all versions of its effect, oldest first. Versions are
+// never edited or removed once shipped: projects pin the version they
+// were authored against (see models.EffectVersions), and an old version
+// disappearing would change how their effects render.
+package effects
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"tempo/internal/models"
+)
+
+//go:embed definitions/*.json
+var builtin embed.FS
+
+var (
+	ErrEffectNotFound  = errors.New("effect not found")
+	ErrVersionNotFound = errors.New("effect version not found")
+)
+
+// idPattern is what effect IDs look like: lowercase words joined by dashes
+var idPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// shaderPattern is what shader file names look like: a file directly in
+// the web app's shader library (apps/web/src/lib/shaders)
+var shaderPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*\.wgsl$`)
+
+// effectFile is the format of a definitions/<id>.json file
+type effectFile struct {
+	ID       string                    `json:"id"`
+	Versions []models.EffectDefinition `json:"versions"`
+}
+
+// Catalog is the loaded set of effects
+// It never changes after Load, so it's safe to share between requests.
+type Catalog struct {
+	versions map[string][]models.EffectDefinition // By ID, oldest first
+	latest   []models.EffectDefinition            // Latest version of each, by ID
+	listETag string
+}
+
+// Load reads the built-in definitions, then those in dir (if not "")
+// A file in dir replaces the built-in file of the same effect, so it must
+// keep that effect's old versions. Any invalid file fails the load: a
+// server with half a catalog would break projects in confusing ways.
+func Load(dir string) (*Catalog, error) {
+	files := map[string]effectFile{}
+	sub, err := fs.Sub(builtin, "definitions")
+	if err != nil {
+		return nil, err
+	}
+	if err := readDir(sub, files); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := readDir(os.DirFS(dir), files); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Catalog{versions: map[string][]models.EffectDefinition{}}
+	for id, f := range files {
+		c.versions[id] = f.Versions
+	}
+
+	// Stacks refer to other effects, so they're checked once all are in.
+	// A compound is available once every layer is; layers are plain
+	// effects, whose availability check already set.
+	for id, versions := range c.versions {
+		for i, def := range versions {
+			if err := c.checkStack(def); err != nil {
+				return nil, fmt.Errorf("effect %s.json: version %d: %w", id, def.Version, err)
+			}
+			if def.IsCompound() {
+				versions[i].Available = c.layersAvailable(def)
+			}
+		}
+	}
+
+	for _, versions := range c.versions {
+		c.latest = append(c.latest, versions[len(versions)-1])
+	}
+	sort.Slice(c.latest, func(i, j int) bool {
+		return c.latest[i].ID < c.latest[j].ID
+	})
+
+	if c.listETag, err = ETag(c.latest); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readDir reads and checks every *.json file in fsys into files
+func readDir(fsys fs.FS, files map[string]effectFile) error {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		var f effectFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("effect %s: %w", name, err)
+		}
+		if err := f.check(strings.TrimSuffix(name, path.Ext(name))); err != nil {
+			return fmt.Errorf("effect %s: %w", name, err)
+		}
+		files[f.ID] = f
+	}
+	return nil
+}
+
+// check validates a definition file named <name>.json
+// The ID and version of every entry are filled in from the file, so
+// they can't disagree.
+func (f *effectFile) check(name string) error {
+	if f.ID != name || !idPattern.MatchString(f.ID) {
+		return fmt.Errorf("id %q must match the file name and look like \"time-smear\"", f.ID)
+	}
+	if len(f.Versions) == 0 {
+		return errors.New("no versions")
+	}
+	for i := range f.Versions {
+		def := &f.Versions[i]
+		if def.Version != i+1 {
+			return fmt.Errorf("versions must be numbered 1, 2, 3, ... in order (entry %d is %d)", i+1, def.Version)
+		}
+		def.ID = f.ID
+		if def.Name == "" {
+			return fmt.Errorf("version %d has no name", def.Version)
+		}
+		if def.IsCompound() && def.Shader != "" {
+			return fmt.Errorf("version %d: a compound effect has no shader of its own", def.Version)
+		}
+		if def.Shader != "" && !shaderPattern.MatchString(def.Shader) {
+			return fmt.Errorf("version %d: shader %q must be a file name like \"time-smear.wgsl\"", def.Version, def.Shader)
+		}
+		// Whatever the file says: only the catalog decides this
+		def.Available = def.Shader != ""
+		if def.Params == nil {
+			def.Params = []models.ParamDefinition{}
+		}
+		seen := map[string]bool{}
+		for j, p := range def.Params {
+			if p.Name == "" || seen[p.Name] {
+				return fmt.Errorf("version %d: missing or duplicate param name %q", def.Version, p.Name)
+			}
+			seen[p.Name] = true
+			if err := def.Params[j].Validate(); err != nil {
+				return fmt.Errorf("version %d: param %q: %w", def.Version, p.Name, err)
+			}
+		}
+		for _, p := range def.Params {
+			for _, old := range p.PreviousNames {
+				if i == 0 || seen[old] || !paramExists(f.Versions[i-1], old) {
+					return fmt.Errorf("version %d: param %q: previous name %q must be a param of the previous version only", def.Version, p.Name, old)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkStack checks the layers of a compound effect version
+//
+// Every layer is a version of a plain effect (no compounds in compounds,
+// so stacks can't loop). Fixed values must be valid, and a macro must be
+// able to drive every param bound to it: same type, and every value the
+// macro allows valid for the param. Values of a compound clip that pass
+// CheckParams then always expand to valid layers.
+func (c *Catalog) checkStack(def models.EffectDefinition) error {
+	if !def.IsCompound() {
+		return nil
+	}
+
+	macros := map[string]models.ParamDefinition{}
+	for _, p := range def.Params {
+		macros[p.Name] = p
+	}
+	bound := map[string]bool{}
+
+	for i, layer := range def.Stack {
+		component, err := c.Get(layer.Effect, layer.Version)
+		if err != nil || layer.Version < 1 {
+			return fmt.Errorf("layer %d: no effect %q version %d", i, layer.Effect, layer.Version)
+		}
+		if component.IsCompound() {
+			return fmt.Errorf("layer %d: %s is itself a compound effect", i, layer.Effect)
+		}
+
+		if msgs := component.CheckParams(layer.Params); len(msgs) > 0 {
+			return fmt.Errorf("layer %d: invalid params %v", i, msgs)
+		}
+
+		for name, macro := range layer.Macros {
+			p, ok := findParam(*component, name)
+			if !ok {
+				return fmt.Errorf("layer %d: %s has no param %q", i, layer.Effect, name)
+			}
+			if _, ok := layer.Params[name]; ok {
+				return fmt.Errorf("layer %d: param %q is both fixed and driven by a macro", i, name)
+			}
+			m, ok := macros[macro]
+			if !ok {
+				return fmt.Errorf("layer %d: no macro control %q", i, macro)
+			}
+			if err := canDrive(m, p); err != nil {
+				return fmt.Errorf("layer %d: macro %q can't drive %q: %w", i, macro, name, err)
+			}
+			bound[macro] = true
+		}
+	}
+
+	for _, p := range def.Params {
+		if !bound[p.Name] {
+			return fmt.Errorf("macro control %q drives nothing", p.Name)
+		}
+	}
+	return nil
+}
+
+// layersAvailable reports whether every layer of a compound effect
+// version has a shader. Call it after checkStack, which makes sure the
+// layers exist.
+func (c *Catalog) layersAvailable(def models.EffectDefinition) bool {
+	for _, layer := range def.Stack {
+		component, err := c.Get(layer.Effect, layer.Version)
+		if err != nil || !component.Available {
+			return false
+		}
+	}
+	return true
+}
+
+// canDrive checks that every value macro m allows is valid for param p
+// For numbers it's enough to check the ends of m's range (ranges are
+// intervals), for enums every option.
+func canDrive(m, p models.ParamDefinition) error {
+	if m.Type != p.Type {
+		return fmt.Errorf("a %s can't drive a %s", m.Type, p.Type)
+	}
+	values := []json.RawMessage{m.Default}
+	switch m.Type {
+	case models.ParamFloat, models.ParamInt:
+		lo, _ := json.Marshal(*m.Min)
+		hi, _ := json.Marshal(*m.Max)
+		values = append(values, lo, hi)
+	case models.ParamVec2, models.ParamCurve:
+		if (p.Min != nil && (m.Min == nil || *m.Min < *p.Min)) || (p.Max != nil && (m.Max == nil || *m.Max > *p.Max)) {
+			return errors.New("its range is wider")
+		}
+	case models.ParamEnum:
+		for _, o := range m.Options {
+			v, _ := json.Marshal(o)
+			values = append(values, v)
+		}
+	}
+	for _, v := range values {
+		if _, err := p.Check(v); err != nil {
+			return fmt.Errorf("%s %s", v, err)
+		}
+	}
+	return nil
+}
+
+// paramExists reports whether an effect version has a param called name
+func paramExists(def models.EffectDefinition, name string) bool {
+	_, ok := findParam(def, name)
+	return ok
+}
+
+// findParam returns the param of an effect version called name
+func findParam(def models.EffectDefinition, name string) (models.ParamDefinition, bool) {
+	for _, p := range def.Params {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return models.ParamDefinition{}, false
+}
+
+// Layer is one effect to render for a clip: the clip's own effect, or one
+// layer of its compound effect
+type Layer struct {
+	Def    *models.EffectDefinition
+	Params map[string]json.RawMessage
+}
+
+// Expand turns a clip's effect and params into the effects to render, in
+// order
+// A plain effect is its own single layer. A compound effect expands to
+// its stack, each layer getting its fixed values and the values of the
+// macros driving it (tracks included, so they animate the layer). Macros
+// the clip leaves out drive their layers with their default.
+func (c *Catalog) Expand(def *models.EffectDefinition, params map[string]json.RawMessage) ([]Layer, error) {
+	if !def.IsCompound() {
+		return []Layer{{Def: def, Params: params}}, nil
+	}
+
+	layers := make([]Layer, 0, len(def.Stack))
+	for _, layer := range def.Stack {
+		component, err := c.Get(layer.Effect, layer.Version)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]json.RawMessage, len(layer.Params)+len(layer.Macros))
+		for name, v := range layer.Params {
+			values[name] = v
+		}
+		for name, macro := range layer.Macros {
+			if v, ok := params[macro]; ok {
+				values[name] = v
+			} else if m, ok := findParam(*def, macro); ok {
+				values[name] = m.Default
+			}
+		}
+		layers = append(layers, Layer{Def: component, Params: values})
+	}
+	return layers, nil
+}
+
+// List returns the latest version of every effect, sorted by ID
+func (c *Catalog) List() []models.EffectDefinition {
+	return c.latest
+}
+
+// ListETag is the entity tag of List, for HTTP caching
+func (c *Catalog) ListETag() string {
+	return c.listETag
+}
+
+// Versions returns every version of an effect, oldest first
+func (c *Catalog) Versions(id string) ([]models.EffectDefinition, error) {
+	versions, ok := c.versions[id]
+	if !ok {
+		return nil, ErrEffectNotFound
+	}
+	return versions, nil
+}
+
+// Get returns a version of an effect; version 0 means the latest
+func (c *Catalog) Get(id string, version int) (*models.EffectDefinition, error) {
+	versions, err := c.Versions(id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, ErrVersionNotFound
+	}
+	return &versions[version-1], nil
+}
+
+// Resolve returns the definitions of the given effects as a project with
+// these pins sees them: the pinned version, or the latest
+// Unknown effects and versions are left out, sorted by ID.
+func (c *Catalog) Resolve(ids []string, pins models.EffectVersions) []models.EffectDefinition {
+	defs := []models.EffectDefinition{}
+	for _, id := range ids {
+		if def, err := c.Get(id, pins[id]); err == nil {
+			defs = append(defs, *def)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].ID < defs[j].ID
+	})
+	return defs
+}
+
+// ForProject returns the whole catalog as a project with these pins sees it
+func (c *Catalog) ForProject(pins models.EffectVersions) []models.EffectDefinition {
+	ids := make([]string, len(c.latest))
+	for i, def := range c.latest {
+		ids[i] = def.ID
+	}
+	return c.Resolve(ids, pins)
+}
+
+// LatestPins returns the latest version of each known effect in ids
+// What a project gets pinned to when it first uses an effect.
+func (c *Catalog) LatestPins(ids []string) models.EffectVersions {
+	pins := models.EffectVersions{}
+	for _, id := range ids {
+		if versions, ok := c.versions[id]; ok {
+			pins[id] = len(versions)
+		}
+	}
+	return pins
+}
+
+// MapParams carries param values saved against one version of an effect
+// over to another, one version at a time
+// A value follows its param through renames (PreviousNames) in either
+// direction. Values with nowhere to go, or that aren't valid for the
+// param they land on (its type or range changed), are dropped: the param
+// takes its default. Returns the mapped params and the dropped names.
+func (c *Catalog) MapParams(id string, from, to int, params map[string]json.RawMessage) (map[string]json.RawMessage, []string, error) {
+	versions, err := c.Versions(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from < 1 || from > len(versions) || to < 1 || to > len(versions) {
+		return nil, nil, ErrVersionNotFound
+	}
+
+	dropped := []string{}
+	for from != to {
+		next := from + 1
+		if to < from {
+			next = from - 1
+		}
+		src, dst := versions[from-1], versions[next-1]
+
+		mapped := map[string]json.RawMessage{}
+		used := map[string]bool{}
+		for _, p := range dst.Params {
+			for _, name := range sourceNames(src, p, next > from) {
+				v, ok := params[name]
+				if !ok {
+					continue
+				}
+				used[name] = true
+				if canonical, err := p.Check(v); err == nil {
+					mapped[p.Name] = canonical
+				} else {
+					dropped = append(dropped, name)
+				}
+				break
+			}
+		}
+		for name := range params {
+			if !used[name] {
+				dropped = append(dropped, name)
+			}
+		}
+
+		params, from = mapped, next
+	}
+
+	sort.Strings(dropped)
+	return params, dropped, nil
+}
+
+// sourceNames lists the names a value of param p may have in src,
+// the version next to p's (older if forward is set, newer if not)
+func sourceNames(src models.EffectDefinition, p models.ParamDefinition, forward bool) []string {
+	names := []string{p.Name}
+	if forward {
+		return append(names, p.PreviousNames...)
+	}
+	// Going back, p's value is in whichever newer param used to be called p
+	for _, newer := range src.Params {
+		for _, old := range newer.PreviousNames {
+			if old == p.Name {
+				names = append(names, newer.Name)
+			}
+		}
+	}
+	return names
+}
+
+// ParamError lists every invalid effect param of a timeline
+// Keys look like "effects.<clip id>.params.<name>".
+type ParamError struct {
+	Fields map[string]string
+}
+
+func (e *ParamError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for field, msg := range e.Fields {
+		parts = append(parts, field+": "+msg)
+	}
+	sort.Strings(parts)
+	return "invalid effect params: " + strings.Join(parts, "; ")
+}
+
+// CheckParams checks the params of every effect clip against the version
+// of its effect the project sees, and puts them in canonical form
+// Returns a *ParamError listing all invalid params. Clips of effects the
+// catalog doesn't have are left alone: they may come from a newer server
+// and are kept as they are, like the rest of the timeline.
+func (c *Catalog) CheckParams(t *models.Timeline, pins models.EffectVersions) error {
+	fields := map[string]string{}
+	for _, clip := range t.Effects {
+		def, err := c.Get(clip.Type, pins[clip.Type])
+		if err != nil {
+			continue
+		}
+		msgs := def.CheckParams(clip.Params)
+		for name, msg := range msgs {
+			fields["effects."+clip.ID+".params."+name] = msg
+		}
+		if len(msgs) > 0 || !def.IsCompound() {
+			continue
+		}
+
+		// Valid macros make valid layers (see checkStack), but what gets
+		// rendered is the layers, so they're what has to be right
+		layers, err := c.Expand(def, clip.Params)
+		if err != nil {
+			return err
+		}
+		for i, layer := range layers {
+			for name, msg := range layer.Def.CheckParams(layer.Params) {
+				fields[fmt.Sprintf("effects.%s.stack.%d.%s", clip.ID, i, name)] = msg
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return &ParamError{Fields: fields}
+	}
+	return nil
+}
+
+// StatesAt returns the effect clips active at time at on the timeline
+// (start <= at < end), in timeline order, with their param values then
+// Compound effects are expanded into their layers. Clips of effects the
+// catalog doesn't have are left out.
+func (c *Catalog) StatesAt(t *models.Timeline, pins models.EffectVersions, at float64) ([]models.EffectState, error) {
+	states := []models.EffectState{}
+	for _, clip := range t.Effects {
+		if at < clip.StartTime || at >= clip.EndTime {
+			continue
+		}
+		def, err := c.Get(clip.Type, pins[clip.Type])
+		if err != nil {
+			continue
+		}
+		layers, err := c.Expand(def, clip.Params)
+		if err != nil {
+			return nil, fmt.Errorf("clip %s: %w", clip.ID, err)
+		}
+		for _, layer := range layers {
+			params, err := layer.Def.ParamsAt(layer.Params, at-clip.StartTime)
+			if err != nil {
+				return nil, fmt.Errorf("clip %s: %w", clip.ID, err)
+			}
+			state := models.EffectState{
+				ClipID:  clip.ID,
+				Type:    layer.Def.ID,
+				Version: layer.Def.Version,
+				Params:  params,
+			}
+			if def.IsCompound() {
+				state.Compound = def.ID
+			}
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+// ETag returns a strong entity tag for a JSON-encodable value
+// Equal content gives equal tags on every server, so caches stay valid
+// across deploys that don't change the catalog.
+func ETag(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
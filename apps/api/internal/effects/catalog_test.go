@@ -0,0 +1,429 @@
+package effects
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"tempo/internal/models"
+)
+
+// shaderDir is the web app's shader library, relative to this package
+var shaderDir = filepath.Join("..", "..", "..", "web", "src", "lib", "shaders")
+
+// TestShadersExist checks every built-in definition against the shader
+// library, so a definition naming a shader that isn't shipped (or was
+// renamed) fails CI instead of rendering nothing
+func TestShadersExist(t *testing.T) {
+	if _, err := os.Stat(shaderDir); err != nil {
+		t.Skipf("no shader library at %s: %v", shaderDir, err)
+	}
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, versions := range c.versions {
+		for _, def := range versions {
+			if def.Shader == "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(shaderDir, def.Shader)); err != nil {
+				t.Errorf("%s version %d: shader %s is not in the web app: %v", id, def.Version, def.Shader, err)
+			}
+		}
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, versions := range c.versions {
+		for _, def := range versions {
+			want := def.Shader != ""
+			if def.IsCompound() {
+				want = true
+				for _, layer := range def.Stack {
+					if component, _ := c.Get(layer.Effect, layer.Version); component.Shader == "" {
+						want = false
+					}
+				}
+			}
+			if def.Available != want {
+				t.Errorf("%s version %d: available = %v, want %v", id, def.Version, def.Available, want)
+			}
+		}
+	}
+	for _, def := range c.List() {
+		if latest, _ := c.Get(def.ID, 0); def.Available != latest.Available {
+			t.Errorf("%s: List says available = %v, Get says %v", def.ID, def.Available, latest.Available)
+		}
+	}
+}
+
+func TestAvailableIgnoresTheFile(t *testing.T) {
+	files := map[string]effectFile{}
+	fsys := fstest.MapFS{
+		"claimed.json": {Data: []byte(`{"id": "claimed", "versions": [{"version": 1, "name": "Claimed", "available": true}]}`)},
+	}
+	if err := readDir(fsys, files); err != nil {
+		t.Fatal(err)
+	}
+	if files["claimed"].Versions[0].Available {
+		t.Error("a definition without a shader was marked available")
+	}
+}
+
+func TestShaderName(t *testing.T) {
+	tests := []struct {
+		shader string
+		ok     bool
+	}{
+		{"time-smear.wgsl", true},
+		{"glow2.wgsl", true},
+		{"time-smear", false},
+		{"../secrets.wgsl", false},
+		{"effects/time-smear.wgsl", false},
+		{"Time-Smear.wgsl", false},
+	}
+	for _, tt := range tests {
+		f := effectFile{ID: "smear", Versions: []models.EffectDefinition{{Version: 1, Name: "Smear", Shader: tt.shader}}}
+		if err := f.check("smear"); (err == nil) != tt.ok {
+			t.Errorf("shader %q: error = %v, want ok: %v", tt.shader, err, tt.ok)
+		}
+	}
+}
+
+// loadWith loads the catalog with extra definition files (name → JSON)
+func loadWith(t *testing.T, files map[string]string) *Catalog {
+	t.Helper()
+	c, err := Load(writeDefinitions(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// writeDefinitions writes definition files (name → JSON) to a new
+// directory for Load
+func writeDefinitions(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// rampVersions is an effect that changes over three versions:
+//   - v2 renames amount to strength, adds option "c" to mode, turns
+//     color into a float and drops legacy
+//   - v3 renames strength to power (with a wider range) and drops option
+//     "a" from mode
+const rampVersions = `{
+	"id": "ramp",
+	"versions": [
+		{
+			"version": 1, "name": "Ramp",
+			"params": [
+				{"name": "amount", "type": "float", "min": 0, "max": 1, "default": 0.5},
+				{"name": "mode", "type": "enum", "options": ["a", "b"], "default": "a"},
+				{"name": "color", "type": "color", "default": "#000000"},
+				{"name": "legacy", "type": "bool", "default": false}
+			]
+		},
+		{
+			"version": 2, "name": "Ramp",
+			"params": [
+				{"name": "strength", "type": "float", "min": 0, "max": 1, "default": 0.5, "previous_names": ["amount"]},
+				{"name": "mode", "type": "enum", "options": ["a", "b", "c"], "default": "a"},
+				{"name": "color", "type": "float", "min": 0, "max": 10, "default": 0}
+			]
+		},
+		{
+			"version": 3, "name": "Ramp",
+			"params": [
+				{"name": "power", "type": "float", "min": 0, "max": 2, "default": 1, "previous_names": ["strength"]},
+				{"name": "mode", "type": "enum", "options": ["b", "c"], "default": "b"},
+				{"name": "color", "type": "float", "min": 0, "max": 10, "default": 0}
+			]
+		}
+	]
+}`
+
+// rawParams turns a JSON object into clip params
+func rawParams(t *testing.T, s string) map[string]json.RawMessage {
+	t.Helper()
+	params := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(s), &params); err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestMapParams(t *testing.T) {
+	c := loadWith(t, map[string]string{"ramp.json": rampVersions})
+
+	tests := []struct {
+		name        string
+		from, to    int
+		params      string
+		want        string
+		wantDropped []string
+	}{
+		{"same version", 2, 2, `{"strength": 0.3}`, `{"strength": 0.3}`, []string{}},
+		{"rename forward", 1, 2, `{"amount": 0.3, "mode": "b"}`, `{"strength": 0.3, "mode": "b"}`, []string{}},
+		{"rename back", 2, 1, `{"strength": 0.3, "mode": "b"}`, `{"amount": 0.3, "mode": "b"}`, []string{}},
+		{"type change drops the value", 1, 2, `{"color": "#ff0000"}`, `{}`, []string{"color"}},
+		{"type change back drops the value", 2, 1, `{"color": 5}`, `{}`, []string{"color"}},
+		{"removed param is dropped", 1, 2, `{"amount": 0.3, "legacy": true}`, `{"strength": 0.3}`, []string{"legacy"}},
+		{"option missing going back", 2, 1, `{"mode": "c"}`, `{}`, []string{"mode"}},
+		{"two renames forward", 1, 3, `{"amount": 0.3, "mode": "b"}`, `{"power": 0.3, "mode": "b"}`, []string{}},
+		{"two renames back", 3, 1, `{"power": 0.4, "mode": "b"}`, `{"amount": 0.4, "mode": "b"}`, []string{}},
+		{"option dropped on the second step", 1, 3, `{"mode": "a"}`, `{}`, []string{"mode"}},
+		{"out of range on the way back", 3, 1, `{"power": 1.5}`, `{}`, []string{"power"}},
+		{"unknown param", 1, 2, `{"speed": 1}`, `{}`, []string{"speed"}},
+		{"values come out canonical", 2, 3, `{"color": 5.0}`, `{"color": 5}`, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped, err := c.MapParams("ramp", tt.from, tt.to, rawParams(t, tt.params))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := rawParams(t, tt.want)
+			if len(got) != len(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			for name, v := range want {
+				var a, b interface{}
+				_ = json.Unmarshal(v, &a)
+				_ = json.Unmarshal(got[name], &b)
+				if !reflect.DeepEqual(a, b) {
+					t.Errorf("%s = %s, want %s", name, got[name], v)
+				}
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestMapParamsErrors(t *testing.T) {
+	c := loadWith(t, map[string]string{"ramp.json": rampVersions})
+
+	if _, _, err := c.MapParams("nope", 1, 2, nil); !errors.Is(err, ErrEffectNotFound) {
+		t.Errorf("unknown effect: %v, want ErrEffectNotFound", err)
+	}
+	for _, v := range [][2]int{{0, 1}, {1, 4}, {4, 1}} {
+		if _, _, err := c.MapParams("ramp", v[0], v[1], nil); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("versions %d → %d: %v, want ErrVersionNotFound", v[0], v[1], err)
+		}
+	}
+}
+
+func TestSourceNames(t *testing.T) {
+	c := loadWith(t, map[string]string{"ramp.json": rampVersions})
+	versions, _ := c.Versions("ramp")
+	v1, v2 := versions[0], versions[1]
+	strength, _ := findParam(v2, "strength")
+	amount, _ := findParam(v1, "amount")
+	mode, _ := findParam(v1, "mode")
+
+	if got := sourceNames(v1, strength, true); !reflect.DeepEqual(got, []string{"strength", "amount"}) {
+		t.Errorf("forward = %v", got)
+	}
+	if got := sourceNames(v2, amount, false); !reflect.DeepEqual(got, []string{"amount", "strength"}) {
+		t.Errorf("back = %v", got)
+	}
+	if got := sourceNames(v2, mode, false); !reflect.DeepEqual(got, []string{"mode"}) {
+		t.Errorf("back, not renamed = %v", got)
+	}
+}
+
+// glowVersions is a plain effect for compounds to stack
+const glowVersions = `{
+	"id": "glow",
+	"versions": [{
+		"version": 1, "name": "Glow", "shader": "glow.wgsl",
+		"params": [
+			{"name": "intensity", "type": "float", "min": 0, "max": 1, "default": 0.5},
+			{"name": "size", "type": "float", "min": 0, "max": 10, "default": 2},
+			{"name": "mode", "type": "enum", "options": ["soft", "hard", "pulse"], "default": "soft"}
+		]
+	}]
+}`
+
+// compound is a definition file of a compound effect "combo" with the
+// given macro params and stack
+func compound(params, stack string) string {
+	return `{"id": "combo", "versions": [{"version": 1, "name": "Combo", "params": ` + params + `, "stack": ` + stack + `}]}`
+}
+
+func TestCheckStack(t *testing.T) {
+	const amount = `[{"name": "amount", "type": "float", "min": 0, "max": 1, "default": 0.3}]`
+
+	tests := []struct {
+		name    string
+		combo   string
+		wantErr string // "" if it loads
+	}{
+		{
+			name:  "valid",
+			combo: compound(amount, `[{"effect": "glow", "version": 1, "params": {"size": 4}, "macros": {"intensity": "amount"}}]`),
+		},
+		{
+			name: "narrower macro range",
+			combo: compound(`[{"name": "amount", "type": "float", "min": 0.2, "max": 0.8, "default": 0.5}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"intensity": "amount"}}]`),
+		},
+		{
+			name: "enum macro with options of the layer param",
+			combo: compound(`[{"name": "style", "type": "enum", "options": ["hard", "soft"], "default": "hard"}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"mode": "style"}}]`),
+		},
+		{
+			name:    "nested compound",
+			combo:   compound(amount, `[{"effect": "echo-glitch-fade", "version": 1, "macros": {"echo": "amount"}}]`),
+			wantErr: "is itself a compound effect",
+		},
+		{
+			name:    "unknown effect",
+			combo:   compound(amount, `[{"effect": "nope", "version": 1, "macros": {"intensity": "amount"}}]`),
+			wantErr: "no effect",
+		},
+		{
+			name:    "unknown version",
+			combo:   compound(amount, `[{"effect": "glow", "version": 2, "macros": {"intensity": "amount"}}]`),
+			wantErr: "no effect",
+		},
+		{
+			name:    "param both fixed and driven",
+			combo:   compound(amount, `[{"effect": "glow", "version": 1, "params": {"intensity": 0.2}, "macros": {"intensity": "amount"}}]`),
+			wantErr: "both fixed and driven",
+		},
+		{
+			name: "unbound macro",
+			combo: compound(`[`+amount[1:len(amount)-1]+`, {"name": "unused", "type": "float", "min": 0, "max": 1, "default": 0}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"intensity": "amount"}}]`),
+			wantErr: `"unused" drives nothing`,
+		},
+		{
+			name:    "macro that doesn't exist",
+			combo:   compound(amount, `[{"effect": "glow", "version": 1, "macros": {"intensity": "amount", "size": "missing"}}]`),
+			wantErr: `no macro control "missing"`,
+		},
+		{
+			name:    "param the layer doesn't have",
+			combo:   compound(amount, `[{"effect": "glow", "version": 1, "macros": {"radius": "amount"}}]`),
+			wantErr: `has no param "radius"`,
+		},
+		{
+			name:    "invalid fixed value",
+			combo:   compound(amount, `[{"effect": "glow", "version": 1, "params": {"size": 20}, "macros": {"intensity": "amount"}}]`),
+			wantErr: "invalid params",
+		},
+		{
+			name: "macro range wider than the param's",
+			combo: compound(`[{"name": "amount", "type": "float", "min": 0, "max": 2, "default": 0.5}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"intensity": "amount"}}]`),
+			wantErr: "can't drive",
+		},
+		{
+			name: "macro of another type",
+			combo: compound(`[{"name": "amount", "type": "int", "min": 0, "max": 1, "default": 0}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"intensity": "amount"}}]`),
+			wantErr: "can't drive",
+		},
+		{
+			name: "enum macro with an option the param lacks",
+			combo: compound(`[{"name": "style", "type": "enum", "options": ["soft", "blurry"], "default": "soft"}]`,
+				`[{"effect": "glow", "version": 1, "macros": {"mode": "style"}}]`),
+			wantErr: "can't drive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeDefinitions(t, map[string]string{"glow.json": glowVersions, "combo.json": tt.combo}))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	c := loadWith(t, map[string]string{
+		"glow.json": glowVersions,
+		"combo.json": compound(
+			`[{"name": "amount", "type": "float", "min": 0, "max": 1, "default": 0.3}]`,
+			`[
+				{"effect": "glow", "version": 1, "params": {"size": 4}, "macros": {"intensity": "amount"}},
+				{"effect": "glow", "version": 1, "params": {"mode": "hard"}, "macros": {"intensity": "amount"}}
+			]`),
+	})
+	combo, err := c.Get("combo", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		want   []string // Each layer's params
+	}{
+		{"macro left out takes its default", `{}`, []string{`{"intensity":0.3,"size":4}`, `{"intensity":0.3,"mode":"hard"}`}},
+		{"macro value drives every layer", `{"amount": 0.8}`, []string{`{"intensity":0.8,"size":4}`, `{"intensity":0.8,"mode":"hard"}`}},
+		{
+			"tracks pass through",
+			`{"amount": {"keyframes":[{"time":0,"value":1}]}}`,
+			[]string{`{"intensity":{"keyframes":[{"time":0,"value":1}]},"size":4}`, `{"intensity":{"keyframes":[{"time":0,"value":1}]},"mode":"hard"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layers, err := c.Expand(combo, rawParams(t, tt.params))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(layers) != len(tt.want) {
+				t.Fatalf("got %d layers, want %d", len(layers), len(tt.want))
+			}
+			for i, layer := range layers {
+				if layer.Def.ID != "glow" {
+					t.Errorf("layer %d is %s, want glow", i, layer.Def.ID)
+				}
+				if got, _ := json.Marshal(layer.Params); string(got) != tt.want[i] {
+					t.Errorf("layer %d params = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	glow, _ := c.Get("glow", 1)
+	params := rawParams(t, `{"size": 1}`)
+	layers, err := c.Expand(glow, params)
+	if err != nil || len(layers) != 1 || layers[0].Def != glow || !reflect.DeepEqual(layers[0].Params, params) {
+		t.Errorf("a plain effect should expand to itself, got %+v, %v", layers, err)
+	}
+}
@@ -0,0 +1,492 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/bundle"
+	"tempo/internal/effects"
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// maxBundleSize caps an imported .tempo file
+// Generous because bundles can carry several 500MB source videos
+const maxBundleSize = 4 << 30
+
+// maxYjsStateSize caps the collaboration snapshot read from a bundle
+const maxYjsStateSize = 64 << 20
+
+// unsafeFilenameChars matches anything we don't want in a download filename
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// BundleHandler exports and imports .tempo project archives
+// Used to move projects between environments and to archive finished work
+type BundleHandler struct {
+	projectRepo *repository.ProjectRepository
+	mediaRepo   *repository.MediaRepository
+	blobs       storage.BlobStore
+	ingestor    *media.Ingestor
+	presetRepo  *repository.EffectPresetRepository
+	catalog     *effects.Catalog
+}
+
+// NewBundleHandler creates a new bundle handler
+func NewBundleHandler(projectRepo *repository.ProjectRepository, mediaRepo *repository.MediaRepository, blobs storage.BlobStore, ingestor *media.Ingestor, presetRepo *repository.EffectPresetRepository, catalog *effects.Catalog) *BundleHandler {
+	return &BundleHandler{
+		projectRepo: projectRepo,
+		mediaRepo:   mediaRepo,
+		blobs:       blobs,
+		ingestor:    ingestor,
+		presetRepo:  presetRepo,
+		catalog:     catalog,
+	}
+}
+
+// Export streams a project as a .tempo archive
+// GET /api/projects/{id}/bundle?include_media=true
+func (h *BundleHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	includeMedia, _ := strconv.ParseBool(r.URL.Query().Get("include_media"))
+
+	// Load everything BEFORE writing anything - once the zip starts
+	// streaming we can no longer send a proper error response
+	project, err := h.projectRepo.GetByID(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get project")
+		return
+	}
+
+	timeline, err := h.projectRepo.GetTimeline(r.Context(), projectID, *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get timeline")
+		return
+	}
+
+	yjsState, err := h.projectRepo.GetYjsState(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get project state")
+		return
+	}
+
+	pins, err := h.projectRepo.GetEffectVersions(r.Context(), projectID, *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get effects")
+		return
+	}
+	effectDefs := h.catalog.Resolve(timeline.EffectIDs(), pins)
+
+	teamPresets, err := h.presetRepo.ListTeam(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get presets")
+		return
+	}
+	presets := make([]bundle.PresetEntry, len(teamPresets))
+	for i, p := range teamPresets {
+		presets[i] = bundle.PresetEntry{
+			EffectID:      p.EffectID,
+			EffectVersion: p.EffectVersion,
+			Name:          p.Name,
+			Description:   p.Description,
+			Tags:          p.Tags,
+			Params:        p.Params,
+		}
+	}
+
+	media, err := h.mediaRepo.ListForProject(r.Context(), projectID, timeline.MediaIDs())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get media")
+		return
+	}
+
+	manifest := bundle.NewManifest()
+	manifest.Project = bundle.ManifestProject{
+		ID:          project.ID,
+		Name:        project.Name,
+		Description: project.Description,
+		Settings:    project.Settings,
+	}
+	manifest.HasYjsState = len(yjsState) > 0
+
+	// Storage keys of the media to include, by path inside the zip
+	mediaFiles := map[string]string{}
+	for i := range media {
+		m := &media[i]
+		entry := bundle.MediaEntry{
+			ID:          m.ID,
+			Kind:        m.Kind,
+			Filename:    m.Filename,
+			ContentType: m.ContentType,
+			Size:        m.Size,
+		}
+		if includeMedia {
+			entry.Path = bundle.MediaDir + filepath.Base(m.StorageKey)
+			mediaFiles[entry.Path] = m.StorageKey
+		}
+		manifest.Media = append(manifest.Media, entry)
+	}
+
+	// A bundle with media can take minutes to download. Lift the server's
+	// write timeout for this response only (errors mean "not supported")
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename := unsafeFilenameChars.ReplaceAllString(project.Name, "-")
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tempo"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Don't let the timeout middleware cancel the blob reads halfway
+	// through; a client that goes away still stops us, as writes to it fail
+	ctx := context.WithoutCancel(r.Context())
+
+	bw := bundle.NewWriter(w)
+	if err := h.writeBundle(ctx, bw, manifest, timeline, effectDefs, presets, yjsState, mediaFiles); err != nil {
+		// Headers are already sent - all we can do is log and cut the
+		// stream short, which leaves the client with a corrupt zip
+		log.Printf("bundle export %s failed: %v", projectID, err)
+		return
+	}
+	if err := bw.Close(); err != nil {
+		log.Printf("bundle export %s failed: %v", projectID, err)
+	}
+}
+
+// writeBundle writes every entry in the documented order (manifest first)
+func (h *BundleHandler) writeBundle(ctx context.Context, bw *bundle.Writer, manifest bundle.Manifest, timeline *models.Timeline, effectDefs []models.EffectDefinition, presets []bundle.PresetEntry, yjsState []byte, mediaFiles map[string]string) error {
+	if err := bw.WriteJSON(bundle.ManifestFile, manifest); err != nil {
+		return err
+	}
+	if err := bw.WriteJSON(bundle.TimelineFile, timeline); err != nil {
+		return err
+	}
+	if err := bw.WriteJSON(bundle.EffectsFile, effectDefs); err != nil {
+		return err
+	}
+	if err := bw.WriteJSON(bundle.PresetsFile, presets); err != nil {
+		return err
+	}
+	if len(yjsState) > 0 {
+		if err := bw.WriteBytes(bundle.YjsFile, yjsState); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range manifest.Media {
+		if entry.Path == "" {
+			continue
+		}
+		blob, _, err := h.blobs.Get(ctx, mediaFiles[entry.Path], nil)
+		if err != nil {
+			return err
+		}
+		err = bw.WriteMedia(entry.Path, blob)
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import recreates a project from a .tempo archive under the current user
+// POST /api/projects/import
+// Body: the raw .tempo file (Content-Type: application/zip)
+//
+// Everything gets fresh IDs. Media files in the bundle are copied in and
+// the timeline is rewritten to point at the new copies. Media that wasn't
+// included is left pointing at the original IDs and listed in missing_media.
+func (h *BundleHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	// Uploading a bundle with media can take minutes too - lift the read
+	// timeout, and keep the timeout middleware from cancelling the media
+	// ingest and the writes that follow once the upload is spooled
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	ctx := context.WithoutCancel(r.Context())
+
+	// Zip's index lives at the END of the file, so we need random access.
+	// Spool the upload to a temp file instead of holding it in memory.
+	tmp, err := os.CreateTemp("", "tempo-import-*.zip")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to import bundle")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Bundle too large or upload interrupted")
+		return
+	}
+
+	br, err := bundle.NewReader(tmp, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, bundle.ErrTooNew), errors.Is(err, models.ErrSettingsFromFuture):
+			respondError(w, http.StatusUnprocessableEntity, "This bundle was made by a newer version of Tempo")
+		case errors.Is(err, bundle.ErrNotABundle):
+			respondError(w, http.StatusBadRequest, "Not a .tempo bundle")
+		default:
+			respondError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	if err := br.Manifest.Project.Settings.Validate(); err != nil {
+		var settingsErr *models.SettingsError
+		if errors.As(err, &settingsErr) {
+			respondFieldErrors(w, "Invalid settings in bundle", settingsErr.Fields)
+			return
+		}
+		respondError(w, http.StatusUnprocessableEntity, "Invalid settings in bundle")
+		return
+	}
+
+	var timeline models.Timeline
+	if err := br.ReadJSON(bundle.TimelineFile, &timeline); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := timeline.Validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "Invalid timeline in bundle: "+err.Error())
+		return
+	}
+
+	pins, err := h.importEffectVersions(br)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.catalog.CheckParams(&timeline, pins); err != nil {
+		var paramErr *effects.ParamError
+		if errors.As(err, &paramErr) {
+			respondFieldErrors(w, "Invalid effect params in bundle", paramErr.Fields)
+			return
+		}
+		respondError(w, http.StatusUnprocessableEntity, "Invalid effect params in bundle")
+		return
+	}
+
+	presets, skippedPresets, err := h.importPresets(br)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var yjsState []byte
+	if br.Has(bundle.YjsFile) {
+		if yjsState, err = br.ReadBytes(bundle.YjsFile, maxYjsStateSize); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid collaboration state in bundle")
+			return
+		}
+	}
+
+	// Copy media in under fresh IDs. The rows start out unattached (owned
+	// by the importer) and move into the project once it exists.
+	remapped := map[uuid.UUID]uuid.UUID{}
+	var imported []*models.Media
+	for _, entry := range br.Manifest.Media {
+		if entry.Path == "" {
+			continue
+		}
+		m, err := h.importBundleMedia(ctx, br, entry, *userID)
+		if err != nil {
+			h.discardImportedMedia(ctx, imported, *userID)
+			var quotaErr *media.QuotaError
+			if errors.As(err, &quotaErr) {
+				respondQuotaError(w, quotaErr)
+				return
+			}
+			respondError(w, http.StatusBadRequest, "Failed to import media "+entry.ID.String())
+			return
+		}
+		imported = append(imported, m)
+		remapped[entry.ID] = m.ID
+	}
+
+	missing := []uuid.UUID{}
+	for _, id := range timeline.MediaIDs() {
+		if _, ok := remapped[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	for i, clip := range timeline.Media {
+		if newID, ok := remapped[clip.MediaID]; ok {
+			timeline.Media[i].MediaID = newID
+		}
+	}
+
+	// The collaboration document is a binary CRDT we can't rewrite
+	// server-side, so once media has new IDs its clips would point at
+	// files that don't exist here, or at someone else's. Drop it: the
+	// editor rebuilds it from timeline.json, the source of truth.
+	if len(remapped) > 0 {
+		yjsState = nil
+	}
+
+	project, err := h.projectRepo.Import(ctx, *userID, repository.ImportedProject{
+		Name:        br.Manifest.Project.Name,
+		Description: br.Manifest.Project.Description,
+		Settings:    br.Manifest.Project.Settings,
+		Timeline:    timeline,
+		YjsState:    yjsState,
+
+		EffectVersions: pins,
+		Presets:        presets,
+	})
+	if err != nil {
+		h.discardImportedMedia(ctx, imported, *userID)
+		respondError(w, http.StatusInternalServerError, "Failed to import project")
+		return
+	}
+
+	importedIDs := make([]uuid.UUID, len(imported))
+	for i, m := range imported {
+		importedIDs[i] = m.ID
+	}
+	if err := h.mediaRepo.AttachToProject(ctx, importedIDs, project.ID, *userID); err != nil {
+		// Not fatal: the importer still owns (and can see) every file,
+		// collaborators they add later just won't see them
+		log.Printf("bundle import: failed to attach media to project %s: %v", project.ID, err)
+	}
+
+	respondJSON(w, http.StatusCreated, models.ImportProjectResponse{
+		Project:       project,
+		RemappedMedia: remapped,
+		MissingMedia:  missing,
+
+		SkippedPresets: skippedPresets,
+	})
+}
+
+// importEffectVersions reads the effect versions the bundled project was
+// pinned to from effects.json
+// Versions this server doesn't have (an effect or version added after
+// its deploy) are left unpinned: the project then uses the latest
+// version here, the closest thing available, and gets pinned to it on the
+// next save.
+func (h *BundleHandler) importEffectVersions(br *bundle.Reader) (models.EffectVersions, error) {
+	pins := models.EffectVersions{}
+	if !br.Has(bundle.EffectsFile) {
+		return pins, nil
+	}
+
+	var defs []models.EffectDefinition
+	if err := br.ReadJSON(bundle.EffectsFile, &defs); err != nil {
+		return nil, err
+	}
+	for _, def := range defs {
+		// Version 0: written before effects had versions, i.e. version 1
+		version := max(def.Version, 1)
+		if _, err := h.catalog.Get(def.ID, version); err == nil {
+			pins[def.ID] = version
+		}
+	}
+	return pins, nil
+}
+
+// importPresets reads the project's team presets from presets.json
+// Presets are checked like ones saved through the API. Ones this server
+// can't take (an effect or version it doesn't have, params that aren't
+// valid for it) are left out and returned by name.
+func (h *BundleHandler) importPresets(br *bundle.Reader) ([]models.EffectPreset, []string, error) {
+	presets := []models.EffectPreset{}
+	skipped := []string{}
+	if !br.Has(bundle.PresetsFile) {
+		return presets, skipped, nil
+	}
+
+	var entries []bundle.PresetEntry
+	if err := br.ReadJSON(bundle.PresetsFile, &entries); err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		preset := models.EffectPreset{
+			EffectID:    entry.EffectID,
+			Name:        strings.TrimSpace(entry.Name),
+			Description: entry.Description,
+			Tags:        entry.Tags,
+			Params:      entry.Params,
+			Scope:       models.PresetScopeTeam,
+			ProjectID:   &uuid.Nil, // The new project's, set on insert
+		}
+		if preset.Params == nil {
+			preset.Params = map[string]json.RawMessage{}
+		}
+		if validatePreset(&preset) != "" {
+			skipped = append(skipped, entry.Name)
+			continue
+		}
+		def, err := h.catalog.Get(entry.EffectID, max(entry.EffectVersion, 1))
+		if err != nil || len(def.CheckParams(preset.Params)) > 0 {
+			skipped = append(skipped, entry.Name)
+			continue
+		}
+		preset.EffectVersion = def.Version
+		presets = append(presets, preset)
+	}
+	return presets, skipped, nil
+}
+
+// importBundleMedia copies one media file out of the bundle into the blob store
+// and records it in the library
+func (h *BundleHandler) importBundleMedia(ctx context.Context, br *bundle.Reader, entry bundle.MediaEntry, userID uuid.UUID) (*models.Media, error) {
+	src, err := br.OpenMedia(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return h.ingestor.Ingest(ctx, src, media.IngestRequest{
+		OwnerID:     userID,
+		Filename:    entry.Filename,
+		ContentType: entry.ContentType,
+		Size:        -1,
+	})
+}
+
+// discardImportedMedia undoes importBundleMedia when an import fails
+func (h *BundleHandler) discardImportedMedia(ctx context.Context, imported []*models.Media, userID uuid.UUID) {
+	for _, m := range imported {
+		if _, err := h.ingestor.Remove(ctx, m.ID, userID); err != nil {
+			log.Printf("bundle import: failed to discard media %s: %v", m.ID, err)
+		}
+	}
+}
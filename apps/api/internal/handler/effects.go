@@ -2,115 +2,272 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/effects"
+	"tempo/internal/models"
+	"tempo/internal/repository"
 )
 
-// Available effects catalog
-var availableEffects = []EffectDefinition{
-	{
-		ID:          "time-smear",
-		Name:        "Time Smear",
-		Description: "Motion trails that linger and fade over time",
-		Category:    "temporal",
-		Params: []ParamDefinition{
-			{Name: "decay", Type: "float", Min: 0, Max: 1, Default: 0.9, Description: "How long trails persist"},
-			{Name: "intensity", Type: "float", Min: 0, Max: 1, Default: 0.5, Description: "Trail opacity strength"},
-		},
-	},
-	{
-		ID:          "echo-cascade",
-		Name:        "Echo Cascade",
-		Description: "Recursive ghost copies offset in time",
-		Category:    "temporal",
-		Params: []ParamDefinition{
-			{Name: "copies", Type: "int", Min: 1, Max: 10, Default: 3, Description: "Number of echo copies"},
-			{Name: "decay", Type: "float", Min: 0, Max: 1, Default: 0.7, Description: "Opacity falloff per copy"},
-			{Name: "offset", Type: "float", Min: 0, Max: 500, Default: 100, Description: "Time offset in ms"},
-		},
-	},
-	{
-		ID:          "liquid-time",
-		Name:        "Liquid Time",
-		Description: "Regions of video move at different speeds",
-		Category:    "temporal",
-		Params: []ParamDefinition{
-			{Name: "speed", Type: "float", Min: 0.1, Max: 3, Default: 0.5, Description: "Time scale factor"},
-			{Name: "smoothness", Type: "float", Min: 0, Max: 1, Default: 0.5, Description: "Transition smoothness"},
-		},
-	},
-	{
-		ID:          "temporal-glitch",
-		Name:        "Temporal Glitch",
-		Description: "Frames from past and future bleed through",
-		Category:    "glitch",
-		Params: []ParamDefinition{
-			{Name: "frequency", Type: "float", Min: 0, Max: 1, Default: 0.3, Description: "How often glitches occur"},
-			{Name: "intensity", Type: "float", Min: 0, Max: 1, Default: 0.5, Description: "Glitch strength"},
-			{Name: "colorShift", Type: "bool", Min: 0, Max: 1, Default: 1, Description: "Enable color channel separation"},
-		},
-	},
-	{
-		ID:          "breath-sync",
-		Name:        "Breath Sync",
-		Description: "Video pulses and breathes rhythmically",
-		Category:    "rhythm",
-		Params: []ParamDefinition{
-			{Name: "speed", Type: "float", Min: 0.1, Max: 3, Default: 1, Description: "Breathing rate"},
-			{Name: "intensity", Type: "float", Min: 0, Max: 1, Default: 0.5, Description: "Pulse intensity"},
-			{Name: "pattern", Type: "string", Min: 0, Max: 0, Default: 0, Description: "smooth or erratic"},
-		},
-	},
-	{
-		ID:          "memory-fade",
-		Name:        "Memory Fade",
-		Description: "Older frames progressively desaturate and blur",
-		Category:    "temporal",
-		Params: []ParamDefinition{
-			{Name: "fadeRate", Type: "float", Min: 0, Max: 1, Default: 0.5, Description: "How fast memory fades"},
-			{Name: "desaturate", Type: "float", Min: 0, Max: 1, Default: 0.7, Description: "Color loss amount"},
-			{Name: "blur", Type: "float", Min: 0, Max: 20, Default: 5, Description: "Blur amount in pixels"},
-		},
-	},
+// EffectHandler serves the effect catalog and the versions projects pin
+//
+// WHY ETAGS?
+// The editor asks for the catalog every time it opens a project, but it
+// only changes on deploys. Every response carries an ETag; a client that
+// sends it back in If-None-Match gets an empty 304 instead of the list.
+// Cache-Control: no-cache makes browsers ask each time rather than guess
+// how long the list stays fresh.
+type EffectHandler struct {
+	catalog     *effects.Catalog
+	projectRepo *repository.ProjectRepository
+}
+
+// NewEffectHandler creates a new effect handler
+func NewEffectHandler(catalog *effects.Catalog, projectRepo *repository.ProjectRepository) *EffectHandler {
+	return &EffectHandler{
+		catalog:     catalog,
+		projectRepo: projectRepo,
+	}
+}
+
+// ListEffects returns the latest version of every effect
+// GET /api/effects
+func (h *EffectHandler) ListEffects(w http.ResponseWriter, r *http.Request) {
+	defs := h.catalog.List()
+	respondCachedJSON(w, r, h.catalog.ListETag(), models.EffectListResponse{
+		Effects: defs,
+		Total:   len(defs),
+	})
 }
 
-type EffectDefinition struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Category    string            `json:"category"`
-	Params      []ParamDefinition `json:"params"`
+// GetEffect returns one effect, the latest version unless ?version= says otherwise
+// GET /api/effects/{effectID}?version=1
+func (h *EffectHandler) GetEffect(w http.ResponseWriter, r *http.Request) {
+	version, ok := parseVersionParam(w, r)
+	if !ok {
+		return
+	}
+
+	def, err := h.catalog.Get(chi.URLParam(r, "effectID"), version)
+	if err != nil {
+		respondEffectLookupError(w, err)
+		return
+	}
+
+	etag, err := effects.ETag(def)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get effect")
+		return
+	}
+	respondCachedJSON(w, r, etag, def)
 }
 
-type ParamDefinition struct {
-	Name        string  `json:"name"`
-	Type        string  `json:"type"`
-	Min         float64 `json:"min"`
-	Max         float64 `json:"max"`
-	Default     float64 `json:"default"`
-	Description string  `json:"description"`
+// ListVersions returns every version of an effect, oldest first
+// GET /api/effects/{effectID}/versions
+func (h *EffectHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.catalog.Versions(chi.URLParam(r, "effectID"))
+	if err != nil {
+		respondEffectLookupError(w, err)
+		return
+	}
+
+	resp := models.EffectListResponse{
+		Effects: versions,
+		Total:   len(versions),
+	}
+	etag, err := effects.ETag(resp)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get effect")
+		return
+	}
+	respondCachedJSON(w, r, etag, resp)
 }
 
-func ListEffects(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"effects": availableEffects,
-		"total":   len(availableEffects),
+// ForProject returns the catalog at the versions the project is pinned to
+// GET /api/projects/{id}/effects
+func (h *EffectHandler) ForProject(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pins, err := h.projectRepo.GetEffectVersions(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get effects")
+		return
+	}
+
+	resp := models.ProjectEffectsResponse{
+		Effects:  h.catalog.ForProject(pins),
+		Versions: pins,
+	}
+	etag, err := effects.ETag(resp)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get effects")
+		return
+	}
+	respondCachedJSON(w, r, etag, resp)
+}
+
+// StatesAt returns the effects active at a point of the timeline, with
+// the values their params have then
+// GET /api/projects/{id}/timeline/effects?t=12.5
+//
+// For previews, thumbnails and renders that aren't done in the browser:
+// keyframes are evaluated exactly as everywhere else (package animation).
+func (h *EffectHandler) StatesAt(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	// !(at >= 0) also turns away NaN
+	at, err := strconv.ParseFloat(r.URL.Query().Get("t"), 64)
+	if err != nil || !(at >= 0) || math.IsInf(at, 0) {
+		respondError(w, http.StatusBadRequest, "t must be a time in seconds")
+		return
+	}
+
+	timeline, err := h.projectRepo.GetTimeline(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get timeline")
+		return
+	}
+	pins, err := h.projectRepo.GetEffectVersions(r.Context(), projectID, *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get effects")
+		return
+	}
+
+	states, err := h.catalog.StatesAt(timeline, pins, at)
+	if err != nil {
+		// Only timelines saved before params were checked get here
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.EffectStatesResponse{
+		Time:    at,
+		Effects: states,
 	})
 }
 
-func GetEffect(w http.ResponseWriter, r *http.Request) {
+// PinVersion moves a project to another version of an effect
+// PUT /api/projects/{id}/effects/{effectID}/version
+// Body: {"version": 2}
+//
+// Effects are pinned automatically when a saved timeline first uses
+// them; this is for upgrading (or going back) on purpose.
+func (h *EffectHandler) PinVersion(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var req models.PinEffectVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Version < 1 {
+		respondError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
 	effectID := chi.URLParam(r, "effectID")
+	if _, err := h.catalog.Get(effectID, req.Version); err != nil {
+		respondEffectLookupError(w, err)
+		return
+	}
 
-	for _, effect := range availableEffects {
-		if effect.ID == effectID {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(effect)
+	pins, err := h.projectRepo.PinEffectVersion(r.Context(), projectID, *userID, effectID, req.Version)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNotAuthorized) {
+			respondError(w, http.StatusForbidden, "Not authorized to edit this project")
 			return
 		}
+		respondError(w, http.StatusInternalServerError, "Failed to pin effect version")
+		return
 	}
 
-	http.Error(w, "Effect not found", http.StatusNotFound)
+	respondJSON(w, http.StatusOK, models.ProjectEffectsResponse{
+		Effects:  h.catalog.ForProject(pins),
+		Versions: pins,
+	})
 }
 
+// respondEffectLookupError maps a catalog lookup failure to a response
+func respondEffectLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, effects.ErrEffectNotFound):
+		respondError(w, http.StatusNotFound, "Effect not found")
+	case errors.Is(err, effects.ErrVersionNotFound):
+		respondError(w, http.StatusNotFound, "Effect version not found")
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to get effect")
+	}
+}
+
+// respondCachedJSON sends data with an ETag, or 304 Not Modified if the
+// client already has that version
+func respondCachedJSON(w http.ResponseWriter, r *http.Request, etag string, data interface{}) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondJSON(w, http.StatusOK, data)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+// Weak tags (W/"...") match too: for GET the comparison is weak.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
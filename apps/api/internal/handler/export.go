@@ -1,38 +1,80 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-)
 
-var (
-	exports     = make(map[string]*ExportJob)
-	exportsLock sync.RWMutex
+	"tempo/internal/effects"
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
 )
 
-type ExportJob struct {
-	ID        string    `json:"id"`
-	ProjectID string    `json:"projectId"`
-	Status    string    `json:"status"` // pending, processing, completed, failed
-	Progress  int       `json:"progress"`
-	URL       string    `json:"url,omitempty"`
-	Error     string    `json:"error,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+// exportURLTTL is how long an export download link stays valid
+const exportURLTTL = 1 * time.Hour
+
+// exportBitrates are rough bitrates (video and audio, bits per second) of
+// a render at each quality, to estimate its size for the quota check
+var exportBitrates = map[string]int64{
+	"low":    2_500_000,
+	"medium": 5_000_000,
+	"high":   10_000_000,
+}
+
+// ExportHandler runs export jobs
+// Rendered files are written to (and downloaded from) the blob store.
+// Jobs are recorded in the database, so any server can report on them.
+type ExportHandler struct {
+	exportRepo  *repository.ExportRepository
+	projectRepo *repository.ProjectRepository
+	blobs       storage.BlobStore
+	quotas      *media.Quotas
+	catalog     *effects.Catalog
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(exportRepo *repository.ExportRepository, projectRepo *repository.ProjectRepository, blobs storage.BlobStore, quotas *media.Quotas, catalog *effects.Catalog) *ExportHandler {
+	return &ExportHandler{
+		exportRepo:  exportRepo,
+		projectRepo: projectRepo,
+		blobs:       blobs,
+		quotas:      quotas,
+		catalog:     catalog,
+	}
+}
+
+// exportRender is what the renderer needs of a project, read when the
+// export starts so later edits don't change a render half way
+type exportRender struct {
+	timeline  *models.Timeline
+	pins      models.EffectVersions
+	frameRate float64
 }
 
 type StartExportRequest struct {
 	ProjectID string `json:"projectId"`
-	Format    string `json:"format"`   // mp4, webm
-	Quality   string `json:"quality"`  // low, medium, high
+	Format    string `json:"format"`  // mp4, webm
+	Quality   string `json:"quality"` // low, medium, high
 }
 
-func StartExport(w http.ResponseWriter, r *http.Request) {
+// StartExport queues a render of a project
+// POST /api/exports
+func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	var req StartExportRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -43,88 +85,204 @@ func StartExport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Project ID is required", http.StatusBadRequest)
 		return
 	}
+	projectID, err := uuid.Parse(req.ProjectID)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "mp4"
+	}
+	if req.Quality == "" {
+		req.Quality = "medium"
+	}
+	if req.Format != "mp4" && req.Format != "webm" {
+		http.Error(w, "format must be mp4 or webm", http.StatusBadRequest)
+		return
+	}
+	if req.Quality != "low" && req.Quality != "medium" && req.Quality != "high" {
+		http.Error(w, "quality must be low, medium or high", http.StatusBadRequest)
+		return
+	}
+
+	timeline, err := h.projectRepo.GetTimeline(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to get project", http.StatusInternalServerError)
+		return
+	}
+
+	project, err := h.projectRepo.GetByID(r.Context(), projectID, *userID)
+	if err != nil {
+		http.Error(w, "Failed to get project", http.StatusInternalServerError)
+		return
+	}
+	pins, err := h.projectRepo.GetEffectVersions(r.Context(), projectID, *userID)
+	if err != nil {
+		http.Error(w, "Failed to get project", http.StatusInternalServerError)
+		return
+	}
+
+	// Renders are stored too, and count against the user's and the
+	// project's quota
+	estimate := int64(timeline.Duration() * float64(exportBitrates[req.Quality]) / 8)
+	if err := h.quotas.CheckExport(r.Context(), *userID, projectID, estimate); err != nil {
+		var quotaErr *media.QuotaError
+		if errors.As(err, &quotaErr) {
+			respondQuotaError(w, quotaErr)
+			return
+		}
+		http.Error(w, "Failed to check storage quota", http.StatusInternalServerError)
+		return
+	}
 
 	// Create export job
-	job := &ExportJob{
-		ID:        uuid.New().String(),
-		ProjectID: req.ProjectID,
-		Status:    "pending",
-		Progress:  0,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+	job := &models.ExportJob{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		UserID:    *userID,
+		Format:    req.Format,
+		Quality:   req.Quality,
+		Status:    models.ExportPending,
 	}
+	job.OutputKey = storage.ExportKey(job.ID.String(), "."+req.Format)
 
-	exportsLock.Lock()
-	exports[job.ID] = job
-	exportsLock.Unlock()
+	job, err = h.exportRepo.Create(r.Context(), job)
+	if err != nil {
+		http.Error(w, "Failed to start export", http.StatusInternalServerError)
+		return
+	}
 
 	// In production, this would queue a job to a worker
+	// The renderer must read each clip's original file (Media.StorageKey),
+	// never a preview proxy - proxies are low resolution by design.
 	// For now, simulate processing in a goroutine
-	go simulateExport(job.ID)
+	go h.simulateExport(job.ID, job.OutputKey, exportRender{
+		timeline:  timeline,
+		pins:      pins,
+		frameRate: project.Settings.FrameRate,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(job)
 }
 
-func simulateExport(exportID string) {
-	exportsLock.Lock()
-	job := exports[exportID]
-	job.Status = "processing"
-	exportsLock.Unlock()
+// simulateExport stands in for the renderer, moving the job along
+// It outlives the request, hence its own context. Frames aren't drawn
+// yet, but each one's effect params are worked out the way the editor
+// and the timeline/effects endpoint do (Catalog.StatesAt), so a render
+// fails on the same timelines they would.
+func (h *ExportHandler) simulateExport(exportID uuid.UUID, outputKey string, render exportRender) {
+	ctx := context.Background()
 
-	// Simulate processing time
+	frames := int(math.Ceil(render.timeline.Duration() * render.frameRate))
+	frame := 0
 	for i := 0; i <= 100; i += 10 {
+		// Simulate processing time
 		time.Sleep(500 * time.Millisecond)
-		exportsLock.Lock()
-		job.Progress = i
-		job.UpdatedAt = time.Now().UTC()
-		exportsLock.Unlock()
-	}
-
-	exportsLock.Lock()
-	job.Status = "completed"
-	job.Progress = 100
-	job.URL = "/exports/" + exportID + ".mp4"
-	job.UpdatedAt = time.Now().UTC()
-	exportsLock.Unlock()
-}
 
-func GetExportStatus(w http.ResponseWriter, r *http.Request) {
-	exportID := chi.URLParam(r, "exportID")
+		for ; frame < frames*i/100; frame++ {
+			at := float64(frame) / render.frameRate
+			if _, err := h.catalog.StatesAt(render.timeline, render.pins, at); err != nil {
+				log.Printf("export %s: frame %d: %v", exportID, frame, err)
+				if err := h.exportRepo.Fail(ctx, exportID, "Failed to evaluate effects"); err != nil {
+					log.Printf("export %s: failed to record failure: %v", exportID, err)
+				}
+				return
+			}
+		}
 
-	exportsLock.RLock()
-	job, exists := exports[exportID]
-	exportsLock.RUnlock()
+		if err := h.exportRepo.SetProgress(ctx, exportID, models.ExportProcessing, i); err != nil {
+			log.Printf("export %s: failed to record progress: %v", exportID, err)
+			return
+		}
+	}
 
-	if !exists {
-		http.Error(w, "Export job not found", http.StatusNotFound)
+	// Record what was written, so it counts against the quota
+	var size int64
+	if info, err := h.blobs.Stat(ctx, outputKey); err == nil {
+		size = info.Size
+	}
+	if err := h.exportRepo.Complete(ctx, exportID, size); err != nil {
+		log.Printf("export %s: failed to record completion: %v", exportID, err)
+	}
+}
+
+// GetExportStatus returns an export job
+// GET /api/exports/{exportID}
+func (h *ExportHandler) GetExportStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getJob(w, r)
+	if !ok {
 		return
 	}
 
+	if job.Status == models.ExportCompleted {
+		job.URL = "/api/exports/" + job.ID.String() + "/download"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(job)
 }
 
-func DownloadExport(w http.ResponseWriter, r *http.Request) {
-	exportID := chi.URLParam(r, "exportID")
-
-	exportsLock.RLock()
-	job, exists := exports[exportID]
-	exportsLock.RUnlock()
-
-	if !exists {
-		http.Error(w, "Export job not found", http.StatusNotFound)
+// DownloadExport redirects to the rendered file
+// GET /api/exports/{exportID}/download
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getJob(w, r)
+	if !ok {
 		return
 	}
 
-	if job.Status != "completed" {
+	if job.Status != models.ExportCompleted {
 		http.Error(w, "Export not ready", http.StatusBadRequest)
 		return
 	}
 
-	// In production, redirect to S3/CloudFront URL
-	// For now, return a placeholder
-	http.Error(w, "Export download not implemented in development mode", http.StatusNotImplemented)
+	// Send the browser straight to storage (S3/CloudFront in production)
+	// The simulated renderer doesn't write a file yet, hence the 404 case
+	if _, err := h.blobs.Stat(r.Context(), job.OutputKey); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Export file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to get export", http.StatusInternalServerError)
+		return
+	}
+
+	url, err := h.blobs.PresignGet(r.Context(), job.OutputKey, exportURLTTL)
+	if err != nil {
+		http.Error(w, "Failed to get export", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
 }
 
+// getJob loads the export job in the URL, if the user started it
+// Writes the error response and returns false otherwise.
+func (h *ExportHandler) getJob(w http.ResponseWriter, r *http.Request) (*models.ExportJob, bool) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	exportID, err := uuid.Parse(chi.URLParam(r, "exportID"))
+	if err != nil {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	job, err := h.exportRepo.Get(r.Context(), exportID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrExportNotFound) {
+			http.Error(w, "Export job not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to get export", http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
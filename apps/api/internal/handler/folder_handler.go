@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+// maxFolderNameLength matches folders.name VARCHAR(255)
+const maxFolderNameLength = 255
+
+// FolderHandler handles a user's project folders
+type FolderHandler struct {
+	folderRepo *repository.FolderRepository
+}
+
+// NewFolderHandler creates a new folder handler
+func NewFolderHandler(folderRepo *repository.FolderRepository) *FolderHandler {
+	return &FolderHandler{folderRepo: folderRepo}
+}
+
+// List returns all of the user's folders
+// GET /api/folders
+func (h *FolderHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	folders, err := h.folderRepo.List(r.Context(), *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list folders")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, folders)
+}
+
+// Create makes a new folder
+// POST /api/folders
+func (h *FolderHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var req models.CreateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxFolderNameLength {
+		respondError(w, http.StatusBadRequest, "Folder name is required (max 255 characters)")
+		return
+	}
+
+	folder, err := h.folderRepo.Create(r.Context(), *userID, req.Name, req.ParentID)
+	if err != nil {
+		h.respondFolderError(w, err, "Failed to create folder")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, folder)
+}
+
+// Update renames or moves a folder
+// PATCH /api/folders/{id}
+func (h *FolderHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	folderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+
+	var req models.UpdateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > maxFolderNameLength {
+			respondError(w, http.StatusBadRequest, "Folder name is required (max 255 characters)")
+			return
+		}
+		req.Name = &name
+	}
+
+	folder, err := h.folderRepo.Update(r.Context(), *userID, folderID, req.Name, req.ParentID)
+	if err != nil {
+		h.respondFolderError(w, err, "Failed to update folder")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, folder)
+}
+
+// Delete removes a folder and its subfolders (projects become unfiled)
+// DELETE /api/folders/{id}
+func (h *FolderHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	folderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+
+	if err := h.folderRepo.Delete(r.Context(), *userID, folderID); err != nil {
+		h.respondFolderError(w, err, "Failed to delete folder")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveProject puts a project into one of the user's folders
+// PUT /api/projects/{id}/folder
+// Body: { "folder_id": "..." } or { "folder_id": null } to unfile
+func (h *FolderHandler) MoveProject(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var req models.MoveProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.folderRepo.MoveProject(r.Context(), *userID, projectID, req.FolderID); err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		h.respondFolderError(w, err, "Failed to move project")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondFolderError maps repository errors to HTTP responses
+func (h *FolderHandler) respondFolderError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrFolderNotFound):
+		respondError(w, http.StatusNotFound, "Folder not found")
+	case errors.Is(err, repository.ErrFolderExists):
+		respondError(w, http.StatusConflict, "A folder with this name already exists here")
+	case errors.Is(err, repository.ErrFolderCycle):
+		respondError(w, http.StatusBadRequest, "A folder can't be moved inside itself")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// FrameHandler serves still frames of videos, for reviews, bug reports
+// and AI analysis
+type FrameHandler struct {
+	mediaRepo *repository.MediaRepository
+	blobs     storage.BlobStore
+	frames    *media.FrameExtractor // nil without ffmpeg
+}
+
+// NewFrameHandler creates a new frame handler
+// frames may be nil: cached frames are still served, new ones get a 503.
+func NewFrameHandler(mediaRepo *repository.MediaRepository, blobs storage.BlobStore, frames *media.FrameExtractor) *FrameHandler {
+	return &FrameHandler{
+		mediaRepo: mediaRepo,
+		blobs:     blobs,
+		frames:    frames,
+	}
+}
+
+// Get returns the frame of a video shown at a given time, as an image
+// GET /api/videos/{id}/frame?t=12.345&w=640&format=jpeg
+//
+// t is in seconds (to the millisecond), w the width in pixels (default
+// and maximum: the video's own; the height follows the aspect ratio),
+// format one of jpeg (default), png or webp. Frames are cached by video,
+// time, width and format, so asking again is just a download.
+//
+// with_effects=true (render the project's effects on top) needs the
+// server-side renderer, which doesn't exist yet: it gets a 501.
+func (h *FrameHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	query := r.URL.Query()
+	if withEffects, _ := strconv.ParseBool(query.Get("with_effects")); withEffects {
+		respondError(w, http.StatusNotImplemented, "Frames with effects need the server-side renderer, which isn't available yet")
+		return
+	}
+
+	// !(req.Time >= 0) also turns away NaN
+	var req media.FrameRequest
+	if req.Time, err = strconv.ParseFloat(query.Get("t"), 64); err != nil || !(req.Time >= 0) || math.IsInf(req.Time, 0) {
+		respondError(w, http.StatusBadRequest, "t must be a time in seconds")
+		return
+	}
+	if value := query.Get("w"); value != "" {
+		if req.Width, err = strconv.Atoi(value); err != nil || req.Width <= 0 {
+			respondError(w, http.StatusBadRequest, "w must be a width in pixels")
+			return
+		}
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "jpeg"
+	}
+	var ok bool
+	if req.Format, ok = media.LookupFrameFormat(format); !ok {
+		respondError(w, http.StatusBadRequest, "format must be jpeg, png or webp")
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMediaNotFound) {
+			respondError(w, http.StatusNotFound, "Video not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get video")
+		return
+	}
+	if m.Kind != models.MediaKindVideo {
+		respondError(w, http.StatusBadRequest, "Only videos have frames")
+		return
+	}
+	if err := media.NormalizeFrameRequest(m, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "t is outside the video")
+		return
+	}
+
+	key := media.FrameKey(m.ID, req)
+	err = h.serveFrame(w, r, key, req.Format)
+	if errors.Is(err, storage.ErrNotFound) {
+		if h.frames == nil {
+			respondError(w, http.StatusServiceUnavailable, "Frame extraction is not available")
+			return
+		}
+		if err := h.frames.Extract(r.Context(), m, req); err != nil {
+			if errors.Is(err, media.ErrNoFrame) {
+				respondError(w, http.StatusNotFound, "No frame at that time")
+				return
+			}
+			log.Printf("media %s: failed to extract frame at %gs: %v", m.ID, req.Time, err)
+			respondError(w, http.StatusInternalServerError, "Failed to extract frame")
+			return
+		}
+		err = h.serveFrame(w, r, key, req.Format)
+	}
+	if err != nil {
+		log.Printf("media %s: failed to serve frame %s: %v", m.ID, key, err)
+		respondError(w, http.StatusInternalServerError, "Failed to read frame")
+	}
+}
+
+// serveFrame sends a cached frame
+// A frame never changes, so browsers may keep it for a day. The headers
+// saying so are only set while serving it: an error sent instead (no
+// frame yet, extraction failed) must not be cached.
+func (h *FrameHandler) serveFrame(w http.ResponseWriter, r *http.Request, key string, format *media.FrameFormat) error {
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	err := storage.ServeBlob(w, r, h.blobs, key)
+	if err != nil {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Cache-Control")
+	}
+	return err
+}
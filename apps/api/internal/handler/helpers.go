@@ -30,6 +30,15 @@ func respondError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
+// respondFieldErrors sends a 422 with a message per invalid field
+// Body: { "error": "...", "fields": { "frame_rate": "must be between 1 and 120" } }
+func respondFieldErrors(w http.ResponseWriter, message string, fields map[string]string) {
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":  message,
+		"fields": fields,
+	})
+}
+
 // getUserIDFromContext retrieves the user ID from the request context
 // Uses the middleware's GetUserID function to ensure consistency
 func getUserIDFromContext(ctx context.Context) *uuid.UUID {
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/media"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// HLSHandler serves HLS packages (see media.JobHLS)
+//
+// WHY NOT PRESIGNED BLOB URLS?
+// A playlist refers to its segments by relative URI, and a presigned URL
+// only covers the one object it was made for - the segment URLs would
+// resolve next to the playlist's and have no signature. So packages are
+// served through us under a signed PATH prefix instead:
+//
+//	/hls/<media id>/<expires>/<signature>/master.m3u8
+//	/hls/<media id>/<expires>/<signature>/720p/index.m3u8
+//	/hls/<media id>/<expires>/<signature>/720p/seg-00003.ts
+//
+// Relative URIs resolve inside the prefix, so one signature covers the
+// whole package and players need no auth headers (a <video> tag can't
+// send them).
+type HLSHandler struct {
+	mediaRepo  *repository.MediaRepository
+	blobs      storage.BlobStore
+	signingKey []byte
+	publicURL  string // Where clients reach this server, e.g. https://api.tempo.app
+}
+
+// NewHLSHandler creates a new HLS handler
+func NewHLSHandler(mediaRepo *repository.MediaRepository, blobs storage.BlobStore, signingKey []byte, publicURL string) *HLSHandler {
+	return &HLSHandler{
+		mediaRepo:  mediaRepo,
+		blobs:      blobs,
+		signingKey: signingKey,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// HLSStream is the response of GET /api/videos/{id}/hls
+type HLSStream struct {
+	URL       string    `json:"url"` // Master playlist
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Get returns a signed URL to a video's master playlist
+// GET /api/videos/{id}/hls
+// 404 until the hls job has finished (see "jobs" on the video); it only
+// runs when the server has MEDIA_HLS enabled.
+func (h *HLSHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMediaNotFound) {
+			respondError(w, http.StatusNotFound, "Video not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get video")
+		return
+	}
+	if m.HLS == nil {
+		respondError(w, http.StatusNotFound, "Stream is not ready")
+		return
+	}
+
+	// The package is stored under the derived ID, which uploads of the
+	// same content share
+	derivedID := m.DerivedID()
+	expiresAt := time.Now().Add(mediaURLTTL).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	respondJSON(w, http.StatusOK, HLSStream{
+		URL:       h.publicURL + "/hls/" + derivedID.String() + "/" + expires + "/" + h.sign(derivedID, expires) + "/" + media.HLSMasterPlaylist,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Serve serves a file of a package under a signed prefix (public)
+// GET /hls/{id}/{expires}/{signature}/*
+//
+// Segments support Range requests like any blob. Everything in a package
+// is immutable, so responses are cacheable until the link expires.
+func (h *HLSHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	expires := chi.URLParam(r, "expires")
+
+	// Constant-time compare so the signature can't be guessed byte by byte
+	if !hmac.Equal([]byte(chi.URLParam(r, "signature")), []byte(h.sign(mediaID, expires))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "Link expired", http.StatusForbidden)
+		return
+	}
+
+	// ValidateKey rejects "..", so the path can't leave the package
+	name := chi.URLParam(r, "*")
+	key := storage.HLSKey(mediaID, name)
+	if name == "" || storage.ValidateKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// A segment on a slow connection can take longer than the server's
+	// write timeout, and the timeout middleware would cancel the read
+	// from the store halfway through. A client that goes away still stops
+	// us, as writes to it fail.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	r = r.WithContext(context.WithoutCancel(r.Context()))
+
+	w.Header().Set("Content-Type", media.HLSContentType(name))
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(max(expiresAt-time.Now().Unix(), 0), 10))
+	if err := storage.ServeBlob(w, r, h.blobs, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("hls %s: failed to serve %s: %v", mediaID, name, err)
+		http.Error(w, "Failed to read stream", http.StatusInternalServerError)
+	}
+}
+
+// sign returns the hex HMAC-SHA256 of a package and expiry
+func (h *HLSHandler) sign(mediaID uuid.UUID, expires string) string {
+	mac := hmac.New(sha256.New, h.signingKey)
+	mac.Write([]byte("hls\n" + mediaID.String() + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
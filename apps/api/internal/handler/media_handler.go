@@ -0,0 +1,651 @@
+package handler
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// mediaURLTTL is how long download links in API responses stay valid
+// Long enough to watch a long clip, short enough that a leaked link dies
+const mediaURLTTL = 6 * time.Hour
+
+// maxUploadSize caps a single upload (500MB; images have a lower limit,
+// see media.Format)
+const maxUploadSize = 500 << 20
+
+// MediaHandler handles the video library
+// Metadata lives in the database (MediaRepository), the bytes in the blob store
+type MediaHandler struct {
+	mediaRepo   *repository.MediaRepository
+	projectRepo *repository.ProjectRepository
+	blobs       storage.BlobStore
+	ingestor    *media.Ingestor
+}
+
+// NewMediaHandler creates a new media handler
+func NewMediaHandler(mediaRepo *repository.MediaRepository, projectRepo *repository.ProjectRepository, blobs storage.BlobStore, ingestor *media.Ingestor) *MediaHandler {
+	return &MediaHandler{
+		mediaRepo:   mediaRepo,
+		projectRepo: projectRepo,
+		blobs:       blobs,
+		ingestor:    ingestor,
+	}
+}
+
+// ContentSHA256Header carries the hex SHA-256 of the file a client is
+// about to upload, so the upload can be skipped if we have the content
+const ContentSHA256Header = "X-Content-SHA256"
+
+// Upload stores a new video, image or audio file
+// POST /api/videos
+// Body: multipart form with a "file" and an optional "project_id"
+// ("video" works too, from before images and audio were supported).
+// The kind is decided by the content, see media.Sniff.
+//
+// With an X-Content-SHA256 header, content the user can already see is
+// linked like FromHash does and the body is never read. That's decided
+// before the form is parsed, so project_id (and optionally filename)
+// must be in the query string then. Clients sending
+// "Expect: 100-continue" don't even send the body.
+func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	if sum := r.Header.Get(ContentSHA256Header); sum != "" {
+		if h.uploadByHash(w, r, *userID, sum) {
+			return
+		}
+	}
+
+	// A 500MB body takes far longer than the server's read timeout, and
+	// the timeout middleware would cancel the ingest that follows it: lift
+	// the one and detach from the other, like tus chunks do
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	r = r.WithContext(context.WithoutCancel(r.Context()))
+
+	// Only the first 32MB are held in memory, the rest spills to a temp
+	// file. For big files on bad connections clients should use /api/uploads.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		respondError(w, http.StatusBadRequest, "File too large (max 500MB)")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		file, header, err = r.FormFile("video")
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	// The declared type is only a hint (the ingestor sniffs the content),
+	// but an obviously wrong one is rejected before we store anything
+	contentType := header.Header.Get("Content-Type")
+	if !media.DeclarableType(contentType) {
+		respondError(w, http.StatusUnsupportedMediaType, "Unsupported file format. Supported: "+media.SupportedFormatNames())
+		return
+	}
+
+	// Attaching to a project means its collaborators will see the file,
+	// so only people who can edit the project may do it
+	var projectID *uuid.UUID
+	if raw := r.FormValue("project_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid project ID")
+			return
+		}
+		if !h.requireProjectEditor(w, r, id, *userID) {
+			return
+		}
+		projectID = &id
+	}
+
+	if err := h.ingestor.CheckQuota(r.Context(), *userID, projectID, header.Size); err != nil {
+		respondIngestError(w, err)
+		return
+	}
+
+	created, err := h.ingestor.Ingest(r.Context(), file, media.IngestRequest{
+		OwnerID:     *userID,
+		ProjectID:   projectID,
+		Filename:    header.Filename,
+		ContentType: contentType,
+		Size:        header.Size,
+	})
+	if err != nil {
+		respondIngestError(w, err)
+		return
+	}
+
+	if err := presignMedia(r.Context(), h.blobs, created); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// FromHash adds a video the library already has, without uploading it
+// POST /api/videos/from-hash
+// Body: {"sha256": "...", "filename": "...", "project_id": "..."}
+//
+// Clients hash the file first and try this before uploading: 201 with
+// the new video if the content is in a video the user can already see,
+// 404 if not (then upload as usual).
+func (h *MediaHandler) FromHash(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var req models.LinkMediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !isSHA256(req.SHA256) {
+		respondError(w, http.StatusBadRequest, "sha256 must be 64 hex characters")
+		return
+	}
+	if req.ProjectID != nil && !h.requireProjectEditor(w, r, *req.ProjectID, *userID) {
+		return
+	}
+
+	created, err := h.ingestor.Link(r.Context(), req.SHA256, media.IngestRequest{
+		OwnerID:   *userID,
+		ProjectID: req.ProjectID,
+		Filename:  req.Filename,
+		Size:      -1,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrMediaNotFound) {
+			respondError(w, http.StatusNotFound, "No video with this content")
+			return
+		}
+		respondIngestError(w, err)
+		return
+	}
+
+	if err := presignMedia(r.Context(), h.blobs, created); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// uploadByHash links content the user can already see instead of
+// receiving it again
+// Returns false, without responding, if there's no such content; the
+// upload then goes ahead as usual.
+func (h *MediaHandler) uploadByHash(w http.ResponseWriter, r *http.Request, userID uuid.UUID, sum string) bool {
+	if !isSHA256(sum) {
+		respondError(w, http.StatusBadRequest, ContentSHA256Header+" must be 64 hex characters")
+		return true
+	}
+
+	var projectID *uuid.UUID
+	if raw := r.URL.Query().Get("project_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid project ID")
+			return true
+		}
+		if !h.requireProjectEditor(w, r, id, userID) {
+			return true
+		}
+		projectID = &id
+	}
+
+	created, err := h.ingestor.Link(r.Context(), sum, media.IngestRequest{
+		OwnerID:   userID,
+		ProjectID: projectID,
+		Filename:  r.URL.Query().Get("filename"),
+		Size:      -1,
+	})
+	if errors.Is(err, repository.ErrMediaNotFound) {
+		return false
+	}
+	if err != nil {
+		respondIngestError(w, err)
+		return true
+	}
+
+	if err := presignMedia(r.Context(), h.blobs, created); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+		return true
+	}
+	respondJSON(w, http.StatusCreated, created)
+	return true
+}
+
+// isSHA256 reports whether s looks like a hex SHA-256 digest
+func isSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// List returns the user's uploads, or a project's media
+// GET /api/videos?project_id=...&kind=video|image|audio
+func (h *MediaHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && !models.ValidMediaKind(kind) {
+		respondError(w, http.StatusBadRequest, "kind must be video, image or audio")
+		return
+	}
+
+	var projectID *uuid.UUID
+	if raw := r.URL.Query().Get("project_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid project ID")
+			return
+		}
+		// 404 rather than an empty list for projects the user isn't on
+		if _, err := h.projectRepo.GetByID(r.Context(), id, *userID); err != nil {
+			respondProjectLookupError(w, err)
+			return
+		}
+		projectID = &id
+	}
+
+	media, err := h.mediaRepo.ListByUser(r.Context(), *userID, projectID, kind)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list videos")
+		return
+	}
+	for i := range media {
+		if err := presignMedia(r.Context(), h.blobs, &media[i]); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, models.MediaListResponse{
+		Media:      media,
+		TotalCount: len(media),
+	})
+}
+
+// Get returns one video's metadata
+// GET /api/videos/{id}
+func (h *MediaHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	media, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		h.respondMediaError(w, err, "Failed to get video")
+		return
+	}
+
+	if err := presignMedia(r.Context(), h.blobs, media); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, media)
+}
+
+// Delete removes a video, and its file unless other videos share it
+// DELETE /api/videos/{id}
+// Allowed for the uploader and for editors of the video's project
+func (h *MediaHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if _, err := h.ingestor.Remove(r.Context(), mediaID, *userID); err != nil {
+		h.respondMediaError(w, err, "Failed to delete video")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ThumbnailsVTT returns the WebVTT thumbnail track for scrubbing
+// GET /api/videos/{id}/thumbnails.vtt
+// 404 until the thumbnails job has finished (see "jobs" on the video)
+func (h *MediaHandler) ThumbnailsVTT(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		h.respondMediaError(w, err, "Failed to get video")
+		return
+	}
+	if m.SpriteSheet == nil {
+		respondError(w, http.StatusNotFound, "Thumbnails are not ready")
+		return
+	}
+
+	urls := make([]string, m.SpriteSheet.SheetCount)
+	for i := range urls {
+		urls[i], err = h.blobs.PresignGet(r.Context(), media.SpriteKey(m.DerivedID(), i), mediaURLTTL)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get thumbnail URLs")
+			return
+		}
+	}
+
+	// The sheet URLs inside expire, so caches mustn't outlive them
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if err := media.WriteThumbnailVTT(w, m.SpriteSheet, m.Duration, urls); err != nil {
+		log.Printf("media %s: failed to write thumbnail track: %v", m.ID, err)
+	}
+}
+
+// requireProjectEditor checks the user can edit a project
+// On failure it has already written the response.
+func (h *MediaHandler) requireProjectEditor(w http.ResponseWriter, r *http.Request, projectID, userID uuid.UUID) bool {
+	project, err := h.projectRepo.GetByID(r.Context(), projectID, userID)
+	if err != nil {
+		respondProjectLookupError(w, err)
+		return false
+	}
+	if !models.CanEdit(project.Role) {
+		respondError(w, http.StatusForbidden, "You don't have permission to add videos to this project")
+		return false
+	}
+	return true
+}
+
+// respondMediaError maps repository errors to HTTP responses
+func (h *MediaHandler) respondMediaError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrMediaNotFound):
+		respondError(w, http.StatusNotFound, "Video not found")
+	case errors.Is(err, repository.ErrNotAuthorized):
+		respondError(w, http.StatusForbidden, "You don't have permission to delete this video")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// respondProjectLookupError answers a failed ProjectRepository.GetByID
+func respondProjectLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrProjectNotFound) {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "Failed to verify access")
+}
+
+// respondIngestError maps Ingestor errors to HTTP responses
+func respondIngestError(w http.ResponseWriter, err error) {
+	var codecErr *media.CodecError
+	var quotaErr *media.QuotaError
+	switch {
+	case errors.As(err, &quotaErr):
+		respondQuotaError(w, quotaErr)
+	case errors.As(err, &codecErr):
+		respondError(w, http.StatusUnprocessableEntity, fmt.Sprintf(
+			"Unsupported %s codec %q for %s. Supported: %s",
+			codecErr.Stream, codecErr.Codec, codecErr.Format.Name, strings.Join(codecErr.Supported, ", "),
+		))
+	case errors.Is(err, media.ErrUnsupportedFormat):
+		respondError(w, http.StatusUnsupportedMediaType, "Unsupported file format. Supported: "+media.SupportedFormatNames())
+	case errors.Is(err, media.ErrFileTooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, media.ErrImageTooLarge), errors.Is(err, media.ErrMissingStream):
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, media.ErrFormatMismatch):
+		respondError(w, http.StatusUnsupportedMediaType, "File content does not match its declared type")
+	case errors.Is(err, media.ErrUnreadableMedia):
+		respondError(w, http.StatusUnprocessableEntity, "The file could not be read as media")
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to save video")
+	}
+}
+
+// respondQuotaError answers with 413 and how much space is used
+func respondQuotaError(w http.ResponseWriter, err *media.QuotaError) {
+	whose := "Your files use"
+	if err.Scope == media.QuotaProject {
+		whose = "This project's files use"
+	}
+	message := fmt.Sprintf("Storage quota exceeded. %s %s of %s", whose, media.FormatBytes(err.Used), media.FormatBytes(err.Limit))
+	if err.Adding > 0 {
+		message += fmt.Sprintf(" and this file needs %s more", media.FormatBytes(err.Adding))
+	}
+	respondError(w, http.StatusRequestEntityTooLarge, message+". Delete videos you no longer need (see /api/me/usage).")
+}
+
+// MediaSource is the response of GET /api/videos/{id}/source
+type MediaSource struct {
+	Variant string `json:"variant"` // "original" or a proxy name like "720p"
+	URL     string `json:"url"`
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+}
+
+// Source returns a URL to play a video from
+// GET /api/videos/{id}/source?variant=original|proxy|540p|720p
+//
+// "proxy" (for preview) picks the best proxy that's ready and falls back
+// to the original while none is; the response says which one you got.
+// Asking for a specific proxy that doesn't exist is a 404. Renders and
+// exports must always use "original" (the default).
+func (h *MediaHandler) Source(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		h.respondMediaError(w, err, "Failed to get video")
+		return
+	}
+
+	var proxy *models.Proxy
+	switch variant := r.URL.Query().Get("variant"); variant {
+	case "", "original":
+	case "proxy":
+		proxy = media.PickProxy(m)
+	default:
+		for i := range m.Proxies {
+			if m.Proxies[i].Name == variant {
+				proxy = &m.Proxies[i]
+			}
+		}
+		if proxy == nil {
+			respondError(w, http.StatusNotFound, "No "+variant+" proxy for this video")
+			return
+		}
+	}
+
+	source := MediaSource{Variant: "original", Width: m.Width, Height: m.Height}
+	key := m.StorageKey
+	if proxy != nil {
+		source = MediaSource{Variant: proxy.Name, Width: proxy.Width, Height: proxy.Height}
+		key = media.ProxyKey(m.DerivedID(), proxy.Name)
+	}
+
+	if source.URL, err = h.blobs.PresignGet(r.Context(), key, mediaURLTTL); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get video URL")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, source)
+}
+
+// Waveform returns one zoom level of a video's audio peaks
+// GET /api/videos/{id}/waveform?zoom=0&format=json
+//
+// zoom 0 is the whole-clip overview, each level up doubles the detail
+// (the video's "waveform.samples_per_pixel" lists them). The response is
+// audiowaveform JSON, or with format=dat a redirect to the binary file.
+// 404 until the waveform job has finished.
+func (h *MediaHandler) Waveform(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		h.respondMediaError(w, err, "Failed to get video")
+		return
+	}
+	if m.Waveform == nil {
+		respondError(w, http.StatusNotFound, "Waveform is not ready")
+		return
+	}
+
+	zoom := 0
+	if raw := r.URL.Query().Get("zoom"); raw != "" {
+		zoom, err = strconv.Atoi(raw)
+		if err != nil || zoom < 0 || zoom >= len(m.Waveform.SamplesPerPixel) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("zoom must be between 0 and %d", len(m.Waveform.SamplesPerPixel)-1))
+			return
+		}
+	}
+	key := media.WaveformLevelKey(m.DerivedID(), m.Waveform.SamplesPerPixel[zoom])
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		// handled below
+	case "dat":
+		url, err := h.blobs.PresignGet(r.Context(), key, mediaURLTTL)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get waveform URL")
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	default:
+		respondError(w, http.StatusBadRequest, "format must be json or dat")
+		return
+	}
+
+	rc, _, err := h.blobs.Get(r.Context(), key, nil)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to read waveform")
+		return
+	}
+	defer rc.Close()
+
+	data, err := media.ReadWaveformData(rc)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to read waveform")
+		return
+	}
+
+	// Peaks never change for a given file and zoom
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	respondJSON(w, http.StatusOK, data)
+}
+
+// presignMedia fills in a media file's download URLs
+func presignMedia(ctx context.Context, blobs storage.BlobStore, m *models.Media) error {
+	url, err := blobs.PresignGet(ctx, m.StorageKey, mediaURLTTL)
+	if err != nil {
+		return err
+	}
+	m.URL = url
+
+	if m.PosterKey != nil {
+		if m.PosterURL, err = blobs.PresignGet(ctx, *m.PosterKey, mediaURLTTL); err != nil {
+			return err
+		}
+	}
+	for i := range m.Proxies {
+		p := &m.Proxies[i]
+		if p.URL, err = blobs.PresignGet(ctx, media.ProxyKey(m.DerivedID(), p.Name), mediaURLTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// presignProjectThumbnail fills in a project's thumbnail_url from the
+// poster frame it uses, unless the project has an explicit one
+// A missing thumbnail isn't worth failing the request over, so errors
+// are only logged.
+func presignProjectThumbnail(ctx context.Context, blobs storage.BlobStore, project *models.Project) {
+	if project.ThumbnailURL != nil || project.ThumbnailKey == nil {
+		return
+	}
+	url, err := blobs.PresignGet(ctx, *project.ThumbnailKey, mediaURLTTL)
+	if err != nil {
+		log.Printf("project %s: failed to presign thumbnail: %v", project.ID, err)
+		return
+	}
+	project.ThumbnailURL = &url
+}
@@ -0,0 +1,394 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/effects"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+// Preset limits
+const (
+	maxPresetNameLength = 100 // Matches effect_presets.name VARCHAR(100)
+	maxPresetTags       = 10
+	maxPresetTagLength  = 30
+)
+
+// PresetHandler handles saved effect presets
+type PresetHandler struct {
+	presetRepo *repository.EffectPresetRepository
+	catalog    *effects.Catalog
+}
+
+// NewPresetHandler creates a new preset handler
+func NewPresetHandler(presetRepo *repository.EffectPresetRepository, catalog *effects.Catalog) *PresetHandler {
+	return &PresetHandler{presetRepo: presetRepo, catalog: catalog}
+}
+
+// ForEffect returns the presets of one effect the caller can see, with
+// params for the latest version of the effect or ?version=
+// GET /api/effects/{effectID}/presets?version=1&tag=nostalgic
+//
+// Works without an account too, listing the public presets.
+func (h *PresetHandler) ForEffect(w http.ResponseWriter, r *http.Request) {
+	effectID := chi.URLParam(r, "effectID")
+	version, ok := parseVersionParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.catalog.Get(effectID, version); err != nil {
+		respondEffectLookupError(w, err)
+		return
+	}
+
+	userID := uuid.Nil
+	if id := getUserIDFromContext(r.Context()); id != nil {
+		userID = *id
+	}
+
+	h.respondList(w, r, userID, effectID, version)
+}
+
+// List returns every preset the user can see, with params for the latest
+// version of their effect
+// GET /api/presets?effect_id=memory-fade&tag=nostalgic
+func (h *PresetHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	h.respondList(w, r, *userID, r.URL.Query().Get("effect_id"), 0)
+}
+
+// respondList sends the presets matching the query, mapped to version
+func (h *PresetHandler) respondList(w http.ResponseWriter, r *http.Request, userID uuid.UUID, effectID string, version int) {
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	presets, err := h.presetRepo.List(r.Context(), userID, effectID, tag)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list presets")
+		return
+	}
+
+	for i := range presets {
+		h.mapToVersion(&presets[i], version)
+	}
+
+	respondJSON(w, http.StatusOK, models.EffectPresetListResponse{
+		Presets: presets,
+		Total:   len(presets),
+	})
+}
+
+// Create saves a new preset
+// POST /api/presets
+func (h *PresetHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var req models.CreateEffectPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = models.PresetScopeUser
+	}
+	preset := &models.EffectPreset{
+		CreatedBy:   *userID,
+		EffectID:    req.EffectID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Tags:        req.Tags,
+		Scope:       req.Scope,
+		ProjectID:   req.ProjectID,
+	}
+	if msg := validatePreset(preset); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if !h.setParams(w, preset, req.EffectVersion, req.Params) {
+		return
+	}
+
+	created, err := h.presetRepo.Create(r.Context(), preset)
+	if err != nil {
+		respondPresetError(w, err, "Failed to save preset")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// Get returns a preset, with params for the latest version of its effect
+// or ?version=
+// GET /api/presets/{id}?version=1
+func (h *PresetHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	presetID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid preset ID")
+		return
+	}
+	version, ok := parseVersionParam(w, r)
+	if !ok {
+		return
+	}
+
+	preset, err := h.presetRepo.Get(r.Context(), *userID, presetID)
+	if err != nil {
+		respondPresetError(w, err, "Failed to get preset")
+		return
+	}
+	if version > 0 {
+		if _, err := h.catalog.Get(preset.EffectID, version); err != nil {
+			respondEffectLookupError(w, err)
+			return
+		}
+	}
+
+	h.mapToVersion(preset, version)
+	respondJSON(w, http.StatusOK, preset)
+}
+
+// Update changes a preset (only its creator can)
+// PATCH /api/presets/{id}
+//
+// Sending only effect_version moves the saved params to that version,
+// which is how a preset is upgraded after its effect changed.
+func (h *PresetHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	presetID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid preset ID")
+		return
+	}
+
+	var req models.UpdateEffectPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	preset, err := h.presetRepo.Get(r.Context(), *userID, presetID)
+	if err != nil {
+		respondPresetError(w, err, "Failed to update preset")
+		return
+	}
+	if preset.CreatedBy != *userID {
+		respondError(w, http.StatusForbidden, "Only the creator can change a preset")
+		return
+	}
+
+	if req.Name != nil {
+		preset.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		preset.Description = req.Description
+	}
+	if req.Tags != nil {
+		preset.Tags = req.Tags
+	}
+	if req.Scope != nil {
+		preset.Scope = *req.Scope
+		if preset.Scope != models.PresetScopeTeam {
+			preset.ProjectID = nil
+		}
+	}
+	if req.ProjectID != nil {
+		preset.ProjectID = req.ProjectID
+	}
+	if msg := validatePreset(preset); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	switch {
+	case req.Params != nil:
+		if !h.setParams(w, preset, req.EffectVersion, req.Params) {
+			return
+		}
+	case req.EffectVersion != 0:
+		params, _, err := h.catalog.MapParams(preset.EffectID, preset.EffectVersion, req.EffectVersion, preset.Params)
+		if err != nil {
+			respondEffectLookupError(w, err)
+			return
+		}
+		preset.Params, preset.EffectVersion = params, req.EffectVersion
+	}
+
+	updated, err := h.presetRepo.Update(r.Context(), *userID, preset)
+	if err != nil {
+		respondPresetError(w, err, "Failed to update preset")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// Delete removes a preset (only its creator can)
+// DELETE /api/presets/{id}
+func (h *PresetHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	presetID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid preset ID")
+		return
+	}
+
+	if err := h.presetRepo.Delete(r.Context(), *userID, presetID); err != nil {
+		respondPresetError(w, err, "Failed to delete preset")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setParams checks params against the given version of the preset's
+// effect (0 = latest) and stores them on the preset
+// Writes the error response and returns false if they're not valid.
+func (h *PresetHandler) setParams(w http.ResponseWriter, preset *models.EffectPreset, version int, params map[string]json.RawMessage) bool {
+	def, err := h.catalog.Get(preset.EffectID, version)
+	if err != nil {
+		respondEffectLookupError(w, err)
+		return false
+	}
+
+	if params == nil {
+		params = map[string]json.RawMessage{}
+	}
+	if fields := def.CheckParams(params); len(fields) > 0 {
+		prefixed := make(map[string]string, len(fields))
+		for name, msg := range fields {
+			prefixed["params."+name] = msg
+		}
+		respondFieldErrors(w, "Invalid preset params", prefixed)
+		return false
+	}
+
+	preset.EffectVersion = def.Version
+	preset.Params = params
+	return true
+}
+
+// mapToVersion maps a preset's params to a version of its effect (0 =
+// latest) for display
+// A preset of an effect no longer in the catalog is left as it is.
+func (h *PresetHandler) mapToVersion(preset *models.EffectPreset, version int) {
+	def, err := h.catalog.Get(preset.EffectID, version)
+	if err != nil || def.Version == preset.EffectVersion {
+		return
+	}
+	params, dropped, err := h.catalog.MapParams(preset.EffectID, preset.EffectVersion, def.Version, preset.Params)
+	if err != nil {
+		return
+	}
+	preset.Params = params
+	preset.EffectVersion = def.Version
+	preset.DroppedParams = dropped
+}
+
+// validatePreset checks the fields of a preset other than its params, and
+// tidies up its description (a blank one is none) and tags (trimmed,
+// lowercase, no duplicates)
+// Returns an error message, or "" if valid.
+func validatePreset(p *models.EffectPreset) string {
+	if p.EffectID == "" {
+		return "effect_id is required"
+	}
+	if p.Name == "" {
+		return "Preset name is required"
+	}
+	if len(p.Name) > maxPresetNameLength {
+		return fmt.Sprintf("Preset name must be at most %d characters", maxPresetNameLength)
+	}
+	if p.Description != nil && strings.TrimSpace(*p.Description) == "" {
+		p.Description = nil
+	}
+
+	switch {
+	case !models.ValidPresetScope(p.Scope):
+		return "scope must be user, team or public"
+	case p.Scope == models.PresetScopeTeam && p.ProjectID == nil:
+		return "A team preset needs a project_id"
+	case p.Scope != models.PresetScopeTeam && p.ProjectID != nil:
+		return "project_id is only for team presets"
+	}
+
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range p.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxPresetTagLength {
+			return fmt.Sprintf("Tags must be 1 to %d characters", maxPresetTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxPresetTags {
+		return fmt.Sprintf("A preset can have at most %d tags", maxPresetTags)
+	}
+	p.Tags = tags
+
+	return ""
+}
+
+// parseVersionParam reads the optional ?version= query parameter (0 if
+// absent); writes a 400 and returns false if it's not a version
+func parseVersionParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("version")
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		respondError(w, http.StatusBadRequest, "version must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// respondPresetError maps repository errors to HTTP responses
+func respondPresetError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrPresetNotFound):
+		respondError(w, http.StatusNotFound, "Preset not found")
+	case errors.Is(err, repository.ErrProjectNotFound):
+		respondError(w, http.StatusNotFound, "Project not found")
+	case errors.Is(err, repository.ErrNotAuthorized):
+		respondError(w, http.StatusForbidden, "You need edit access to share presets with this project")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -3,24 +3,29 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"tempo/internal/effects"
 	"tempo/internal/models"
 	"tempo/internal/repository"
+	"tempo/internal/storage"
 )
 
 // ProjectHandler handles project CRUD operations
 type ProjectHandler struct {
 	projectRepo *repository.ProjectRepository
+	blobs       storage.BlobStore // For thumbnail URLs
+	catalog     *effects.Catalog  // For pinning the effects a timeline uses
 }
 
 // NewProjectHandler creates a new project handler
-func NewProjectHandler(projectRepo *repository.ProjectRepository) *ProjectHandler {
-	return &ProjectHandler{projectRepo: projectRepo}
+func NewProjectHandler(projectRepo *repository.ProjectRepository, blobs storage.BlobStore, catalog *effects.Catalog) *ProjectHandler {
+	return &ProjectHandler{projectRepo: projectRepo, blobs: blobs, catalog: catalog}
 }
 
 // Create creates a new project
@@ -54,6 +59,18 @@ func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 // List returns all projects the user has access to
 // GET /api/projects
+//
+// Query parameters (all optional):
+//   q         - full-text search over name and description
+//   role      - owner, editor or viewer
+//   owner_id  - only projects owned by this user
+//   folder_id - only projects in one of your folders ("none" = unfiled)
+//   tag_id    - only projects with this tag
+//   sort      - name, created or updated (default)
+//   order     - asc or desc
+//   cursor    - next_cursor from the previous page
+//   page      - offset pagination for older clients (ignored with cursor)
+//   per_page  - page size, 1-100 (default 20)
 func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID := getUserIDFromContext(r.Context())
 	if userID == nil {
@@ -61,33 +78,93 @@ func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+
 	// Parse pagination parameters
 	page := 1
 	perPage := 20 // default
 
-	if p := r.URL.Query().Get("page"); p != "" {
+	if p := query.Get("page"); p != "" {
 		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
 			page = parsed
 		}
 	}
 
-	if pp := r.URL.Query().Get("per_page"); pp != "" {
+	if pp := query.Get("per_page"); pp != "" {
 		if parsed, err := strconv.Atoi(pp); err == nil && parsed > 0 && parsed <= 100 {
 			perPage = parsed
 		}
 	}
 
-	projects, totalCount, err := h.projectRepo.ListByUser(r.Context(), *userID, page, perPage)
+	opts := repository.ProjectListOptions{
+		Search:  query.Get("q"),
+		Role:    query.Get("role"),
+		Sort:    query.Get("sort"),
+		Order:   query.Get("order"),
+		Cursor:  query.Get("cursor"),
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	if opts.Role != "" && opts.Role != models.RoleOwner && opts.Role != models.RoleEditor && opts.Role != models.RoleViewer {
+		respondError(w, http.StatusBadRequest, "Invalid role filter")
+		return
+	}
+
+	if owner := query.Get("owner_id"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid owner ID")
+			return
+		}
+		opts.OwnerID = &ownerID
+	}
+
+	if folder := query.Get("folder_id"); folder == "none" {
+		opts.Unfiled = true
+	} else if folder != "" {
+		folderID, err := uuid.Parse(folder)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid folder ID")
+			return
+		}
+		opts.FolderID = &folderID
+	}
+
+	if tag := query.Get("tag_id"); tag != "" {
+		tagID, err := uuid.Parse(tag)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid tag ID")
+			return
+		}
+		opts.TagID = &tagID
+	}
+
+	result, err := h.projectRepo.ListByUser(r.Context(), *userID, opts)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to list projects")
 		return
 	}
 
+	for i := range result.Projects {
+		presignProjectThumbnail(r.Context(), h.blobs, &result.Projects[i])
+	}
+
+	// A cursor page has no page number: ?page= is ignored, so don't echo it
+	if opts.Cursor != "" {
+		page = 1
+	}
+
 	respondJSON(w, http.StatusOK, models.ProjectListResponse{
-		Projects:   projects,
-		TotalCount: totalCount,
+		Projects:   result.Projects,
+		TotalCount: result.TotalCount,
 		Page:       page,
 		PerPage:    perPage,
+		NextCursor: result.NextCursor,
 	})
 }
 
@@ -125,6 +202,7 @@ func (h *ProjectHandler) Get(w http.ResponseWriter, r *http.Request) {
 		project.Collaborators = collaborators
 	}
 
+	presignProjectThumbnail(r.Context(), h.blobs, project)
 	respondJSON(w, http.StatusOK, project)
 }
 
@@ -164,9 +242,168 @@ func (h *ProjectHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	presignProjectThumbnail(r.Context(), h.blobs, project)
+	respondJSON(w, http.StatusOK, project)
+}
+
+// maxSettingsPatchSize caps the settings PATCH body
+// Settings are a handful of fields - anything bigger is a mistake or abuse
+const maxSettingsPatchSize = 64 << 10
+
+// UpdateSettings changes project settings using JSON merge patch (RFC 7386)
+// PATCH /api/projects/{id}/settings
+// Content-Type: application/merge-patch+json (application/json also accepted)
+// Body: only the fields to change, null resets a field to its default
+//   { "frame_rate": 24, "canvas": { "width": 3840, "height": 2160 } }
+func (h *ProjectHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectIDStr := chi.URLParam(r, "id")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsPatchSize))
+	if err != nil || !json.Valid(patch) {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project, err := h.projectRepo.UpdateSettings(r.Context(), projectID, *userID, func(current models.ProjectSettings) (models.ProjectSettings, error) {
+		return current.ApplyPatch(patch)
+	})
+	if err != nil {
+		var settingsErr *models.SettingsError
+		if errors.As(err, &settingsErr) {
+			respondFieldErrors(w, "Invalid settings", settingsErr.Fields)
+			return
+		}
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNotAuthorized) {
+			respondError(w, http.StatusForbidden, "Not authorized to edit this project")
+			return
+		}
+		if errors.Is(err, models.ErrSettingsFromFuture) {
+			respondError(w, http.StatusConflict, "Settings were saved by a newer version of Tempo")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update settings")
+		return
+	}
+
+	presignProjectThumbnail(r.Context(), h.blobs, project)
 	respondJSON(w, http.StatusOK, project)
 }
 
+// maxTimelineSize caps the timeline PUT body
+const maxTimelineSize = 5 << 20
+
+// GetTimeline returns the project's timeline
+// GET /api/projects/{id}/timeline
+func (h *ProjectHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectIDStr := chi.URLParam(r, "id")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	timeline, err := h.projectRepo.GetTimeline(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get timeline")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, timeline)
+}
+
+// UpdateTimeline replaces the project's timeline
+// PUT /api/projects/{id}/timeline
+func (h *ProjectHandler) UpdateTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectIDStr := chi.URLParam(r, "id")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var timeline models.Timeline
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTimelineSize)).Decode(&timeline); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := timeline.Validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	timeline.Normalize()
+
+	// Params are checked against the effect versions the project is
+	// pinned to (the latest for effects it hasn't used yet)
+	pinned, err := h.projectRepo.GetEffectVersions(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update timeline")
+		return
+	}
+	if err := h.catalog.CheckParams(&timeline, pinned); err != nil {
+		var paramErr *effects.ParamError
+		if errors.As(err, &paramErr) {
+			respondFieldErrors(w, "Invalid effect params", paramErr.Fields)
+			return
+		}
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// Effects used for the first time get pinned to the current version
+	pins := h.catalog.LatestPins(timeline.EffectIDs())
+	err = h.projectRepo.UpdateTimeline(r.Context(), projectID, *userID, timeline, pins)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNotAuthorized) {
+			respondError(w, http.StatusForbidden, "Not authorized to edit this project")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update timeline")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, timeline)
+}
+
 // Delete removes a project
 // DELETE /api/projects/{id}
 func (h *ProjectHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+// SceneHandler serves the shot boundaries found by the scenes job
+type SceneHandler struct {
+	mediaRepo   *repository.MediaRepository
+	projectRepo *repository.ProjectRepository
+	threshold   float64 // Used when the request doesn't give one
+}
+
+// NewSceneHandler creates a new scene handler
+// A default threshold outside 0.1-1 is replaced by media.DefaultSceneThreshold.
+func NewSceneHandler(mediaRepo *repository.MediaRepository, projectRepo *repository.ProjectRepository, threshold float64) *SceneHandler {
+	if threshold < media.SceneMinScore || threshold > 1 {
+		threshold = media.DefaultSceneThreshold
+	}
+	return &SceneHandler{
+		mediaRepo:   mediaRepo,
+		projectRepo: projectRepo,
+		threshold:   threshold,
+	}
+}
+
+// VideoScenes is the response of GET /api/videos/{id}/scenes
+type VideoScenes struct {
+	Threshold float64              `json:"threshold"`
+	Markers   []models.SceneMarker `json:"markers"`
+}
+
+// ProjectScenes is the response of GET /api/projects/{id}/scenes
+type ProjectScenes struct {
+	Threshold float64           `json:"threshold"`
+	Points    []media.SnapPoint `json:"points"`
+}
+
+// Get returns a video's shot boundaries, in source time
+// GET /api/videos/{id}/scenes?threshold=0.3
+//
+// threshold (0.1-1) is how different a frame must be from the previous
+// one to count as a cut; higher finds fewer, harder cuts. 404 until the
+// scenes job has finished.
+func (h *SceneHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	mediaID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	threshold, err := h.parseThreshold(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	m, err := h.mediaRepo.GetByID(r.Context(), mediaID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMediaNotFound) {
+			respondError(w, http.StatusNotFound, "Video not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get video")
+		return
+	}
+	if m.Scenes == nil {
+		respondError(w, http.StatusNotFound, "Scene detection is not ready")
+		return
+	}
+
+	markers, err := h.mediaRepo.SceneMarkers(r.Context(), []uuid.UUID{m.ID}, threshold)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get scenes")
+		return
+	}
+
+	scenes := VideoScenes{Threshold: threshold, Markers: markers[m.ID]}
+	if scenes.Markers == nil {
+		scenes.Markers = []models.SceneMarker{}
+	}
+	respondJSON(w, http.StatusOK, scenes)
+}
+
+// ForProject returns the shot boundaries inside the project's media
+// clips, in timeline time, for clips and effects to snap to
+// GET /api/projects/{id}/scenes?threshold=0.3
+//
+// Clips whose video hasn't been analyzed yet just have no points.
+func (h *SceneHandler) ForProject(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	threshold, err := h.parseThreshold(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timeline, err := h.projectRepo.GetTimeline(r.Context(), projectID, *userID)
+	if err != nil {
+		respondProjectLookupError(w, err)
+		return
+	}
+
+	// Only files the project may use: the timeline is client-written JSON
+	// (see MediaRepository.ListForProject)
+	files, err := h.mediaRepo.ListForProject(r.Context(), projectID, timeline.MediaIDs())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get scenes")
+		return
+	}
+	mediaIDs := make([]uuid.UUID, 0, len(files))
+	for _, m := range files {
+		mediaIDs = append(mediaIDs, m.ID)
+	}
+
+	markers, err := h.mediaRepo.SceneMarkers(r.Context(), mediaIDs, threshold)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get scenes")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ProjectScenes{
+		Threshold: threshold,
+		Points:    media.TimelineScenes(timeline, markers),
+	})
+}
+
+// parseThreshold reads ?threshold=, defaulting to the configured one
+func (h *SceneHandler) parseThreshold(r *http.Request) (float64, error) {
+	value := r.URL.Query().Get("threshold")
+	if value == "" {
+		return h.threshold, nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < media.SceneMinScore || threshold > 1 {
+		return 0, fmt.Errorf("threshold must be between %g and 1", media.SceneMinScore)
+	}
+	return threshold, nil
+}
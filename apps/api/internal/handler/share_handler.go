@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/auth"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// shareTokenPrefixLength is how much of a token we keep in clear text
+// Enough for an owner to tell their links apart, useless to an attacker
+const shareTokenPrefixLength = 6
+
+// SharePasswordHeader carries the password for protected share links
+// A header rather than a query parameter so it doesn't end up in logs
+const SharePasswordHeader = "X-Share-Password"
+
+// ShareHandler manages and serves public read-only share links
+type ShareHandler struct {
+	shareRepo   *repository.ShareLinkRepository
+	projectRepo *repository.ProjectRepository
+	mediaRepo   *repository.MediaRepository
+	blobs       storage.BlobStore
+	frontendURL string
+}
+
+// NewShareHandler creates a new share handler
+func NewShareHandler(shareRepo *repository.ShareLinkRepository, projectRepo *repository.ProjectRepository, mediaRepo *repository.MediaRepository, blobs storage.BlobStore, frontendURL string) *ShareHandler {
+	return &ShareHandler{
+		shareRepo:   shareRepo,
+		projectRepo: projectRepo,
+		mediaRepo:   mediaRepo,
+		blobs:       blobs,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+// Create makes a new share link (owner only)
+// POST /api/projects/{id}/share-links
+// Body: { "expires_at": "2025-01-01T00:00:00Z", "password": "..." } (both optional)
+func (h *ShareHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, projectID, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest, "Expiry must be in the future")
+		return
+	}
+
+	var passwordHash *string
+	if req.Password != nil {
+		if err := auth.PasswordMeetsRequirements(*req.Password); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		hash, err := auth.HashPassword(*req.Password)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		passwordHash = &hash
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	link, err := h.shareRepo.Create(r.Context(), projectID, userID, tokenHash, token[:shareTokenPrefixLength], passwordHash, req.ExpiresAt)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, models.CreateShareLinkResponse{
+		ShareLink: *link,
+		Token:     token,
+		URL:       h.frontendURL + "/share/" + token,
+	})
+}
+
+// List returns all of a project's share links (owner only)
+// GET /api/projects/{id}/share-links
+func (h *ShareHandler) List(w http.ResponseWriter, r *http.Request) {
+	_, projectID, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := h.shareRepo.ListByProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list share links")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, links)
+}
+
+// Revoke disables a share link (owner only)
+// DELETE /api/projects/{id}/share-links/{linkID}
+func (h *ShareHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	_, projectID, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := uuid.Parse(chi.URLParam(r, "linkID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid share link ID")
+		return
+	}
+
+	if err := h.shareRepo.Revoke(r.Context(), projectID, linkID); err != nil {
+		if errors.Is(err, repository.ErrShareLinkNotFound) {
+			respondError(w, http.StatusNotFound, "Share link not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to revoke share link")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// View returns a shared project, read-only
+// GET /api/share/{token}
+// Header: X-Share-Password (only for password-protected links)
+//
+// Public route (OptionalAuth). Logged-in collaborators opening their own
+// link don't count as views.
+func (h *ShareHandler) View(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	link, err := h.shareRepo.GetByTokenHash(r.Context(), auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrShareLinkNotFound) {
+			respondError(w, http.StatusNotFound, "Share link not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to open share link")
+		return
+	}
+
+	// Expired and revoked links look exactly like missing ones
+	if !link.IsActive(time.Now()) {
+		respondError(w, http.StatusNotFound, "Share link not found")
+		return
+	}
+
+	if link.PasswordHash != nil {
+		password := r.Header.Get(SharePasswordHeader)
+		if password == "" {
+			respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error":             "Password required",
+				"password_required": true,
+			})
+			return
+		}
+		if err := auth.VerifyPassword(password, *link.PasswordHash); err != nil {
+			respondError(w, http.StatusUnauthorized, "Incorrect password")
+			return
+		}
+	}
+
+	project, timeline, err := h.projectRepo.GetShared(r.Context(), link.ProjectID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Share link not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to open share link")
+		return
+	}
+
+	media, err := h.mediaRepo.ListForProject(r.Context(), link.ProjectID, timeline.MediaIDs())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to open share link")
+		return
+	}
+
+	presignProjectThumbnail(r.Context(), h.blobs, project)
+	shared := models.SharedProject{
+		Name:         project.Name,
+		Description:  project.Description,
+		ThumbnailURL: project.ThumbnailURL,
+		Settings:     project.Settings,
+		Timeline:     *timeline,
+		Media:        []models.SharedMedia{},
+		UpdatedAt:    project.UpdatedAt,
+	}
+	for i := range media {
+		m := &media[i]
+		if err := presignMedia(r.Context(), h.blobs, m); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to open share link")
+			return
+		}
+		shared.Media = append(shared.Media, models.SharedMedia{
+			ID:          m.ID,
+			Kind:        m.Kind,
+			ContentType: m.ContentType,
+			Duration:    m.Duration,
+			Width:       m.Width,
+			Height:      m.Height,
+			URL:         m.URL,
+			PosterURL:   m.PosterURL,
+		})
+	}
+
+	if !h.isCollaborator(r, link.ProjectID) {
+		if err := h.shareRepo.RecordView(r.Context(), link.ID); err != nil {
+			// Never fail the page over a counter
+			log.Printf("failed to record share link view %s: %v", link.ID, err)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, shared)
+}
+
+// isCollaborator reports whether the (optional) logged-in user is on the project
+func (h *ShareHandler) isCollaborator(r *http.Request, projectID uuid.UUID) bool {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		return false
+	}
+	_, err := h.projectRepo.GetByID(r.Context(), projectID, *userID)
+	return err == nil
+}
+
+// requireOwner checks auth, parses {id} and verifies the user can manage
+// the project. On failure it has already written the response.
+func (h *ShareHandler) requireOwner(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	project, err := h.projectRepo.GetByID(r.Context(), projectID, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProjectNotFound) {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return uuid.Nil, uuid.Nil, false
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to verify access")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if !models.CanManage(project.Role) {
+		respondError(w, http.StatusForbidden, "Only the owner can manage share links")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return *userID, projectID, true
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+// maxTagNameLength matches tags.name VARCHAR(50)
+const maxTagNameLength = 50
+
+// hexColorPattern accepts CSS-style "#rrggbb" colors
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// TagHandler handles project tags
+type TagHandler struct {
+	tagRepo *repository.TagRepository
+}
+
+// NewTagHandler creates a new tag handler
+func NewTagHandler(tagRepo *repository.TagRepository) *TagHandler {
+	return &TagHandler{tagRepo: tagRepo}
+}
+
+// List returns every tag the user can see
+// GET /api/tags
+func (h *TagHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	tags, err := h.tagRepo.List(r.Context(), *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list tags")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tags)
+}
+
+// Create makes a new tag
+// POST /api/tags
+func (h *TagHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var req models.CreateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if msg := validateTag(&req.Name, req.Color); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	tag, err := h.tagRepo.Create(r.Context(), *userID, req.Name, req.Color)
+	if err != nil {
+		h.respondTagError(w, err, "Failed to create tag")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, tag)
+}
+
+// Update renames or recolors a tag
+// PATCH /api/tags/{id}
+func (h *TagHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	tagID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	var req models.UpdateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		req.Name = &name
+	}
+	if msg := validateTag(req.Name, req.Color); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	tag, err := h.tagRepo.Update(r.Context(), *userID, tagID, req.Name, req.Color)
+	if err != nil {
+		h.respondTagError(w, err, "Failed to update tag")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tag)
+}
+
+// Delete removes a tag from every project
+// DELETE /api/tags/{id}
+func (h *TagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	tagID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	if err := h.tagRepo.Delete(r.Context(), *userID, tagID); err != nil {
+		h.respondTagError(w, err, "Failed to delete tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddToProject attaches a tag to a project
+// POST /api/projects/{id}/tags
+// Body: { "tag_id": "..." }
+func (h *TagHandler) AddToProject(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var req models.AddProjectTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.tagRepo.AddToProject(r.Context(), *userID, projectID, req.TagID); err != nil {
+		h.respondTagError(w, err, "Failed to tag project")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFromProject detaches a tag from a project
+// DELETE /api/projects/{id}/tags/{tagID}
+func (h *TagHandler) RemoveFromProject(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	if err := h.tagRepo.RemoveFromProject(r.Context(), *userID, projectID, tagID); err != nil {
+		h.respondTagError(w, err, "Failed to untag project")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateTag checks optional name/color fields, returning an error message
+func validateTag(name, color *string) string {
+	if name != nil && (*name == "" || len(*name) > maxTagNameLength) {
+		return "Tag name is required (max 50 characters)"
+	}
+	if color != nil && !hexColorPattern.MatchString(*color) {
+		return "Tag color must look like #rrggbb"
+	}
+	return ""
+}
+
+// respondTagError maps repository errors to HTTP responses
+func (h *TagHandler) respondTagError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrTagNotFound):
+		respondError(w, http.StatusNotFound, "Tag not found")
+	case errors.Is(err, repository.ErrTagExists):
+		respondError(w, http.StatusConflict, "A tag with this name already exists")
+	case errors.Is(err, repository.ErrProjectNotFound):
+		respondError(w, http.StatusNotFound, "Project not found")
+	case errors.Is(err, repository.ErrNotAuthorized):
+		respondError(w, http.StatusForbidden, "Not authorized to edit this project")
+	default:
+		respondError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,548 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"tempo/internal/media"
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// Resumable uploads - the tus 1.0 protocol (https://tus.io/protocols/resumable-upload)
+//
+// WHY?
+// A plain multipart upload is all-or-nothing: drop the connection at 90%
+// of a 450MB clip and you start over. With tus the client first creates an
+// upload (POST), then sends the bytes in one or more PATCH requests. If a
+// request dies, the client asks how far we got (HEAD) and continues from
+// there. Off-the-shelf clients exist (tus-js-client, Uppy).
+//
+// Supported extensions: creation, termination, expiration.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+
+	// tusUploadTTL is how long an upload survives without progress
+	// Each PATCH pushes the expiry forward.
+	tusUploadTTL = 24 * time.Hour
+)
+
+// MediaIDHeader tells the client which media file a finished upload became
+const MediaIDHeader = "Upload-Media-Id"
+
+// TusHeaders are the request headers tus clients send (for CORS)
+var TusHeaders = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+
+// TusExposedHeaders are the response headers tus clients read (for CORS)
+var TusExposedHeaders = []string{
+	"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+	"Upload-Length", "Upload-Offset", "Upload-Expires", MediaIDHeader,
+}
+
+// UploadHandler implements the tus protocol on top of the blob store
+type UploadHandler struct {
+	uploadRepo  *repository.UploadRepository
+	projectRepo *repository.ProjectRepository
+	blobs       storage.BlobStore
+	ingestor    *media.Ingestor
+}
+
+// NewUploadHandler creates a new upload handler
+func NewUploadHandler(uploadRepo *repository.UploadRepository, projectRepo *repository.ProjectRepository, blobs storage.BlobStore, ingestor *media.Ingestor) *UploadHandler {
+	return &UploadHandler{
+		uploadRepo:  uploadRepo,
+		projectRepo: projectRepo,
+		blobs:       blobs,
+		ingestor:    ingestor,
+	}
+}
+
+// Options advertises what the server supports
+// OPTIONS /api/uploads
+// Public: clients call it before they have a token.
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts an upload
+// POST /api/uploads
+// Headers: Upload-Length (required),
+// Upload-Metadata: "filename <base64>,filetype <base64>,project_id <base64>,sha256 <base64>"
+//
+// sha256 (hex, optional) is the hash of the whole file. If the user can
+// already see a file with that content, the upload is created complete
+// (Upload-Offset equals Upload-Length, Upload-Media-Id is set) and no
+// bytes need to be sent, like POST /api/videos/from-hash.
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		// We don't support Upload-Defer-Length: the size must be known
+		respondError(w, http.StatusBadRequest, "Upload-Length header is required")
+		return
+	}
+	if length > maxUploadSize {
+		respondError(w, http.StatusRequestEntityTooLarge, "File too large (max 500MB)")
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid Upload-Metadata header")
+		return
+	}
+
+	// Check everything we can now rather than after 500MB have arrived
+	contentType := metadata["filetype"]
+	if !media.DeclarableType(contentType) {
+		respondError(w, http.StatusUnsupportedMediaType, "Unsupported file format. Supported: "+media.SupportedFormatNames())
+		return
+	}
+
+	upload := &models.Upload{
+		OwnerID:     userID,
+		Filename:    metadata["filename"],
+		ContentType: contentType,
+		Length:      length,
+		ExpiresAt:   time.Now().Add(tusUploadTTL),
+	}
+	if upload.Filename == "" {
+		upload.Filename = "upload"
+	}
+
+	if raw := metadata["project_id"]; raw != "" {
+		projectID, err := uuid.Parse(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid project ID")
+			return
+		}
+		project, err := h.projectRepo.GetByID(r.Context(), projectID, userID)
+		if err != nil {
+			respondProjectLookupError(w, err)
+			return
+		}
+		if !models.CanEdit(project.Role) {
+			respondError(w, http.StatusForbidden, "You don't have permission to add videos to this project")
+			return
+		}
+		upload.ProjectID = &projectID
+	}
+
+	if sum := metadata["sha256"]; sum != "" {
+		if !isSHA256(sum) {
+			respondError(w, http.StatusBadRequest, "sha256 metadata must be 64 hex characters")
+			return
+		}
+		linked, err := h.ingestor.Link(r.Context(), sum, media.IngestRequest{
+			OwnerID:   userID,
+			ProjectID: upload.ProjectID,
+			Filename:  metadata["filename"],
+			Size:      length,
+		})
+		if err == nil {
+			h.createLinked(w, r, upload, linked)
+			return
+		}
+		if !errors.Is(err, repository.ErrMediaNotFound) {
+			respondIngestError(w, err)
+			return
+		}
+	}
+
+	if err := h.ingestor.CheckQuota(r.Context(), userID, upload.ProjectID, length); err != nil {
+		respondIngestError(w, err)
+		return
+	}
+
+	created, err := h.uploadRepo.Create(r.Context(), upload)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+created.ID.String())
+	w.Header().Set("Upload-Expires", created.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// createLinked records an upload that Link already completed
+func (h *UploadHandler) createLinked(w http.ResponseWriter, r *http.Request, upload *models.Upload, linked *models.Media) {
+	created, err := h.uploadRepo.CreateLinked(r.Context(), upload, linked.ID)
+	if err != nil {
+		h.discardMedia(r.Context(), linked)
+		respondError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+created.ID.String())
+	writeUploadState(w, created)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head reports how many bytes we have
+// HEAD /api/uploads/{id}
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	upload, ok := h.load(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// The offset changes with every PATCH - never cache it
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.MediaID != nil {
+		w.Header().Set(MediaIDHeader, upload.MediaID.String())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends bytes at Upload-Offset
+// PATCH /api/uploads/{id}
+// Headers: Upload-Offset, Content-Type: application/offset+octet-stream
+//
+// If the connection drops halfway, the bytes that DID arrive are kept, so
+// the client's next HEAD shows real progress. The last chunk assembles the
+// file into the blob store and creates the media record.
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondError(w, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	upload, ok := h.load(w, r, userID)
+	if !ok {
+		return
+	}
+	if upload.MediaID != nil {
+		// Already finished (e.g. created from a known hash): whatever the
+		// client sends, tell it everything has arrived
+		writeUploadState(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if offset != upload.Offset {
+		respondError(w, http.StatusConflict, "Upload-Offset does not match the current offset")
+		return
+	}
+
+	remaining := upload.Length - upload.Offset
+	if r.ContentLength > remaining {
+		respondError(w, http.StatusRequestEntityTooLarge, "Chunk is larger than the rest of the upload")
+		return
+	}
+
+	if remaining > 0 {
+		upload, err = h.storePart(w, r, upload, remaining)
+		if err != nil {
+			if errors.Is(err, repository.ErrOffsetMismatch) {
+				respondError(w, http.StatusConflict, "Upload-Offset does not match the current offset")
+				return
+			}
+			respondError(w, http.StatusInternalServerError, "Failed to store chunk")
+			return
+		}
+	}
+
+	if upload.IsComplete() && upload.MediaID == nil {
+		created, err := h.finish(r.Context(), upload)
+		if err != nil {
+			if media.IsRejection(err) {
+				// Retrying won't help - throw the upload away
+				if _, delErr := h.uploadRepo.Delete(r.Context(), upload.ID, userID); delErr != nil {
+					log.Printf("upload %s: failed to delete: %v", upload.ID, delErr)
+				}
+				h.deleteParts(upload.PartKeys)
+				respondIngestError(w, err)
+				return
+			}
+			if errors.Is(err, media.ErrQuotaExceeded) {
+				// Kept like any failed assembly: after deleting some
+				// files the client can retry
+				respondIngestError(w, err)
+				return
+			}
+			log.Printf("upload %s: failed to assemble: %v", upload.ID, err)
+			// The parts are still there: the client can retry with an
+			// empty PATCH at the final offset
+			respondError(w, http.StatusInternalServerError, "Failed to assemble upload")
+			return
+		}
+		upload.MediaID = &created.ID
+	}
+
+	writeUploadState(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadState sets the headers telling a client where an upload is
+func writeUploadState(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.MediaID != nil {
+		w.Header().Set(MediaIDHeader, upload.MediaID.String())
+	}
+}
+
+// Delete cancels an upload and throws away its chunks
+// DELETE /api/uploads/{id}
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid upload ID")
+		return
+	}
+
+	upload, err := h.uploadRepo.Delete(r.Context(), uploadID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUploadNotFound) {
+			respondError(w, http.StatusNotFound, "Upload not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to delete upload")
+		return
+	}
+
+	h.deleteParts(upload.PartKeys)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeExpired deletes uploads nobody has touched for tusUploadTTL
+// Run periodically from main. Returns how many were removed.
+func (h *UploadHandler) PurgeExpired(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		uploads, err := h.uploadRepo.DeleteExpired(ctx, time.Now(), 100)
+		if err != nil {
+			return total, err
+		}
+		for _, upload := range uploads {
+			h.deleteParts(upload.PartKeys)
+		}
+		total += len(uploads)
+		if len(uploads) < 100 {
+			return total, nil
+		}
+	}
+}
+
+// storePart streams the request body into a new part blob and records it
+func (h *UploadHandler) storePart(w http.ResponseWriter, r *http.Request, upload *models.Upload, remaining int64) (*models.Upload, error) {
+	// Chunks can take far longer than the server's read timeout
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	// Keep going even if the request context is cancelled (client gone,
+	// timeout middleware): saving what arrived is the whole point
+	ctx := context.WithoutCancel(r.Context())
+
+	body := &partialReader{r: io.LimitReader(r.Body, remaining)}
+	key := storage.UploadPartKey(upload.ID, uuid.New())
+
+	info, err := h.blobs.Put(ctx, key, body, storage.PutOptions{
+		ContentType: "application/octet-stream",
+		Size:        -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if body.err != nil {
+		log.Printf("upload %s: chunk interrupted after %d bytes: %v", upload.ID, info.Size, body.err)
+	}
+	if info.Size == 0 {
+		h.deleteParts([]string{key})
+		return upload, nil
+	}
+
+	updated, err := h.uploadRepo.AppendPart(ctx, upload.ID, upload.Offset, info.Size, key, time.Now().Add(tusUploadTTL))
+	if err != nil {
+		h.deleteParts([]string{key})
+		return nil, err
+	}
+	return updated, nil
+}
+
+// finish stitches the parts into one media file and records it
+func (h *UploadHandler) finish(ctx context.Context, upload *models.Upload) (*models.Media, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	parts := storage.NewConcatReader(ctx, h.blobs, upload.PartKeys)
+	defer parts.Close()
+
+	created, err := h.ingestor.Ingest(ctx, parts, media.IngestRequest{
+		OwnerID:     upload.OwnerID,
+		ProjectID:   upload.ProjectID,
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Size:        upload.Length,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created.Size != upload.Length {
+		err = fmt.Errorf("assembled %d bytes, expected %d", created.Size, upload.Length)
+	} else {
+		// Fails if another request finished the same upload first
+		err = h.uploadRepo.Complete(ctx, upload.ID, created.ID)
+	}
+	if err != nil {
+		h.discardMedia(ctx, created)
+		return nil, err
+	}
+
+	h.deleteParts(upload.PartKeys)
+	return created, nil
+}
+
+// discardMedia removes a media file that shouldn't have been created
+func (h *UploadHandler) discardMedia(ctx context.Context, m *models.Media) {
+	if _, err := h.ingestor.Remove(ctx, m.ID, m.OwnerID); err != nil {
+		log.Printf("failed to remove media %s: %v", m.ID, err)
+	}
+}
+
+// begin checks auth and the Tus-Resumable header, and sets the response
+// Tus-Resumable header that every tus response must carry
+func (h *UploadHandler) begin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return uuid.Nil, false
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondError(w, http.StatusPreconditionFailed, "Unsupported tus version")
+		return uuid.Nil, false
+	}
+
+	return *userID, true
+}
+
+// load parses {id} and fetches the user's upload
+// Expired uploads answer 410 Gone, as the expiration extension requires.
+func (h *UploadHandler) load(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*models.Upload, bool) {
+	uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid upload ID")
+		return nil, false
+	}
+
+	upload, err := h.uploadRepo.GetByID(r.Context(), uploadID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUploadNotFound) {
+			respondError(w, http.StatusNotFound, "Upload not found")
+			return nil, false
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to get upload")
+		return nil, false
+	}
+
+	if upload.MediaID == nil && time.Now().After(upload.ExpiresAt) {
+		respondError(w, http.StatusGone, "Upload expired")
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// deleteParts removes blobs that are no longer needed
+// Failures only waste space, so they're logged rather than returned.
+func (h *UploadHandler) deleteParts(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, key := range keys {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2"
+// Values are optional ("key" alone means an empty value).
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, errors.New("invalid metadata pair")
+		}
+	}
+
+	return metadata, nil
+}
+
+// partialReader turns a read error into a clean EOF
+// A dropped connection then still leaves us with the bytes that arrived
+// instead of failing the whole chunk. The error is kept for logging.
+type partialReader struct {
+	r   io.Reader
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"tempo/internal/media"
+)
+
+// UsageHandler reports storage usage against the quotas
+type UsageHandler struct {
+	quotas *media.Quotas
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(quotas *media.Quotas) *UsageHandler {
+	return &UsageHandler{quotas: quotas}
+}
+
+// Get returns how much space the user's files take up
+// GET /api/me/usage
+//
+// Broken down by kind (uploads, proxies, HLS renditions) and by project,
+// with the largest files, so people can see what to delete. A file
+// marked "shared" is also used by other videos: deleting it frees only
+// its proxies and renditions.
+func (h *UsageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromContext(r.Context())
+	if userID == nil {
+		respondError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	usage, err := h.quotas.Usage(r.Context(), *userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get storage usage")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, usage)
+}
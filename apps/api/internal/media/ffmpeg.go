@@ -0,0 +1,66 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+var ErrFFmpegUnavailable = errors.New("ffmpeg not available")
+
+// stderrTail is how much of ffmpeg's error output ends up in job errors
+// The useful line is the last one; the rest is banner and stream info.
+const stderrTail = 500
+
+// FFmpeg runs the ffmpeg binary
+type FFmpeg struct {
+	path string
+}
+
+// NewFFmpeg finds the ffmpeg binary
+// binary may be a name on $PATH ("ffmpeg") or an absolute path.
+func NewFFmpeg(binary string) (*FFmpeg, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFFmpegUnavailable, err)
+	}
+	return &FFmpeg{path: path}, nil
+}
+
+// Run runs ffmpeg with the given arguments
+// "-hide_banner -nostdin -v error" are always added, so the error (if
+// any) is just the message ffmpeg printed.
+func (f *FFmpeg) Run(ctx context.Context, args ...string) error {
+	return f.Output(ctx, nil, args...)
+}
+
+// Output runs ffmpeg with its standard output going to stdout
+// For output "pipe:1", so results can be processed as they're decoded
+// instead of going through a temp file.
+func (f *FFmpeg) Output(ctx context.Context, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, f.path, append([]string{"-hide_banner", "-nostdin", "-v", "error"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > stderrTail {
+			msg = "..." + msg[len(msg)-stderrTail:]
+		}
+		return fmt.Errorf("ffmpeg: %v: %s", err, msg)
+	}
+	return nil
+}
+
+// formatSeconds formats a time offset for ffmpeg's -ss / -t options
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,177 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+var (
+	ErrFrameOutOfRange = errors.New("time is outside the video")
+	ErrNoFrame         = errors.New("no frame at that time")
+)
+
+// Frame settings
+const (
+	// FrameMinWidth is the narrowest frame that can be asked for
+	FrameMinWidth = 16
+
+	// FrameCacheTTL is how long an extracted frame is kept
+	// Frames are cheap to make again, so the cleanup (see GC) drops them
+	// after this long instead of letting every scrubbed timestamp pile up.
+	FrameCacheTTL = 7 * 24 * time.Hour
+
+	// frameConcurrency caps the ffmpeg processes extracting frames at once
+	// They run while a request waits, next to the background jobs.
+	frameConcurrency = 4
+)
+
+// FrameFormat is an image format frames can be extracted as
+type FrameFormat struct {
+	Name        string
+	Ext         string
+	ContentType string
+	codecArgs   []string
+}
+
+// frameFormats are the formats frames can be extracted as
+var frameFormats = map[string]*FrameFormat{
+	"jpeg": {Name: "jpeg", Ext: ".jpg", ContentType: "image/jpeg", codecArgs: []string{"-c:v", "mjpeg", "-q:v", "2"}},
+	"png":  {Name: "png", Ext: ".png", ContentType: "image/png", codecArgs: []string{"-c:v", "png"}},
+	"webp": {Name: "webp", Ext: ".webp", ContentType: "image/webp", codecArgs: []string{"-c:v", "libwebp", "-quality", "90"}},
+}
+
+// LookupFrameFormat returns the format with the given name ("jpeg",
+// "png", "webp"; "jpg" works too)
+func LookupFrameFormat(name string) (*FrameFormat, bool) {
+	name = strings.ToLower(name)
+	if name == "jpg" {
+		name = "jpeg"
+	}
+	format, ok := frameFormats[name]
+	return format, ok
+}
+
+// FrameRequest selects a still frame of a video
+type FrameRequest struct {
+	Time   float64 // Seconds into the video
+	Width  int     // 0 = the video's own width
+	Format *FrameFormat
+}
+
+// FrameKey is where a frame is cached
+// Times are rounded to the millisecond: finer than any frame rate, and
+// requests for "the same" time share a file.
+func FrameKey(mediaID uuid.UUID, req FrameRequest) string {
+	ms := int64(math.Round(req.Time * 1000))
+	return storage.FrameKey(mediaID, fmt.Sprintf("%d-%d%s", ms, req.Width, req.Format.Ext))
+}
+
+// FrameExtractor decodes still frames of videos on request
+//
+// Unlike the jobs it runs while a client waits, so it's the caller's
+// job to serve a cached frame (FrameKey) before asking for a new one.
+type FrameExtractor struct {
+	ffmpeg    *FFmpeg
+	blobs     storage.BlobStore
+	mediaRepo *repository.MediaRepository
+	sem       chan struct{}
+}
+
+// NewFrameExtractor creates a frame extractor
+func NewFrameExtractor(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository) *FrameExtractor {
+	return &FrameExtractor{
+		ffmpeg:    ffmpeg,
+		blobs:     blobs,
+		mediaRepo: mediaRepo,
+		sem:       make(chan struct{}, frameConcurrency),
+	}
+}
+
+// NormalizeFrameRequest checks a request against the video and fills in
+// defaults: the time is rounded to the millisecond, the width defaults
+// to the video's and is never larger (upscaling adds nothing but bytes)
+func NormalizeFrameRequest(media *models.Media, req *FrameRequest) error {
+	// !(req.Time >= 0) also turns away NaN
+	if !(req.Time >= 0) || math.IsInf(req.Time, 0) {
+		return ErrFrameOutOfRange
+	}
+	req.Time = math.Round(req.Time*1000) / 1000
+	if media.Duration > 0 && req.Time >= media.Duration {
+		return ErrFrameOutOfRange
+	}
+	if req.Width <= 0 || (media.Width > 0 && req.Width > media.Width) {
+		req.Width = media.Width
+	}
+	if req.Width > 0 && req.Width < FrameMinWidth {
+		req.Width = FrameMinWidth
+	}
+	return nil
+}
+
+// Extract decodes the frame shown at req.Time and caches it at FrameKey
+// req must have been normalized.
+//
+// WHY -ss BEFORE -i?
+// As an input option ffmpeg jumps to the keyframe before the time and
+// decodes from there, dropping frames until it gets to it: exact, and
+// fast however far into the video the frame is. (After -i it would
+// decode everything from the start.)
+func (f *FrameExtractor) Extract(ctx context.Context, media *models.Media, req FrameRequest) error {
+	select {
+	case f.sem <- struct{}{}:
+		defer func() { <-f.sem }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	input, err := storage.ToolInput(ctx, f.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"-ss", formatSeconds(req.Time),
+		"-i", input,
+		"-map", "0:v:0",
+		"-frames:v", "1",
+	}
+	if req.Width > 0 {
+		// -2 keeps the aspect ratio with an even height
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", req.Width))
+	}
+	args = append(args, "-f", "image2pipe")
+	args = append(args, req.Format.codecArgs...)
+	args = append(args, "pipe:1")
+
+	var out bytes.Buffer
+	if err := f.ffmpeg.Output(ctx, &out, args...); err != nil {
+		return err
+	}
+	if out.Len() == 0 {
+		// Past the last frame: durations are rounded, and some files end
+		// in audio only
+		return ErrNoFrame
+	}
+
+	key, size := FrameKey(media.ID, req), int64(out.Len())
+	_, err = f.blobs.Put(ctx, key, &out, storage.PutOptions{
+		ContentType: req.Format.ContentType,
+		Size:        size,
+	})
+	if err != nil {
+		return err
+	}
+	// Cached frames take space too (see Quotas)
+	return f.mediaRepo.RecordFrame(ctx, media.ID, key, size)
+}
@@ -0,0 +1,57 @@
+package media
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"tempo/internal/models"
+)
+
+func TestNormalizeFrameRequest(t *testing.T) {
+	video := &models.Media{Duration: 10, Width: 1920}
+	unprobed := &models.Media{}
+
+	tests := []struct {
+		name      string
+		media     *models.Media
+		time      float64
+		width     int
+		wantTime  float64
+		wantWidth int
+		wantErr   bool
+	}{
+		{"start", video, 0, 0, 0, 1920, false},
+		{"rounded to the millisecond", video, 1.23456, 640, 1.235, 640, false},
+		{"never upscaled", video, 1, 4000, 1, 1920, false},
+		{"minimum width", video, 1, 2, 1, FrameMinWidth, false},
+		{"last millisecond", video, 9.999, 0, 9.999, 1920, false},
+		{"at the end", video, 10, 0, 0, 0, true},
+		{"rounds up to the end", video, 9.9996, 0, 0, 0, true},
+		{"negative", video, -1, 0, 0, 0, true},
+		{"NaN", video, math.NaN(), 0, 0, 0, true},
+		{"infinity", video, math.Inf(1), 0, 0, 0, true},
+		{"unknown duration", unprobed, 3600, 320, 3600, 320, false},
+		{"NaN with unknown duration", unprobed, math.NaN(), 0, 0, 0, true},
+		{"infinity with unknown duration", unprobed, math.Inf(1), 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := FrameRequest{Time: tt.time, Width: tt.width}
+			err := NormalizeFrameRequest(tt.media, &req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrFrameOutOfRange) {
+					t.Errorf("error = %v, want ErrFrameOutOfRange", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req.Time != tt.wantTime || req.Width != tt.wantWidth {
+				t.Errorf("got %vs at %dpx, want %vs at %dpx", req.Time, req.Width, tt.wantTime, tt.wantWidth)
+			}
+		})
+	}
+}
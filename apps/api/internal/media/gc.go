@@ -0,0 +1,305 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// Key prefixes the cleanup owns (see the key layout in storage)
+// Anything else in the bucket is left alone.
+const (
+	gcMediaPrefix  = "media/"
+	gcUploadPrefix = "uploads/"
+	gcExportPrefix = "exports/"
+	gcFramePrefix  = "frames/"
+)
+
+// gcDerivedPrefixes hold what jobs make from a media file, each under
+// <prefix><media id>/
+var gcDerivedPrefixes = []string{"thumbnails/", "waveforms/", "proxies/", "hls/"}
+
+// gcReportLimit caps how many orphans a dry run logs one by one
+const gcReportLimit = 100
+
+// GCOptions configures the cleanup
+type GCOptions struct {
+	// Interval is the least time between passes, across all servers
+	Interval time.Duration
+
+	// GracePeriod protects blobs that are still being written: uploads
+	// store bytes before their record exists, jobs before they record
+	// what they made. Unreferenced blobs younger than this are left alone.
+	GracePeriod time.Duration
+
+	// DryRun reports orphans without deleting anything
+	DryRun bool
+}
+
+// GC is the orphaned blob cleanup
+//
+// WHY IS IT NEEDED?
+// Every delete path removes the bytes it knows about, but "best effort":
+// a blob delete that fails is logged and forgotten, a server that crashes
+// mid-upload leaves parts nobody will stitch, and rows removed by ON
+// DELETE CASCADE (deleting a user) never reach application code at all.
+// Instead of making each path perfect, a periodic pass lists the blob
+// store and deletes whatever no record points to.
+//
+// A blob is referenced if:
+//   - media/: a media record stores its bytes there
+//   - thumbnails/, waveforms/, proxies/, hls/: a media record using the
+//     files under that ID (Media.DerivedID) still exists and lists it
+//     (DerivedKeys) - leftovers of a job that was re-run with different
+//     output count as orphans too
+//   - uploads/: its resumable upload still lists it as a part
+//   - exports/: an export job (on any server) writes or wrote it
+//   - frames/: its media record still exists and it was extracted less
+//     than FrameCacheTTL ago - frames are a cache, made again on request
+type GC struct {
+	blobs      storage.BlobStore
+	mediaRepo  *repository.MediaRepository
+	uploadRepo *repository.UploadRepository
+	gcRepo     *repository.BlobGCRepository
+	exportRepo *repository.ExportRepository
+	opts       GCOptions
+}
+
+// NewGC creates the cleanup
+// The grace period is raised to the job lease if it's shorter: a job may
+// take that long between writing a file and recording it.
+func NewGC(blobs storage.BlobStore, mediaRepo *repository.MediaRepository, uploadRepo *repository.UploadRepository, gcRepo *repository.BlobGCRepository, exportRepo *repository.ExportRepository, opts GCOptions) *GC {
+	if opts.GracePeriod < jobLease {
+		opts.GracePeriod = jobLease
+	}
+	return &GC{
+		blobs:      blobs,
+		mediaRepo:  mediaRepo,
+		uploadRepo: uploadRepo,
+		gcRepo:     gcRepo,
+		exportRepo: exportRepo,
+		opts:       opts,
+	}
+}
+
+// Run does one pass and records it in blob_gc_runs
+// Returns repository.ErrGCRecentlyRun if a pass (on any server) started
+// less than the interval ago. A pass that fails part way is recorded
+// with its error: what it deleted is gone either way.
+func (gc *GC) Run(ctx context.Context) (*models.GCRun, error) {
+	run, err := gc.gcRepo.StartRun(ctx, gc.opts.DryRun, gc.opts.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gc.sweep(ctx, run); err != nil {
+		msg := err.Error()
+		run.Error = &msg
+	}
+
+	if err := gc.gcRepo.FinishRun(context.WithoutCancel(ctx), run); err != nil {
+		return run, err
+	}
+	if run.Error != nil {
+		return run, errors.New(*run.Error)
+	}
+	return run, nil
+}
+
+// sweep lists every prefix the cleanup owns and deals with the orphans
+// It stops at the first error looking up references: when in doubt,
+// nothing is deleted.
+func (gc *GC) sweep(ctx context.Context, run *models.GCRun) error {
+	cutoff := time.Now().Add(-gc.opts.GracePeriod)
+	refs := &gcRefs{gc: gc}
+
+	prefixes := append([]string{gcMediaPrefix, gcUploadPrefix, gcExportPrefix, gcFramePrefix}, gcDerivedPrefixes...)
+	for _, prefix := range prefixes {
+		var stats models.GCStats
+		err := gc.blobs.List(ctx, prefix, func(obj storage.ObjectInfo) error {
+			stats.Scanned++
+			stats.ScannedBytes += obj.Size
+
+			used, err := refs.used(ctx, prefix, obj)
+			if err != nil || used {
+				return err
+			}
+			if obj.ModTime.After(cutoff) {
+				stats.Pending++
+				stats.PendingBytes += obj.Size
+				return nil
+			}
+
+			if gc.opts.DryRun {
+				stats.Orphans++
+				stats.OrphanBytes += obj.Size
+				if run.Orphans+stats.Orphans <= gcReportLimit {
+					log.Printf("blob gc: orphan %s (%s, last modified %s)", obj.Key, FormatBytes(obj.Size), obj.ModTime.Format(time.RFC3339))
+				}
+				return nil
+			}
+
+			deleted, err := gc.delete(ctx, obj)
+			if err != nil {
+				// One stubborn blob shouldn't stop the pass; it's retried
+				// next time
+				log.Printf("blob gc: failed to delete %s: %v", obj.Key, err)
+				stats.Orphans++
+				stats.OrphanBytes += obj.Size
+				stats.Failed++
+				return nil
+			}
+			if deleted {
+				stats.Orphans++
+				stats.OrphanBytes += obj.Size
+				stats.Deleted++
+				stats.ReclaimedBytes += obj.Size
+			}
+			return nil
+		})
+		run.ByPrefix[prefix] = stats
+		run.GCStats.Add(stats)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Blob records whose bytes are gone, or were just deleted above
+	n, err := gc.mediaRepo.DeleteUnusedBlobRecords(ctx, cutoff, gc.opts.DryRun)
+	run.BlobRecords = n
+	if err != nil || gc.opts.DryRun {
+		return err
+	}
+
+	// Frame records go at the age their files do (see used)
+	_, err = gc.mediaRepo.DeleteFrameRecords(ctx, time.Now().Add(-FrameCacheTTL))
+	return err
+}
+
+// delete removes an orphan, returning false if it turned out to be in use
+// Stored content can gain a reference at any moment (an upload of the
+// same bytes), so it's deleted under the blob's row lock.
+func (gc *GC) delete(ctx context.Context, obj storage.ObjectInfo) (bool, error) {
+	remove := func(key string) error {
+		return gc.blobs.Delete(ctx, key)
+	}
+	if sum, ok := storage.ParseContentKey(obj.Key); ok {
+		return gc.mediaRepo.DeleteUnusedBlob(ctx, sum, obj.Key, obj.Size, remove)
+	}
+	return true, remove(obj.Key)
+}
+
+// gcRefs looks up whether blobs are referenced
+// Listings keep each media file's (or upload's) blobs together, so the
+// last record looked up is remembered: one query per record, not per blob.
+type gcRefs struct {
+	gc *GC
+
+	mediaID      uuid.UUID
+	mediaDerived bool            // mediaID is a derived ID, not a record's
+	mediaKeys    map[string]bool // nil until a media record was looked up
+	mediaExists  bool
+	uploadID     uuid.UUID
+	uploadKeys   map[string]bool
+}
+
+// used reports whether a blob listed under prefix is referenced
+func (r *gcRefs) used(ctx context.Context, prefix string, obj storage.ObjectInfo) (bool, error) {
+	key := obj.Key
+	switch prefix {
+	case gcMediaPrefix:
+		return r.gc.mediaRepo.StorageKeyInUse(ctx, key)
+
+	case gcExportPrefix:
+		return r.gc.exportRepo.OutputKeyInUse(ctx, key)
+
+	case gcUploadPrefix:
+		uploadID, ok := gcOwner(prefix, key)
+		if !ok {
+			return false, nil
+		}
+		if r.uploadKeys == nil || uploadID != r.uploadID {
+			keys, err := r.gc.uploadRepo.PartKeys(ctx, uploadID)
+			if err != nil && !errors.Is(err, repository.ErrUploadNotFound) {
+				return false, err
+			}
+			r.uploadID, r.uploadKeys = uploadID, toSet(keys)
+		}
+		return r.uploadKeys[key], nil
+
+	case gcFramePrefix:
+		if time.Since(obj.ModTime) > FrameCacheTTL {
+			return false, nil
+		}
+		mediaID, ok := gcOwner(prefix, key)
+		if !ok {
+			return false, nil
+		}
+		if err := r.lookupMedia(ctx, mediaID, false); err != nil {
+			return false, err
+		}
+		return r.mediaExists, nil
+
+	default:
+		derivedID, ok := gcOwner(prefix, key)
+		if !ok {
+			return false, nil
+		}
+		if err := r.lookupMedia(ctx, derivedID, true); err != nil {
+			return false, err
+		}
+		return r.mediaKeys[key], nil
+	}
+}
+
+// lookupMedia loads what a media record references, unless it's the
+// record looked up last
+// With derived, id is a derived ID and any record using it will do: they
+// all reference the same files.
+func (r *gcRefs) lookupMedia(ctx context.Context, id uuid.UUID, derived bool) error {
+	if r.mediaKeys != nil && id == r.mediaID && derived == r.mediaDerived {
+		return nil
+	}
+	var keys []string
+	var media *models.Media
+	var err error
+	if derived {
+		media, err = r.gc.mediaRepo.GetByDerivedID(ctx, id)
+	} else {
+		media, err = r.gc.mediaRepo.GetForJob(ctx, id)
+	}
+	if err == nil {
+		keys = DerivedKeys(media)
+	} else if !errors.Is(err, repository.ErrMediaNotFound) {
+		return err
+	}
+	r.mediaID, r.mediaDerived, r.mediaKeys, r.mediaExists = id, derived, toSet(keys), err == nil
+	return nil
+}
+
+// gcOwner parses the record ID out of "<prefix><id>/<name>"
+func gcOwner(prefix, key string) (uuid.UUID, bool) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+	if !ok {
+		return uuid.Nil, false
+	}
+	parsed, err := uuid.Parse(id)
+	return parsed, err == nil
+}
+
+// toSet turns a list of keys into a set (never nil)
+func toSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
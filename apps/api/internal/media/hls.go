@@ -0,0 +1,313 @@
+package media
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// JobHLS packages videos for HTTP Live Streaming
+// Optional (MEDIA_HLS): it's the most expensive job, one encode per rendition.
+const JobHLS = "hls"
+
+// HLSMasterPlaylist is the name of the playlist players open first
+const HLSMasterPlaylist = "master.m3u8"
+
+// hlsSegmentDuration is the target segment length in seconds
+// Shorter segments make seeking and quality switches quicker, longer ones
+// compress better and mean fewer requests. 4s is the usual middle ground.
+const hlsSegmentDuration = 4
+
+// hlsRenditions are the quality levels, by their short side
+// maxRate caps the bitrate so the player's bandwidth estimate holds.
+var hlsRenditions = []struct {
+	name      string
+	shortSide int
+	maxRate   string
+}{
+	{"360p", 360, "800k"},
+	{"540p", 540, "1500k"},
+	{"720p", 720, "3000k"},
+	{"1080p", 1080, "6000k"},
+}
+
+// Content types players expect for playlists and MPEG-TS segments
+const (
+	hlsPlaylistType = "application/vnd.apple.mpegurl"
+	hlsSegmentType  = "video/mp2t"
+)
+
+// HLSContentType returns the content type for a file of an HLS package
+func HLSContentType(name string) string {
+	if strings.HasSuffix(name, ".m3u8") {
+		return hlsPlaylistType
+	}
+	return hlsSegmentType
+}
+
+// hlsPlaylistName is a rendition's playlist, relative to the package
+func hlsPlaylistName(rendition string) string {
+	return rendition + "/index.m3u8"
+}
+
+// hlsSegmentName is a rendition's n-th segment (from 0)
+// Matches the -hls_segment_filename pattern given to ffmpeg.
+func hlsSegmentName(rendition string, n int) string {
+	return fmt.Sprintf("%s/seg-%05d.ts", rendition, n)
+}
+
+// HLSKeys lists every blob of a media file's HLS package
+func HLSKeys(mediaID uuid.UUID, pkg *models.HLSPackage) []string {
+	keys := []string{storage.HLSKey(mediaID, HLSMasterPlaylist)}
+	for _, r := range pkg.Renditions {
+		keys = append(keys, storage.HLSKey(mediaID, hlsPlaylistName(r.Name)))
+		for i := 0; i < r.Segments; i++ {
+			keys = append(keys, storage.HLSKey(mediaID, hlsSegmentName(r.Name, i)))
+		}
+	}
+	return keys
+}
+
+// HLSPackager is the HLS job
+type HLSPackager struct {
+	ffmpeg    *FFmpeg
+	blobs     storage.BlobStore
+	mediaRepo *repository.MediaRepository
+}
+
+// NewHLSPackager creates the HLS job
+func NewHLSPackager(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository) *HLSPackager {
+	return &HLSPackager{
+		ffmpeg:    ffmpeg,
+		blobs:     blobs,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// Kind implements Job
+func (p *HLSPackager) Kind() string {
+	return JobHLS
+}
+
+// Wants implements Job: probed videos (the renditions depend on the size)
+func (p *HLSPackager) Wants(media *models.Media) bool {
+	return media.Kind == models.MediaKindVideo && media.VideoCodec != "" && media.Duration > 0 && shortSide(media.Width, media.Height) > 0
+}
+
+// Run implements Job
+//
+// Each rendition is a separate ffmpeg run writing a playlist and its
+// segments. Keyframes are forced on segment boundaries so every rendition
+// cuts at the same times - the player can only switch quality there.
+func (p *HLSPackager) Run(ctx context.Context, job *models.MediaJob, media *models.Media) error {
+	input, err := storage.ToolInput(ctx, p.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tempo-hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := &models.HLSPackage{SegmentDuration: hlsSegmentDuration}
+	for _, size := range hlsSizes(media.Width, media.Height) {
+		if err := os.Mkdir(filepath.Join(dir, size.name), 0o755); err != nil {
+			return err
+		}
+		if err := p.encode(ctx, input, media.AudioCodec != "", size, dir); err != nil {
+			return err
+		}
+
+		rendition, err := measureRendition(dir, size)
+		if err != nil {
+			return err
+		}
+		pkg.Renditions = append(pkg.Renditions, *rendition)
+	}
+
+	// Master playlist last: it's the entry point, so players never see a
+	// package whose renditions are still being uploaded
+	var master strings.Builder
+	if err := WriteHLSMasterPlaylist(&master, pkg); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, HLSMasterPlaylist), []byte(master.String()), 0o644); err != nil {
+		return err
+	}
+
+	for _, r := range pkg.Renditions {
+		for i := 0; i < r.Segments; i++ {
+			if err := p.upload(ctx, media.DerivedID(), dir, hlsSegmentName(r.Name, i)); err != nil {
+				return err
+			}
+		}
+		if err := p.upload(ctx, media.DerivedID(), dir, hlsPlaylistName(r.Name)); err != nil {
+			return err
+		}
+	}
+	if err := p.upload(ctx, media.DerivedID(), dir, HLSMasterPlaylist); err != nil {
+		return err
+	}
+
+	return p.mediaRepo.SetHLS(ctx, job, media.DerivedID(), pkg)
+}
+
+// hlsSize is a rendition to encode
+type hlsSize struct {
+	name          string
+	width, height int
+	maxRate       string
+}
+
+// hlsSizes returns the renditions for a video of the given (displayed)
+// size: every level up to the source's own. Sources smaller than the
+// lowest level get a single rendition at their own size.
+func hlsSizes(width, height int) []hlsSize {
+	short := shortSide(width, height)
+
+	var sizes []hlsSize
+	for _, r := range hlsRenditions {
+		if r.shortSide > short {
+			break
+		}
+		w, h := scaleToShortSide(width, height, r.shortSide)
+		sizes = append(sizes, hlsSize{name: r.name, width: w, height: h, maxRate: r.maxRate})
+	}
+	if len(sizes) == 0 {
+		even := short / 2 * 2
+		w, h := scaleToShortSide(width, height, even)
+		sizes = append(sizes, hlsSize{name: fmt.Sprintf("%dp", even), width: w, height: h, maxRate: hlsRenditions[0].maxRate})
+	}
+	return sizes
+}
+
+// encode writes one rendition's playlist and segments into dir/<name>/
+func (p *HLSPackager) encode(ctx context.Context, input string, hasAudio bool, size hlsSize, dir string) error {
+	args := []string{
+		"-i", input,
+		"-vf", fmt.Sprintf("scale=%d:%d", size.width, size.height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-maxrate", size.maxRate,
+		"-bufsize", size.maxRate,
+		"-profile:v", "high",
+		"-pix_fmt", "yuv420p",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentDuration),
+	}
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	} else {
+		args = append(args, "-an")
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-start_number", "0",
+		"-hls_segment_filename", filepath.Join(dir, size.name, "seg-%05d.ts"),
+		"-y", filepath.Join(dir, hlsPlaylistName(size.name)),
+	)
+
+	return p.ffmpeg.Run(ctx, args...)
+}
+
+// measureRendition reads back what ffmpeg wrote: the segment count from
+// the playlist, the size and the peak bitrate from the segments
+//
+// The master playlist must give each rendition's peak BANDWIDTH; players
+// use it to pick a level the connection can sustain.
+func measureRendition(dir string, size hlsSize) (*models.HLSRendition, error) {
+	durations, err := readSegmentDurations(filepath.Join(dir, hlsPlaylistName(size.name)))
+	if err != nil {
+		return nil, err
+	}
+	if len(durations) == 0 {
+		return nil, errors.New("ffmpeg produced no HLS segments for " + size.name)
+	}
+
+	rendition := &models.HLSRendition{
+		Name:     size.name,
+		Width:    size.width,
+		Height:   size.height,
+		Segments: len(durations),
+	}
+	for i, d := range durations {
+		st, err := os.Stat(filepath.Join(dir, hlsSegmentName(size.name, i)))
+		if err != nil {
+			return nil, err
+		}
+		rendition.Size += st.Size()
+		if d <= 0 {
+			continue
+		}
+		if bps := int(float64(st.Size()*8) / d); bps > rendition.Bandwidth {
+			rendition.Bandwidth = bps
+		}
+	}
+	return rendition, nil
+}
+
+// readSegmentDurations returns the #EXTINF durations of a media playlist,
+// in segment order
+func readSegmentDurations(path string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var durations []float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "#EXTINF:")
+		if !ok {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ",")
+		d, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad segment duration %q in HLS playlist", value)
+		}
+		durations = append(durations, d)
+	}
+	return durations, scanner.Err()
+}
+
+// upload copies one file of the package into the blob store
+func (p *HLSPackager) upload(ctx context.Context, mediaID uuid.UUID, dir, name string) error {
+	_, err := storage.PutFile(ctx, p.blobs, storage.HLSKey(mediaID, name), filepath.Join(dir, name), HLSContentType(name))
+	return err
+}
+
+// WriteHLSMasterPlaylist writes the playlist listing a package's renditions
+//
+// URIs are relative, so the package works wherever it's served from as
+// long as the directory layout is kept. CODECS is left out: the H.264
+// level ffmpeg picks varies with the size, and players probe it anyway.
+func WriteHLSMasterPlaylist(w io.Writer, pkg *models.HLSPackage) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, r := range pkg.Renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s\n",
+			r.Bandwidth, r.Width, r.Height, hlsPlaylistName(r.Name))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
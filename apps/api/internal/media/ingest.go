@@ -0,0 +1,406 @@
+package media
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// IngestRequest describes a file being added to the library
+type IngestRequest struct {
+	OwnerID     uuid.UUID
+	ProjectID   *uuid.UUID
+	Filename    string // Original name on the uploader's machine
+	ContentType string
+	Size        int64 // Expected size, -1 if unknown
+}
+
+// Ingestor is the single path every new media file takes
+//
+// Plain uploads, resumable uploads and bundle imports all end up here, so
+// they all get the same treatment: store the bytes, look inside, record it.
+type Ingestor struct {
+	blobs       storage.BlobStore
+	prober      Prober
+	mediaRepo   *repository.MediaRepository
+	projectRepo *repository.ProjectRepository
+	worker      *Worker
+	quotas      *Quotas
+}
+
+// NewIngestor creates an ingestor
+// prober may be nil (ffprobe not installed): files are then stored
+// without technical metadata. The worker gets the follow-up jobs.
+func NewIngestor(blobs storage.BlobStore, prober Prober, mediaRepo *repository.MediaRepository, projectRepo *repository.ProjectRepository, worker *Worker, quotas *Quotas) *Ingestor {
+	return &Ingestor{
+		blobs:       blobs,
+		prober:      prober,
+		mediaRepo:   mediaRepo,
+		projectRepo: projectRepo,
+		worker:      worker,
+		quotas:      quotas,
+	}
+}
+
+// CheckQuota fails early with a *QuotaError if a file of the declared
+// size won't fit, before its bytes arrive
+// Ingest checks again with the real size and content.
+func (in *Ingestor) CheckQuota(ctx context.Context, ownerID uuid.UUID, projectID *uuid.UUID, size int64) error {
+	return in.quotas.Check(ctx, ownerID, projectID, size, nil)
+}
+
+// Ingest sniffs src, stores it, probes it and creates the media record
+//
+// DEDUPLICATION: the bytes are hashed (SHA-256) while they're spooled to
+// a temp file, then stored under that hash. Content we already have isn't
+// stored, probed or processed again - the new record just references the
+// same blob, copies its technical metadata and shares its derived files
+// (see Media.DerivedID), so a re-upload completes as soon as the bytes
+// have arrived. (Clients that know the hash up front can skip sending
+// them too: see Link.)
+func (in *Ingestor) Ingest(ctx context.Context, src io.Reader, req IngestRequest) (*models.Media, error) {
+	// Look at the first bytes before storing anything: the declared type
+	// and the filename are only hints, the content decides
+	br := bufio.NewReaderSize(src, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	format, err := Sniff(head)
+	if err != nil {
+		return nil, err
+	}
+	if err := format.CheckDeclaredType(req.ContentType); err != nil {
+		return nil, err
+	}
+	if req.Size >= 0 {
+		if err := format.CheckSize(req.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	spool, err := os.CreateTemp("", "tempo-ingest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), br)
+	if err != nil {
+		return nil, err
+	}
+	if req.Size >= 0 && size != req.Size {
+		return nil, fmt.Errorf("received %d bytes, expected %d", size, req.Size)
+	}
+	if err := format.CheckSize(size); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if err := in.quotas.Check(ctx, req.OwnerID, req.ProjectID, size, &sum); err != nil {
+		return nil, err
+	}
+
+	media := &models.Media{
+		ID:          uuid.New(),
+		OwnerID:     req.OwnerID,
+		ProjectID:   req.ProjectID,
+		Kind:        format.Kind, // Until probing says otherwise
+		Filename:    filepath.Base(req.Filename),
+		ContentType: format.ContentType,
+		Size:        size,
+		ContentHash: &sum,
+	}
+
+	// The storage key is built from the content and the detected format,
+	// never from the client's filename, so neither "../../etc/passwd" nor
+	// "evil.html" ends up in storage
+	media.StorageKey = storage.ContentKey(sum, format.Ext)
+
+	// Probing reads the local copy: no round trips to the blob store
+	if known, err := in.mediaRepo.GetProbedByContentHash(ctx, sum); err == nil {
+		copyTechnicalMetadata(media, known)
+		shareDerived(media, known)
+	} else if !errors.Is(err, repository.ErrMediaNotFound) {
+		return nil, err
+	} else if err := in.probe(ctx, media, format, spool.Name()); err != nil {
+		return nil, err
+	}
+
+	// Bytes before the record, so records don't point at missing files
+	if err := in.store(ctx, media, spool); err != nil {
+		return nil, err
+	}
+
+	created, newBlob, err := in.mediaRepo.Create(ctx, media)
+	if err != nil {
+		// The bytes may already be shared by another record, so they're
+		// left for the orphan cleanup rather than deleted here
+		return nil, err
+	}
+	if newBlob {
+		// A Delete may have removed the bytes between store and Create
+		if err := in.store(ctx, created, spool); err != nil {
+			in.discard(created)
+			return nil, err
+		}
+	}
+
+	in.enqueueJobs(ctx, created)
+	in.setProjectThumbnail(ctx, created)
+	return created, nil
+}
+
+// Link creates a media record for content the user can already see,
+// without the bytes: the "upload" of a file the library already has
+// completes instantly
+//
+// Only content visible to the user counts. Otherwise knowing a file's
+// hash - which is not a secret - would be enough to get a copy of it.
+// Returns repository.ErrMediaNotFound if there's no such file (or it
+// isn't req.Size bytes, when that's known); the client then uploads it
+// normally.
+func (in *Ingestor) Link(ctx context.Context, sum string, req IngestRequest) (*models.Media, error) {
+	known, err := in.mediaRepo.GetByContentHash(ctx, strings.ToLower(sum), req.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Size >= 0 && known.Size != req.Size {
+		return nil, repository.ErrMediaNotFound
+	}
+	if err := in.quotas.Check(ctx, req.OwnerID, req.ProjectID, known.Size, known.ContentHash); err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Base(req.Filename)
+	if req.Filename == "" {
+		filename = known.Filename
+	}
+	media := &models.Media{
+		ID:          uuid.New(),
+		OwnerID:     req.OwnerID,
+		ProjectID:   req.ProjectID,
+		Kind:        known.Kind,
+		Filename:    filename,
+		ContentType: known.ContentType,
+		Size:        known.Size,
+		StorageKey:  known.StorageKey,
+		ContentHash: known.ContentHash,
+	}
+	copyTechnicalMetadata(media, known)
+	shareDerived(media, known)
+
+	created, newBlob, err := in.mediaRepo.Create(ctx, media)
+	if err != nil {
+		return nil, err
+	}
+	if newBlob {
+		// The file we matched was deleted in the meantime, bytes and all
+		in.discard(created)
+		return nil, repository.ErrMediaNotFound
+	}
+
+	in.enqueueJobs(ctx, created)
+	in.setProjectThumbnail(ctx, created)
+	return created, nil
+}
+
+// Remove deletes a media record, and its bytes and the files jobs
+// generated from it if no other record uses them
+// Every way out of the library goes through here, like every way in goes
+// through Ingest. userID must be allowed to delete the file.
+func (in *Ingestor) Remove(ctx context.Context, mediaID, userID uuid.UUID) (*models.Media, error) {
+	media, derivedInUse, err := in.mediaRepo.Delete(ctx, mediaID, userID, func(key string) error {
+		// Not the request context: the client hanging up mustn't leave a
+		// record pointing at bytes that are half gone
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		return in.blobs.Delete(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing else uses the derived files, so they're unreachable either
+	// way and a failure only wastes space. Frames are per record.
+	if !derivedInUse {
+		for _, key := range DerivedKeys(media) {
+			in.deleteBlob(key)
+		}
+	}
+	in.deleteFrames(media.ID)
+	return media, nil
+}
+
+// store uploads the spooled bytes unless the blob store already has them
+func (in *Ingestor) store(ctx context.Context, media *models.Media, spool *os.File) error {
+	_, err := in.blobs.Stat(ctx, media.StorageKey)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = in.blobs.Put(ctx, media.StorageKey, spool, storage.PutOptions{
+		ContentType: media.ContentType,
+		Size:        media.Size,
+	})
+	return err
+}
+
+// enqueueJobs schedules the follow-up work for a new record
+// The file is usable without thumbnails etc., so a failure to queue them
+// doesn't fail the upload.
+func (in *Ingestor) enqueueJobs(ctx context.Context, media *models.Media) {
+	if err := in.worker.EnqueueFor(ctx, media); err != nil {
+		log.Printf("media %s: failed to queue jobs: %v", media.ID, err)
+	}
+}
+
+// setProjectThumbnail makes a new video's poster frame the default
+// thumbnail of its project
+// Normally the thumbnails job does it, but a record sharing another
+// one's files (see shareDerived) already has a poster and no such job.
+func (in *Ingestor) setProjectThumbnail(ctx context.Context, media *models.Media) {
+	if media.PosterKey == nil || media.ProjectID == nil || media.Kind != models.MediaKindVideo {
+		return
+	}
+	if err := in.projectRepo.SetDefaultThumbnail(ctx, *media.ProjectID, media.ID); err != nil {
+		log.Printf("media %s: failed to set project thumbnail: %v", media.ID, err)
+	}
+}
+
+// shareDerived makes a new record use the derived files (thumbnails,
+// waveform, proxies, HLS, scenes) of one with the same content
+// Only what's done is copied; EnqueueFor queues the rest.
+func shareDerived(dst, src *models.Media) {
+	derivedID := src.DerivedID()
+	dst.DerivedFrom = &derivedID
+	dst.PosterKey = src.PosterKey
+	dst.SpriteSheet = src.SpriteSheet
+	dst.ThumbnailBytes = src.ThumbnailBytes
+	dst.Waveform = src.Waveform
+	dst.WaveformBytes = src.WaveformBytes
+	dst.Proxies = src.Proxies
+	dst.HLS = src.HLS
+	dst.Scenes = src.Scenes
+}
+
+// copyTechnicalMetadata copies what probing found from a file with the
+// same content
+func copyTechnicalMetadata(dst, src *models.Media) {
+	dst.Kind = src.Kind
+	dst.Duration = src.Duration
+	dst.Width = src.Width
+	dst.Height = src.Height
+	dst.FrameRate = src.FrameRate
+	dst.Rotation = src.Rotation
+	dst.VideoCodec = src.VideoCodec
+	dst.AudioCodec = src.AudioCodec
+	dst.AudioChannels = src.AudioChannels
+	dst.SampleRate = src.SampleRate
+	dst.BitRate = src.BitRate
+	dst.ProbedAt = src.ProbedAt
+}
+
+// IsRejection reports whether Ingest failed because of the file itself
+// (format, codecs, corrupt data) rather than a server problem, i.e.
+// whether retrying with the same bytes is pointless
+func IsRejection(err error) bool {
+	return errors.Is(err, ErrUnsupportedFormat) ||
+		errors.Is(err, ErrFormatMismatch) ||
+		errors.Is(err, ErrUnsupportedCodec) ||
+		errors.Is(err, ErrUnreadableMedia) ||
+		errors.Is(err, ErrFileTooLarge) ||
+		errors.Is(err, ErrImageTooLarge) ||
+		errors.Is(err, ErrMissingStream)
+}
+
+// probe fills in the technical metadata from the file at input
+// A missing prober or a probe that times out isn't the file's fault, so
+// the upload still goes through (ProbedAt stays NULL). A file ffprobe
+// can't make sense of is rejected with ErrUnreadableMedia, one with
+// codecs the editor can't decode with a *CodecError, one that lacks what
+// its kind needs (see Format.KindOf) with another rejection.
+func (in *Ingestor) probe(ctx context.Context, media *models.Media, format *Format, input string) error {
+	if in.prober == nil {
+		return nil
+	}
+
+	result, err := in.prober.Probe(ctx, input)
+	if err != nil {
+		if errors.Is(err, ErrUnreadableMedia) {
+			return err
+		}
+		log.Printf("media %s: probe failed: %v", media.ID, err)
+		return nil
+	}
+
+	if err := format.CheckCodecs(result); err != nil {
+		return err
+	}
+	kind, err := format.KindOf(result)
+	if err != nil {
+		return err
+	}
+
+	result.ApplyTo(media)
+	media.Kind = kind
+	if kind == models.MediaKindImage {
+		// The image demuxers report a one-frame "video" of 1/25s
+		media.Duration = 0
+		media.FrameRate = 0
+		media.BitRate = 0
+	}
+	return nil
+}
+
+// discard undoes a Create that can't be completed
+func (in *Ingestor) discard(media *models.Media) {
+	if _, err := in.Remove(context.Background(), media.ID, media.OwnerID); err != nil {
+		log.Printf("failed to remove media %s: %v", media.ID, err)
+	}
+}
+
+// deleteFrames deletes the cached still frames of a media file
+// No record lists them, so they're found by listing.
+func (in *Ingestor) deleteFrames(mediaID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := in.blobs.List(ctx, storage.FrameKey(mediaID, ""), func(obj storage.ObjectInfo) error {
+		return in.blobs.Delete(ctx, obj.Key)
+	})
+	if err != nil {
+		log.Printf("media %s: failed to delete frames: %v", mediaID, err)
+	}
+}
+
+// deleteBlob deletes a blob that no record points to
+func (in *Ingestor) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := in.blobs.Delete(ctx, key); err != nil {
+		log.Printf("failed to delete blob %s: %v", key, err)
+	}
+}
@@ -0,0 +1,254 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+const (
+	// jobPollInterval is how often idle workers look for new jobs
+	// Jobs enqueued by this server wake them up right away; polling picks
+	// up the ones other servers enqueued and retries whose delay is over.
+	jobPollInterval = 5 * time.Second
+
+	// jobTimeout bounds a single run (a long video can take a while)
+	jobTimeout = 30 * time.Minute
+
+	// jobLease is when a running job counts as abandoned by a crashed
+	// server and is handed to another worker
+	jobLease = jobTimeout + 5*time.Minute
+
+	// maxJobAttempts before a job is marked failed
+	maxJobAttempts = 3
+
+	// jobRetryDelay is multiplied by the attempt number
+	jobRetryDelay = time.Minute
+)
+
+// Job is a kind of background work done on media files
+//
+// WHY BACKGROUND JOBS?
+// Generating thumbnails means decoding the whole video, which takes far
+// longer than an upload request should. The upload returns as soon as
+// the file is stored; jobs fill in the rest and report progress on the
+// media record (Media.Jobs).
+type Job interface {
+	// Kind names the job, e.g. "thumbnails" (stored in media_jobs.kind)
+	Kind() string
+
+	// Wants reports whether a newly ingested file needs this job
+	Wants(media *models.Media) bool
+
+	// Run does the work. Errors are retried up to maxJobAttempts times,
+	// so Run must be safe to repeat. Results are recorded against job, so
+	// they're dropped if this run lost the job in the meantime (see
+	// repository.ErrRunSuperseded).
+	Run(ctx context.Context, job *models.MediaJob, media *models.Media) error
+}
+
+// DerivedKeys lists the blobs jobs generated from a media file, so they
+// can be deleted along with it (once no record with the same content
+// uses them anymore, see Media.DerivedID)
+func DerivedKeys(media *models.Media) []string {
+	id := media.DerivedID()
+	var keys []string
+	if media.PosterKey != nil {
+		keys = append(keys, *media.PosterKey)
+	}
+	if media.SpriteSheet != nil {
+		for i := 0; i < media.SpriteSheet.SheetCount; i++ {
+			keys = append(keys, SpriteKey(id, i))
+		}
+	}
+	if media.Waveform != nil {
+		for _, spp := range media.Waveform.SamplesPerPixel {
+			keys = append(keys, WaveformLevelKey(id, spp))
+		}
+	}
+	for _, proxy := range media.Proxies {
+		keys = append(keys, ProxyKey(id, proxy.Name))
+	}
+	if media.HLS != nil {
+		keys = append(keys, HLSKeys(id, media.HLS)...)
+	}
+	return keys
+}
+
+// Worker runs queued jobs
+type Worker struct {
+	jobRepo     *repository.MediaJobRepository
+	mediaRepo   *repository.MediaRepository
+	jobs        map[string]Job
+	kinds       []string // Registration order, which is also enqueue order
+	concurrency int
+	wake        chan struct{}
+}
+
+// NewWorker creates a worker running up to concurrency jobs at a time
+func NewWorker(jobRepo *repository.MediaJobRepository, mediaRepo *repository.MediaRepository, concurrency int) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Worker{
+		jobRepo:     jobRepo,
+		mediaRepo:   mediaRepo,
+		jobs:        make(map[string]Job),
+		concurrency: concurrency,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Register adds a kind of job
+// Call before Run. Kinds that aren't registered (e.g. because ffmpeg is
+// missing) are never enqueued, and stay queued if another server
+// enqueued them until a server that can run them picks them up.
+func (w *Worker) Register(job Job) {
+	w.jobs[job.Kind()] = job
+	w.kinds = append(w.kinds, job.Kind())
+}
+
+// EnqueueFor schedules every job a newly ingested file wants
+// A file sharing derived files with earlier uploads of the same content
+// only gets the kinds none of them has run or is running (Media.Jobs
+// covers them all), so duplicates cost no processing.
+func (w *Worker) EnqueueFor(ctx context.Context, media *models.Media) error {
+	queued := false
+	for _, kind := range w.kinds {
+		if !w.jobs[kind].Wants(media) {
+			continue
+		}
+		switch media.Jobs[kind].Status {
+		case models.JobQueued, models.JobRunning, models.JobDone:
+			continue
+		}
+		if err := w.jobRepo.Enqueue(ctx, media.ID, kind); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		w.notify()
+	}
+	return nil
+}
+
+// Enqueue schedules one kind of job, e.g. to redo it
+func (w *Worker) Enqueue(ctx context.Context, mediaID uuid.UUID, kind string) error {
+	if _, ok := w.jobs[kind]; !ok {
+		return errors.New("unknown job kind: " + kind)
+	}
+	if err := w.jobRepo.Enqueue(ctx, mediaID, kind); err != nil {
+		return err
+	}
+	w.notify()
+	return nil
+}
+
+// notify wakes an idle worker goroutine, if there is one
+func (w *Worker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes jobs until ctx is cancelled
+// Interrupted jobs are put back in the queue for the next start.
+func (w *Worker) Run(ctx context.Context) {
+	if len(w.kinds) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// loop runs jobs back to back, then sleeps until woken or polled
+func (w *Worker) loop(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && w.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs one job, returning false if there was none
+func (w *Worker) runNext(ctx context.Context) bool {
+	job, err := w.jobRepo.Claim(ctx, w.kinds, jobLease)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNoJobs) && ctx.Err() == nil {
+			log.Printf("media jobs: failed to claim: %v", err)
+		}
+		return false
+	}
+
+	// The job row goes away with the media row (ON DELETE CASCADE), so
+	// a missing file here just means it was deleted a moment ago
+	media, err := w.mediaRepo.GetForJob(ctx, job.MediaID)
+	if err != nil {
+		w.finish(ctx, job, err)
+		return true
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	err = w.jobs[job.Kind].Run(runCtx, job, media)
+	cancel()
+
+	w.finish(ctx, job, err)
+	return true
+}
+
+// finish records the outcome of a run
+func (w *Worker) finish(ctx context.Context, job *models.MediaJob, runErr error) {
+	// Record the outcome even if we're shutting down
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	var err error
+	switch {
+	case runErr == nil:
+		err = w.jobRepo.Complete(saveCtx, job)
+	case ctx.Err() != nil:
+		// Not the job's fault - run it again after the restart
+		err = w.jobRepo.Release(saveCtx, job)
+	case errors.Is(runErr, repository.ErrRunSuperseded):
+		// The job was re-enqueued or claimed again after the lease ran
+		// out: the newer run records the outcome
+		log.Printf("media %s: %s job run %d was superseded, dropping its result", job.MediaID, job.Kind, job.Run)
+	case errors.Is(runErr, repository.ErrMediaNotFound):
+		err = w.jobRepo.Fail(saveCtx, job, "media file was deleted")
+	case job.Attempts < maxJobAttempts:
+		log.Printf("media %s: %s job failed (attempt %d): %v", job.MediaID, job.Kind, job.Attempts, runErr)
+		err = w.jobRepo.Retry(saveCtx, job, runErr.Error(), time.Now().Add(time.Duration(job.Attempts)*jobRetryDelay))
+	default:
+		log.Printf("media %s: %s job failed, giving up: %v", job.MediaID, job.Kind, runErr)
+		err = w.jobRepo.Fail(saveCtx, job, runErr.Error())
+	}
+	if err != nil {
+		log.Printf("media %s: failed to update %s job: %v", job.MediaID, job.Kind, err)
+	}
+}
@@ -0,0 +1,243 @@
+// Package media turns uploaded files into usable project media
+//
+// Everything that has to look INSIDE a media file lives here: probing
+// (what's in it), and later the derived assets the editor needs. The heavy
+// lifting is done by the ffmpeg tools, run as separate processes - they're
+// the industry standard and decode every format our users throw at us.
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrProberUnavailable = errors.New("media prober not available")
+	ErrUnreadableMedia   = errors.New("file is not readable media")
+)
+
+// probeTimeout bounds a single ffprobe run
+// Probing only reads headers, so this is generous even over the network
+const probeTimeout = 30 * time.Second
+
+// Prober extracts technical metadata from a media file
+//
+// An interface so handlers and tests don't depend on ffprobe being
+// installed - swap in a fake that returns a fixed ProbeResult.
+type Prober interface {
+	// Probe reads the file at input, a local path or an http(s) URL
+	Probe(ctx context.Context, input string) (*ProbeResult, error)
+}
+
+// ProbeResult is what we know about a media file
+// Zero values mean "not present" (e.g. AudioCodec is "" for silent video).
+type ProbeResult struct {
+	Container     string  // e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	Duration      float64 // Seconds
+	BitRate       int64   // Bits per second, whole file
+	VideoCodec    string  // e.g. "h264", "vp9"
+	Width         int     // As displayed, i.e. after rotation
+	Height        int
+	FrameRate     float64
+	Rotation      int // Clockwise degrees the player must rotate: 0, 90, 180, 270
+	AudioCodec    string
+	AudioChannels int
+	SampleRate    int // Hz
+}
+
+// ApplyTo copies the probe result onto a media record
+func (r *ProbeResult) ApplyTo(media *models.Media) {
+	now := time.Now().UTC()
+	media.Duration = r.Duration
+	media.Width = r.Width
+	media.Height = r.Height
+	media.FrameRate = r.FrameRate
+	media.Rotation = r.Rotation
+	media.VideoCodec = r.VideoCodec
+	media.AudioCodec = r.AudioCodec
+	media.AudioChannels = r.AudioChannels
+	media.SampleRate = r.SampleRate
+	media.BitRate = r.BitRate
+	media.ProbedAt = &now
+}
+
+// FFprobe is the ffprobe-based Prober
+type FFprobe struct {
+	path string
+}
+
+// NewFFprobe finds the ffprobe binary
+// binary may be a name on $PATH ("ffprobe") or an absolute path.
+func NewFFprobe(binary string) (*FFprobe, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProberUnavailable, err)
+	}
+	return &FFprobe{path: path}, nil
+}
+
+// Probe runs ffprobe and parses its JSON output
+func (p *FFprobe) Probe(ctx context.Context, input string) (*ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.path,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		input,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// ffprobe exits non-zero for files it can't parse at all
+		return nil, fmt.Errorf("%w: %s", ErrUnreadableMedia, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseFFprobeOutput(stdout.Bytes())
+}
+
+// ffprobeOutput is the subset of `ffprobe -print_format json` we use
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Channels     int               `json:"channels"`
+		SampleRate   string            `json:"sample_rate"`
+		Duration     string            `json:"duration"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []ffprobeSideData `json:"side_data_list"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// ffprobeSideData is per-stream extra info (we only need the display matrix)
+type ffprobeSideData struct {
+	Rotation *float64 `json:"rotation"`
+}
+
+// parseFFprobeOutput maps ffprobe's JSON onto ProbeResult
+// Only the first video and first audio stream count.
+func parseFFprobeOutput(data []byte) (*ProbeResult, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	result := &ProbeResult{
+		Container: out.Format.FormatName,
+		Duration:  parseFloat(out.Format.Duration),
+		BitRate:   int64(parseFloat(out.Format.BitRate)),
+	}
+
+	for _, s := range out.Streams {
+		switch s.CodecType {
+		case "video":
+			// Cover art in music files shows up as a one-frame "video"
+			if result.VideoCodec != "" || s.Disposition.AttachedPic == 1 {
+				continue
+			}
+			result.VideoCodec = s.CodecName
+			result.Width = s.Width
+			result.Height = s.Height
+			result.FrameRate = parseRational(s.AvgFrameRate)
+			if result.FrameRate == 0 {
+				result.FrameRate = parseRational(s.RFrameRate)
+			}
+			result.Rotation = streamRotation(s.Tags["rotate"], s.SideDataList)
+			if result.Rotation == 90 || result.Rotation == 270 {
+				// Phones record portrait video as rotated landscape
+				result.Width, result.Height = result.Height, result.Width
+			}
+			if result.Duration == 0 {
+				result.Duration = parseFloat(s.Duration)
+			}
+		case "audio":
+			if result.AudioCodec != "" {
+				continue
+			}
+			result.AudioCodec = s.CodecName
+			result.AudioChannels = s.Channels
+			result.SampleRate = int(parseFloat(s.SampleRate))
+			if result.Duration == 0 {
+				result.Duration = parseFloat(s.Duration)
+			}
+		}
+	}
+
+	if result.VideoCodec == "" && result.AudioCodec == "" {
+		return nil, fmt.Errorf("%w: no audio or video streams", ErrUnreadableMedia)
+	}
+
+	return result, nil
+}
+
+// streamRotation normalizes rotation metadata to 0/90/180/270 clockwise
+// Older files use a "rotate" tag; newer ffprobe reports a display matrix
+// whose rotation is counter-clockwise, hence the minus sign.
+func streamRotation(tag string, sideData []ffprobeSideData) int {
+	degrees := 0.0
+	if tag != "" {
+		degrees = parseFloat(tag)
+	} else {
+		for _, sd := range sideData {
+			if sd.Rotation != nil {
+				degrees = -*sd.Rotation
+				break
+			}
+		}
+	}
+
+	// Snap to the nearest quarter turn, then into 0..359
+	quarter := int(math.Round(degrees/90)) * 90
+	return ((quarter % 360) + 360) % 360
+}
+
+// parseRational parses ffprobe fractions like "30000/1001"
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return parseFloat(s)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
+
+// parseFloat returns 0 for empty or invalid values ("N/A")
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
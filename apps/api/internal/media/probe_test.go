@@ -0,0 +1,383 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+)
+
+func TestParseFFprobeOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    ProbeResult
+		wantErr error
+	}{
+		{
+			name: "landscape mp4",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+					 "avg_frame_rate": "30000/1001", "r_frame_rate": "30000/1001", "duration": "12.000000"},
+					{"codec_type": "audio", "codec_name": "aac", "channels": 2, "sample_rate": "48000", "duration": "12.010000"}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.012000", "bit_rate": "8123456"}
+			}`,
+			want: ProbeResult{
+				Container:     "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:      12.012,
+				BitRate:       8123456,
+				VideoCodec:    "h264",
+				Width:         1920,
+				Height:        1080,
+				FrameRate:     30000.0 / 1001,
+				AudioCodec:    "aac",
+				AudioChannels: 2,
+				SampleRate:    48000,
+			},
+		},
+		{
+			name: "phone portrait video with a display matrix",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+					 "avg_frame_rate": "30/1", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "3.5"}
+			}`,
+			want: ProbeResult{
+				Container:  "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:   3.5,
+				VideoCodec: "hevc",
+				Width:      1080,
+				Height:     1920,
+				FrameRate:  30,
+				Rotation:   90,
+			},
+		},
+		{
+			name: "rotate tag, upside down",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720,
+					 "avg_frame_rate": "25/1", "tags": {"rotate": "180"}}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "1"}
+			}`,
+			want: ProbeResult{
+				Container:  "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:   1,
+				VideoCodec: "h264",
+				Width:      1280,
+				Height:     720,
+				FrameRate:  25,
+				Rotation:   180,
+			},
+		},
+		{
+			name: "no average frame rate, no format duration",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "vp9", "width": 640, "height": 360,
+					 "avg_frame_rate": "0/0", "r_frame_rate": "24/1", "duration": "N/A"},
+					{"codec_type": "audio", "codec_name": "opus", "channels": 1, "sample_rate": "48000", "duration": "7.25"}
+				],
+				"format": {"format_name": "matroska,webm", "duration": "N/A", "bit_rate": "N/A"}
+			}`,
+			want: ProbeResult{
+				Container:     "matroska,webm",
+				Duration:      7.25,
+				VideoCodec:    "vp9",
+				Width:         640,
+				Height:        360,
+				FrameRate:     24,
+				AudioCodec:    "opus",
+				AudioChannels: 1,
+				SampleRate:    48000,
+			},
+		},
+		{
+			name: "mp3 with cover art",
+			output: `{
+				"streams": [
+					{"codec_type": "audio", "codec_name": "mp3", "channels": 2, "sample_rate": "44100"},
+					{"codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+					 "avg_frame_rate": "0/0", "r_frame_rate": "90000/1", "disposition": {"attached_pic": 1}}
+				],
+				"format": {"format_name": "mp3", "duration": "200.5", "bit_rate": "320000"}
+			}`,
+			want: ProbeResult{
+				Container:     "mp3",
+				Duration:      200.5,
+				BitRate:       320000,
+				AudioCodec:    "mp3",
+				AudioChannels: 2,
+				SampleRate:    44100,
+			},
+		},
+		{
+			name: "only the first stream of each type counts",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "60/1"},
+					{"codec_type": "video", "codec_name": "mjpeg", "width": 320, "height": 240, "avg_frame_rate": "1/1"},
+					{"codec_type": "audio", "codec_name": "aac", "channels": 6, "sample_rate": "48000"},
+					{"codec_type": "audio", "codec_name": "ac3", "channels": 2, "sample_rate": "44100"},
+					{"codec_type": "subtitle", "codec_name": "mov_text"}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "2"}
+			}`,
+			want: ProbeResult{
+				Container:     "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:      2,
+				VideoCodec:    "h264",
+				Width:         1920,
+				Height:        1080,
+				FrameRate:     60,
+				AudioCodec:    "aac",
+				AudioChannels: 6,
+				SampleRate:    48000,
+			},
+		},
+		{
+			name: "single image",
+			output: `{
+				"streams": [
+					{"codec_type": "video", "codec_name": "png", "width": 800, "height": 600,
+					 "avg_frame_rate": "0/0", "r_frame_rate": "25/1"}
+				],
+				"format": {"format_name": "png_pipe", "duration": "0.040000"}
+			}`,
+			want: ProbeResult{
+				Container:  "png_pipe",
+				Duration:   0.04,
+				VideoCodec: "png",
+				Width:      800,
+				Height:     600,
+				FrameRate:  25,
+			},
+		},
+		{
+			name:    "subtitles only",
+			output:  `{"streams": [{"codec_type": "subtitle", "codec_name": "subrip"}], "format": {"format_name": "srt"}}`,
+			wantErr: ErrUnreadableMedia,
+		},
+		{
+			name:    "no streams",
+			output:  `{"format": {"format_name": "mp3"}}`,
+			wantErr: ErrUnreadableMedia,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFFprobeOutput([]byte(tt.output))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got  %+v\nwant %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFFprobeOutputInvalidJSON(t *testing.T) {
+	if _, err := parseFFprobeOutput([]byte(`{"streams": [`)); err == nil {
+		t.Fatal("expected an error for truncated output")
+	}
+}
+
+func TestStreamRotation(t *testing.T) {
+	deg := func(d float64) *float64 { return &d }
+
+	tests := []struct {
+		name     string
+		tag      string
+		sideData []ffprobeSideData
+		want     int
+	}{
+		{name: "none", want: 0},
+		{name: "tag 90", tag: "90", want: 90},
+		{name: "tag 270", tag: "270", want: 270},
+		{name: "negative tag", tag: "-90", want: 270},
+		{name: "full turn", tag: "360", want: 0},
+		{name: "tag not a number", tag: "N/A", want: 0},
+		{name: "matrix is counter-clockwise", sideData: []ffprobeSideData{{Rotation: deg(-90)}}, want: 90},
+		{name: "matrix 90", sideData: []ffprobeSideData{{Rotation: deg(90)}}, want: 270},
+		{name: "matrix 180", sideData: []ffprobeSideData{{Rotation: deg(180)}}, want: 180},
+		{name: "matrix snaps to a quarter turn", sideData: []ffprobeSideData{{Rotation: deg(-89.99)}}, want: 90},
+		{name: "first side data with a rotation", sideData: []ffprobeSideData{{}, {Rotation: deg(-270)}, {Rotation: deg(-90)}}, want: 270},
+		{name: "tag wins over matrix", tag: "180", sideData: []ffprobeSideData{{Rotation: deg(-90)}}, want: 180},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamRotation(tt.tag, tt.sideData); got != tt.want {
+				t.Errorf("streamRotation(%q) = %d, want %d", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRational(t *testing.T) {
+	tests := map[string]float64{
+		"30/1":       30,
+		"30000/1001": 30000.0 / 1001,
+		"0/0":        0,
+		"25":         25,
+		"":           0,
+		"N/A":        0,
+		"1/x":        0,
+	}
+	for in, want := range tests {
+		if got := parseRational(in); got != want {
+			t.Errorf("parseRational(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// fakeProber returns a fixed result, standing in for ffprobe
+type fakeProber struct {
+	result *ProbeResult
+	err    error
+	inputs []string
+}
+
+func (p *fakeProber) Probe(ctx context.Context, input string) (*ProbeResult, error) {
+	p.inputs = append(p.inputs, input)
+	if p.err != nil {
+		return nil, p.err
+	}
+	r := *p.result
+	return &r, nil
+}
+
+var _ Prober = (*fakeProber)(nil)
+
+func TestIngestorProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		prober    *fakeProber
+		format    *Format
+		wantErr   error
+		wantKind  string
+		wantProbe bool // ProbedAt set
+		check     func(t *testing.T, m *models.Media)
+	}{
+		{
+			name: "video",
+			prober: &fakeProber{result: &ProbeResult{
+				Duration: 10, VideoCodec: "h264", Width: 1920, Height: 1080, FrameRate: 30,
+				AudioCodec: "aac", AudioChannels: 2, SampleRate: 48000, BitRate: 5_000_000,
+			}},
+			format:    FormatMP4,
+			wantKind:  models.MediaKindVideo,
+			wantProbe: true,
+			check: func(t *testing.T, m *models.Media) {
+				if m.Width != 1920 || m.Height != 1080 || m.Duration != 10 || m.AudioCodec != "aac" {
+					t.Errorf("probe result not applied: %+v", m)
+				}
+			},
+		},
+		{
+			name:      "mp4 with only sound is audio",
+			prober:    &fakeProber{result: &ProbeResult{Duration: 4, AudioCodec: "aac", AudioChannels: 1, SampleRate: 44100}},
+			format:    FormatMP4,
+			wantKind:  models.MediaKindAudio,
+			wantProbe: true,
+		},
+		{
+			name:      "image drops the one-frame video timing",
+			prober:    &fakeProber{result: &ProbeResult{Duration: 0.04, FrameRate: 25, BitRate: 1000, VideoCodec: "png", Width: 800, Height: 600}},
+			format:    FormatPNG,
+			wantKind:  models.MediaKindImage,
+			wantProbe: true,
+			check: func(t *testing.T, m *models.Media) {
+				if m.Duration != 0 || m.FrameRate != 0 || m.BitRate != 0 {
+					t.Errorf("image kept video timing: duration %v, frame rate %v, bit rate %v", m.Duration, m.FrameRate, m.BitRate)
+				}
+			},
+		},
+		{
+			name:    "codec the container doesn't allow",
+			prober:  &fakeProber{result: &ProbeResult{VideoCodec: "prores", Width: 1920, Height: 1080}},
+			format:  FormatMP4,
+			wantErr: ErrUnsupportedCodec,
+		},
+		{
+			name:    "audio format without audio",
+			prober:  &fakeProber{result: &ProbeResult{VideoCodec: "mjpeg", Width: 600, Height: 600}},
+			format:  FormatMP3,
+			wantErr: ErrUnsupportedCodec,
+		},
+		{
+			name:    "oversized image",
+			prober:  &fakeProber{result: &ProbeResult{VideoCodec: "png", Width: 20000, Height: 100}},
+			format:  FormatPNG,
+			wantErr: ErrImageTooLarge,
+		},
+		{
+			name:    "unreadable file is rejected",
+			prober:  &fakeProber{err: ErrUnreadableMedia},
+			format:  FormatMP4,
+			wantErr: ErrUnreadableMedia,
+		},
+		{
+			name:   "probe failure isn't the file's fault",
+			prober: &fakeProber{err: context.DeadlineExceeded},
+			format: FormatMP4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &Ingestor{prober: tt.prober}
+			m := &models.Media{ID: uuid.New()}
+
+			err := in.probe(context.Background(), m, tt.format, "/tmp/upload")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.prober.inputs) != 1 || tt.prober.inputs[0] != "/tmp/upload" {
+				t.Errorf("prober called with %v", tt.prober.inputs)
+			}
+			if m.Kind != tt.wantKind {
+				t.Errorf("kind = %q, want %q", m.Kind, tt.wantKind)
+			}
+			if (m.ProbedAt != nil) != tt.wantProbe {
+				t.Errorf("ProbedAt = %v, want set: %v", m.ProbedAt, tt.wantProbe)
+			}
+			if tt.check != nil {
+				tt.check(t, m)
+			}
+		})
+	}
+}
+
+func TestIngestorProbeWithoutProber(t *testing.T) {
+	in := &Ingestor{}
+	m := &models.Media{ID: uuid.New()}
+	if err := in.probe(context.Background(), m, FormatMP4, "/tmp/upload"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.ProbedAt != nil {
+		t.Error("ProbedAt set without a prober")
+	}
+}
@@ -0,0 +1,172 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// JobProxy transcodes low-resolution preview copies
+const JobProxy = "proxy"
+
+// proxyRenditions are the preview sizes, by their short side
+// Portrait video gets the same treatment (540x960 rather than 304x540).
+var proxyRenditions = []struct {
+	name      string
+	shortSide int
+}{
+	{"540p", 540},
+	{"720p", 720},
+}
+
+// proxyKeyframeInterval is the seconds between keyframes in a proxy
+// Seeking decodes from the previous keyframe, so frequent keyframes make
+// scrubbing instant at the cost of a somewhat bigger file.
+const proxyKeyframeInterval = 0.5
+
+// ProxyKey is where a named proxy of a media file is stored
+func ProxyKey(mediaID uuid.UUID, name string) string {
+	return storage.ProxyKey(mediaID, name+".mp4")
+}
+
+// Proxier is the proxy job
+type Proxier struct {
+	ffmpeg    *FFmpeg
+	blobs     storage.BlobStore
+	mediaRepo *repository.MediaRepository
+}
+
+// NewProxier creates the proxy job
+func NewProxier(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository) *Proxier {
+	return &Proxier{
+		ffmpeg:    ffmpeg,
+		blobs:     blobs,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// Kind implements Job
+func (p *Proxier) Kind() string {
+	return JobProxy
+}
+
+// Wants implements Job: videos bigger than the smallest proxy
+// Smaller ones are already light enough to preview as they are.
+func (p *Proxier) Wants(media *models.Media) bool {
+	return media.Kind == models.MediaKindVideo && media.VideoCodec != "" && len(proxySizes(media.Width, media.Height)) > 0
+}
+
+// Run implements Job
+func (p *Proxier) Run(ctx context.Context, job *models.MediaJob, media *models.Media) error {
+	input, err := storage.ToolInput(ctx, p.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tempo-proxy-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var proxies []models.Proxy
+	for _, size := range proxySizes(media.Width, media.Height) {
+		out := filepath.Join(dir, size.Name+".mp4")
+		if err := p.transcode(ctx, input, media.AudioCodec != "", size, out); err != nil {
+			return err
+		}
+
+		info, err := storage.PutFile(ctx, p.blobs, ProxyKey(media.DerivedID(), size.Name), out, "video/mp4")
+		if err != nil {
+			return err
+		}
+
+		size.Size = info.Size
+		proxies = append(proxies, size)
+	}
+
+	return p.mediaRepo.SetProxies(ctx, job, media.DerivedID(), proxies)
+}
+
+// transcode writes one proxy
+//
+// H.264 + AAC in MP4 plays in every browser. "faststart" moves the index
+// to the front so playback starts before the whole file has loaded.
+func (p *Proxier) transcode(ctx context.Context, input string, hasAudio bool, size models.Proxy, out string) error {
+	args := []string{
+		"-i", input,
+		"-vf", fmt.Sprintf("scale=%d:%d", size.Width, size.Height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "26",
+		"-profile:v", "high",
+		"-pix_fmt", "yuv420p",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", proxyKeyframeInterval),
+	}
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-b:a", "128k")
+	} else {
+		args = append(args, "-an")
+	}
+	args = append(args, "-movflags", "+faststart", "-y", out)
+
+	return p.ffmpeg.Run(ctx, args...)
+}
+
+// proxySizes returns the proxies to make for a video of the given
+// (displayed) size: each rendition smaller than the source
+func proxySizes(width, height int) []models.Proxy {
+	var sizes []models.Proxy
+	for _, r := range proxyRenditions {
+		if r.shortSide >= shortSide(width, height) {
+			continue
+		}
+		w, h := scaleToShortSide(width, height, r.shortSide)
+		sizes = append(sizes, models.Proxy{Name: r.name, Width: w, Height: h})
+	}
+	return sizes
+}
+
+// shortSide is the smaller dimension of a video (0 if unknown)
+func shortSide(width, height int) int {
+	if width < height {
+		return width
+	}
+	return height
+}
+
+// scaleToShortSide scales a video so its short side is short, keeping the
+// aspect ratio. The long side is rounded to even: H.264 needs even
+// dimensions.
+func scaleToShortSide(width, height, short int) (int, int) {
+	from := shortSide(width, height)
+	long := width
+	if width < height {
+		long = height
+	}
+	scaledLong := int(math.Round(float64(long)*float64(short)/float64(from)/2)) * 2
+	if width < height {
+		return short, scaledLong
+	}
+	return scaledLong, short
+}
+
+// PickProxy chooses what to preview: the largest proxy that's ready, or
+// nil if there is none (use the original)
+func PickProxy(media *models.Media) *models.Proxy {
+	var best *models.Proxy
+	for i := range media.Proxies {
+		if best == nil || media.Proxies[i].Height*media.Proxies[i].Width > best.Height*best.Width {
+			best = &media.Proxies[i]
+		}
+	}
+	return best
+}
@@ -0,0 +1,155 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+)
+
+// ErrQuotaExceeded is returned when storing something would take a user
+// or project over its storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Quota scopes
+const (
+	QuotaUser    = "user"
+	QuotaProject = "project"
+)
+
+// QuotaError says which quota a file would exceed and by how much
+type QuotaError struct {
+	Scope  string // QuotaUser or QuotaProject
+	Used   int64
+	Limit  int64
+	Adding int64 // An estimate for exports, whose size isn't known up front
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s storage quota exceeded: %s of %s used", e.Scope, FormatBytes(e.Used), FormatBytes(e.Limit))
+}
+
+// Unwrap makes errors.Is(err, ErrQuotaExceeded) work
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Quotas enforces the storage limits
+//
+// Usage is computed from the media, frame and export records on every
+// check rather than kept in a counter: a few indexed sums per upload are
+// cheap, and there is no running total that can drift. Two uploads racing
+// each other can both pass, so a quota is a soft limit - off by at most
+// one file.
+type Quotas struct {
+	mediaRepo    *repository.MediaRepository
+	userLimit    int64 // 0 = unlimited
+	projectLimit int64
+}
+
+// NewQuotas creates the quota checker
+// Limits are in bytes; 0 means unlimited.
+func NewQuotas(mediaRepo *repository.MediaRepository, userLimit, projectLimit int64) *Quotas {
+	return &Quotas{
+		mediaRepo:    mediaRepo,
+		userLimit:    userLimit,
+		projectLimit: projectLimit,
+	}
+}
+
+// Check returns a *QuotaError if storing size more bytes for the user
+// (and the project, if not nil) would exceed a quota
+//
+// With the content's hash, content already stored for the user or the
+// project counts as free there - it's stored once (see Ingest).
+func (q *Quotas) Check(ctx context.Context, userID uuid.UUID, projectID *uuid.UUID, size int64, contentHash *string) error {
+	if q.userLimit == 0 && (q.projectLimit == 0 || projectID == nil) {
+		return nil
+	}
+
+	userSize, projectSize := size, size
+	if contentHash != nil {
+		userHas, projectHas, err := q.mediaRepo.HasContent(ctx, *contentHash, userID, projectID)
+		if err != nil {
+			return err
+		}
+		if userHas {
+			userSize = 0
+		}
+		if projectHas {
+			projectSize = 0
+		}
+	}
+
+	if q.userLimit > 0 {
+		usage, err := q.mediaRepo.UserStorage(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if usage.UsedBytes+userSize > q.userLimit {
+			return &QuotaError{Scope: QuotaUser, Used: usage.UsedBytes, Limit: q.userLimit, Adding: size}
+		}
+	}
+
+	if q.projectLimit > 0 && projectID != nil {
+		usage, err := q.mediaRepo.ProjectStorage(ctx, *projectID)
+		if err != nil {
+			return err
+		}
+		if usage.UsedBytes+projectSize > q.projectLimit {
+			return &QuotaError{Scope: QuotaProject, Used: usage.UsedBytes, Limit: q.projectLimit, Adding: size}
+		}
+	}
+	return nil
+}
+
+// CheckExport returns a *QuotaError if a render of a project would take
+// the user or the project over its quota
+// A render's size isn't known until it's done: estimate is the caller's
+// guess, so this errs like any soft limit.
+func (q *Quotas) CheckExport(ctx context.Context, userID, projectID uuid.UUID, estimate int64) error {
+	return q.Check(ctx, userID, &projectID, estimate, nil)
+}
+
+// Usage returns the user's storage usage with the quotas filled in
+func (q *Quotas) Usage(ctx context.Context, userID uuid.UUID) (*models.StorageUsage, error) {
+	usage, err := q.mediaRepo.UserStorage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage.QuotaBytes = q.userLimit
+
+	if q.projectLimit > 0 {
+		for i := range usage.Projects {
+			p := &usage.Projects[i]
+			if p.ProjectID == nil {
+				continue
+			}
+			total, err := q.mediaRepo.ProjectStorage(ctx, *p.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			p.ProjectUsedBytes = total.UsedBytes
+			p.ProjectQuotaBytes = q.projectLimit
+		}
+	}
+	return usage, nil
+}
+
+// FormatBytes formats a size for people, e.g. "1.5 GB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,195 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// JobScenes finds the shot boundaries (cuts) of a video
+const JobScenes = "scenes"
+
+// Scene detection settings
+//
+// HOW IT WORKS: ffmpeg's scene filter scores every frame by how much it
+// differs from the previous one (sum of absolute pixel differences,
+// corrected for overall motion), from 0 to 1. A hard cut scores high,
+// a pan or a moving subject low. Frames are scaled down first: a cut is
+// just as visible at 320 pixels and scoring is much cheaper.
+const (
+	// SceneMinScore is the lowest score kept as a candidate
+	// Ordinary motion stays well below it; thresholds below it can't be
+	// asked for.
+	SceneMinScore = 0.1
+
+	// DefaultSceneThreshold is the score most hard cuts exceed while
+	// camera moves and lighting changes don't (MEDIA_SCENE_THRESHOLD)
+	DefaultSceneThreshold = 0.3
+
+	// sceneMinGap is the shortest shot, in seconds
+	// Flashes, strobes and fades score high on several frames in a row;
+	// of cuts closer than this only the strongest is kept.
+	sceneMinGap = 0.5
+
+	sceneAnalysisWidth = 320
+)
+
+// SceneDetector is the scenes job
+type SceneDetector struct {
+	ffmpeg    *FFmpeg
+	blobs     storage.BlobStore
+	mediaRepo *repository.MediaRepository
+}
+
+// NewSceneDetector creates the scenes job
+func NewSceneDetector(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository) *SceneDetector {
+	return &SceneDetector{
+		ffmpeg:    ffmpeg,
+		blobs:     blobs,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// Kind implements Job
+func (d *SceneDetector) Kind() string {
+	return JobScenes
+}
+
+// Wants implements Job: probed videos
+func (d *SceneDetector) Wants(media *models.Media) bool {
+	return media.Kind == models.MediaKindVideo && media.VideoCodec != "" && media.Duration > 0
+}
+
+// Run implements Job
+// The whole video is decoded once; select passes only the candidate
+// frames on, and metadata=print writes their time and score to stdout.
+func (d *SceneDetector) Run(ctx context.Context, job *models.MediaJob, media *models.Media) error {
+	input, err := storage.ToolInput(ctx, d.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	filter := fmt.Sprintf("scale=%d:-2,select='gt(scene,%g)',metadata=print:file=-", sceneAnalysisWidth, SceneMinScore)
+	var out bytes.Buffer
+	err = d.ffmpeg.Output(ctx, &out,
+		"-i", input,
+		"-map", "0:v:0",
+		"-an", "-sn",
+		"-vf", filter,
+		"-f", "null", "-",
+	)
+	if err != nil {
+		return err
+	}
+
+	markers, err := parseSceneScores(&out)
+	if err != nil {
+		return err
+	}
+	markers = mergeCloseScenes(markers, sceneMinGap)
+
+	detection := &models.SceneDetection{MinScore: SceneMinScore, Candidates: len(markers)}
+	return d.mediaRepo.SetScenes(ctx, job, media.DerivedID(), detection, markers)
+}
+
+// parseSceneScores reads metadata=print output, which has a line per
+// frame followed by its metadata:
+//
+//	frame:41   pts:42042   pts_time:1.4014
+//	lavfi.scene_score=0.734208
+func parseSceneScores(r io.Reader) ([]models.SceneMarker, error) {
+	var markers []models.SceneMarker
+	frameTime := -1.0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "frame:") {
+			frameTime = -1
+			for _, field := range strings.Fields(line) {
+				if value, ok := strings.CutPrefix(field, "pts_time:"); ok {
+					t, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						return nil, fmt.Errorf("bad frame time %q in scene scores", value)
+					}
+					frameTime = t
+				}
+			}
+			continue
+		}
+
+		value, ok := strings.CutPrefix(line, "lavfi.scene_score=")
+		if !ok || frameTime < 0 {
+			continue
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad scene score %q", value)
+		}
+		markers = append(markers, models.SceneMarker{Time: frameTime, Score: score})
+	}
+	return markers, scanner.Err()
+}
+
+// mergeCloseScenes keeps only the strongest of cuts less than gap apart
+// markers must be in time order.
+func mergeCloseScenes(markers []models.SceneMarker, gap float64) []models.SceneMarker {
+	merged := []models.SceneMarker{}
+	for _, m := range markers {
+		last := len(merged) - 1
+		if last >= 0 && m.Time-merged[last].Time < gap {
+			if m.Score > merged[last].Score {
+				merged[last] = m
+			}
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// SnapPoint is a shot boundary of a clip, in timeline time
+type SnapPoint struct {
+	Time       float64 `json:"time"` // Seconds on the timeline
+	ClipID     string  `json:"clip_id"`
+	SourceTime float64 `json:"source_time"` // Seconds into the clip's file
+	Score      float64 `json:"score"`
+}
+
+// TimelineScenes maps the shot boundaries of a timeline's media clips to
+// timeline time, sorted by time
+// Only cuts inside the used part of each clip count; a cut right at the
+// clip's start is the clip edge itself, which editors snap to anyway.
+func TimelineScenes(timeline *models.Timeline, markers map[uuid.UUID][]models.SceneMarker) []SnapPoint {
+	points := []SnapPoint{}
+	for _, clip := range timeline.Media {
+		sourceOut := clip.SourceIn + clip.EndTime - clip.StartTime
+		for _, m := range markers[clip.MediaID] {
+			if m.Time <= clip.SourceIn || m.Time >= sourceOut {
+				continue
+			}
+			points = append(points, SnapPoint{
+				Time:       clip.StartTime + m.Time - clip.SourceIn,
+				ClipID:     clip.ID,
+				SourceTime: m.Time,
+				Score:      m.Score,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Time < points[j].Time
+	})
+	return points
+}
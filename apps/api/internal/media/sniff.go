@@ -0,0 +1,542 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported media format")
+	ErrFormatMismatch    = errors.New("file content does not match its declared type")
+	ErrUnsupportedCodec  = errors.New("unsupported codec")
+	ErrFileTooLarge      = errors.New("file too large")
+	ErrImageTooLarge     = errors.New("image dimensions too large")
+	ErrMissingStream     = errors.New("file has no usable stream")
+)
+
+// Image limits
+// A 5KB PNG can declare 50000x50000 pixels and take 10GB to decode, so
+// images are checked by their dimensions, not just their size. 16384 is
+// also the largest texture most GPUs take.
+const (
+	maxImageSide   = 16384
+	maxImagePixels = 64 << 20 // 8192x8192
+)
+
+// sniffLen is how much of a file Sniff looks at
+// The container headers we check sit in the first few hundred bytes.
+const sniffLen = 4096
+
+// Format is a container format we accept
+//
+// WHY SNIFF?
+// The Content-Type header and the file extension are whatever the client
+// says they are - anyone can label arbitrary bytes "video/mp4". The first
+// bytes of the file can't lie: every container starts with a signature
+// and a header structure we can check before storing anything.
+type Format struct {
+	Name        string // Short name shown to users, e.g. "MP4"
+	Kind        string // models.MediaKindVideo, MediaKindImage or MediaKindAudio
+	Ext         string // Extension the file is stored under
+	ContentType string // The type we serve it as
+
+	// Largest file accepted, 0 = only the upload limit
+	maxSize int64
+
+	// Types a client may declare for this format. Browsers disagree on
+	// MP4 vs QuickTime, so the ISO family accepts both.
+	declaredTypes []string
+
+	// Codecs the editor can decode in this container (ffprobe names)
+	// Images are a single "video" frame to ffprobe, so they list theirs
+	// as video codecs.
+	videoCodecs []string
+	audioCodecs []string
+}
+
+// Video formats
+var (
+	FormatMP4 = &Format{
+		Name:          "MP4",
+		Kind:          models.MediaKindVideo,
+		Ext:           ".mp4",
+		ContentType:   "video/mp4",
+		declaredTypes: []string{"video/mp4", "video/quicktime", "video/x-m4v"},
+		videoCodecs:   []string{"h264", "hevc", "av1", "vp9", "mpeg4"},
+		audioCodecs:   []string{"aac", "mp3", "opus", "alac", "flac", "ac3", "eac3"},
+	}
+	FormatMOV = &Format{
+		Name:          "MOV",
+		Kind:          models.MediaKindVideo,
+		Ext:           ".mov",
+		ContentType:   "video/quicktime",
+		declaredTypes: []string{"video/quicktime", "video/mp4", "video/x-m4v"},
+		videoCodecs:   []string{"h264", "hevc", "prores", "mpeg4", "mjpeg"},
+		audioCodecs:   []string{"aac", "mp3", "alac", "ac3", "eac3", "pcm_*"},
+	}
+	FormatWebM = &Format{
+		Name:          "WebM",
+		Kind:          models.MediaKindVideo,
+		Ext:           ".webm",
+		ContentType:   "video/webm",
+		declaredTypes: []string{"video/webm", "audio/webm"},
+		videoCodecs:   []string{"vp8", "vp9", "av1"},
+		audioCodecs:   []string{"opus", "vorbis"},
+	}
+)
+
+// Image formats
+// Still images only: browsers can't decode HEIC, and animated GIFs or
+// WebPs belong in a video container.
+var (
+	FormatPNG = &Format{
+		Name:          "PNG",
+		Kind:          models.MediaKindImage,
+		Ext:           ".png",
+		ContentType:   "image/png",
+		maxSize:       50 << 20,
+		declaredTypes: []string{"image/png"},
+		videoCodecs:   []string{"png"},
+	}
+	FormatJPEG = &Format{
+		Name:          "JPEG",
+		Kind:          models.MediaKindImage,
+		Ext:           ".jpg",
+		ContentType:   "image/jpeg",
+		maxSize:       50 << 20,
+		declaredTypes: []string{"image/jpeg", "image/jpg", "image/pjpeg"},
+		videoCodecs:   []string{"mjpeg"},
+	}
+	FormatWebP = &Format{
+		Name:          "WebP",
+		Kind:          models.MediaKindImage,
+		Ext:           ".webp",
+		ContentType:   "image/webp",
+		maxSize:       50 << 20,
+		declaredTypes: []string{"image/webp"},
+		videoCodecs:   []string{"webp"},
+	}
+)
+
+// Audio formats
+// Cover art inside them is ignored (see parseFFprobeOutput); any other
+// video stream makes the file a video, which these formats can't hold.
+var (
+	FormatMP3 = &Format{
+		Name:          "MP3",
+		Kind:          models.MediaKindAudio,
+		Ext:           ".mp3",
+		ContentType:   "audio/mpeg",
+		declaredTypes: []string{"audio/mpeg", "audio/mp3"},
+		audioCodecs:   []string{"mp3"},
+	}
+	FormatM4A = &Format{
+		Name:          "M4A",
+		Kind:          models.MediaKindAudio,
+		Ext:           ".m4a",
+		ContentType:   "audio/mp4",
+		declaredTypes: []string{"audio/mp4", "audio/x-m4a", "audio/m4a", "audio/aac"},
+		audioCodecs:   []string{"aac", "alac", "mp3"},
+	}
+	FormatWAV = &Format{
+		Name:          "WAV",
+		Kind:          models.MediaKindAudio,
+		Ext:           ".wav",
+		ContentType:   "audio/wav",
+		declaredTypes: []string{"audio/wav", "audio/x-wav", "audio/wave", "audio/vnd.wave"},
+		audioCodecs:   []string{"pcm_*"},
+	}
+	FormatFLAC = &Format{
+		Name:          "FLAC",
+		Kind:          models.MediaKindAudio,
+		Ext:           ".flac",
+		ContentType:   "audio/flac",
+		declaredTypes: []string{"audio/flac", "audio/x-flac"},
+		audioCodecs:   []string{"flac"},
+	}
+	FormatOgg = &Format{
+		Name:          "Ogg",
+		Kind:          models.MediaKindAudio,
+		Ext:           ".ogg",
+		ContentType:   "audio/ogg",
+		declaredTypes: []string{"audio/ogg", "audio/opus", "application/ogg"},
+		audioCodecs:   []string{"opus", "vorbis", "flac"},
+	}
+)
+
+// SupportedFormats lists the formats uploads may use
+var SupportedFormats = []*Format{
+	FormatMP4, FormatMOV, FormatWebM,
+	FormatPNG, FormatJPEG, FormatWebP,
+	FormatMP3, FormatM4A, FormatWAV, FormatFLAC, FormatOgg,
+}
+
+// SupportedFormatNames is the human-readable list for error messages
+func SupportedFormatNames() string {
+	names := make([]string, len(SupportedFormats))
+	for i, f := range SupportedFormats {
+		names[i] = f.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// DeclarableType reports whether a client-declared Content-Type could be
+// a supported format. Used to fail fast before any bytes arrive; the
+// real check happens in Sniff. Clients that don't know the type send ""
+// or application/octet-stream, and that's fine - the bytes decide.
+func DeclarableType(contentType string) bool {
+	contentType = normalizeType(contentType)
+	if contentType == "" || contentType == "application/octet-stream" {
+		return true
+	}
+	for _, f := range SupportedFormats {
+		if f.accepts(contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDeclaredType rejects a file whose declared type contradicts its
+// content, e.g. WebM bytes uploaded as video/mp4
+func (f *Format) CheckDeclaredType(contentType string) error {
+	contentType = normalizeType(contentType)
+	if contentType == "" || contentType == "application/octet-stream" || f.accepts(contentType) {
+		return nil
+	}
+	return fmt.Errorf("%w: declared %s, content is %s", ErrFormatMismatch, contentType, f.Name)
+}
+
+// CheckSize rejects files larger than the format allows
+func (f *Format) CheckSize(size int64) error {
+	if f.maxSize > 0 && size > f.maxSize {
+		return fmt.Errorf("%w: %s files can be at most %s", ErrFileTooLarge, f.Name, FormatBytes(f.maxSize))
+	}
+	return nil
+}
+
+func (f *Format) accepts(contentType string) bool {
+	for _, t := range f.declaredTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// CodecError reports a stream the editor can't decode
+type CodecError struct {
+	Stream    string // "video" or "audio"
+	Codec     string
+	Format    *Format
+	Supported []string
+}
+
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("unsupported %s codec %q in %s", e.Stream, e.Codec, e.Format.Name)
+}
+
+func (e *CodecError) Unwrap() error {
+	return ErrUnsupportedCodec
+}
+
+// CheckCodecs rejects probe results with codecs this format doesn't allow
+func (f *Format) CheckCodecs(r *ProbeResult) error {
+	if r.VideoCodec != "" && !codecAllowed(f.videoCodecs, r.VideoCodec) {
+		return &CodecError{Stream: "video", Codec: r.VideoCodec, Format: f, Supported: f.videoCodecs}
+	}
+	if r.AudioCodec != "" && !codecAllowed(f.audioCodecs, r.AudioCodec) {
+		return &CodecError{Stream: "audio", Codec: r.AudioCodec, Format: f, Supported: f.audioCodecs}
+	}
+	return nil
+}
+
+// KindOf decides what a probed file is and checks it has what that
+// kind needs
+// A video container with only a sound track is audio (an MP4 from a
+// voice recorder, a WebM from the browser's MediaRecorder).
+func (f *Format) KindOf(r *ProbeResult) (string, error) {
+	switch f.Kind {
+	case models.MediaKindImage:
+		if r.Width <= 0 || r.Height <= 0 {
+			return "", fmt.Errorf("%w: image without dimensions", ErrUnreadableMedia)
+		}
+		if r.Width > maxImageSide || r.Height > maxImageSide || r.Width*r.Height > maxImagePixels {
+			return "", fmt.Errorf("%w: %dx%d, images can be at most %dx%d and %d megapixels",
+				ErrImageTooLarge, r.Width, r.Height, maxImageSide, maxImageSide, maxImagePixels>>20)
+		}
+		return models.MediaKindImage, nil
+
+	case models.MediaKindAudio:
+		if r.AudioCodec == "" {
+			return "", fmt.Errorf("%w: %s file without an audio stream", ErrMissingStream, f.Name)
+		}
+		return models.MediaKindAudio, nil
+
+	default:
+		if r.VideoCodec == "" {
+			return models.MediaKindAudio, nil
+		}
+		return models.MediaKindVideo, nil
+	}
+}
+
+// codecAllowed matches a codec against a list, where "pcm_*" covers
+// every PCM sample layout (pcm_s16le, pcm_s24be, ...)
+func codecAllowed(allowed []string, codec string) bool {
+	for _, a := range allowed {
+		if a == codec || (strings.HasSuffix(a, "*") && strings.HasPrefix(codec, strings.TrimSuffix(a, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sniff identifies a file's container from its first bytes
+// head should be the first sniffLen bytes (less if the file is shorter).
+// Formats with a fixed signature are checked first; ISO files only have
+// a plausible box structure, so they're the fallback.
+func Sniff(head []byte) (*Format, error) {
+	switch {
+	case bytes.HasPrefix(head, ebmlMagic):
+		return sniffEBML(head)
+	case bytes.HasPrefix(head, pngMagic):
+		return FormatPNG, nil
+	case bytes.HasPrefix(head, jpegMagic):
+		return FormatJPEG, nil
+	case len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")):
+		return sniffRIFF(head)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return FormatFLAC, nil
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return FormatOgg, nil
+	case bytes.HasPrefix(head, []byte("ID3")) || isMPEGAudioFrame(head):
+		return FormatMP3, nil
+	case len(head) >= 8:
+		return sniffISOBMFF(head)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// Signatures of the single-image formats
+var (
+	pngMagic  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+)
+
+// RIFF (WAV, WebP)
+//
+// "RIFF", a 4-byte little-endian size, then a form type saying what the
+// chunks inside are. Extended WebP (a "VP8X" chunk) has flags saying
+// whether the image is animated.
+
+// webpAnimationFlag is set in the VP8X flags of animated WebP
+const webpAnimationFlag = 0x02
+
+func sniffRIFF(head []byte) (*Format, error) {
+	switch string(head[8:12]) {
+	case "WAVE":
+		return FormatWAV, nil
+	case "WEBP":
+		if len(head) >= 21 && string(head[12:16]) == "VP8X" && head[20]&webpAnimationFlag != 0 {
+			return nil, fmt.Errorf("%w: animated WebP", ErrUnsupportedFormat)
+		}
+		return FormatWebP, nil
+	}
+	return nil, fmt.Errorf("%w: RIFF %q", ErrUnsupportedFormat, head[8:12])
+}
+
+// isMPEGAudioFrame reports whether head starts with an MPEG audio frame
+// header, i.e. an MP3 without an ID3 tag
+// The 11-bit sync word alone shows up in random data, so the version,
+// layer, bit rate and sample rate fields must hold valid values too.
+func isMPEGAudioFrame(head []byte) bool {
+	if len(head) < 4 || head[0] != 0xff || head[1]&0xe0 != 0xe0 {
+		return false
+	}
+	version := (head[1] >> 3) & 0x03
+	layer := (head[1] >> 1) & 0x03
+	bitRate := head[2] >> 4
+	sampleRate := (head[2] >> 2) & 0x03
+	return version != 0x01 && layer != 0x00 && bitRate != 0x0f && bitRate != 0x00 && sampleRate != 0x03
+}
+
+// ISO base media file format (MP4, MOV)
+//
+// The file is a sequence of "boxes": 4-byte big-endian size, 4-byte type,
+// payload. Modern files open with an "ftyp" box whose major brand tells
+// MP4 ("isom", "mp42", ...) from QuickTime ("qt  "). Old QuickTime files
+// skip ftyp and start straight with a movie or padding box.
+
+// quickTimeLeadBoxes may open a QuickTime file that has no ftyp box
+var quickTimeLeadBoxes = map[string]bool{
+	"moov": true, "mdat": true, "wide": true, "free": true, "skip": true, "pnot": true,
+}
+
+// imageBrands are ISO files that hold still images, not video
+var imageBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "mif1": true, "msf1": true, "avif": true, "avis": true,
+}
+
+// audioBrands are ISO files that hold audio only
+// M4P is DRM-protected iTunes audio, which nothing but iTunes can decode.
+var audioBrands = map[string]bool{
+	"M4A ": true, "M4B ": true,
+}
+
+func sniffISOBMFF(head []byte) (*Format, error) {
+	if err := checkBoxes(head); err != nil {
+		return nil, err
+	}
+
+	boxType := string(head[4:8])
+	if boxType != "ftyp" {
+		if quickTimeLeadBoxes[boxType] {
+			return FormatMOV, nil
+		}
+		return nil, ErrUnsupportedFormat
+	}
+
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size < 16 || size > len(head) {
+		return nil, fmt.Errorf("%w: malformed ftyp box", ErrUnsupportedFormat)
+	}
+
+	major := string(head[8:12])
+	if audioBrands[major] {
+		return FormatM4A, nil
+	}
+	if imageBrands[major] || major == "M4P " {
+		return nil, ErrUnsupportedFormat
+	}
+	if major == "qt  " {
+		return FormatMOV, nil
+	}
+	return FormatMP4, nil
+}
+
+// checkBoxes walks the top-level boxes that fit in head
+// Random bytes almost never produce a chain of plausible sizes and
+// four-letter types, so this rejects files that only fake the signature.
+func checkBoxes(head []byte) error {
+	for offset := 0; offset+8 <= len(head); {
+		size := uint64(binary.BigEndian.Uint32(head[offset:]))
+		boxType := head[offset+4 : offset+8]
+		for _, c := range boxType {
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("%w: invalid box type", ErrUnsupportedFormat)
+			}
+		}
+
+		switch size {
+		case 0:
+			// Box runs to the end of the file
+			return nil
+		case 1:
+			// 64-bit size follows the type
+			if offset+16 > len(head) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(head[offset+8:])
+			if size < 16 {
+				return fmt.Errorf("%w: invalid box size", ErrUnsupportedFormat)
+			}
+		default:
+			if size < 8 {
+				return fmt.Errorf("%w: invalid box size", ErrUnsupportedFormat)
+			}
+		}
+
+		if size >= uint64(len(head)-offset) {
+			// The rest of the box is beyond what we peeked at
+			return nil
+		}
+		offset += int(size)
+	}
+	return nil
+}
+
+// EBML (Matroska, WebM)
+//
+// The file opens with an EBML header element whose DocType child says
+// which flavour it is. Element IDs and sizes are variable-length
+// integers: the number of leading zero bits in the first byte gives the
+// length.
+
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+const ebmlDocTypeID = 0x4282
+
+func sniffEBML(head []byte) (*Format, error) {
+	size, n, ok := readVint(head[4:], true)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed EBML header", ErrUnsupportedFormat)
+	}
+	body := head[4+n:]
+	if size < uint64(len(body)) {
+		body = body[:size]
+	}
+
+	for len(body) > 0 {
+		id, idLen, ok := readVint(body, false)
+		if !ok {
+			break
+		}
+		elemSize, sizeLen, ok := readVint(body[idLen:], true)
+		if !ok {
+			break
+		}
+		start := idLen + sizeLen
+		if elemSize > uint64(len(body)-start) {
+			break
+		}
+		end := start + int(elemSize)
+
+		if id == ebmlDocTypeID {
+			docType := strings.TrimRight(string(body[start:end]), "\x00")
+			if docType == "webm" {
+				return FormatWebM, nil
+			}
+			// Plain Matroska can hold codecs browsers can't play
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, docType)
+		}
+		body = body[end:]
+	}
+
+	return nil, fmt.Errorf("%w: EBML header without DocType", ErrUnsupportedFormat)
+}
+
+// readVint decodes an EBML variable-length integer
+// Sizes drop the length marker bit (stripMarker), element IDs keep it.
+func readVint(b []byte, stripMarker bool) (value uint64, length int, ok bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	length = 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(b) < length {
+		return 0, 0, false
+	}
+
+	value = uint64(b[0])
+	if stripMarker {
+		value &= uint64(0xff >> length)
+	}
+	for _, c := range b[1:length] {
+		value = value<<8 | uint64(c)
+	}
+	return value, length, true
+}
+
+// normalizeType drops parameters like "; codecs=..." and lowercases
+func normalizeType(contentType string) string {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
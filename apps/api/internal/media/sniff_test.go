@@ -0,0 +1,253 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// box builds an ISO BMFF box: 4-byte size, type, payload
+func box(boxType string, payload ...byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], boxType)
+	return append(b, payload...)
+}
+
+// ftyp builds an ftyp box with a major brand, minor version 0 and the
+// given compatible brands
+func ftyp(major string, compatible ...string) []byte {
+	payload := append([]byte(major), 0, 0, 0, 0)
+	for _, c := range compatible {
+		payload = append(payload, c...)
+	}
+	return box("ftyp", payload...)
+}
+
+// ebml builds an EBML header holding a DocType element
+func ebml(docType string) []byte {
+	docTypeElem := append([]byte{0x42, 0x82, 0x80 | byte(len(docType))}, docType...)
+	// EBMLVersion = 1 first, as real files have it
+	body := append([]byte{0x42, 0x86, 0x81, 0x01}, docTypeElem...)
+	return append(append([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x80 | byte(len(body))}, body...), 0x18, 0x53, 0x80, 0x67)
+}
+
+// riff builds a RIFF header of a form type followed by chunk bytes
+func riff(form string, chunks ...byte) []byte {
+	b := []byte("RIFF\x24\x00\x00\x00" + form)
+	return append(b, chunks...)
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want *Format
+	}{
+		// ISO BMFF
+		{"mp4 isom", cat(ftyp("isom", "isom", "iso2", "avc1", "mp41"), box("free"), box("mdat", 0, 0)), FormatMP4},
+		{"mp4 mp42", cat(ftyp("mp42", "mp42", "isom"), box("moov")), FormatMP4},
+		{"mp4 from a phone", cat(ftyp("3gp4", "isom", "3gp4")), FormatMP4},
+		{"quicktime brand", cat(ftyp("qt  ", "qt  "), box("wide"), box("mdat")), FormatMOV},
+		{"old quicktime without ftyp", cat(box("moov", 0, 0, 0, 0), box("mdat")), FormatMOV},
+		{"old quicktime opening with padding", cat(box("wide"), box("mdat", 1, 2, 3)), FormatMOV},
+		{"m4a", cat(ftyp("M4A ", "M4A ", "mp42", "isom"), box("moov")), FormatM4A},
+		{"audiobook", cat(ftyp("M4B ", "M4B ", "mp42")), FormatM4A},
+		{"box running to the end of the file", cat(ftyp("isom"), []byte{0, 0, 0, 0}, []byte("mdat")), FormatMP4},
+		{"64-bit box size", cat(ftyp("isom"), []byte{0, 0, 0, 1}, []byte("mdat"), []byte{0, 0, 0, 1, 0, 0, 0, 0}), FormatMP4},
+
+		// EBML
+		{"webm", ebml("webm"), FormatWebM},
+		{"webm with padding in the doc type", ebml("webm\x00"), FormatWebM},
+
+		// Fixed signatures
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), FormatPNG},
+		{"jpeg jfif", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), FormatJPEG},
+		{"jpeg exif", []byte("\xff\xd8\xff\xe1\x00\x18Exif\x00\x00"), FormatJPEG},
+		{"wav", riff("WAVE", []byte("fmt ")...), FormatWAV},
+		{"webp lossy", riff("WEBP", []byte("VP8 ")...), FormatWebP},
+		{"webp extended, still", riff("WEBP", append([]byte("VP8X\x0a\x00\x00\x00"), 0x10, 0, 0, 0)...), FormatWebP},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), FormatFLAC},
+		{"ogg", []byte("OggS\x00\x02\x00\x00"), FormatOgg},
+		{"mp3 with id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), FormatMP3},
+		{"mp3 frame, mpeg1 layer 3, 128k, 44.1kHz", []byte{0xff, 0xfb, 0x90, 0x64, 0x00}, FormatMP3},
+		{"mp3 frame, mpeg2 layer 3", []byte{0xff, 0xf3, 0x64, 0xc4}, FormatMP3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.head)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Sniff() = %s, want %s", got.Name, tt.want.Name)
+			}
+		})
+	}
+}
+
+func TestSniffRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+	}{
+		{"empty", nil},
+		{"too short for anything", []byte{0x00, 0x01}},
+		{"text", []byte("hello, this is not a video at all")},
+		{"html labelled as video", []byte("<!DOCTYPE html><html><script>alert(1)</script>")},
+		{"zip", []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00")},
+		{"pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3")},
+		{"elf executable", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00")},
+
+		// ISO BMFF
+		{"heic", cat(ftyp("heic", "mif1", "heic"), box("meta"))},
+		{"avif", cat(ftyp("avif", "avif", "mif1"), box("meta"))},
+		{"drm protected audio", cat(ftyp("M4P ", "M4P ", "mp42"))},
+		{"ftyp too short for a brand", cat(box("ftyp", 'i', 's'), box("free"))},
+		{"box type not printable", cat(ftyp("isom"), []byte{0, 0, 0, 8, 0x01, 0x02, 0x03, 0x04}, box("free"))},
+		{"box smaller than its header", cat(ftyp("isom"), []byte{0, 0, 0, 4}, []byte("mdat"), box("free"))},
+		{"64-bit box size too small", cat(ftyp("isom"), []byte{0, 0, 0, 1}, []byte("mdat"), []byte{0, 0, 0, 0, 0, 0, 0, 8}, box("free"))},
+		{"unknown lead box", cat(box("abcd"), box("mdat"))},
+
+		// EBML
+		{"matroska", ebml("matroska")},
+		{"ebml without doc type", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x84, 0x42, 0x86, 0x81, 0x01}},
+		{"ebml with a broken size", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x00, 0x00}},
+		{"ebml magic alone", []byte{0x1a, 0x45, 0xdf, 0xa3}},
+
+		// RIFF
+		{"avi", riff("AVI ", []byte("LIST")...)},
+		{"animated webp", riff("WEBP", append([]byte("VP8X\x0a\x00\x00\x00"), 0x12, 0, 0, 0)...)},
+
+		// MPEG audio sync word with invalid fields
+		{"mpeg reserved version", []byte{0xff, 0xeb, 0x90, 0x64}},
+		{"mpeg reserved layer", []byte{0xff, 0xf9, 0x90, 0x64}},
+		{"mpeg free bit rate", []byte{0xff, 0xfb, 0x00, 0x64}},
+		{"mpeg bad bit rate", []byte{0xff, 0xfb, 0xf0, 0x64}},
+		{"mpeg reserved sample rate", []byte{0xff, 0xfb, 0x9c, 0x64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.head)
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				name := "<nil>"
+				if got != nil {
+					name = got.Name
+				}
+				t.Errorf("Sniff() = %s, %v; want ErrUnsupportedFormat", name, err)
+			}
+		})
+	}
+}
+
+func TestCheckDeclaredType(t *testing.T) {
+	tests := []struct {
+		format   *Format
+		declared string
+		ok       bool
+	}{
+		{FormatMP4, "video/mp4", true},
+		{FormatMP4, "video/quicktime", true},
+		{FormatMP4, "Video/MP4; codecs=avc1", true},
+		{FormatMP4, "", true},
+		{FormatMP4, "application/octet-stream", true},
+		{FormatMP4, "video/webm", false},
+		{FormatWebM, "audio/webm", true},
+		{FormatPNG, "image/jpeg", false},
+		{FormatJPEG, "image/pjpeg", true},
+		{FormatWAV, "audio/x-wav", true},
+		{FormatMP3, "text/html", false},
+	}
+	for _, tt := range tests {
+		err := tt.format.CheckDeclaredType(tt.declared)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s.CheckDeclaredType(%q) = %v, want ok: %v", tt.format.Name, tt.declared, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrFormatMismatch) {
+			t.Errorf("%s.CheckDeclaredType(%q) = %v, want ErrFormatMismatch", tt.format.Name, tt.declared, err)
+		}
+	}
+}
+
+func TestDeclarableType(t *testing.T) {
+	for _, ct := range []string{"", "application/octet-stream", "video/mp4", "audio/ogg; codecs=opus", "image/webp"} {
+		if !DeclarableType(ct) {
+			t.Errorf("DeclarableType(%q) = false, want true", ct)
+		}
+	}
+	for _, ct := range []string{"text/html", "image/gif", "video/x-msvideo", "image/heic"} {
+		if DeclarableType(ct) {
+			t.Errorf("DeclarableType(%q) = true, want false", ct)
+		}
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	if err := FormatPNG.CheckSize(50 << 20); err != nil {
+		t.Errorf("PNG at the limit: %v", err)
+	}
+	if err := FormatPNG.CheckSize(50<<20 + 1); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("PNG over the limit: %v, want ErrFileTooLarge", err)
+	}
+	if err := FormatMP4.CheckSize(1 << 40); err != nil {
+		t.Errorf("MP4 has no format limit: %v", err)
+	}
+}
+
+func TestCodecAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		codec   string
+		want    bool
+	}{
+		{[]string{"h264", "hevc"}, "h264", true},
+		{[]string{"h264", "hevc"}, "prores", false},
+		{[]string{"pcm_*"}, "pcm_s16le", true},
+		{[]string{"pcm_*"}, "pcm_f32be", true},
+		{[]string{"pcm_*"}, "pcm", false},
+		{[]string{"pcm_*"}, "adpcm_ms", false},
+		{nil, "h264", false},
+	}
+	for _, tt := range tests {
+		if got := codecAllowed(tt.allowed, tt.codec); got != tt.want {
+			t.Errorf("codecAllowed(%v, %q) = %v, want %v", tt.allowed, tt.codec, got, tt.want)
+		}
+	}
+}
+
+func TestReadVint(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          []byte
+		stripMarker bool
+		value       uint64
+		length      int
+		ok          bool
+	}{
+		{"one byte size", []byte{0x81}, true, 1, 1, true},
+		{"one byte id keeps the marker", []byte{0x81}, false, 0x81, 1, true},
+		{"two byte id", []byte{0x42, 0x82}, false, 0x4282, 2, true},
+		{"two byte size", []byte{0x40, 0x02}, true, 2, 2, true},
+		{"four byte id", []byte{0x1a, 0x45, 0xdf, 0xa3}, false, 0x1a45dfa3, 4, true},
+		{"eight byte size", []byte{0x01, 0, 0, 0, 0, 0, 0, 0x10}, true, 16, 8, true},
+		{"zero first byte", []byte{0x00, 0x81}, true, 0, 0, false},
+		{"truncated", []byte{0x40}, true, 0, 0, false},
+		{"empty", nil, true, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, length, ok := readVint(tt.in, tt.stripMarker)
+			if value != tt.value || length != tt.length || ok != tt.ok {
+				t.Errorf("readVint() = %#x, %d, %v; want %#x, %d, %v", value, length, ok, tt.value, tt.length, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// JobThumbnails generates the poster frame and sprite sheets
+const JobThumbnails = "thumbnails"
+
+// Thumbnail settings
+// 160x90 tiles every 2 seconds, 100 to a sheet: a one-hour video is 18
+// sheets of roughly 100KB, small enough to load while scrubbing.
+const (
+	posterMaxWidth   = 1280
+	posterMaxOffset  = 5.0 // Seconds - past the fade-in, before anything important
+	spriteInterval   = 2.0 // Seconds between tiles
+	spriteTileWidth  = 160
+	spriteTileHeight = 90
+	spriteColumns    = 10
+	spriteRows       = 10
+)
+
+// PosterKey is where a video's poster frame is stored
+func PosterKey(mediaID uuid.UUID) string {
+	return storage.ThumbnailKey(mediaID, "poster.jpg")
+}
+
+// SpriteKey is where a video's n-th sprite sheet (from 0) is stored
+func SpriteKey(mediaID uuid.UUID, sheet int) string {
+	return storage.ThumbnailKey(mediaID, fmt.Sprintf("sprite-%03d.jpg", sheet))
+}
+
+// Thumbnailer is the thumbnails job
+type Thumbnailer struct {
+	ffmpeg      *FFmpeg
+	blobs       storage.BlobStore
+	mediaRepo   *repository.MediaRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewThumbnailer creates the thumbnails job
+func NewThumbnailer(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository, projectRepo *repository.ProjectRepository) *Thumbnailer {
+	return &Thumbnailer{
+		ffmpeg:      ffmpeg,
+		blobs:       blobs,
+		mediaRepo:   mediaRepo,
+		projectRepo: projectRepo,
+	}
+}
+
+// Kind implements Job
+func (t *Thumbnailer) Kind() string {
+	return JobThumbnails
+}
+
+// Wants implements Job: probed videos and images
+// The tile count comes from the duration, so unprobed videos are
+// skipped. Images only get a poster (a downscaled copy for the library).
+func (t *Thumbnailer) Wants(media *models.Media) bool {
+	switch media.Kind {
+	case models.MediaKindVideo:
+		return media.VideoCodec != "" && media.Duration > 0
+	case models.MediaKindImage:
+		return media.Width > 0
+	}
+	return false
+}
+
+// Run implements Job
+func (t *Thumbnailer) Run(ctx context.Context, job *models.MediaJob, media *models.Media) error {
+	input, err := storage.ToolInput(ctx, t.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tempo-thumbnails-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	posterPath := filepath.Join(dir, "poster.jpg")
+	if err := t.renderPoster(ctx, input, media.Duration, posterPath); err != nil {
+		return err
+	}
+
+	var sheet *models.SpriteSheet
+	var sheetPaths []string
+	if media.Kind == models.MediaKindVideo {
+		sheet, sheetPaths, err = t.renderSprites(ctx, input, media.Duration, dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sheets first, poster last: the poster key is what marks the set as
+	// present (see DerivedKeys), so a crash halfway leaves nothing referenced
+	derivedID := media.DerivedID()
+	var size int64
+	for i, p := range sheetPaths {
+		info, err := storage.PutFile(ctx, t.blobs, SpriteKey(derivedID, i), p, "image/jpeg")
+		if err != nil {
+			return err
+		}
+		size += info.Size
+	}
+	posterKey := PosterKey(derivedID)
+	info, err := storage.PutFile(ctx, t.blobs, posterKey, posterPath, "image/jpeg")
+	if err != nil {
+		return err
+	}
+	size += info.Size
+
+	projects, err := t.mediaRepo.SetThumbnails(ctx, job, derivedID, posterKey, sheet, size)
+	if err != nil {
+		return err
+	}
+
+	// A logo or title card doesn't show what a project is about
+	if media.Kind != models.MediaKindVideo {
+		return nil
+	}
+	for projectID, mediaID := range projects {
+		if err := t.projectRepo.SetDefaultThumbnail(ctx, projectID, mediaID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderPoster grabs one frame a little way into the video
+// (the very first frame is often black), or scales down an image
+func (t *Thumbnailer) renderPoster(ctx context.Context, input string, duration float64, out string) error {
+	offset := math.Min(duration/10, posterMaxOffset)
+
+	// -ss before -i seeks in the input, so only a few frames are decoded
+	return t.ffmpeg.Run(ctx,
+		"-ss", formatSeconds(offset),
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", posterMaxWidth),
+		"-q:v", "3",
+		"-y", out,
+	)
+}
+
+// renderSprites writes the sprite sheets into dir
+//
+// One ffmpeg pass does it all: fps picks a frame every spriteInterval,
+// scale+pad letterbox it into the tile, tile packs the tiles into sheets
+// (the last one is padded with black).
+func (t *Thumbnailer) renderSprites(ctx context.Context, input string, duration float64, dir string) (*models.SpriteSheet, []string, error) {
+	filter := fmt.Sprintf(
+		"fps=1/%g,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		spriteInterval,
+		spriteTileWidth, spriteTileHeight,
+		spriteTileWidth, spriteTileHeight,
+		spriteColumns, spriteRows,
+	)
+	err := t.ffmpeg.Run(ctx,
+		"-i", input,
+		"-an",
+		"-vf", filter,
+		"-q:v", "5",
+		"-start_number", "0",
+		"-y", filepath.Join(dir, "sprite-%03d.jpg"),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Glob returns names sorted, which is sheet order thanks to the padding
+	paths, err := filepath.Glob(filepath.Join(dir, "sprite-*.jpg"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil, errors.New("ffmpeg produced no sprite sheets")
+	}
+
+	sheet := &models.SpriteSheet{
+		Interval:   spriteInterval,
+		SheetCount: len(paths),
+		Columns:    spriteColumns,
+		Rows:       spriteRows,
+		TileWidth:  spriteTileWidth,
+		TileHeight: spriteTileHeight,
+	}
+
+	// The probed duration can be slightly off, so never claim more tiles
+	// than the sheets hold
+	sheet.FrameCount = int(math.Ceil(duration / spriteInterval))
+	if sheet.FrameCount < 1 {
+		sheet.FrameCount = 1
+	}
+	if max := sheet.SheetCount * sheet.FramesPerSheet(); sheet.FrameCount > max {
+		sheet.FrameCount = max
+	}
+
+	return sheet, paths, nil
+}
+
+// WriteThumbnailVTT writes the WebVTT thumbnail track for a sprite sheet
+//
+// Players (video.js, Plyr, Vidstack...) read thumbnail tracks as cues
+// whose text is an image URL with a "#xywh=" fragment selecting the tile.
+// The track is built on request rather than stored because the sheet
+// URLs are presigned and expire.
+func WriteThumbnailVTT(w io.Writer, sheet *models.SpriteSheet, duration float64, sheetURLs []string) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	perSheet := sheet.FramesPerSheet()
+	for i := 0; i < sheet.FrameCount; i++ {
+		n := i / perSheet
+		if n >= len(sheetURLs) {
+			break
+		}
+
+		start := float64(i) * sheet.Interval
+		end := start + sheet.Interval
+		if duration > 0 && end > duration {
+			end = duration
+		}
+		if end <= start {
+			break
+		}
+
+		tile := i % perSheet
+		x := (tile % sheet.Columns) * sheet.TileWidth
+		y := (tile / sheet.Columns) * sheet.TileHeight
+
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), sheetURLs[n],
+			x, y, sheet.TileWidth, sheet.TileHeight)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// vttTimestamp formats seconds as HH:MM:SS.mmm
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,307 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+	"tempo/internal/repository"
+	"tempo/internal/storage"
+)
+
+// JobWaveform computes the audio peaks shown on the timeline
+const JobWaveform = "waveform"
+
+// Waveform settings
+// At 44.1kHz and 256 samples per pixel the finest level has ~172 peaks
+// per second, enough to line effects up with a breath or a drum hit.
+const (
+	waveformSampleRate = 44100
+	waveformBaseSPP    = 256  // Samples per pixel of the finest level
+	waveformMinLength  = 1000 // Stop adding coarser levels below this many peaks
+	waveformMaxLevels  = 8
+)
+
+// ErrInvalidWaveform is returned for peak files that can't be decoded
+var ErrInvalidWaveform = errors.New("invalid waveform data")
+
+// WaveformLevelKey is where one zoom level of a file's peaks is stored
+func WaveformLevelKey(mediaID uuid.UUID, samplesPerPixel int) string {
+	return storage.WaveformKey(mediaID, fmt.Sprintf("%d.dat", samplesPerPixel))
+}
+
+// WaveformData is one zoom level of peak data
+//
+// FORMAT: this is the format of BBC's audiowaveform tool, which most
+// waveform renderers (peaks.js, wavesurfer.js via its peaks option, ...)
+// read directly. It's stored in the binary variant (.dat), 8 bits per
+// value, and served as JSON or binary. Data holds min/max pairs:
+// [min0, max0, min1, max1, ...] for a single (mixed down) channel.
+type WaveformData struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"` // Number of min/max pairs
+	Data            []int8 `json:"data"`
+}
+
+// audiowaveform binary header: version, flags, sample rate, samples per
+// pixel, length, channels - little-endian 32-bit each
+const (
+	waveformDatVersion  = 2
+	waveformDatHeader   = 24
+	waveformFlag8Bit    = 1
+	waveformMaxDatBytes = 64 << 20 // Sanity limit when reading
+)
+
+// MarshalBinary encodes the data as an audiowaveform .dat file
+func (d *WaveformData) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, waveformDatHeader+len(d.Data)))
+	header := []int32{
+		waveformDatVersion,
+		waveformFlag8Bit,
+		int32(d.SampleRate),
+		int32(d.SamplesPerPixel),
+		int32(d.Length),
+		int32(d.Channels),
+	}
+	if err := binary.Write(buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, d.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadWaveformData decodes an audiowaveform .dat file written by
+// MarshalBinary (version 2, 8-bit)
+func ReadWaveformData(r io.Reader) (*WaveformData, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, waveformMaxDatBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < waveformDatHeader {
+		return nil, ErrInvalidWaveform
+	}
+
+	var header [6]int32
+	if err := binary.Read(bytes.NewReader(raw[:waveformDatHeader]), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header[0] != waveformDatVersion || header[1]&waveformFlag8Bit == 0 || header[5] != 1 {
+		return nil, ErrInvalidWaveform
+	}
+
+	d := &WaveformData{
+		Version:         waveformDatVersion,
+		Channels:        1,
+		SampleRate:      int(header[2]),
+		SamplesPerPixel: int(header[3]),
+		Bits:            8,
+		Length:          int(header[4]),
+	}
+	body := raw[waveformDatHeader:]
+	if d.Length < 0 || len(body) != d.Length*2 {
+		return nil, ErrInvalidWaveform
+	}
+	d.Data = make([]int8, len(body))
+	for i, b := range body {
+		d.Data[i] = int8(b)
+	}
+	return d, nil
+}
+
+// Waveformer is the waveform job
+type Waveformer struct {
+	ffmpeg    *FFmpeg
+	blobs     storage.BlobStore
+	mediaRepo *repository.MediaRepository
+}
+
+// NewWaveformer creates the waveform job
+func NewWaveformer(ffmpeg *FFmpeg, blobs storage.BlobStore, mediaRepo *repository.MediaRepository) *Waveformer {
+	return &Waveformer{
+		ffmpeg:    ffmpeg,
+		blobs:     blobs,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// Kind implements Job
+func (wf *Waveformer) Kind() string {
+	return JobWaveform
+}
+
+// Wants implements Job: videos and audio files with an audio stream
+func (wf *Waveformer) Wants(media *models.Media) bool {
+	return media.Kind != models.MediaKindImage && media.AudioCodec != ""
+}
+
+// Run implements Job
+//
+// ffmpeg decodes the audio to raw 16-bit mono PCM on its stdout; we fold
+// it into peaks as it streams, so memory use doesn't grow with the length
+// of the clip. Coarser levels are then built from the finest one.
+func (wf *Waveformer) Run(ctx context.Context, job *models.MediaJob, media *models.Media) error {
+	input, err := storage.ToolInput(ctx, wf.blobs, media.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	peaks := newPeakWriter(waveformBaseSPP)
+	err = wf.ffmpeg.Output(ctx, peaks,
+		"-i", input,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprint(waveformSampleRate),
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"pipe:1",
+	)
+	if err != nil {
+		return err
+	}
+
+	level := peaks.finish()
+	if len(level) == 0 {
+		return errors.New("no audio decoded")
+	}
+
+	// Finest first while building, then reversed so zoom 0 is the overview
+	var levels [][]int16
+	spp := []int{}
+	for n := waveformBaseSPP; ; n *= 2 {
+		levels = append(levels, level)
+		spp = append(spp, n)
+		if len(level)/2 <= waveformMinLength || len(levels) == waveformMaxLevels {
+			break
+		}
+		level = halvePeaks(level)
+	}
+
+	waveform := &models.Waveform{SampleRate: waveformSampleRate}
+	var size int64
+	for i := len(levels) - 1; i >= 0; i-- {
+		n, err := wf.upload(ctx, media.DerivedID(), spp[i], levels[i])
+		if err != nil {
+			return err
+		}
+		size += n
+		waveform.SamplesPerPixel = append(waveform.SamplesPerPixel, spp[i])
+	}
+
+	return wf.mediaRepo.SetWaveform(ctx, job, media.DerivedID(), waveform, size)
+}
+
+// upload stores one level as an 8-bit .dat file, returning its size
+func (wf *Waveformer) upload(ctx context.Context, mediaID uuid.UUID, samplesPerPixel int, peaks []int16) (int64, error) {
+	d := &WaveformData{
+		Version:         waveformDatVersion,
+		Channels:        1,
+		SampleRate:      waveformSampleRate,
+		SamplesPerPixel: samplesPerPixel,
+		Bits:            8,
+		Length:          len(peaks) / 2,
+		Data:            make([]int8, len(peaks)),
+	}
+	for i, p := range peaks {
+		// Keep the high byte: 8 bits is plenty for drawing
+		d.Data[i] = int8(p >> 8)
+	}
+
+	raw, err := d.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	_, err = wf.blobs.Put(ctx, WaveformLevelKey(mediaID, samplesPerPixel), bytes.NewReader(raw), storage.PutOptions{
+		ContentType: "application/octet-stream",
+		Size:        int64(len(raw)),
+	})
+	return int64(len(raw)), err
+}
+
+// peakWriter turns a stream of 16-bit little-endian samples into
+// min/max pairs, one per samplesPerPixel samples
+type peakWriter struct {
+	samplesPerPixel int
+	peaks           []int16
+	min, max        int16
+	count           int    // Samples in the current bucket
+	odd             []byte // A sample split across two writes
+}
+
+func newPeakWriter(samplesPerPixel int) *peakWriter {
+	return &peakWriter{samplesPerPixel: samplesPerPixel, min: math.MaxInt16, max: math.MinInt16}
+}
+
+func (p *peakWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(p.odd) > 0 {
+		b = append(p.odd, b...)
+		p.odd = nil
+	}
+
+	for len(b) >= 2 {
+		s := int16(binary.LittleEndian.Uint16(b))
+		b = b[2:]
+
+		if s < p.min {
+			p.min = s
+		}
+		if s > p.max {
+			p.max = s
+		}
+		p.count++
+		if p.count == p.samplesPerPixel {
+			p.flush()
+		}
+	}
+	if len(b) == 1 {
+		p.odd = []byte{b[0]}
+	}
+	return n, nil
+}
+
+// flush closes the current bucket
+func (p *peakWriter) flush() {
+	p.peaks = append(p.peaks, p.min, p.max)
+	p.min, p.max, p.count = math.MaxInt16, math.MinInt16, 0
+}
+
+// finish closes the last, partial bucket and returns all peaks
+func (p *peakWriter) finish() []int16 {
+	if p.count > 0 {
+		p.flush()
+	}
+	return p.peaks
+}
+
+// halvePeaks merges neighbouring buckets: the next level's min is the
+// smaller of two mins, its max the larger of two maxes
+func halvePeaks(peaks []int16) []int16 {
+	pairs := len(peaks) / 2
+	out := make([]int16, 0, (pairs+1)/2*2)
+	for i := 0; i < pairs; i += 2 {
+		lo, hi := peaks[2*i], peaks[2*i+1]
+		if i+1 < pairs {
+			if peaks[2*i+2] < lo {
+				lo = peaks[2*i+2]
+			}
+			if peaks[2*i+3] > hi {
+				hi = peaks[2*i+3]
+			}
+		}
+		out = append(out, lo, hi)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// pcm encodes samples as 16-bit little-endian PCM, what ffmpeg pipes in
+func pcm(samples ...int16) []byte {
+	b := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(s))
+	}
+	return b
+}
+
+func TestPeakWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		samplesPerPixel int
+		samples         []int16
+		want            []int16
+	}{
+		{"no samples", 2, nil, nil},
+		{"full buckets", 2, []int16{1, 5, -3, 2}, []int16{1, 5, -3, 2}},
+		{"partial last bucket", 3, []int16{0, 10, -10, 7}, []int16{-10, 10, 7, 7}},
+		{"extremes", 2, []int16{-32768, 32767}, []int16{-32768, 32767}},
+		{"one sample per bucket", 1, []int16{4, -4}, []int16{4, 4, -4, -4}},
+		{"bytes that look negative", 2, []int16{0x00ff, -0x0100}, []int16{-0x0100, 0x00ff}},
+	}
+
+	for _, tt := range tests {
+		data := pcm(tt.samples...)
+		// Every write size, so samples get split across writes at every
+		// possible byte
+		for size := 1; size <= max(len(data), 1); size++ {
+			p := newPeakWriter(tt.samplesPerPixel)
+			for i := 0; i < len(data); i += size {
+				chunk := data[i:min(i+size, len(data))]
+				if n, err := p.Write(chunk); n != len(chunk) || err != nil {
+					t.Fatalf("%s: Write = %d, %v", tt.name, n, err)
+				}
+			}
+			if got := p.finish(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s, writes of %d bytes: got %v, want %v", tt.name, size, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestPeakWriterDoesNotKeepCallerBytes(t *testing.T) {
+	p := newPeakWriter(2)
+	buf := pcm(100, 200)
+	p.Write(buf[:3]) // One sample and half of the next
+	buf[2], buf[3] = 0xff, 0xff
+	p.Write([]byte{pcm(200)[1]})
+	if got := p.finish(); !reflect.DeepEqual(got, []int16{100, 200}) {
+		t.Errorf("got %v, want [100 200]", got)
+	}
+}
+
+func TestHalvePeaks(t *testing.T) {
+	tests := []struct {
+		name  string
+		peaks []int16
+		want  []int16
+	}{
+		{"empty", nil, []int16{}},
+		{"one pair is kept", []int16{-1, 1}, []int16{-1, 1}},
+		{"two pairs merge", []int16{-1, 5, -7, 2}, []int16{-7, 5}},
+		{"odd pair count keeps the last pair", []int16{-1, 1, -2, 2, -3, 3}, []int16{-2, 2, -3, 3}},
+		{"four pairs", []int16{0, 1, -1, 0, 5, 6, 4, 9}, []int16{-1, 1, 4, 9}},
+	}
+
+	for _, tt := range tests {
+		if got := halvePeaks(tt.peaks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWaveformDataRoundTrip(t *testing.T) {
+	d := &WaveformData{
+		Version:         waveformDatVersion,
+		Channels:        1,
+		SampleRate:      44100,
+		SamplesPerPixel: 512,
+		Bits:            8,
+		Length:          3,
+		Data:            []int8{-128, 127, -1, 0, -50, 50},
+	}
+	raw, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHeader := []byte{
+		2, 0, 0, 0, // Version
+		1, 0, 0, 0, // Flags: 8 bit
+		0x44, 0xac, 0, 0, // 44100 Hz
+		0, 2, 0, 0, // 512 samples per pixel
+		3, 0, 0, 0, // Length
+		1, 0, 0, 0, // Channels
+	}
+	if !bytes.Equal(raw[:waveformDatHeader], wantHeader) {
+		t.Errorf("header = % x, want % x", raw[:waveformDatHeader], wantHeader)
+	}
+	if len(raw) != waveformDatHeader+6 {
+		t.Errorf("got %d bytes, want %d", len(raw), waveformDatHeader+6)
+	}
+
+	got, err := ReadWaveformData(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("read back %+v, want %+v", got, d)
+	}
+}
+
+func TestReadWaveformDataRejects(t *testing.T) {
+	valid := func() []byte {
+		d := &WaveformData{SampleRate: 44100, SamplesPerPixel: 256, Channels: 1, Length: 2, Data: []int8{-1, 1, -2, 2}}
+		raw, _ := d.MarshalBinary()
+		return raw
+	}
+	set := func(offset int, v uint32) []byte {
+		raw := valid()
+		binary.LittleEndian.PutUint32(raw[offset:], v)
+		return raw
+	}
+
+	tests := map[string][]byte{
+		"empty":              {},
+		"short header":       valid()[:waveformDatHeader-1],
+		"version 1":          set(0, 1),
+		"16 bit":             set(4, 0),
+		"two channels":       set(20, 2),
+		"length too long":    set(16, 3),
+		"length too short":   set(16, 1),
+		"negative length":    set(16, 0xffffffff),
+		"odd number of data": valid()[:waveformDatHeader+3],
+	}
+	for name, raw := range tests {
+		if _, err := ReadWaveformData(bytes.NewReader(raw)); !errors.Is(err, ErrInvalidWaveform) {
+			t.Errorf("%s: error = %v, want ErrInvalidWaveform", name, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GCStats counts what a pass of the orphaned blob cleanup found
+// An orphan is a blob no record points to: the leftovers of crashed
+// uploads, failed deletes and rows removed by ON DELETE CASCADE.
+type GCStats struct {
+	Scanned      int   `json:"scanned"`
+	ScannedBytes int64 `json:"scanned_bytes"`
+
+	// Unreferenced and older than the grace period
+	Orphans     int   `json:"orphans"`
+	OrphanBytes int64 `json:"orphan_bytes"`
+
+	// Unreferenced but too new to tell from a file still being written
+	Pending      int   `json:"pending"`
+	PendingBytes int64 `json:"pending_bytes"`
+
+	// Orphans actually deleted (none in a dry run)
+	Deleted        int   `json:"deleted"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	Failed         int   `json:"failed"`
+}
+
+// Add adds another set of counts to s
+func (s *GCStats) Add(other GCStats) {
+	s.Scanned += other.Scanned
+	s.ScannedBytes += other.ScannedBytes
+	s.Orphans += other.Orphans
+	s.OrphanBytes += other.OrphanBytes
+	s.Pending += other.Pending
+	s.PendingBytes += other.PendingBytes
+	s.Deleted += other.Deleted
+	s.ReclaimedBytes += other.ReclaimedBytes
+	s.Failed += other.Failed
+}
+
+// GCRun is one pass of the cleanup (a row of blob_gc_runs)
+type GCRun struct {
+	ID     uuid.UUID `json:"id"`
+	DryRun bool      `json:"dry_run"`
+
+	GCStats
+	ByPrefix map[string]GCStats `json:"by_prefix"` // e.g. "thumbnails/"
+
+	// media_blobs rows with no references and no bytes left, removed (or,
+	// in a dry run, found)
+	BlobRecords int `json:"blob_records"`
+
+	Error      *string    `json:"error,omitempty"` // Why the pass stopped early
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"tempo/internal/animation"
+)
+
+// EffectDefinition is one version of an effect in the catalog
+//
+// Versions are immutable once shipped: a shader change that makes old
+// parameter values look different is a new version, so projects authored
+// against the old one keep rendering the same (see EffectVersions).
+type EffectDefinition struct {
+	ID          string            `json:"id"` // e.g. "time-smear", what EffectClip.Type refers to
+	Version     int               `json:"version"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Category    string            `json:"category"`
+	Shader      string            `json:"shader,omitempty"` // WGSL file in the web app's shader library, if it has one yet
+	Params      []ParamDefinition `json:"params"`
+	Stack       []StackLayer      `json:"stack,omitempty"` // Set for compound effects: Params are then its macro controls
+
+	// Available is whether the web app can render the effect: it has a
+	// shader, or for a compound, all its layers do. Set by the catalog,
+	// not read from definition files.
+	Available bool `json:"available"`
+}
+
+// IsCompound reports whether the effect is a stack of other effects
+func (def EffectDefinition) IsCompound() bool {
+	return len(def.Stack) > 0
+}
+
+// StackLayer is one effect in a compound effect, applied in stack order
+//
+// Each param of the layer's effect is fixed (Params), driven by one of the
+// compound's macro controls (Macros), or left at its default. The layer's
+// version is part of the compound's version, so a compound renders the
+// same however the project pins its components.
+type StackLayer struct {
+	Effect  string                     `json:"effect"` // Catalog effect ID, not itself compound
+	Version int                        `json:"version"`
+	Params  map[string]json.RawMessage `json:"params,omitempty"`
+	Macros  map[string]string          `json:"macros,omitempty"` // Layer param → compound param that drives it
+}
+
+// Param types
+const (
+	ParamFloat = "float" // Number, between Min and Max
+	ParamInt   = "int"   // Whole number, between Min and Max
+	ParamBool  = "bool"  // true or false
+	ParamEnum  = "enum"  // One of Options, e.g. "smooth"
+	ParamColor = "color" // "#rrggbb" or "#rrggbbaa"
+	ParamVec2  = "vec2"  // [x, y], each between Min and Max if set
+	ParamCurve = "curve" // [[x, y], ...] points with x from 0 to 1, ascending; y between Min and Max if set
+)
+
+// maxCurvePoints caps the points of a curve value
+const maxCurvePoints = 64
+
+// paramColorPattern is what color param values look like (alpha optional)
+var paramColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// ParamDefinition describes one parameter of an effect
+//
+// WHY RAW JSON VALUES?
+// Parameters used to be float64 only, which left no way to store "smooth"
+// or a color. Values are now kept as the JSON the client sent (see
+// EffectClip.Params) and checked against the definition with Check, which
+// also brings them into one canonical form. The JSON of each type is
+// listed with the Param* constants. Animatable params may instead hold a
+// keyframe track, {"keyframes": [...]} (see package animation).
+type ParamDefinition struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Min         *float64        `json:"min,omitempty"`     // float, int (required), vec2, curve
+	Max         *float64        `json:"max,omitempty"`     // float, int (required), vec2, curve
+	Options     []string        `json:"options,omitempty"` // enum only
+	Default     json.RawMessage `json:"default"`
+	Description string          `json:"description"`
+
+	// Names this param had in the previous version, if it was renamed
+	// Lets values saved against that version (presets) carry over.
+	PreviousNames []string `json:"previous_names,omitempty"`
+}
+
+// Validate checks the definition itself and puts Default in canonical form
+func (p *ParamDefinition) Validate() error {
+	ranged := p.Type == ParamFloat || p.Type == ParamInt || p.Type == ParamVec2 || p.Type == ParamCurve
+	switch {
+	case !ranged && p.Type != ParamBool && p.Type != ParamEnum && p.Type != ParamColor:
+		return fmt.Errorf("unknown type %q", p.Type)
+	case !ranged && (p.Min != nil || p.Max != nil):
+		return fmt.Errorf("a %s has no min or max", p.Type)
+	case (p.Type == ParamFloat || p.Type == ParamInt) && (p.Min == nil || p.Max == nil):
+		return fmt.Errorf("a %s needs a min and a max", p.Type)
+	case p.Min != nil && p.Max != nil && *p.Min > *p.Max:
+		return errors.New("min is above max")
+	case p.Type == ParamInt && (*p.Min != math.Trunc(*p.Min) || *p.Max != math.Trunc(*p.Max)):
+		return errors.New("an int needs whole min and max")
+	}
+
+	if p.Type == ParamEnum {
+		if len(p.Options) < 2 {
+			return errors.New("an enum needs at least two options")
+		}
+		seen := map[string]bool{}
+		for _, o := range p.Options {
+			if o == "" || seen[o] {
+				return fmt.Errorf("missing or duplicate option %q", o)
+			}
+			seen[o] = true
+		}
+	} else if len(p.Options) > 0 {
+		return fmt.Errorf("a %s has no options", p.Type)
+	}
+
+	if len(p.Default) == 0 {
+		return errors.New("no default")
+	}
+	def, err := p.Check(p.Default)
+	if err != nil {
+		return fmt.Errorf("default %w", err)
+	}
+	p.Default = def
+	return nil
+}
+
+// Check validates a value of this parameter and returns it in canonical
+// form (e.g. colors in lowercase)
+// Values saved before params were typed are accepted too: 0/1 for a
+// bool, the index of an option for an enum.
+func (p ParamDefinition) Check(v json.RawMessage) (json.RawMessage, error) {
+	// encoding/json decodes null into anything as the zero value
+	if strings.TrimSpace(string(v)) == "null" {
+		return nil, errors.New("must not be null")
+	}
+	if animation.IsTrack(v) {
+		return p.checkTrack(v)
+	}
+
+	switch p.Type {
+	case ParamFloat, ParamInt:
+		var f float64
+		if err := json.Unmarshal(v, &f); err != nil {
+			return nil, errors.New("must be a number")
+		}
+		if p.Type == ParamInt && f != math.Trunc(f) {
+			return nil, errors.New("must be a whole number")
+		}
+		if err := p.checkRange(f); err != nil {
+			return nil, err
+		}
+		return json.Marshal(f)
+
+	case ParamBool:
+		var b bool
+		if err := json.Unmarshal(v, &b); err == nil {
+			return json.Marshal(b)
+		}
+		var f float64
+		if err := json.Unmarshal(v, &f); err == nil && (f == 0 || f == 1) {
+			return json.Marshal(f == 1)
+		}
+		return nil, errors.New("must be true or false")
+
+	case ParamEnum:
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			for _, o := range p.Options {
+				if s == o {
+					return json.Marshal(s)
+				}
+			}
+		}
+		var i float64
+		if err := json.Unmarshal(v, &i); err == nil && i >= 0 && int(i) < len(p.Options) && i == math.Trunc(i) {
+			return json.Marshal(p.Options[int(i)])
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(p.Options, ", "))
+
+	case ParamColor:
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil || !paramColorPattern.MatchString(s) {
+			return nil, errors.New(`must be a color like "#ff8800"`)
+		}
+		return json.Marshal(strings.ToLower(s))
+
+	case ParamVec2:
+		var xy []float64
+		if err := json.Unmarshal(v, &xy); err != nil || len(xy) != 2 {
+			return nil, errors.New("must be [x, y]")
+		}
+		for _, f := range xy {
+			if err := p.checkRange(f); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(xy)
+
+	case ParamCurve:
+		var points [][]float64
+		if err := json.Unmarshal(v, &points); err != nil {
+			return nil, errors.New("must be a list of [x, y] points")
+		}
+		if len(points) < 2 || len(points) > maxCurvePoints {
+			return nil, fmt.Errorf("must have 2 to %d points", maxCurvePoints)
+		}
+		for i, pt := range points {
+			if len(pt) != 2 {
+				return nil, errors.New("must be a list of [x, y] points")
+			}
+			if pt[0] < 0 || pt[0] > 1 || (i > 0 && pt[0] <= points[i-1][0]) {
+				return nil, errors.New("point x values must go up from 0 to 1")
+			}
+			if err := p.checkRange(pt[1]); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(points)
+	}
+	return nil, fmt.Errorf("has unknown type %q", p.Type)
+}
+
+// Animatable reports whether values of this param can be keyframed
+// Numbers and vectors only: there's nothing between two enum options.
+func (p ParamDefinition) Animatable() bool {
+	return p.Type == ParamFloat || p.Type == ParamInt || p.Type == ParamVec2
+}
+
+// checkTrack checks a keyframe track of this param; every keyframe value
+// must be a valid value on its own
+func (p ParamDefinition) checkTrack(v json.RawMessage) (json.RawMessage, error) {
+	if !p.Animatable() {
+		return nil, fmt.Errorf("a %s can't be animated", p.Type)
+	}
+	track, err := animation.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range track.Keyframes {
+		value, err := json.Marshal(k.Value)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.Check(value); err != nil {
+			return nil, fmt.Errorf("keyframe %d %w", i, err)
+		}
+	}
+	return json.Marshal(track)
+}
+
+// ValueAt returns a checked value of this param at time at (seconds from
+// the start of the clip): the value itself, or what its track evaluates to
+// Easing curves can overshoot, so the result is clamped to Min and Max.
+func (p ParamDefinition) ValueAt(v json.RawMessage, at float64) (json.RawMessage, error) {
+	if !animation.IsTrack(v) {
+		return v, nil
+	}
+	track, err := animation.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	value := track.Evaluate(at)
+	for i, f := range value {
+		if p.Min != nil {
+			f = math.Max(f, *p.Min)
+		}
+		if p.Max != nil {
+			f = math.Min(f, *p.Max)
+		}
+		if p.Type == ParamInt {
+			f = math.Round(f)
+		}
+		value[i] = f
+	}
+	return json.Marshal(value)
+}
+
+// ParamsAt returns the value of every param of this effect at time at
+// (seconds from the start of the clip), from a clip's checked params
+// Params the clip leaves out take their default.
+func (def EffectDefinition) ParamsAt(params map[string]json.RawMessage, at float64) (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage, len(def.Params))
+	for _, p := range def.Params {
+		v, ok := params[p.Name]
+		if !ok {
+			values[p.Name] = p.Default
+			continue
+		}
+		value, err := p.ValueAt(v, at)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", p.Name, err)
+		}
+		values[p.Name] = value
+	}
+	return values, nil
+}
+
+// checkRange checks a number against Min and Max, where set
+func (p ParamDefinition) checkRange(f float64) error {
+	switch {
+	case p.Min != nil && p.Max != nil && (f < *p.Min || f > *p.Max):
+		return fmt.Errorf("must be between %g and %g", *p.Min, *p.Max)
+	case p.Min != nil && f < *p.Min:
+		return fmt.Errorf("must be at least %g", *p.Min)
+	case p.Max != nil && f > *p.Max:
+		return fmt.Errorf("must be at most %g", *p.Max)
+	}
+	return nil
+}
+
+// CheckParams checks the params of a clip of this effect and puts them in
+// canonical form
+// Returns an error message per invalid param, by name. Params left out
+// are fine: they take the default.
+func (def EffectDefinition) CheckParams(params map[string]json.RawMessage) map[string]string {
+	known := make(map[string]ParamDefinition, len(def.Params))
+	for _, p := range def.Params {
+		known[p.Name] = p
+	}
+
+	fields := map[string]string{}
+	for name, v := range params {
+		p, ok := known[name]
+		if !ok {
+			fields[name] = "is not a parameter of " + def.ID
+			continue
+		}
+		canonical, err := p.Check(v)
+		if err != nil {
+			fields[name] = err.Error()
+			continue
+		}
+		params[name] = canonical
+	}
+	return fields
+}
+
+// EffectVersions pins effects to catalog versions, by effect ID
+// A project renders each effect at its pinned version; effects it
+// doesn't pin use the latest.
+type EffectVersions map[string]int
+
+// PinEffectVersionRequest is the payload for pinning an effect version
+type PinEffectVersionRequest struct {
+	Version int `json:"version"`
+}
+
+// EffectListResponse is the effect catalog
+type EffectListResponse struct {
+	Effects []EffectDefinition `json:"effects"`
+	Total   int                `json:"total"`
+}
+
+// ProjectEffectsResponse is the effect catalog as a project sees it
+// Effects are at the project's pinned versions (the latest if unpinned);
+// Versions lists the pins.
+type ProjectEffectsResponse struct {
+	Effects  []EffectDefinition `json:"effects"`
+	Versions EffectVersions     `json:"versions"`
+}
+
+// EffectState is what an effect clip looks like at one point in time:
+// every param's value, with tracks evaluated and defaults filled in
+// A compound effect clip shows up as one state per layer, in stack order.
+type EffectState struct {
+	ClipID   string                     `json:"clip_id"`
+	Type     string                     `json:"type"`
+	Version  int                        `json:"version"`
+	Compound string                     `json:"compound,omitempty"` // The compound effect the layer is part of
+	Params   map[string]json.RawMessage `json:"params"`
+}
+
+// EffectStatesResponse lists the effects active at a time on the timeline
+type EffectStatesResponse struct {
+	Time    float64       `json:"time"`
+	Effects []EffectState `json:"effects"`
+}
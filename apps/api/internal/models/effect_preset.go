@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Preset scopes: who can see (and use) a preset
+// Only its creator can change or delete it, whatever the scope.
+const (
+	PresetScopeUser   = "user"   // The creator only
+	PresetScopeTeam   = "team"   // Everyone on ProjectID
+	PresetScopePublic = "public" // Everyone, even without an account
+)
+
+// ValidPresetScope reports whether s is a known preset scope
+func ValidPresetScope(s string) bool {
+	return s == PresetScopeUser || s == PresetScopeTeam || s == PresetScopePublic
+}
+
+// EffectPreset is a saved set of param values for an effect
+//
+// Params are stored against the effect version they were saved with. When
+// a preset is read for another version they're carried over by name,
+// following renames (ParamDefinition.PreviousNames); what doesn't fit the
+// new definition is dropped and takes the default.
+type EffectPreset struct {
+	ID            uuid.UUID                  `json:"id" db:"id"`
+	CreatedBy     uuid.UUID                  `json:"created_by" db:"created_by"`
+	EffectID      string                     `json:"effect_id" db:"effect_id"`
+	EffectVersion int                        `json:"effect_version" db:"effect_version"` // The version Params are for
+	Name          string                     `json:"name" db:"name"`
+	Description   *string                    `json:"description,omitempty" db:"description"`
+	Tags          []string                   `json:"tags" db:"tags"` // Free-form labels like "nostalgic", lowercase
+	Params        map[string]json.RawMessage `json:"params" db:"params"`
+	Scope         string                     `json:"scope" db:"scope"`
+	ProjectID     *uuid.UUID                 `json:"project_id,omitempty" db:"project_id"` // The team, for scope "team"
+	CreatedAt     time.Time                  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time                  `json:"updated_at" db:"updated_at"`
+
+	// Set when Params were mapped from the saved version: params that
+	// version had and this one has no place for
+	DroppedParams []string `json:"dropped_params,omitempty" db:"-"`
+}
+
+// CreateEffectPresetRequest is the payload for saving a preset
+// EffectVersion defaults to the latest version; Scope to "user".
+type CreateEffectPresetRequest struct {
+	EffectID      string                     `json:"effect_id"`
+	EffectVersion int                        `json:"effect_version,omitempty"`
+	Name          string                     `json:"name"`
+	Description   *string                    `json:"description,omitempty"`
+	Tags          []string                   `json:"tags,omitempty"`
+	Params        map[string]json.RawMessage `json:"params"`
+	Scope         string                     `json:"scope,omitempty"`
+	ProjectID     *uuid.UUID                 `json:"project_id,omitempty"`
+}
+
+// UpdateEffectPresetRequest is the payload for changing a preset
+// Fields left out stay as they are. New Params replace the old ones and
+// are for EffectVersion (the latest if left out).
+type UpdateEffectPresetRequest struct {
+	EffectVersion int                        `json:"effect_version,omitempty"`
+	Name          *string                    `json:"name,omitempty"`
+	Description   *string                    `json:"description,omitempty"` // "" removes it
+	Tags          []string                   `json:"tags,omitempty"`
+	Params        map[string]json.RawMessage `json:"params,omitempty"`
+	Scope         *string                    `json:"scope,omitempty"`
+	ProjectID     *uuid.UUID                 `json:"project_id,omitempty"`
+}
+
+// EffectPresetListResponse is a list of presets
+type EffectPresetListResponse struct {
+	Presets []EffectPreset `json:"presets"`
+	Total   int            `json:"total"`
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func float(f float64) *float64 { return &f }
+
+func TestParamValueAt(t *testing.T) {
+	intensity := ParamDefinition{Name: "intensity", Type: ParamFloat, Min: float(0), Max: float(1)}
+	samples := ParamDefinition{Name: "samples", Type: ParamInt, Min: float(1), Max: float(16)}
+	offset := ParamDefinition{Name: "offset", Type: ParamVec2, Min: float(-1), Max: float(1)}
+
+	// Overshoots below the start value on the way out and above the end
+	// value on the way in
+	overshoot := `"easing": "bezier", "bezier": [0.5, -0.5, 0.5, 1.5]`
+
+	tests := []struct {
+		name  string
+		param ParamDefinition
+		value string
+		at    float64
+		want  string
+	}{
+		{"plain value is returned as is", intensity, `0.25`, 3, `0.25`},
+		{"before the first keyframe", intensity, `{"keyframes": [{"time": 1, "value": 0.2}, {"time": 2, "value": 0.8}]}`, 0, `0.2`},
+		{"after the last keyframe", intensity, `{"keyframes": [{"time": 1, "value": 0.2}, {"time": 2, "value": 0.8}]}`, 9, `0.8`},
+		{"between keyframes", intensity, `{"keyframes": [{"time": 0, "value": 0}, {"time": 2, "value": 1}]}`, 0.5, `0.25`},
+		{"hold", intensity, `{"keyframes": [{"time": 0, "value": 0.3, "easing": "hold"}, {"time": 2, "value": 1}]}`, 1.9, `0.3`},
+		{"overshoot clamped to min", intensity, `{"keyframes": [{"time": 0, "value": 0, ` + overshoot + `}, {"time": 1, "value": 1}]}`, 0.1, `0`},
+		{"overshoot clamped to max", intensity, `{"keyframes": [{"time": 0, "value": 0, ` + overshoot + `}, {"time": 1, "value": 1}]}`, 0.9, `1`},
+		{"int rounds down", samples, `{"keyframes": [{"time": 0, "value": 1}, {"time": 1, "value": 16}]}`, 0.1, `3`},
+		{"int rounds up", samples, `{"keyframes": [{"time": 0, "value": 1}, {"time": 1, "value": 16}]}`, 0.5, `9`},
+		{"int rounded after clamping", samples, `{"keyframes": [{"time": 0, "value": 1, ` + overshoot + `}, {"time": 1, "value": 16}]}`, 0.9, `16`},
+		{"vec2 clamps each component", offset, `{"keyframes": [{"time": 0, "value": [-1, 1], ` + overshoot + `}, {"time": 1, "value": [1, -1]}]}`, 0.9, `[1,-1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.param.ValueAt(json.RawMessage(tt.value), tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ValueAt(%v) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamsAt(t *testing.T) {
+	def := EffectDefinition{
+		ID: "glow",
+		Params: []ParamDefinition{
+			{Name: "intensity", Type: ParamFloat, Min: float(0), Max: float(1), Default: json.RawMessage(`0.5`)},
+			{Name: "color", Type: ParamColor, Default: json.RawMessage(`"#ffffff"`)},
+		},
+	}
+
+	got, err := def.ParamsAt(map[string]json.RawMessage{
+		"intensity": json.RawMessage(`{"keyframes": [{"time": 0, "value": 0}, {"time": 4, "value": 1}]}`),
+	}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got["intensity"]) != `0.25` {
+		t.Errorf("intensity = %s, want 0.25", got["intensity"])
+	}
+	if string(got["color"]) != `"#ffffff"` {
+		t.Errorf("color = %s, want the default", got["color"])
+	}
+
+	_, err = def.ParamsAt(map[string]json.RawMessage{
+		"intensity": json.RawMessage(`{"keyframes": []}`),
+	}, 1)
+	if err == nil {
+		t.Error("expected an error for an invalid track")
+	}
+}
+
+func TestParamCheck(t *testing.T) {
+	intensity := ParamDefinition{Name: "intensity", Type: ParamFloat, Min: float(0), Max: float(1)}
+	samples := ParamDefinition{Name: "samples", Type: ParamInt, Min: float(1), Max: float(16)}
+	enabled := ParamDefinition{Name: "enabled", Type: ParamBool}
+	mode := ParamDefinition{Name: "mode", Type: ParamEnum, Options: []string{"smooth", "stepped", "random"}}
+	tint := ParamDefinition{Name: "tint", Type: ParamColor}
+	offset := ParamDefinition{Name: "offset", Type: ParamVec2, Min: float(-1), Max: float(1)}
+	free := ParamDefinition{Name: "free", Type: ParamVec2}
+	falloff := ParamDefinition{Name: "falloff", Type: ParamCurve, Min: float(0), Max: float(1)}
+
+	tests := []struct {
+		name  string
+		param ParamDefinition
+		value string
+		want  string // Canonical form; "" means the value is rejected
+	}{
+		{"float", intensity, `0.5`, `0.5`},
+		{"float at min", intensity, `0`, `0`},
+		{"float at max", intensity, `1.0`, `1`},
+		{"float below min", intensity, `-0.1`, ``},
+		{"float above max", intensity, `1.5`, ``},
+		{"float as a string", intensity, `"0.5"`, ``},
+		{"null", intensity, `null`, ``},
+		{"int", samples, `4`, `4`},
+		{"int written as a float", samples, `4.0`, `4`},
+		{"int with a fraction", samples, `4.5`, ``},
+		{"int out of range", samples, `17`, ``},
+
+		{"bool", enabled, `true`, `true`},
+		{"legacy bool 1", enabled, `1`, `true`},
+		{"legacy bool 0", enabled, `0`, `false`},
+		{"legacy bool 2", enabled, `2`, ``},
+		{"legacy bool 0.5", enabled, `0.5`, ``},
+		{"bool as a string", enabled, `"true"`, ``},
+
+		{"enum option", mode, `"stepped"`, `"stepped"`},
+		{"enum option is case sensitive", mode, `"Stepped"`, ``},
+		{"unknown enum option", mode, `"jumpy"`, ``},
+		{"legacy enum index", mode, `2`, `"random"`},
+		{"legacy enum index 0", mode, `0`, `"smooth"`},
+		{"legacy enum index out of range", mode, `3`, ``},
+		{"legacy enum index negative", mode, `-1`, ``},
+		{"legacy enum index with a fraction", mode, `1.5`, ``},
+
+		{"color", tint, `"#ff8800"`, `"#ff8800"`},
+		{"color folded to lowercase", tint, `"#FF88AA"`, `"#ff88aa"`},
+		{"color with alpha", tint, `"#FF880080"`, `"#ff880080"`},
+		{"short color", tint, `"#f80"`, ``},
+		{"color without #", tint, `"ff8800"`, ``},
+		{"color name", tint, `"orange"`, ``},
+
+		{"vec2", offset, `[0.5, -0.5]`, `[0.5,-0.5]`},
+		{"vec2 component out of range", offset, `[0.5, -2]`, ``},
+		{"vec2 with three components", offset, `[0, 0, 0]`, ``},
+		{"vec2 as a number", offset, `0.5`, ``},
+		{"vec2 without a range", free, `[100, -100]`, `[100,-100]`},
+
+		{"curve", falloff, `[[0, 0], [0.5, 0.8], [1, 1]]`, `[[0,0],[0.5,0.8],[1,1]]`},
+		{"curve x out of order", falloff, `[[0, 0], [0.6, 0.5], [0.4, 1]]`, ``},
+		{"curve with a repeated x", falloff, `[[0, 0], [0.5, 0.5], [0.5, 1]]`, ``},
+		{"curve x above 1", falloff, `[[0, 0], [1.5, 1]]`, ``},
+		{"curve x below 0", falloff, `[[-0.5, 0], [1, 1]]`, ``},
+		{"curve y out of range", falloff, `[[0, 0], [1, 2]]`, ``},
+		{"curve with one point", falloff, `[[0, 0]]`, ``},
+		{"curve point with three numbers", falloff, `[[0, 0, 0], [1, 1, 1]]`, ``},
+
+		{"float track", intensity, `{"keyframes": [{"time": 0, "value": 0}, {"time": 1, "value": 1}]}`, `{"keyframes":[{"time":0,"value":0},{"time":1,"value":1}]}`},
+		{"track value out of range", intensity, `{"keyframes": [{"time": 0, "value": 0}, {"time": 1, "value": 2}]}`, ``},
+		{"int track with a fraction", samples, `{"keyframes": [{"time": 0, "value": 1.5}]}`, ``},
+		{"vec2 track", offset, `{"keyframes": [{"time": 0, "value": [0, 0]}]}`, `{"keyframes":[{"time":0,"value":[0,0]}]}`},
+		{"enum track", mode, `{"keyframes": [{"time": 0, "value": 0}]}`, ``},
+		{"color track", tint, `{"keyframes": [{"time": 0, "value": 0}]}`, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.param.Check(json.RawMessage(tt.value))
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Check(%s) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check(%s): unexpected error: %v", tt.value, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Check(%s) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		param ParamDefinition
+		ok    bool
+	}{
+		{"float", ParamDefinition{Type: ParamFloat, Min: float(0), Max: float(1), Default: json.RawMessage(`0.5`)}, true},
+		{"float without max", ParamDefinition{Type: ParamFloat, Min: float(0), Default: json.RawMessage(`0.5`)}, false},
+		{"min above max", ParamDefinition{Type: ParamFloat, Min: float(1), Max: float(0), Default: json.RawMessage(`0.5`)}, false},
+		{"int with a fractional range", ParamDefinition{Type: ParamInt, Min: float(0.5), Max: float(4), Default: json.RawMessage(`1`)}, false},
+		{"default out of range", ParamDefinition{Type: ParamFloat, Min: float(0), Max: float(1), Default: json.RawMessage(`2`)}, false},
+		{"no default", ParamDefinition{Type: ParamBool}, false},
+		{"bool with a range", ParamDefinition{Type: ParamBool, Min: float(0), Max: float(1), Default: json.RawMessage(`true`)}, false},
+		{"enum", ParamDefinition{Type: ParamEnum, Options: []string{"a", "b"}, Default: json.RawMessage(`"b"`)}, true},
+		{"enum with one option", ParamDefinition{Type: ParamEnum, Options: []string{"a"}, Default: json.RawMessage(`"a"`)}, false},
+		{"enum with a duplicate option", ParamDefinition{Type: ParamEnum, Options: []string{"a", "b", "a"}, Default: json.RawMessage(`"a"`)}, false},
+		{"enum with an empty option", ParamDefinition{Type: ParamEnum, Options: []string{"a", ""}, Default: json.RawMessage(`"a"`)}, false},
+		{"options on a float", ParamDefinition{Type: ParamFloat, Min: float(0), Max: float(1), Options: []string{"a", "b"}, Default: json.RawMessage(`0`)}, false},
+		{"vec2 without a range", ParamDefinition{Type: ParamVec2, Default: json.RawMessage(`[0, 0]`)}, true},
+		{"curve", ParamDefinition{Type: ParamCurve, Min: float(0), Max: float(1), Default: json.RawMessage(`[[0, 0], [1, 1]]`)}, true},
+		{"unknown type", ParamDefinition{Type: "matrix", Default: json.RawMessage(`0`)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.param.Validate()
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate() error = %v, want ok: %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParamValidateCanonicalDefault(t *testing.T) {
+	tint := ParamDefinition{Name: "tint", Type: ParamColor, Default: json.RawMessage(`"#FF8800"`)}
+	mode := ParamDefinition{Name: "mode", Type: ParamEnum, Options: []string{"smooth", "stepped"}, Default: json.RawMessage(`1`)}
+	for _, p := range []*ParamDefinition{&tint, &mode} {
+		if err := p.Validate(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", p.Name, err)
+		}
+	}
+	if string(tint.Default) != `"#ff8800"` {
+		t.Errorf("color default = %s, want it in lowercase", tint.Default)
+	}
+	if string(mode.Default) != `"stepped"` {
+		t.Errorf("enum default = %s, want the option", mode.Default)
+	}
+}
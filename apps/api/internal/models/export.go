@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Export statuses
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportCompleted  = "completed"
+	ExportFailed     = "failed"
+)
+
+// ExportJob is a render of a project into a video file
+// JSON is camelCase like the timeline: the export dialog in the editor
+// polls it while the render runs.
+type ExportJob struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	ProjectID uuid.UUID `json:"projectId" db:"project_id"`
+	UserID    uuid.UUID `json:"-" db:"user_id"`
+	Format    string    `json:"format" db:"format"`   // mp4, webm
+	Quality   string    `json:"quality" db:"quality"` // low, medium, high
+	Status    string    `json:"status" db:"status"`   // pending, processing, completed, failed
+	Progress  int       `json:"progress" db:"progress"`
+	URL       string    `json:"url,omitempty" db:"-"`
+	OutputKey string    `json:"-" db:"output_key"` // Where the rendered file goes in the blob store
+	SizeBytes int64     `json:"sizeBytes,omitempty" db:"size_bytes"`
+	Error     *string   `json:"error,omitempty" db:"error"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
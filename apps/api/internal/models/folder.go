@@ -0,0 +1,63 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Folder organizes projects on a user's dashboard
+// Folders are private to each user: the same shared project can sit in
+// "Client Work" for the owner and in "Reviews" for a collaborator.
+type Folder struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty" db:"parent_id"` // nil = top level
+	Name      string     `json:"name" db:"name"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreateFolderRequest is the payload for creating a folder
+type CreateFolderRequest struct {
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+// UpdateFolderRequest is the payload for renaming or moving a folder
+// "parent_id": null moves the folder to the top level,
+// leaving parent_id out keeps it where it is
+type UpdateFolderRequest struct {
+	Name     *string      `json:"name,omitempty"`
+	ParentID NullableUUID `json:"parent_id"`
+}
+
+// MoveProjectRequest puts a project into one of the user's folders
+// "folder_id": null takes it out of any folder
+type MoveProjectRequest struct {
+	FolderID *uuid.UUID `json:"folder_id"`
+}
+
+// NullableUUID tells "field set to null" apart from "field not sent"
+// A plain *uuid.UUID is nil in both cases, which makes PATCH ambiguous.
+type NullableUUID struct {
+	Set  bool       // Field was present in the JSON
+	UUID *uuid.UUID // nil when the field was null
+}
+
+// UnmarshalJSON is only called when the field is present
+func (n *NullableUUID) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		n.UUID = nil
+		return nil
+	}
+	var id uuid.UUID
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	n.UUID = &id
+	return nil
+}
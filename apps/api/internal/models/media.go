@@ -0,0 +1,178 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Media kinds
+// The kind comes from the file's content (see media.Sniff), never from
+// what the client says, and decides which background jobs run.
+const (
+	MediaKindVideo = "video"
+	MediaKindImage = "image" // Stills: overlays, title cards. No duration.
+	MediaKindAudio = "audio" // Music beds, voice-over
+)
+
+// ValidMediaKind reports whether kind is one of the media kinds
+func ValidMediaKind(kind string) bool {
+	return kind == MediaKindVideo || kind == MediaKindImage || kind == MediaKindAudio
+}
+
+// Media is an uploaded source file (the "video library")
+// Every file has an owner (the uploader) and can optionally belong to a
+// project, which gives that project's collaborators access to it too.
+type Media struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	OwnerID     uuid.UUID  `json:"owner_id" db:"owner_id"`
+	ProjectID   *uuid.UUID `json:"project_id,omitempty" db:"project_id"`
+	Kind        string     `json:"kind" db:"kind"`         // MediaKindVideo, MediaKindImage or MediaKindAudio
+	Filename    string     `json:"filename" db:"filename"` // Original name on the uploader's machine
+	ContentType string     `json:"content_type" db:"content_type"`
+	Size        int64      `json:"size" db:"size_bytes"`
+	StorageKey  string     `json:"-" db:"storage_key"`                 // Where the bytes live - internal detail
+	ContentHash *string    `json:"sha256,omitempty" db:"content_hash"` // Hex SHA-256; NULL for files stored before deduplication
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Filled in by probing the file (zero = unknown / not present)
+	Duration      float64    `json:"duration,omitempty" db:"duration"` // Seconds
+	Width         int        `json:"width,omitempty" db:"width"`       // As displayed (after rotation)
+	Height        int        `json:"height,omitempty" db:"height"`
+	FrameRate     float64    `json:"frame_rate,omitempty" db:"frame_rate"`
+	Rotation      int        `json:"rotation,omitempty" db:"rotation"` // Clockwise degrees
+	VideoCodec    string     `json:"video_codec,omitempty" db:"video_codec"`
+	AudioCodec    string     `json:"audio_codec,omitempty" db:"audio_codec"`
+	AudioChannels int        `json:"audio_channels,omitempty" db:"audio_channels"`
+	SampleRate    int        `json:"sample_rate,omitempty" db:"sample_rate"` // Hz
+	BitRate       int64      `json:"bit_rate,omitempty" db:"bit_rate"`       // Bits per second
+	ProbedAt      *time.Time `json:"probed_at,omitempty" db:"probed_at"`     // NULL = never probed
+
+	// Generated in the background (see Jobs for progress)
+	// Shared by records with the same content, see DerivedID.
+	DerivedFrom    *uuid.UUID      `json:"-" db:"derived_from"`
+	PosterKey      *string         `json:"-" db:"poster_key"`
+	SpriteSheet    *SpriteSheet    `json:"sprite_sheet,omitempty" db:"sprite_sheet"`
+	ThumbnailBytes int64           `json:"-" db:"thumbnail_bytes"` // Poster and sprite sheets, for quotas
+	Waveform       *Waveform       `json:"waveform,omitempty" db:"waveform"`
+	WaveformBytes  int64           `json:"-" db:"waveform_bytes"`
+	Proxies        []Proxy         `json:"proxies,omitempty" db:"proxies"`
+	HLS            *HLSPackage     `json:"hls,omitempty" db:"hls"`
+	Scenes         *SceneDetection `json:"scenes,omitempty" db:"scenes"`
+
+	// Background processing by kind, e.g. {"thumbnails": {"status": "running"}}
+	Jobs map[string]JobState `json:"jobs"`
+
+	// Computed, not stored: short-lived links from the blob store
+	URL       string `json:"url"`
+	PosterURL string `json:"poster_url,omitempty"`
+}
+
+// DerivedID is the ID the derived files (thumbnails, waveform, proxies,
+// HLS) are stored under: the record's own, or that of the earlier record
+// with the same content they were made for
+func (m *Media) DerivedID() uuid.UUID {
+	if m.DerivedFrom != nil {
+		return *m.DerivedFrom
+	}
+	return m.ID
+}
+
+// SpriteSheet describes the scrubbing thumbnails of a video
+//
+// Frames are taken every Interval seconds, scaled to fit a
+// TileWidth x TileHeight box and packed Columns x Rows to an image, left
+// to right and top to bottom. Long videos need several images (sheets).
+// GET /api/videos/{id}/thumbnails.vtt maps times to tiles for players.
+type SpriteSheet struct {
+	Interval   float64 `json:"interval"` // Seconds between frames
+	FrameCount int     `json:"frame_count"`
+	SheetCount int     `json:"sheet_count"`
+	Columns    int     `json:"columns"`
+	Rows       int     `json:"rows"`
+	TileWidth  int     `json:"tile_width"`
+	TileHeight int     `json:"tile_height"`
+}
+
+// FramesPerSheet is how many tiles fit on one sheet
+func (s *SpriteSheet) FramesPerSheet() int {
+	return s.Columns * s.Rows
+}
+
+// Proxy is a low-resolution copy of a video for smooth preview
+//
+// 4K sources are too heavy to decode in the browser while effects run on
+// top, so the editor previews a small, keyframe-dense H.264 copy. Final
+// exports always read the original.
+type Proxy struct {
+	Name   string `json:"name"` // "540p", "720p"
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+
+	// Computed, not stored (never set when saving)
+	URL string `json:"url,omitempty"`
+}
+
+// HLSPackage describes a video packaged for HTTP Live Streaming
+//
+// Each rendition is a playlist of short segments, and a master playlist
+// lists the renditions so the player can switch between them as the
+// bandwidth changes. Seeking only fetches the segment it lands in.
+// GET /api/videos/{id}/hls returns a signed URL to the master playlist.
+type HLSPackage struct {
+	SegmentDuration float64        `json:"segment_duration"` // Target, in seconds
+	Renditions      []HLSRendition `json:"renditions"`
+}
+
+// HLSRendition is one quality level of an HLS package
+type HLSRendition struct {
+	Name      string `json:"name"` // "360p", "720p", ...
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Bandwidth int    `json:"bandwidth"` // Peak bits per second
+	Segments  int    `json:"segments"`
+	Size      int64  `json:"size"` // Bytes of all segments
+}
+
+// Waveform describes the audio peak data of a media file
+//
+// Peaks are stored at several zoom levels, each with half the detail of
+// the next: zoom 0 is an overview of the whole clip, the last level has
+// a min/max pair for every SamplesPerPixel[last] audio samples.
+// GET /api/videos/{id}/waveform?zoom= returns one level.
+type Waveform struct {
+	SampleRate      int   `json:"sample_rate"`
+	SamplesPerPixel []int `json:"samples_per_pixel"` // Per zoom level
+}
+
+// SceneDetection summarizes the shot boundaries found in a video
+//
+// Every candidate cut down to MinScore is kept, and the API filters them
+// by a threshold (GET /api/videos/{id}/scenes?threshold=), so the
+// sensitivity can be tuned per request without decoding the video again.
+type SceneDetection struct {
+	MinScore   float64 `json:"min_score"`
+	Candidates int     `json:"candidates"`
+}
+
+// SceneMarker is a shot boundary: the first frame of a new shot
+type SceneMarker struct {
+	Time  float64 `json:"time"`  // Seconds into the source file
+	Score float64 `json:"score"` // How much the frame differs from the previous one, 0-1
+}
+
+// LinkMediaRequest adds a file the library already has without sending
+// its bytes (POST /api/videos/from-hash)
+type LinkMediaRequest struct {
+	SHA256    string     `json:"sha256"`             // Hex SHA-256 of the file
+	Filename  string     `json:"filename,omitempty"` // Defaults to the existing file's name
+	ProjectID *uuid.UUID `json:"project_id,omitempty"`
+}
+
+// MediaListResponse is a list of media files
+type MediaListResponse struct {
+	Media      []Media `json:"media"`
+	TotalCount int     `json:"total_count"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job statuses
+// queued -> running -> done, or back to queued for a retry, or failed
+// once the attempts run out
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// MediaJob is a piece of background work on a media file
+// (e.g. generating thumbnails). One row per file and kind: running a
+// kind again resets the existing row instead of adding another.
+type MediaJob struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	MediaID    uuid.UUID  `json:"media_id" db:"media_id"`
+	Kind       string     `json:"kind" db:"kind"`
+	Status     string     `json:"status" db:"status"`
+	Attempts   int        `json:"attempts" db:"attempts"`
+	Run        int        `json:"-" db:"run"`                 // Bumped by every claim; results are reported against it
+	Error      *string    `json:"error,omitempty" db:"error"` // Last failure
+	RunAfter   time.Time  `json:"run_after" db:"run_after"`   // Retries are delayed
+	StartedAt  *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// JobState is a job's progress as shown on the media record
+type JobState struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -13,7 +13,9 @@ type Project struct {
 	Name         string     `json:"name" db:"name"`
 	Description  *string    `json:"description,omitempty" db:"description"`
 	ThumbnailURL *string    `json:"thumbnail_url,omitempty" db:"thumbnail_url"`
-	Settings     JSONMap    `json:"settings" db:"settings"` // JSONB field
+	ThumbnailKey *string `json:"-" db:"-"` // Poster frame used when ThumbnailURL is unset (of the media in thumbnail_media_id)
+	Settings     ProjectSettings `json:"settings" db:"settings"` // JSONB field, see settings.go
+	SettingsUnreadable bool `json:"settings_unreadable,omitempty" db:"-"` // Settings couldn't be read (newer server, damaged) and show the defaults
 	IsDeleted    bool       `json:"-" db:"is_deleted"`      // Don't expose in API
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
@@ -22,6 +24,8 @@ type Project struct {
 	Owner         *UserPublic     `json:"owner,omitempty"`
 	Collaborators []Collaborator  `json:"collaborators,omitempty"`
 	Role          string          `json:"role,omitempty"` // Current user's role
+	FolderID      *uuid.UUID      `json:"folder_id,omitempty"` // Current user's folder
+	Tags          []Tag           `json:"tags,omitempty"`
 }
 
 // JSONMap is a helper type for JSONB columns
@@ -41,10 +45,24 @@ type UpdateProjectRequest struct {
 }
 
 // ProjectListResponse is a paginated list of projects
+// NextCursor is set when there are more results - pass it back as ?cursor=
+// TotalCount counts every match, not just the ones on this page. Page is
+// 1 for cursor pages, which have no page number.
 type ProjectListResponse struct {
 	Projects   []Project `json:"projects"`
 	TotalCount int       `json:"total_count"`
 	Page       int       `json:"page"`
 	PerPage    int       `json:"per_page"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
+// ImportProjectResponse is returned after importing a .tempo bundle
+type ImportProjectResponse struct {
+	Project       *Project                `json:"project"`
+	RemappedMedia map[uuid.UUID]uuid.UUID `json:"remapped_media"` // Old media ID → new
+	MissingMedia  []uuid.UUID             `json:"missing_media"`  // Referenced but not in the bundle
+
+	// Names of bundled team presets this server couldn't take (unknown
+	// effect or version, invalid params)
+	SkippedPresets []string `json:"skipped_presets"`
+}
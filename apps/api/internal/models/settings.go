@@ -0,0 +1,380 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CurrentSettingsVersion is the schema version new settings are written with
+//
+// HOW TO CHANGE THE SETTINGS SCHEMA:
+//  1. Bump CurrentSettingsVersion
+//  2. Append a migration to settingsMigrations that upgrades a document
+//     from the previous version (rename keys, fill in new defaults, ...)
+//  3. Update ProjectSettings, DefaultProjectSettings and Validate
+//
+// Old documents are upgraded whenever they're read, and rewritten at the
+// new version by ProjectRepository.MigrateSettings at startup.
+const CurrentSettingsVersion = 1
+
+// ErrSettingsFromFuture means a document was written by a newer server
+// We refuse to touch it rather than silently dropping fields we don't know.
+var ErrSettingsFromFuture = errors.New("settings were written by a newer version of the API")
+
+// Export presets a project can default to
+// Format + quality, matching what the export endpoint accepts
+var ExportPresets = []string{
+	"mp4-low", "mp4-medium", "mp4-high",
+	"webm-low", "webm-medium", "webm-high",
+}
+
+// ProjectSettings is the typed, versioned form of projects.settings
+type ProjectSettings struct {
+	Version             int            `json:"version"`
+	Canvas              CanvasSettings `json:"canvas"`
+	FrameRate           float64        `json:"frame_rate"`
+	AspectRatio         string         `json:"aspect_ratio"`     // e.g. "16:9"
+	BackgroundColor     string         `json:"background_color"` // "#rrggbb"
+	DefaultExportPreset string         `json:"default_export_preset"`
+}
+
+// CanvasSettings is the output resolution in pixels
+type CanvasSettings struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// DefaultProjectSettings returns the settings for a brand new project
+// 1080p, 30fps - what most source footage and most platforms use
+func DefaultProjectSettings() ProjectSettings {
+	return ProjectSettings{
+		Version:             CurrentSettingsVersion,
+		Canvas:              CanvasSettings{Width: 1920, Height: 1080},
+		FrameRate:           30,
+		AspectRatio:         "16:9",
+		BackgroundColor:     "#000000",
+		DefaultExportPreset: "mp4-high",
+	}
+}
+
+// SettingsError lists every invalid field, so clients can show all
+// problems at once instead of making the user fix them one by one
+type SettingsError struct {
+	Fields map[string]string
+}
+
+func (e *SettingsError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for field, msg := range e.Fields {
+		parts = append(parts, field+": "+msg)
+	}
+	return "invalid settings: " + strings.Join(parts, "; ")
+}
+
+var (
+	aspectRatioPattern = regexp.MustCompile(`^([1-9][0-9]*):([1-9][0-9]*)$`)
+	colorPattern       = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// Validate checks every field and returns a *SettingsError if any are wrong
+func (s ProjectSettings) Validate() error {
+	fields := map[string]string{}
+
+	// Up to 8K. Video encoders (H.264 with 4:2:0 chroma) need even dimensions
+	if s.Canvas.Width < 16 || s.Canvas.Width > 7680 || s.Canvas.Width%2 != 0 {
+		fields["canvas.width"] = "must be an even number between 16 and 7680"
+	}
+	if s.Canvas.Height < 16 || s.Canvas.Height > 4320 || s.Canvas.Height%2 != 0 {
+		fields["canvas.height"] = "must be an even number between 16 and 4320"
+	}
+	if s.FrameRate < 1 || s.FrameRate > 120 {
+		fields["frame_rate"] = "must be between 1 and 120"
+	}
+	if !aspectRatioPattern.MatchString(s.AspectRatio) {
+		fields["aspect_ratio"] = `must look like "16:9"`
+	}
+	if !colorPattern.MatchString(s.BackgroundColor) {
+		fields["background_color"] = "must look like #rrggbb"
+	}
+	if !isExportPreset(s.DefaultExportPreset) {
+		fields["default_export_preset"] = "must be one of " + strings.Join(ExportPresets, ", ")
+	}
+
+	if len(fields) > 0 {
+		return &SettingsError{Fields: fields}
+	}
+	return nil
+}
+
+func isExportPreset(preset string) bool {
+	for _, p := range ExportPresets {
+		if p == preset {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON upgrades old documents while decoding
+// This means every code path that reads settings from the database (or from
+// an imported file) gets the current schema without having to remember to.
+func (s *ProjectSettings) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	upgraded, err := UpgradeSettings(raw)
+	if err != nil {
+		return err
+	}
+
+	// Re-encode and decode into an alias type
+	// (the alias has no UnmarshalJSON, so this doesn't recurse)
+	type plain ProjectSettings
+	encoded, err := json.Marshal(upgraded)
+	if err != nil {
+		return err
+	}
+	var p plain
+	if err := json.Unmarshal(encoded, &p); err != nil {
+		return err
+	}
+
+	*s = ProjectSettings(p)
+	return nil
+}
+
+// ApplyPatch applies a JSON merge patch (RFC 7386) and validates the result
+// The version field is managed by the server and can't be patched.
+func (s ProjectSettings) ApplyPatch(patch []byte) (ProjectSettings, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return s, err
+	}
+	if obj, ok := patchDoc.(map[string]interface{}); ok {
+		if _, ok := obj["version"]; ok {
+			return s, &SettingsError{Fields: map[string]string{"version": "is managed by the server"}}
+		}
+	} else {
+		// A non-object patch replaces the whole document - never valid here
+		return s, &SettingsError{Fields: map[string]string{"": "patch must be a JSON object"}}
+	}
+
+	current, err := toJSONMap(s)
+	if err != nil {
+		return s, err
+	}
+	defaults, err := toJSONMap(DefaultProjectSettings())
+	if err != nil {
+		return s, err
+	}
+
+	merged := mergePatch(current, patchDoc)
+
+	// RFC 7386 deletes keys set to null. For a fixed schema, a missing key
+	// means "back to the default", so fill those in from the defaults.
+	merged = fillDefaults(merged, defaults)
+
+	// Decode strictly: unknown keys and wrong types are client errors
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return s, err
+	}
+	type plain ProjectSettings
+	var p plain
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return s, decodeErrorToSettingsError(err)
+	}
+
+	result := ProjectSettings(p)
+	if err := result.Validate(); err != nil {
+		return s, err
+	}
+	return result, nil
+}
+
+// mergePatch implements the RFC 7386 algorithm
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+// fillDefaults copies any keys missing from doc over from defaults, recursively
+func fillDefaults(doc interface{}, defaults map[string]interface{}) interface{} {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return doc
+	}
+	for key, def := range defaults {
+		value, exists := obj[key]
+		if !exists {
+			obj[key] = def
+			continue
+		}
+		if defObj, ok := def.(map[string]interface{}); ok {
+			obj[key] = fillDefaults(value, defObj)
+		}
+	}
+	return obj
+}
+
+// decodeErrorToSettingsError turns encoding/json errors into field errors
+func decodeErrorToSettingsError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &SettingsError{Fields: map[string]string{
+			typeErr.Field: "must be a " + jsonTypeName(typeErr.Type.Kind().String()),
+		}}
+	}
+
+	// DisallowUnknownFields errors look like: json: unknown field "foo"
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(msg, "json: unknown field "))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(msg, "json: unknown field ")
+		}
+		return &SettingsError{Fields: map[string]string{field: "is not a known setting"}}
+	}
+
+	return err
+}
+
+// jsonTypeName maps Go kinds to the names API users know
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "int", "int64", "float64":
+		return "number"
+	case "struct":
+		return "object"
+	default:
+		return kind
+	}
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ============================================
+// SCHEMA MIGRATIONS
+// ============================================
+
+// settingsMigrations[i] upgrades a document from version i to version i+1
+var settingsMigrations = []func(map[string]interface{}) map[string]interface{}{
+	migrateSettingsV0ToV1,
+}
+
+// UpgradeSettings brings a raw settings document up to CurrentSettingsVersion
+// Documents without a version are treated as version 0 (the untyped JSONMap era)
+func UpgradeSettings(raw map[string]interface{}) (map[string]interface{}, error) {
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > CurrentSettingsVersion {
+		return nil, fmt.Errorf("%w (version %d)", ErrSettingsFromFuture, version)
+	}
+
+	for version < CurrentSettingsVersion {
+		raw = settingsMigrations[version](raw)
+		version++
+		raw["version"] = version
+	}
+
+	return raw, nil
+}
+
+// migrateSettingsV0ToV1 converts the old free-form settings map
+// Version 0 had no schema, so we pick up the keys the web client used to
+// write where they make sense and use defaults for everything else.
+func migrateSettingsV0ToV1(old map[string]interface{}) map[string]interface{} {
+	def := DefaultProjectSettings()
+
+	width, height := def.Canvas.Width, def.Canvas.Height
+	if w, ok := old["width"].(float64); ok {
+		width = int(w)
+	}
+	if h, ok := old["height"].(float64); ok {
+		height = int(h)
+	}
+
+	frameRate := def.FrameRate
+	for _, key := range []string{"fps", "frameRate", "frame_rate"} {
+		if fps, ok := old[key].(float64); ok {
+			frameRate = fps
+			break
+		}
+	}
+
+	background := def.BackgroundColor
+	for _, key := range []string{"backgroundColor", "background_color"} {
+		if c, ok := old[key].(string); ok && colorPattern.MatchString(c) {
+			background = c
+			break
+		}
+	}
+
+	aspect := def.AspectRatio
+	if width != def.Canvas.Width || height != def.Canvas.Height {
+		aspect = reduceAspectRatio(width, height)
+	}
+
+	return map[string]interface{}{
+		"canvas": map[string]interface{}{
+			"width":  width,
+			"height": height,
+		},
+		"frame_rate":            frameRate,
+		"aspect_ratio":          aspect,
+		"background_color":      background,
+		"default_export_preset": def.DefaultExportPreset,
+	}
+}
+
+// reduceAspectRatio turns 1280x720 into "16:9"
+func reduceAspectRatio(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return DefaultProjectSettings().AspectRatio
+	}
+	a, b := width, height
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return fmt.Sprintf("%d:%d", width/a, height/a)
+}
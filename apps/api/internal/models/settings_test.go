@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestMergePatch runs the examples from RFC 7386, appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch interface{}
+		if err := json.Unmarshal([]byte(tt.target), &target); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(mergePatch(target, patch))
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	current := DefaultProjectSettings()
+	current.Canvas = CanvasSettings{Width: 1280, Height: 720}
+	current.FrameRate = 60
+	current.BackgroundColor = "#112233"
+
+	tests := []struct {
+		name  string
+		patch string
+		want  func(s *ProjectSettings)
+	}{
+		{"empty patch", `{}`, func(s *ProjectSettings) {}},
+		{"top-level value", `{"frame_rate": 24}`, func(s *ProjectSettings) { s.FrameRate = 24 }},
+		{"nested value keeps its siblings", `{"canvas": {"width": 1920}}`, func(s *ProjectSettings) { s.Canvas.Width = 1920 }},
+		{"null resets to the default", `{"frame_rate": null}`, func(s *ProjectSettings) { s.FrameRate = 30 }},
+		{"nested null resets one field", `{"canvas": {"height": null}}`, func(s *ProjectSettings) { s.Canvas.Height = 1080 }},
+		{"null object resets all of it", `{"canvas": null}`, func(s *ProjectSettings) { s.Canvas = CanvasSettings{Width: 1920, Height: 1080} }},
+		{"several at once", `{"background_color": null, "default_export_preset": "webm-low"}`, func(s *ProjectSettings) {
+			s.BackgroundColor = "#000000"
+			s.DefaultExportPreset = "webm-low"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := current
+			tt.want(&want)
+			got, err := current.ApplyPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	current := DefaultProjectSettings()
+
+	tests := []struct {
+		name  string
+		patch string
+		field string // "" and no SettingsError: a plain error
+	}{
+		{"version", `{"version": 2}`, "version"},
+		{"not an object", `[{"frame_rate": 24}]`, ""},
+		{"unknown key", `{"fps": 24}`, "fps"},
+		{"wrong type", `{"frame_rate": "fast"}`, "frame_rate"},
+		{"wrong nested type", `{"canvas": {"width": "wide"}}`, "canvas.width"},
+		{"object replaced by a scalar", `{"canvas": 5}`, "canvas"},
+		{"invalid value", `{"canvas": {"width": 15}}`, "canvas.width"},
+		{"invalid color", `{"background_color": "red"}`, "background_color"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := current.ApplyPatch([]byte(tt.patch))
+			var settingsErr *SettingsError
+			if !errors.As(err, &settingsErr) {
+				t.Fatalf("error = %v, want a SettingsError", err)
+			}
+			if _, ok := settingsErr.Fields[tt.field]; !ok {
+				t.Errorf("fields = %v, want one for %q", settingsErr.Fields, tt.field)
+			}
+			if got != current {
+				t.Errorf("settings changed on error: %+v", got)
+			}
+		})
+	}
+
+	if _, err := current.ApplyPatch([]byte(`{"frame_rate": `)); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestUpgradeSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want ProjectSettings
+	}{
+		{
+			name: "empty version 0",
+			doc:  `{}`,
+			want: DefaultProjectSettings(),
+		},
+		{
+			name: "version 0 written by the web client",
+			doc:  `{"width": 1280, "height": 720, "fps": 24, "backgroundColor": "#112233", "zoom": 2}`,
+			want: ProjectSettings{
+				Version:             1,
+				Canvas:              CanvasSettings{Width: 1280, Height: 720},
+				FrameRate:           24,
+				AspectRatio:         "16:9",
+				BackgroundColor:     "#112233",
+				DefaultExportPreset: "mp4-high",
+			},
+		},
+		{
+			name: "version 0 with an odd size and snake case keys",
+			doc:  `{"width": 1080, "height": 1350, "frame_rate": 25, "background_color": "#abcdef"}`,
+			want: ProjectSettings{
+				Version:             1,
+				Canvas:              CanvasSettings{Width: 1080, Height: 1350},
+				FrameRate:           25,
+				AspectRatio:         "4:5",
+				BackgroundColor:     "#abcdef",
+				DefaultExportPreset: "mp4-high",
+			},
+		},
+		{
+			name: "version 0 values of the wrong type take the default",
+			doc:  `{"width": "1280", "fps": "24", "backgroundColor": "red"}`,
+			want: DefaultProjectSettings(),
+		},
+		{
+			name: "current version is left alone",
+			doc:  `{"version": 1, "canvas": {"width": 640, "height": 480}, "frame_rate": 12, "aspect_ratio": "4:3", "background_color": "#ffffff", "default_export_preset": "webm-low"}`,
+			want: ProjectSettings{
+				Version:             1,
+				Canvas:              CanvasSettings{Width: 640, Height: 480},
+				FrameRate:           12,
+				AspectRatio:         "4:3",
+				BackgroundColor:     "#ffffff",
+				DefaultExportPreset: "webm-low",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// UnmarshalJSON goes through UpgradeSettings
+			var got ProjectSettings
+			if err := json.Unmarshal([]byte(tt.doc), &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("upgraded settings are invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpgradeSettingsFromFuture(t *testing.T) {
+	_, err := UpgradeSettings(map[string]interface{}{"version": float64(CurrentSettingsVersion + 1)})
+	if !errors.Is(err, ErrSettingsFromFuture) {
+		t.Errorf("error = %v, want ErrSettingsFromFuture", err)
+	}
+
+	var s ProjectSettings
+	if err := json.Unmarshal([]byte(`{"version": 99}`), &s); !errors.Is(err, ErrSettingsFromFuture) {
+		t.Errorf("UnmarshalJSON error = %v, want ErrSettingsFromFuture", err)
+	}
+}
+
+func TestUpgradeSettingsNil(t *testing.T) {
+	got, err := UpgradeSettings(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["version"] != CurrentSettingsVersion {
+		t.Errorf("version = %v, want %d", got["version"], CurrentSettingsVersion)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink gives people without an account read-only access to a project
+// The token itself is never stored - only its hash (see auth.GenerateOpaqueToken)
+type ShareLink struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	ProjectID    uuid.UUID  `json:"project_id" db:"project_id"`
+	CreatedBy    uuid.UUID  `json:"created_by" db:"created_by"`
+	TokenPrefix  string     `json:"token_prefix" db:"token_prefix"` // First few characters, to tell links apart
+	PasswordHash *string    `json:"-" db:"password_hash"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	ViewCount    int64      `json:"view_count" db:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty" db:"last_viewed_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+
+	// Computed, for the UI
+	HasPassword bool `json:"has_password"`
+}
+
+// IsActive reports whether the link can currently be used
+func (l *ShareLink) IsActive(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	return l.ExpiresAt == nil || now.Before(*l.ExpiresAt)
+}
+
+// CreateShareLinkRequest is the payload for creating a share link
+// Both fields are optional: no expiry = valid until revoked
+type CreateShareLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Password  *string    `json:"password,omitempty"`
+}
+
+// CreateShareLinkResponse is returned ONCE when a link is created
+// The token can't be recovered later - only its hash is stored
+type CreateShareLinkResponse struct {
+	ShareLink ShareLink `json:"share_link"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+}
+
+// SharedProject is what a share-link visitor sees
+//
+// This is deliberately a separate type rather than Project with fields
+// blanked out: nothing identifying people (user IDs, emails, collaborators)
+// can leak through it, even if Project grows new fields later.
+type SharedProject struct {
+	Name         string          `json:"name"`
+	Description  *string         `json:"description,omitempty"`
+	ThumbnailURL *string         `json:"thumbnail_url,omitempty"`
+	Settings     ProjectSettings `json:"settings"`
+	Timeline     Timeline        `json:"timeline"`
+	Media        []SharedMedia   `json:"media"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// SharedMedia is a media file referenced by a shared timeline
+type SharedMedia struct {
+	ID          uuid.UUID `json:"id"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Duration    float64   `json:"duration,omitempty"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	URL         string    `json:"url"`
+	PosterURL   string    `json:"poster_url,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tag is a label that can be attached to projects
+// A tag is created (and renamed/deleted) by one user, but once it's on a
+// project every collaborator sees it and can filter by it.
+type Tag struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
+	Name      string    `json:"name" db:"name"`
+	Color     *string   `json:"color,omitempty" db:"color"` // "#rrggbb"
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// CreateTagRequest is the payload for creating a tag
+type CreateTagRequest struct {
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+}
+
+// UpdateTagRequest is the payload for updating a tag
+type UpdateTagRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Color *string `json:"color,omitempty"`
+}
+
+// AddProjectTagRequest attaches an existing tag to a project
+type AddProjectTagRequest struct {
+	TagID uuid.UUID `json:"tag_id"`
+}
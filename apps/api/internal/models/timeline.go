@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Timeline is the server-side copy of a project's edit
+//
+// Field names are camelCase (unlike the rest of the API) because this
+// mirrors the shared Yjs document the web editor works on - the client can
+// save and load it without renaming anything.
+type Timeline struct {
+	Media   []MediaClip  `json:"media"`
+	Effects []EffectClip `json:"effects"`
+}
+
+// MediaClip places (part of) an uploaded file on the timeline
+// Any media kind works. An image has no duration: it's shown for the
+// whole clip and SourceIn is ignored. Audio clips are just not drawn.
+type MediaClip struct {
+	ID        string    `json:"id"`
+	MediaID   uuid.UUID `json:"mediaId"`
+	StartTime float64   `json:"startTime"` // Position on the timeline, seconds
+	EndTime   float64   `json:"endTime"`
+	SourceIn  float64   `json:"sourceIn"` // Where in the source file the clip starts
+}
+
+// EffectClip applies an effect over a time range
+// Params hold each value as JSON of its type (see ParamDefinition), e.g.
+// {"decay": 0.9, "pattern": "smooth", "tint": "#ff8800"}.
+type EffectClip struct {
+	ID        string                     `json:"id"`
+	Type      string                     `json:"type"` // Effect ID, e.g. "time-smear"
+	Name      string                     `json:"name"`
+	StartTime float64                    `json:"startTime"`
+	EndTime   float64                    `json:"endTime"`
+	Params    map[string]json.RawMessage `json:"params"`
+}
+
+// Normalize turns nil slices into empty ones
+// so the API returns [] instead of null
+func (t *Timeline) Normalize() {
+	if t.Media == nil {
+		t.Media = []MediaClip{}
+	}
+	if t.Effects == nil {
+		t.Effects = []EffectClip{}
+	}
+}
+
+// Duration is where the last clip ends, in seconds
+func (t Timeline) Duration() float64 {
+	end := 0.0
+	for _, c := range t.Media {
+		end = max(end, c.EndTime)
+	}
+	for _, c := range t.Effects {
+		end = max(end, c.EndTime)
+	}
+	return end
+}
+
+// Validate checks the structural rules every timeline must follow
+// It does NOT check that media exists or that effect params are valid
+// (effects.Catalog.CheckParams does, against the project's versions).
+func (t Timeline) Validate() error {
+	ids := map[string]bool{}
+
+	checkClip := func(kind, id string, start, end float64) error {
+		if id == "" {
+			return fmt.Errorf("%s clip is missing an id", kind)
+		}
+		if ids[id] {
+			return fmt.Errorf("duplicate clip id %q", id)
+		}
+		ids[id] = true
+		if start < 0 || end <= start {
+			return fmt.Errorf("clip %q must have 0 <= startTime < endTime", id)
+		}
+		return nil
+	}
+
+	for _, c := range t.Media {
+		if err := checkClip("media", c.ID, c.StartTime, c.EndTime); err != nil {
+			return err
+		}
+		if c.MediaID == uuid.Nil {
+			return fmt.Errorf("clip %q is missing a mediaId", c.ID)
+		}
+		if c.SourceIn < 0 {
+			return fmt.Errorf("clip %q has a negative sourceIn", c.ID)
+		}
+	}
+
+	for _, c := range t.Effects {
+		if err := checkClip("effect", c.ID, c.StartTime, c.EndTime); err != nil {
+			return err
+		}
+		if c.Type == "" {
+			return fmt.Errorf("clip %q is missing an effect type", c.ID)
+		}
+	}
+
+	return nil
+}
+
+// MediaIDs returns the distinct media referenced by the timeline
+func (t Timeline) MediaIDs() []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	ids := []uuid.UUID{}
+	for _, c := range t.Media {
+		if !seen[c.MediaID] {
+			seen[c.MediaID] = true
+			ids = append(ids, c.MediaID)
+		}
+	}
+	return ids
+}
+
+// EffectIDs returns the distinct effects used by the timeline
+func (t Timeline) EffectIDs() []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, c := range t.Effects {
+		if !seen[c.Type] {
+			seen[c.Type] = true
+			ids = append(ids, c.Type)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload is an in-progress resumable (tus) upload
+// Bytes arrive in chunks which are kept as separate blobs (PartKeys)
+// until the last one lands, then assembled into a Media file.
+type Upload struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	OwnerID     uuid.UUID  `json:"owner_id" db:"owner_id"`
+	ProjectID   *uuid.UUID `json:"project_id,omitempty" db:"project_id"`
+	Filename    string     `json:"filename" db:"filename"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	Length      int64      `json:"length" db:"upload_length"`        // Total size, declared up front
+	Offset      int64      `json:"offset" db:"upload_offset"`        // Bytes received so far
+	PartKeys    []string   `json:"-" db:"part_keys"`                 // Blob keys of the chunks, in order
+	MediaID     *uuid.UUID `json:"media_id,omitempty" db:"media_id"` // Set once assembled
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsComplete reports whether every byte has arrived
+func (u *Upload) IsComplete() bool {
+	return u.Offset == u.Length
+}
@@ -0,0 +1,55 @@
+package models
+
+import "github.com/google/uuid"
+
+// StorageBreakdown is the space a set of media files and exports takes
+// up, by kind
+//
+// Files are stored once per content (see Media.ContentHash), and so are
+// the files generated from them (see Media.DerivedID), so a file uploaded
+// into several projects counts once in a total. Frames are cached per
+// video and always count.
+type StorageBreakdown struct {
+	UsedBytes      int64 `json:"used_bytes"`      // Everything below
+	MediaBytes     int64 `json:"media_bytes"`     // Original uploads
+	ProxyBytes     int64 `json:"proxy_bytes"`     // Preview proxies
+	StreamBytes    int64 `json:"stream_bytes"`    // HLS renditions
+	ThumbnailBytes int64 `json:"thumbnail_bytes"` // Posters and sprite sheets
+	WaveformBytes  int64 `json:"waveform_bytes"`  // Audio peaks
+	FrameBytes     int64 `json:"frame_bytes"`     // Cached still frames
+	ExportBytes    int64 `json:"export_bytes"`    // Rendered exports
+	FileCount      int   `json:"file_count"`
+}
+
+// StorageUsage is the response of GET /api/me/usage
+type StorageUsage struct {
+	StorageBreakdown
+	QuotaBytes int64 `json:"quota_bytes"` // 0 = unlimited
+
+	// Where the space goes, biggest first, to help decide what to delete
+	Projects     []ProjectStorage `json:"projects"`
+	LargestFiles []MediaStorage   `json:"largest_files"`
+}
+
+// ProjectStorage is the space the user's files take up in one project
+type ProjectStorage struct {
+	ProjectID   *uuid.UUID `json:"project_id"` // null = files not in any project
+	ProjectName *string    `json:"project_name,omitempty"`
+	StorageBreakdown
+
+	// The project's own quota covers every collaborator's files
+	ProjectUsedBytes  int64 `json:"project_used_bytes,omitempty"`
+	ProjectQuotaBytes int64 `json:"project_quota_bytes,omitempty"` // 0 = unlimited
+}
+
+// MediaStorage is the space one media file takes up
+type MediaStorage struct {
+	MediaID   uuid.UUID  `json:"media_id"`
+	Filename  string     `json:"filename"`
+	ProjectID *uuid.UUID `json:"project_id,omitempty"`
+	Bytes     int64      `json:"bytes"` // Original plus generated files and cached frames
+
+	// Other videos use the same file, so deleting this one frees only its
+	// cached frames
+	Shared bool `json:"shared"`
+}
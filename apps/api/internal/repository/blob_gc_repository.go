@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+// ErrGCRecentlyRun means another pass of the cleanup started too recently
+var ErrGCRecentlyRun = errors.New("blob cleanup ran recently")
+
+// BlobGCRepository records passes of the orphaned blob cleanup
+type BlobGCRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewBlobGCRepository creates a new blob cleanup repository
+func NewBlobGCRepository(db *pgxpool.Pool) *BlobGCRepository {
+	return &BlobGCRepository{db: db}
+}
+
+// StartRun records the start of a pass, unless one (on any server)
+// started less than interval ago
+//
+// WHY AN ADVISORY LOCK?
+// Every server runs the cleanup loop. Holding the lock makes "look at the
+// last start, insert a new one" atomic, so only one of them wins.
+func (r *BlobGCRepository) StartRun(ctx context.Context, dryRun bool, interval time.Duration) (*models.GCRun, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('blob_gc_runs'))`); err != nil {
+		return nil, err
+	}
+
+	run := &models.GCRun{DryRun: dryRun, ByPrefix: map[string]models.GCStats{}}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO blob_gc_runs (dry_run)
+		SELECT $1
+		WHERE NOT EXISTS (
+			SELECT 1 FROM blob_gc_runs
+			WHERE started_at > NOW() - make_interval(secs => $2)
+		)
+		RETURNING id, started_at
+	`, dryRun, interval.Seconds()).Scan(&run.ID, &run.StartedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGCRecentlyRun
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// FinishRun saves what a pass found and marks it finished
+func (r *BlobGCRepository) FinishRun(ctx context.Context, run *models.GCRun) error {
+	return r.db.QueryRow(ctx, `
+		UPDATE blob_gc_runs
+		SET scanned = $2, scanned_bytes = $3,
+			orphans = $4, orphan_bytes = $5,
+			pending = $6, pending_bytes = $7,
+			deleted = $8, reclaimed_bytes = $9, failed = $10,
+			blob_records = $11, by_prefix = $12, error = $13,
+			finished_at = NOW()
+		WHERE id = $1
+		RETURNING finished_at
+	`,
+		run.ID, run.Scanned, run.ScannedBytes,
+		run.Orphans, run.OrphanBytes,
+		run.Pending, run.PendingBytes,
+		run.Deleted, run.ReclaimedBytes, run.Failed,
+		run.BlobRecords, run.ByPrefix, run.Error,
+	).Scan(&run.FinishedAt)
+}
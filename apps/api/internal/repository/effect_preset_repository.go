@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var ErrPresetNotFound = errors.New("preset not found")
+
+// EffectPresetRepository handles effect preset database operations
+//
+// Params are stored as given: checking them against the effect catalog,
+// and mapping them to other effect versions, is the caller's job.
+type EffectPresetRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewEffectPresetRepository creates a new effect preset repository
+func NewEffectPresetRepository(db *pgxpool.Pool) *EffectPresetRepository {
+	return &EffectPresetRepository{db: db}
+}
+
+// presetColumns is the column list every preset query selects
+const presetColumns = `
+	p.id, p.created_by, p.effect_id, p.effect_version, p.name, p.description,
+	p.tags, p.params, p.scope, p.project_id, p.created_at, p.updated_at`
+
+// visiblePresetsSQL matches the presets a user ($1) can see: their own,
+// public ones, and team presets of live projects they collaborate on
+// Anonymous users pass uuid.Nil and see the public ones.
+const visiblePresetsSQL = `(
+	p.created_by = $1
+	OR p.scope = 'public'
+	OR (p.scope = 'team' AND p.project_id IN (
+		SELECT c.project_id FROM collaborators c
+		INNER JOIN projects pr ON pr.id = c.project_id
+		WHERE c.user_id = $1 AND c.status = 'accepted' AND pr.is_deleted = false
+	))
+)`
+
+// scanPreset reads one row of presetColumns
+func scanPreset(row pgx.Row) (*models.EffectPreset, error) {
+	p := &models.EffectPreset{}
+	err := row.Scan(
+		&p.ID,
+		&p.CreatedBy,
+		&p.EffectID,
+		&p.EffectVersion,
+		&p.Name,
+		&p.Description,
+		&p.Tags,
+		&p.Params,
+		&p.Scope,
+		&p.ProjectID,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+// List returns the presets a user can see, newest first
+// effectID and tag narrow the list down when not "".
+func (r *EffectPresetRepository) List(ctx context.Context, userID uuid.UUID, effectID, tag string) ([]models.EffectPreset, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+presetColumns+`
+		FROM effect_presets p
+		WHERE `+visiblePresetsSQL+`
+			AND ($2 = '' OR p.effect_id = $2)
+			AND ($3 = '' OR $3 = ANY(p.tags))
+		ORDER BY p.created_at DESC, p.id
+	`, userID, effectID, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presets := []models.EffectPreset{}
+	for rows.Next() {
+		p, err := scanPreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, *p)
+	}
+
+	return presets, rows.Err()
+}
+
+// ListTeam returns the team presets shared with a project, oldest first
+// Access to the project is the caller's to check.
+func (r *EffectPresetRepository) ListTeam(ctx context.Context, projectID uuid.UUID) ([]models.EffectPreset, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+presetColumns+`
+		FROM effect_presets p
+		WHERE p.scope = 'team' AND p.project_id = $1
+		ORDER BY p.created_at, p.id
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presets := []models.EffectPreset{}
+	for rows.Next() {
+		p, err := scanPreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, *p)
+	}
+
+	return presets, rows.Err()
+}
+
+// Get returns a preset the user can see
+func (r *EffectPresetRepository) Get(ctx context.Context, userID, presetID uuid.UUID) (*models.EffectPreset, error) {
+	p, err := scanPreset(r.db.QueryRow(ctx, `
+		SELECT `+presetColumns+`
+		FROM effect_presets p
+		WHERE p.id = $2 AND `+visiblePresetsSQL+`
+	`, userID, presetID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPresetNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// Create saves a new preset made by preset.CreatedBy
+// A team preset needs edit access to its project, since everyone on it
+// will see the preset.
+func (r *EffectPresetRepository) Create(ctx context.Context, preset *models.EffectPreset) (*models.EffectPreset, error) {
+	if preset.Scope == models.PresetScopeTeam {
+		if err := r.checkCanEdit(ctx, preset.CreatedBy, *preset.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := scanPreset(r.db.QueryRow(ctx, `
+		INSERT INTO effect_presets AS p
+			(created_by, effect_id, effect_version, name, description, tags, params, scope, project_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+presetColumns+`
+	`, preset.CreatedBy, preset.EffectID, preset.EffectVersion, preset.Name, preset.Description,
+		preset.Tags, preset.Params, preset.Scope, preset.ProjectID))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update saves changes to a preset (only its creator can)
+// preset is the whole new state, usually a Get with fields changed.
+func (r *EffectPresetRepository) Update(ctx context.Context, userID uuid.UUID, preset *models.EffectPreset) (*models.EffectPreset, error) {
+	if preset.Scope == models.PresetScopeTeam {
+		if err := r.checkCanEdit(ctx, userID, *preset.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := scanPreset(r.db.QueryRow(ctx, `
+		UPDATE effect_presets AS p
+		SET
+			effect_version = $3,
+			name = $4,
+			description = $5,
+			tags = $6,
+			params = $7,
+			scope = $8,
+			project_id = $9,
+			updated_at = NOW()
+		WHERE p.id = $1 AND p.created_by = $2
+		RETURNING `+presetColumns+`
+	`, preset.ID, userID, preset.EffectVersion, preset.Name, preset.Description,
+		preset.Tags, preset.Params, preset.Scope, preset.ProjectID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPresetNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete removes a preset (only its creator can)
+func (r *EffectPresetRepository) Delete(ctx context.Context, userID, presetID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM effect_presets WHERE id = $1 AND created_by = $2
+	`, presetID, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrPresetNotFound
+	}
+
+	return nil
+}
+
+// checkCanEdit verifies the user has an editing role on a live project
+func (r *EffectPresetRepository) checkCanEdit(ctx context.Context, userID, projectID uuid.UUID) error {
+	var role string
+	err := r.db.QueryRow(ctx, `
+		SELECT c.role FROM collaborators c
+		INNER JOIN projects p ON p.id = c.project_id
+		WHERE c.project_id = $1 AND c.user_id = $2
+			AND c.status = 'accepted' AND p.is_deleted = false
+	`, projectID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProjectNotFound
+		}
+		return err
+	}
+
+	if !models.CanEdit(role) {
+		return ErrNotAuthorized
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var ErrExportNotFound = errors.New("export not found")
+
+// exportColumns is the column list every export query returns
+const exportColumns = `
+	id, project_id, user_id, format, quality, status, progress,
+	output_key, size_bytes, error, created_at, updated_at
+`
+
+// ExportRepository handles export job database operations
+type ExportRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewExportRepository creates a new export repository
+func NewExportRepository(db *pgxpool.Pool) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+// scanExport reads one row of exportColumns
+func scanExport(row pgx.Row) (*models.ExportJob, error) {
+	job := &models.ExportJob{}
+	err := row.Scan(
+		&job.ID,
+		&job.ProjectID,
+		&job.UserID,
+		&job.Format,
+		&job.Quality,
+		&job.Status,
+		&job.Progress,
+		&job.OutputKey,
+		&job.SizeBytes,
+		&job.Error,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	return job, err
+}
+
+// Create stores a new export job
+// Callers must check the user may access the project first
+func (r *ExportRepository) Create(ctx context.Context, job *models.ExportJob) (*models.ExportJob, error) {
+	return scanExport(r.db.QueryRow(ctx, `
+		INSERT INTO exports (id, project_id, user_id, format, quality, status, output_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+exportColumns,
+		job.ID, job.ProjectID, job.UserID, job.Format, job.Quality, job.Status, job.OutputKey))
+}
+
+// Get returns an export job started by the user
+func (r *ExportRepository) Get(ctx context.Context, exportID, userID uuid.UUID) (*models.ExportJob, error) {
+	return scanExport(r.db.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM exports
+		WHERE id = $1 AND user_id = $2
+	`, exportID, userID))
+}
+
+// SetProgress records how far a render has got
+func (r *ExportRepository) SetProgress(ctx context.Context, exportID uuid.UUID, status string, progress int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE exports SET status = $2, progress = $3, updated_at = NOW()
+		WHERE id = $1
+	`, exportID, status, progress)
+	return err
+}
+
+// Complete marks a render done, with the size of the file it wrote
+// (0 if it didn't write one)
+func (r *ExportRepository) Complete(ctx context.Context, exportID uuid.UUID, sizeBytes int64) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE exports SET status = 'completed', progress = 100, size_bytes = $2, updated_at = NOW()
+		WHERE id = $1
+	`, exportID, sizeBytes)
+	return err
+}
+
+// Fail marks a render failed
+func (r *ExportRepository) Fail(ctx context.Context, exportID uuid.UUID, msg string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE exports SET status = 'failed', error = $2, updated_at = NOW()
+		WHERE id = $1
+	`, exportID, msg)
+	return err
+}
+
+// OutputKeyInUse reports whether an export job writes (or wrote) to key
+// Used by the orphaned blob cleanup.
+func (r *ExportRepository) OutputKeyInUse(ctx context.Context, key string) (bool, error) {
+	var used bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM exports WHERE output_key = $1)
+	`, key).Scan(&used)
+	return used, err
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("a folder with this name already exists here")
+	ErrFolderCycle    = errors.New("a folder can't be moved inside itself")
+)
+
+// FolderRepository handles folder database operations
+// Every query is scoped by user_id - folders are never shared
+type FolderRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewFolderRepository creates a new folder repository
+func NewFolderRepository(db *pgxpool.Pool) *FolderRepository {
+	return &FolderRepository{db: db}
+}
+
+// List returns all of a user's folders as a flat list
+// Clients build the tree from parent_id - it's one query instead of one per level
+func (r *FolderRepository) List(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, parent_id, name, created_at, updated_at
+		FROM folders
+		WHERE user_id = $1
+		ORDER BY name, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		var f models.Folder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.ParentID, &f.Name, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+
+	return folders, rows.Err()
+}
+
+// Create makes a new folder, optionally inside another one
+func (r *FolderRepository) Create(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error) {
+	if parentID != nil {
+		if err := r.checkOwned(ctx, userID, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	folder := &models.Folder{}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO folders (user_id, parent_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, parent_id, name, created_at, updated_at
+	`, userID, parentID, name).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrFolderExists
+		}
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// Update renames and/or moves a folder
+func (r *FolderRepository) Update(ctx context.Context, userID, folderID uuid.UUID, name *string, parent models.NullableUUID) (*models.Folder, error) {
+	if err := r.checkOwned(ctx, userID, folderID); err != nil {
+		return nil, err
+	}
+
+	if parent.Set && parent.UUID != nil {
+		if err := r.checkOwned(ctx, userID, *parent.UUID); err != nil {
+			return nil, err
+		}
+
+		// Walk up from the new parent - if we reach the folder being
+		// moved, the move would create a loop (A inside B inside A)
+		var cycle bool
+		err := r.db.QueryRow(ctx, `
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM folders WHERE id = $1
+				UNION ALL
+				SELECT f.id, f.parent_id FROM folders f
+				INNER JOIN ancestors a ON f.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+		`, *parent.UUID, folderID).Scan(&cycle)
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, ErrFolderCycle
+		}
+	}
+
+	folder := &models.Folder{}
+	err := r.db.QueryRow(ctx, `
+		UPDATE folders
+		SET
+			name = COALESCE($3, name),
+			parent_id = CASE WHEN $4 THEN $5 ELSE parent_id END,
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, parent_id, name, created_at, updated_at
+	`, folderID, userID, name, parent.Set, parent.UUID).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrFolderNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrFolderExists
+		}
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// Delete removes a folder and its subfolders
+// Projects inside are NOT deleted - they just become unfiled
+// (ON DELETE CASCADE removes the project_folders rows)
+func (r *FolderRepository) Delete(ctx context.Context, userID, folderID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM folders WHERE id = $1 AND user_id = $2
+	`, folderID, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrFolderNotFound
+	}
+
+	return nil
+}
+
+// MoveProject files a project into one of the user's folders
+// A nil folderID takes the project out of its folder
+// Any collaborator can do this - it only affects their own dashboard
+func (r *FolderRepository) MoveProject(ctx context.Context, userID, projectID uuid.UUID, folderID *uuid.UUID) error {
+	var hasAccess bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM collaborators c
+			INNER JOIN projects p ON p.id = c.project_id
+			WHERE c.project_id = $1 AND c.user_id = $2
+				AND c.status = 'accepted' AND p.is_deleted = false
+		)
+	`, projectID, userID).Scan(&hasAccess)
+	if err != nil {
+		return err
+	}
+	if !hasAccess {
+		return ErrProjectNotFound
+	}
+
+	if folderID == nil {
+		_, err = r.db.Exec(ctx, `
+			DELETE FROM project_folders WHERE user_id = $1 AND project_id = $2
+		`, userID, projectID)
+		return err
+	}
+
+	if err := r.checkOwned(ctx, userID, *folderID); err != nil {
+		return err
+	}
+
+	// Upsert: a project lives in at most one folder per user
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO project_folders (user_id, project_id, folder_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, project_id) DO UPDATE SET folder_id = EXCLUDED.folder_id
+	`, userID, projectID, *folderID)
+	return err
+}
+
+// checkOwned returns ErrFolderNotFound unless the folder belongs to the user
+// We don't distinguish "doesn't exist" from "someone else's" - that would
+// let users probe for other people's folder IDs
+func (r *FolderRepository) checkOwned(ctx context.Context, userID, folderID uuid.UUID) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND user_id = $2)
+	`, folderID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrFolderNotFound
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation
+// Checking the SQLSTATE code is more robust than matching the error text,
+// which changes with the constraint name and server language.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecordFrame records a cached still frame, so it counts against quotas
+// Extracting the same frame again replaces the row.
+func (r *MediaRepository) RecordFrame(ctx context.Context, mediaID uuid.UUID, key string, size int64) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO media_frames (key, media_id, size_bytes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET size_bytes = $3, created_at = NOW()
+	`, key, mediaID, size)
+	return err
+}
+
+// DeleteFrameRecords forgets frames cached before the given time
+// The blob cleanup deletes their files at the same age.
+func (r *MediaRepository) DeleteFrameRecords(ctx context.Context, before time.Time) (int, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM media_frames WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrNoJobs = errors.New("no runnable jobs")
+
+	// ErrRunSuperseded is returned when a job run records its results
+	// after it lost the job (re-enqueued, or claimed again once its lease
+	// ran out): the newer run's results win
+	ErrRunSuperseded = errors.New("job run was superseded")
+)
+
+// mediaJobColumns is the column list every job query returns
+const mediaJobColumns = `
+	id, media_id, kind, status, attempts, run, error, run_after,
+	started_at, finished_at, created_at, updated_at
+`
+
+// MediaJobRepository is the background job queue for media files
+type MediaJobRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewMediaJobRepository creates a new media job repository
+func NewMediaJobRepository(db *pgxpool.Pool) *MediaJobRepository {
+	return &MediaJobRepository{db: db}
+}
+
+// Enqueue schedules a job, or resets it if the file already has one of
+// that kind (whatever state it was in)
+// run is left alone: a worker still busy with the old run must not be
+// able to report on the new one.
+func (r *MediaJobRepository) Enqueue(ctx context.Context, mediaID uuid.UUID, kind string) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO media_jobs (media_id, kind)
+		VALUES ($1, $2)
+		ON CONFLICT (media_id, kind) DO UPDATE
+		SET status = 'queued', attempts = 0, error = NULL, run_after = NOW(),
+			started_at = NULL, finished_at = NULL, updated_at = NOW()
+	`, mediaID, kind)
+	return err
+}
+
+// Claim takes the oldest runnable job of the given kinds
+//
+// CONCURRENCY: FOR UPDATE SKIP LOCKED makes concurrent workers (also on
+// other servers) skip rows someone else is claiming instead of waiting,
+// so each job goes to exactly one worker.
+//
+// A job still "running" after lease was abandoned by a crashed worker
+// and is handed out again. Returns ErrNoJobs when there's nothing to do.
+func (r *MediaJobRepository) Claim(ctx context.Context, kinds []string, lease time.Duration) (*models.MediaJob, error) {
+	row := r.db.QueryRow(ctx, `
+		UPDATE media_jobs
+		SET status = 'running', attempts = attempts + 1, run = run + 1, started_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM media_jobs
+			WHERE kind = ANY($1) AND (
+				(status = 'queued' AND run_after <= NOW())
+				OR (status = 'running' AND started_at < NOW() - make_interval(secs => $2))
+			)
+			ORDER BY run_after
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+mediaJobColumns,
+		kinds, lease.Seconds())
+	job, err := scanMediaJob(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoJobs
+	}
+	return job, err
+}
+
+// Complete marks a claimed job done
+//
+// All the updates below only match the run that was claimed: if the job
+// was re-enqueued (or re-claimed after its lease) in the meantime, the
+// stale worker's result is dropped.
+func (r *MediaJobRepository) Complete(ctx context.Context, job *models.MediaJob) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE media_jobs
+		SET status = 'done', error = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND run = $2
+	`, job.ID, job.Run)
+	return err
+}
+
+// Retry records a failed attempt and queues the job again at runAfter
+func (r *MediaJobRepository) Retry(ctx context.Context, job *models.MediaJob, message string, runAfter time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE media_jobs
+		SET status = 'queued', error = $3, run_after = $4, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND run = $2
+	`, job.ID, job.Run, message, runAfter)
+	return err
+}
+
+// Fail gives up on a job
+func (r *MediaJobRepository) Fail(ctx context.Context, job *models.MediaJob, message string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE media_jobs
+		SET status = 'failed', error = $3, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND run = $2
+	`, job.ID, job.Run, message)
+	return err
+}
+
+// Release puts back a job that was interrupted (e.g. by a shutdown)
+// without counting the attempt
+func (r *MediaJobRepository) Release(ctx context.Context, job *models.MediaJob) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE media_jobs
+		SET status = 'queued', attempts = attempts - 1, run_after = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND run = $2
+	`, job.ID, job.Run)
+	return err
+}
+
+// scanMediaJob reads one row in mediaJobColumns order
+func scanMediaJob(row pgx.Row) (*models.MediaJob, error) {
+	job := &models.MediaJob{}
+	err := row.Scan(
+		&job.ID,
+		&job.MediaID,
+		&job.Kind,
+		&job.Status,
+		&job.Attempts,
+		&job.Run,
+		&job.Error,
+		&job.RunAfter,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
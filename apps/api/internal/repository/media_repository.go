@@ -0,0 +1,705 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var ErrMediaNotFound = errors.New("media not found")
+
+// mediaColumns is the column list every media query returns
+// The last one gathers the file's background jobs into a JSON object
+// keyed by kind, so the status comes along with every read. Records
+// sharing derived files (see Media.DerivedID) share their jobs too: a
+// job run for any of them reports for all, the latest one winning.
+const mediaColumns = `
+	m.id, m.owner_id, m.project_id, m.kind, m.filename, m.content_type, m.size_bytes,
+	m.storage_key, m.content_hash, m.duration, m.width, m.height, m.frame_rate, m.rotation,
+	m.video_codec, m.audio_codec, m.audio_channels, m.sample_rate, m.bit_rate, m.probed_at,
+	m.derived_from, m.poster_key, m.sprite_sheet, m.thumbnail_bytes, m.waveform, m.waveform_bytes,
+	m.proxies, m.hls, m.scenes, m.created_at, m.updated_at,
+	(
+		SELECT COALESCE(jsonb_object_agg(j.kind, jsonb_strip_nulls(jsonb_build_object(
+			'status', j.status, 'error', j.error, 'updated_at', j.updated_at
+		)) ORDER BY j.updated_at), '{}'::jsonb)
+		FROM media_jobs j WHERE j.media_id IN (
+			SELECT g.id FROM media_assets g
+			WHERE (g.id = COALESCE(m.derived_from, m.id) AND g.derived_from IS NULL)
+				OR g.derived_from = COALESCE(m.derived_from, m.id)
+		)
+	)
+`
+
+// derivedGroupSQL is true when media row m uses the derived files stored
+// under ID $1 (see Media.DerivedID)
+const derivedGroupSQL = `((m.id = $1 AND m.derived_from IS NULL) OR m.derived_from = $1)`
+
+// claimedRunSQL is true while job $2 is still in the run numbered $3
+// Job results go through it, so a run that lost its job (see
+// MediaJobRepository.Complete) can't overwrite a newer run's. The job's
+// own media row always uses its derived files, so an update guarded by it
+// matching nothing means the run was superseded.
+const claimedRunSQL = `EXISTS (
+	SELECT 1 FROM media_jobs j
+	WHERE j.id = $2 AND j.status = 'running' AND j.run = $3
+)`
+
+// mediaVisibleSQL is true when user $2 may see media row m
+// ACCESS RULE: the uploader, or anyone on the (non-deleted) project
+// the file belongs to.
+const mediaVisibleSQL = `(
+	m.owner_id = $2 OR EXISTS (
+		SELECT 1 FROM collaborators c
+		INNER JOIN projects p ON p.id = c.project_id
+		WHERE c.project_id = m.project_id AND c.user_id = $2
+			AND c.status = 'accepted' AND p.is_deleted = false
+	)
+)`
+
+// mediaDeletableSQL is true when user $2 may delete media row m
+// Same as visible, but viewers on the project can't delete
+const mediaDeletableSQL = `(
+	m.owner_id = $2 OR EXISTS (
+		SELECT 1 FROM collaborators c
+		INNER JOIN projects p ON p.id = c.project_id
+		WHERE c.project_id = m.project_id AND c.user_id = $2
+			AND c.status = 'accepted' AND c.role IN ('owner', 'editor')
+			AND p.is_deleted = false
+	)
+)`
+
+// MediaRepository handles uploaded media database operations
+type MediaRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewMediaRepository creates a new media repository
+func NewMediaRepository(db *pgxpool.Pool) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+// Create records an uploaded file and takes a reference on its blob
+// The caller must check project access first.
+//
+// newBlob is true when the record is the first one using its content
+// (files stored before deduplication have no blob and never are). The
+// caller must then make sure the bytes are in storage: a Delete of the
+// last previous reference may have removed them just before.
+//
+// With DerivedFrom set, the record shares the derived files the caller
+// copied from a record with the same content. If the last record using
+// them was deleted in the meantime (the files with it), the record is
+// created without them instead: check created.DerivedFrom.
+func (r *MediaRepository) Create(ctx context.Context, media *models.Media) (created *models.Media, newBlob bool, err error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if media.ContentHash != nil {
+		// DO UPDATE rather than DO NOTHING: it locks the row, so this
+		// waits for a Delete that is removing the bytes right now, and
+		// then inserts a fresh row. xmax = 0 means the row was inserted.
+		// ref_count itself is kept by a trigger (see schema.sql).
+		err = tx.QueryRow(ctx, `
+			INSERT INTO media_blobs (sha256, storage_key, size_bytes)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (sha256) DO UPDATE SET ref_count = media_blobs.ref_count
+			RETURNING storage_key, xmax = 0
+		`, *media.ContentHash, media.StorageKey, media.Size).Scan(&media.StorageKey, &newBlob)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if media.DerivedFrom != nil {
+		// Records sharing derived files have the same content, so the
+		// blob row lock taken above orders this after a Delete of the
+		// last of them
+		var shared bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM media_assets m WHERE `+derivedGroupSQL+`)
+		`, *media.DerivedFrom).Scan(&shared)
+		if err != nil {
+			return nil, false, err
+		}
+		if !shared {
+			withoutDerived(media)
+		}
+	}
+
+	row := tx.QueryRow(ctx, `
+		INSERT INTO media_assets AS m (
+			id, owner_id, project_id, kind, filename, content_type, size_bytes,
+			storage_key, content_hash, duration, width, height, frame_rate, rotation,
+			video_codec, audio_codec, audio_channels, sample_rate, bit_rate, probed_at,
+			derived_from, poster_key, sprite_sheet, thumbnail_bytes, waveform, waveform_bytes,
+			proxies, hls, scenes
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, $26, $27, $28, $29)
+		RETURNING `+mediaColumns,
+		media.ID, media.OwnerID, media.ProjectID, media.Kind, media.Filename, media.ContentType,
+		media.Size, media.StorageKey, media.ContentHash, media.Duration, media.Width,
+		media.Height, media.FrameRate, media.Rotation, media.VideoCodec, media.AudioCodec,
+		media.AudioChannels, media.SampleRate, media.BitRate, media.ProbedAt,
+		media.DerivedFrom, media.PosterKey, media.SpriteSheet, media.ThumbnailBytes, media.Waveform,
+		media.WaveformBytes, media.Proxies, media.HLS, media.Scenes)
+	created, err = scanMedia(row)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created.DerivedFrom != nil && created.Scenes != nil {
+		// Scene markers are rows of their own, per record
+		_, err = tx.Exec(ctx, `
+			INSERT INTO media_scene_markers (media_id, time, score)
+			SELECT $2, s.time, s.score
+			FROM media_scene_markers s
+			WHERE s.media_id = (
+				SELECT m.id FROM media_assets m
+				WHERE `+derivedGroupSQL+` AND m.id <> $2 AND m.scenes IS NOT NULL
+				LIMIT 1
+			)
+		`, *created.DerivedFrom, created.ID)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+	return created, newBlob, nil
+}
+
+// GetByContentHash returns a file with the given content that the user
+// can see, preferring their own
+func (r *MediaRepository) GetByContentHash(ctx context.Context, sha256 string, userID uuid.UUID) (*models.Media, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE m.content_hash = $1 AND `+mediaVisibleSQL+`
+		ORDER BY m.owner_id = $2 DESC, m.created_at
+		LIMIT 1
+	`, sha256, userID)
+	return scanMedia(row)
+}
+
+// GetProbedByContentHash returns any probed file with the given content,
+// without an access check
+// Only for copying technical metadata, which is the same for equal bytes.
+func (r *MediaRepository) GetProbedByContentHash(ctx context.Context, sha256 string) (*models.Media, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE m.content_hash = $1 AND m.probed_at IS NOT NULL
+		LIMIT 1
+	`, sha256)
+	return scanMedia(row)
+}
+
+// GetByDerivedID returns a record using the derived files stored under
+// derivedID, without an access check
+// Only for the orphan cleanup: the files are in use while there is one.
+func (r *MediaRepository) GetByDerivedID(ctx context.Context, derivedID uuid.UUID) (*models.Media, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE `+derivedGroupSQL+`
+		LIMIT 1
+	`, derivedID)
+	return scanMedia(row)
+}
+
+// GetByID returns a media file if the user can see it
+// Files the user can't see look exactly like missing ones
+func (r *MediaRepository) GetByID(ctx context.Context, mediaID, userID uuid.UUID) (*models.Media, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE m.id = $1 AND `+mediaVisibleSQL,
+		mediaID, userID)
+	return scanMedia(row)
+}
+
+// GetForJob returns a media file without an access check
+// Only for background jobs, which act on behalf of the system
+func (r *MediaRepository) GetForJob(ctx context.Context, mediaID uuid.UUID) (*models.Media, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE m.id = $1
+	`, mediaID)
+	return scanMedia(row)
+}
+
+// ListByUser returns the user's own uploads, newest first
+// With a projectID it returns that project's files instead (any uploader),
+// still filtered by what the user is allowed to see. kind limits the list
+// to one media kind; "" returns all of them.
+func (r *MediaRepository) ListByUser(ctx context.Context, userID uuid.UUID, projectID *uuid.UUID, kind string) ([]models.Media, error) {
+	var rows pgx.Rows
+	var err error
+	if projectID == nil {
+		rows, err = r.db.Query(ctx, `
+			SELECT `+mediaColumns+`
+			FROM media_assets m
+			WHERE m.owner_id = $1 AND ($2 = '' OR m.kind = $2)
+			ORDER BY m.created_at DESC
+		`, userID, kind)
+	} else {
+		rows, err = r.db.Query(ctx, `
+			SELECT `+mediaColumns+`
+			FROM media_assets m
+			WHERE m.project_id = $1 AND `+mediaVisibleSQL+` AND ($3 = '' OR m.kind = $3)
+			ORDER BY m.created_at DESC
+		`, *projectID, userID, kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectMedia(rows)
+}
+
+// ListForProject returns the given media, limited to files the project may use
+//
+// Used when a project's timeline is shown to someone else (share links,
+// bundle export). A timeline is just JSON that any editor can write, so
+// we can't trust the IDs in it: only files attached to the project, or
+// uploaded by one of its collaborators, are returned. Otherwise anyone
+// could paste a stranger's media ID into their timeline and share it.
+func (r *MediaRepository) ListForProject(ctx context.Context, projectID uuid.UUID, mediaIDs []uuid.UUID) ([]models.Media, error) {
+	if len(mediaIDs) == 0 {
+		return []models.Media{}, nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+mediaColumns+`
+		FROM media_assets m
+		WHERE m.id = ANY($2) AND (
+			m.project_id = $1 OR EXISTS (
+				SELECT 1 FROM collaborators c
+				WHERE c.project_id = $1 AND c.user_id = m.owner_id AND c.status = 'accepted'
+			)
+		)
+	`, projectID, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectMedia(rows)
+}
+
+// AttachToProject moves the user's own files into a project
+// Used after an import, once the new project exists
+func (r *MediaRepository) AttachToProject(ctx context.Context, mediaIDs []uuid.UUID, projectID, ownerID uuid.UUID) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE media_assets
+		SET project_id = $1, updated_at = NOW()
+		WHERE id = ANY($2) AND owner_id = $3
+	`, projectID, mediaIDs, ownerID)
+	return err
+}
+
+// SetThumbnails records the generated poster frame and sprite sheets
+// (size bytes in all) on every record using the files stored under
+// derivedID, unless job's run was superseded (ErrRunSuperseded)
+// Returns the projects of those records, with the record in each.
+func (r *MediaRepository) SetThumbnails(ctx context.Context, job *models.MediaJob, derivedID uuid.UUID, posterKey string, sheet *models.SpriteSheet, size int64) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE media_assets AS m
+		SET poster_key = $4, sprite_sheet = $5, thumbnail_bytes = $6, updated_at = NOW()
+		WHERE `+derivedGroupSQL+` AND `+claimedRunSQL+`
+		RETURNING m.id, m.project_id
+	`, derivedID, job.ID, job.Run, posterKey, sheet, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := false
+	projects := map[uuid.UUID]uuid.UUID{}
+	for rows.Next() {
+		var mediaID uuid.UUID
+		var projectID *uuid.UUID
+		if err := rows.Scan(&mediaID, &projectID); err != nil {
+			return nil, err
+		}
+		found = true
+		if projectID != nil {
+			projects[*projectID] = mediaID
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrRunSuperseded
+	}
+	return projects, nil
+}
+
+// SetWaveform records the generated audio peak levels (size bytes in
+// all) on every record using the files stored under derivedID, unless
+// job's run was superseded (ErrRunSuperseded)
+func (r *MediaRepository) SetWaveform(ctx context.Context, job *models.MediaJob, derivedID uuid.UUID, waveform *models.Waveform, size int64) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE media_assets AS m
+		SET waveform = $4, waveform_bytes = $5, updated_at = NOW()
+		WHERE `+derivedGroupSQL+` AND `+claimedRunSQL,
+		derivedID, job.ID, job.Run, waveform, size)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRunSuperseded
+	}
+	return nil
+}
+
+// SetProxies records the generated preview proxies on every record using the
+// files stored under derivedID, unless job's run was superseded
+func (r *MediaRepository) SetProxies(ctx context.Context, job *models.MediaJob, derivedID uuid.UUID, proxies []models.Proxy) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE media_assets AS m
+		SET proxies = $4, updated_at = NOW()
+		WHERE `+derivedGroupSQL+` AND `+claimedRunSQL,
+		derivedID, job.ID, job.Run, proxies)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRunSuperseded
+	}
+	return nil
+}
+
+// SetHLS records the generated HLS package on every record using the
+// files stored under derivedID, unless job's run was superseded
+func (r *MediaRepository) SetHLS(ctx context.Context, job *models.MediaJob, derivedID uuid.UUID, pkg *models.HLSPackage) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE media_assets AS m
+		SET hls = $4, updated_at = NOW()
+		WHERE `+derivedGroupSQL+` AND `+claimedRunSQL,
+		derivedID, job.ID, job.Run, pkg)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRunSuperseded
+	}
+	return nil
+}
+
+// Delete removes a media record and returns it so the caller can remove
+// the derived files. Uploaders and project editors can delete; viewers
+// get ErrNotAuthorized.
+//
+// derivedInUse is true when another record with the same content still
+// uses the derived files; they must be kept then. Jobs that were still
+// to run for the deleted record are handed over to that one.
+//
+// removeBytes is called with the storage key when the record was the
+// last reference to its bytes (always, for files stored before
+// deduplication). It runs inside the transaction, holding the blob's row
+// lock, so a concurrent upload of the same content waits and then stores
+// the bytes again. If it fails, nothing is deleted.
+func (r *MediaRepository) Delete(ctx context.Context, mediaID, userID uuid.UUID, removeBytes func(key string) error) (media *models.Media, derivedInUse bool, err error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Read before the delete cascades to them
+	pending, err := pendingJobKinds(ctx, tx, mediaID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	row := tx.QueryRow(ctx, `
+		DELETE FROM media_assets m
+		WHERE m.id = $1 AND `+mediaDeletableSQL+`
+		RETURNING `+mediaColumns,
+		mediaID, userID)
+	media, err = scanMedia(row)
+	if errors.Is(err, ErrMediaNotFound) {
+		// Nothing deleted - tell "can't see it" apart from "can't delete it"
+		if _, err := r.GetByID(ctx, mediaID, userID); err != nil {
+			return nil, false, err
+		}
+		return nil, false, ErrNotAuthorized
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if media.ContentHash == nil {
+		err = removeBytes(media.StorageKey)
+	} else {
+		err = releaseBlob(ctx, tx, *media.ContentHash, removeBytes)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if media.ContentHash != nil {
+		// After releaseBlob: its row lock keeps a Create of the same
+		// content from joining the group while we look (see Create)
+		derivedInUse, err = handOverJobs(ctx, tx, media.DerivedID(), pending)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+	return media, derivedInUse, nil
+}
+
+// pendingJobKinds returns the kinds of a record's jobs that haven't run yet
+func pendingJobKinds(ctx context.Context, tx pgx.Tx, mediaID uuid.UUID) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT kind FROM media_jobs
+		WHERE media_id = $1 AND status IN ('queued', 'running')
+	`, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kinds []string
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, rows.Err()
+}
+
+// handOverJobs queues kinds for a record still using the derived files
+// stored under derivedID, and reports whether there is one
+// Workers poll, so the jobs get picked up without a notification.
+func handOverJobs(ctx context.Context, tx pgx.Tx, derivedID uuid.UUID, kinds []string) (bool, error) {
+	var heir uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT m.id FROM media_assets m WHERE `+derivedGroupSQL+` LIMIT 1
+	`, derivedID).Scan(&heir)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(kinds) == 0 {
+		return true, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO media_jobs (media_id, kind)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (media_id, kind) DO UPDATE
+		SET status = 'queued', attempts = 0, error = NULL, run_after = NOW(),
+			started_at = NULL, finished_at = NULL, updated_at = NOW()
+	`, heir, kinds)
+	return true, err
+}
+
+// withoutDerived clears what a record would have shared from another one
+func withoutDerived(media *models.Media) {
+	media.DerivedFrom = nil
+	media.PosterKey = nil
+	media.SpriteSheet = nil
+	media.ThumbnailBytes = 0
+	media.Waveform = nil
+	media.WaveformBytes = 0
+	media.Proxies = nil
+	media.HLS = nil
+	media.Scenes = nil
+}
+
+// releaseBlob removes a blob nothing references anymore
+// The trigger has already counted the deleted reference.
+func releaseBlob(ctx context.Context, tx pgx.Tx, sha256 string, removeBytes func(key string) error) error {
+	var refs int
+	var key string
+	err := tx.QueryRow(ctx, `
+		SELECT ref_count, storage_key FROM media_blobs WHERE sha256 = $1 FOR UPDATE
+	`, sha256).Scan(&refs, &key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil || refs > 0 {
+		return err
+	}
+
+	if err := removeBytes(key); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM media_blobs WHERE sha256 = $1`, sha256)
+	return err
+}
+
+// StorageKeyInUse reports whether any media record stores its bytes at key
+func (r *MediaRepository) StorageKeyInUse(ctx context.Context, key string) (bool, error) {
+	var used bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM media_assets WHERE storage_key = $1)
+	`, key).Scan(&used)
+	return used, err
+}
+
+// DeleteUnusedBlob removes stored content nothing references, holding the
+// same row lock as Create and Delete
+// Called by the orphan cleanup, which found the bytes at key unused when
+// it looked - but an upload of the same content may be about to take a
+// reference. Returns false (and keeps the bytes) if one did.
+//
+// If the blob has no row (Create failed after the bytes were stored), a
+// placeholder is inserted to lock. A racing Create waits for it, finds
+// the row gone and reports newBlob, so the upload stores the bytes again.
+func (r *MediaRepository) DeleteUnusedBlob(ctx context.Context, sha256, key string, size int64, removeBytes func(key string) error) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO media_blobs (sha256, storage_key, size_bytes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (sha256) DO NOTHING
+	`, sha256, key, size)
+	if err != nil {
+		return false, err
+	}
+
+	var refs int
+	var rowKey string
+	err = tx.QueryRow(ctx, `
+		SELECT ref_count, storage_key FROM media_blobs WHERE sha256 = $1 FOR UPDATE
+	`, sha256).Scan(&refs, &rowKey)
+	if err != nil {
+		return false, err
+	}
+	if refs > 0 && rowKey == key {
+		return false, nil
+	}
+
+	if err := removeBytes(key); err != nil {
+		return false, err
+	}
+	if refs == 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM media_blobs WHERE sha256 = $1`, sha256); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteUnusedBlobRecords removes media_blobs rows that lost their last
+// reference before the given time
+// Deletes through ON DELETE CASCADE leave them behind (see the trigger in
+// schema.sql). Run after the cleanup has dealt with the bytes. With
+// dryRun the rows are only counted.
+func (r *MediaRepository) DeleteUnusedBlobRecords(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	if dryRun {
+		var n int
+		err := r.db.QueryRow(ctx, `
+			SELECT COUNT(*) FROM media_blobs WHERE ref_count = 0 AND created_at < $1
+		`, before).Scan(&n)
+		return n, err
+	}
+
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM media_blobs WHERE ref_count = 0 AND created_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// collectMedia scans every row of a media query
+func collectMedia(rows pgx.Rows) ([]models.Media, error) {
+	media := []models.Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, *m)
+	}
+
+	return media, rows.Err()
+}
+
+// scanMedia reads one row in mediaColumns order
+func scanMedia(row pgx.Row) (*models.Media, error) {
+	m := &models.Media{}
+	err := row.Scan(
+		&m.ID,
+		&m.OwnerID,
+		&m.ProjectID,
+		&m.Kind,
+		&m.Filename,
+		&m.ContentType,
+		&m.Size,
+		&m.StorageKey,
+		&m.ContentHash,
+		&m.Duration,
+		&m.Width,
+		&m.Height,
+		&m.FrameRate,
+		&m.Rotation,
+		&m.VideoCodec,
+		&m.AudioCodec,
+		&m.AudioChannels,
+		&m.SampleRate,
+		&m.BitRate,
+		&m.ProbedAt,
+		&m.DerivedFrom,
+		&m.PosterKey,
+		&m.SpriteSheet,
+		&m.ThumbnailBytes,
+		&m.Waveform,
+		&m.WaveformBytes,
+		&m.Proxies,
+		&m.HLS,
+		&m.Scenes,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+		&m.Jobs,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
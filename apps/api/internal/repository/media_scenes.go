@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"tempo/internal/models"
+)
+
+// SetScenes replaces a video's shot boundaries, on every record using
+// the derived files stored under derivedID (see Media.DerivedID)
+// Markers and summary change together, so a re-run never shows a mix.
+// Nothing changes if job's run was superseded (ErrRunSuperseded).
+func (r *MediaRepository) SetScenes(ctx context.Context, job *models.MediaJob, derivedID uuid.UUID, detection *models.SceneDetection, markers []models.SceneMarker) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE media_assets AS m
+		SET scenes = $4, updated_at = NOW()
+		WHERE `+derivedGroupSQL+` AND `+claimedRunSQL+`
+		RETURNING m.id
+	`, derivedID, job.ID, job.Run, detection)
+	if err != nil {
+		return err
+	}
+	var mediaIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		mediaIDs = append(mediaIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(mediaIDs) == 0 {
+		return ErrRunSuperseded
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM media_scene_markers WHERE media_id = ANY($1)`, mediaIDs); err != nil {
+		return err
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"media_scene_markers"},
+		[]string{"media_id", "time", "score"},
+		pgx.CopyFromSlice(len(mediaIDs)*len(markers), func(i int) ([]any, error) {
+			m := markers[i%len(markers)]
+			return []any{mediaIDs[i/len(markers)], m.Time, m.Score}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SceneMarkers returns the shot boundaries of the given videos with at
+// least minScore, in time order
+// Videos without any are missing from the map.
+func (r *MediaRepository) SceneMarkers(ctx context.Context, mediaIDs []uuid.UUID, minScore float64) (map[uuid.UUID][]models.SceneMarker, error) {
+	markers := map[uuid.UUID][]models.SceneMarker{}
+	if len(mediaIDs) == 0 {
+		return markers, nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT media_id, time, score
+		FROM media_scene_markers
+		WHERE media_id = ANY($1) AND score >= $2
+		ORDER BY media_id, time
+	`, mediaIDs, minScore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaID uuid.UUID
+		var marker models.SceneMarker
+		if err := rows.Scan(&mediaID, &marker.Time, &marker.Score); err != nil {
+			return nil, err
+		}
+		markers[mediaID] = append(markers[mediaID], marker)
+	}
+	return markers, rows.Err()
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+)
+
+// largestFilesLimit is how many files UserStorage lists
+const largestFilesLimit = 10
+
+// mediaDerivedBytesSQL are the generated and cached bytes of media row m
+// Proxies and HLS renditions are JSON arrays of objects with a "size"
+// (see models.Proxy and models.HLSRendition). SUM of bigint is numeric,
+// hence the casts back.
+const mediaDerivedBytesSQL = `
+	COALESCE((SELECT SUM((p->>'size')::bigint) FROM jsonb_array_elements(COALESCE(m.proxies, '[]')) p), 0)::bigint AS proxy_bytes,
+	COALESCE((SELECT SUM((r->>'size')::bigint) FROM jsonb_array_elements(COALESCE(m.hls->'renditions', '[]')) r), 0)::bigint AS stream_bytes,
+	m.thumbnail_bytes, m.waveform_bytes,
+	COALESCE((SELECT SUM(fr.size_bytes) FROM media_frames fr WHERE fr.media_id = m.id), 0)::bigint AS frame_bytes
+`
+
+// mediaBlobSQL identifies the stored bytes of media row m
+// Files stored before deduplication have a blob of their own.
+const mediaBlobSQL = `COALESCE(m.content_hash, m.id::text)`
+
+// mediaStorageSQL sums the space the media rows matching where take up,
+// per groupBy value (an expression of m, returned first) or in total if
+// groupBy is ""
+//
+// WHY ROW_NUMBER?
+// A file shared by several videos is stored once, and so are the files
+// generated from it, so their bytes must count once: first_of_blob and
+// first_of_derived mark one row per blob (and derived ID) in each group.
+func mediaStorageSQL(where, groupBy string) string {
+	key, partition, groupKey, group := "", "", "", ""
+	if groupBy != "" {
+		key, partition = groupBy+" AS group_key,", groupBy+", "
+		groupKey, group = "f.group_key,", "GROUP BY f.group_key"
+	}
+	return fmt.Sprintf(`
+		SELECT %[4]s COUNT(*),
+			COALESCE(SUM(f.size_bytes) FILTER (WHERE f.first_of_blob), 0)::bigint,
+			COALESCE(SUM(f.proxy_bytes) FILTER (WHERE f.first_of_derived), 0)::bigint,
+			COALESCE(SUM(f.stream_bytes) FILTER (WHERE f.first_of_derived), 0)::bigint,
+			COALESCE(SUM(f.thumbnail_bytes) FILTER (WHERE f.first_of_derived), 0)::bigint,
+			COALESCE(SUM(f.waveform_bytes) FILTER (WHERE f.first_of_derived), 0)::bigint,
+			COALESCE(SUM(f.frame_bytes), 0)::bigint
+		FROM (
+			SELECT %[2]s m.size_bytes,
+				ROW_NUMBER() OVER (PARTITION BY %[3]s`+mediaBlobSQL+`) = 1 AS first_of_blob,
+				ROW_NUMBER() OVER (PARTITION BY %[3]sCOALESCE(m.derived_from, m.id)) = 1 AS first_of_derived,
+				`+mediaDerivedBytesSQL+`
+			FROM media_assets m
+			WHERE %[1]s
+		) f
+		%[5]s
+	`, where, key, partition, groupKey, group)
+}
+
+// breakdownDest returns scan targets for a mediaStorageSQL row (after
+// the group key)
+func breakdownDest(b *models.StorageBreakdown) []any {
+	return []any{
+		&b.FileCount, &b.MediaBytes, &b.ProxyBytes, &b.StreamBytes,
+		&b.ThumbnailBytes, &b.WaveformBytes, &b.FrameBytes,
+	}
+}
+
+// sumUsedBytes sets UsedBytes to the total of the kinds
+func sumUsedBytes(b *models.StorageBreakdown) {
+	b.UsedBytes = b.MediaBytes + b.ProxyBytes + b.StreamBytes + b.ThumbnailBytes +
+		b.WaveformBytes + b.FrameBytes + b.ExportBytes
+}
+
+// UserStorage returns the space a user's uploads and exports take up, in
+// total and per project, and their largest files
+func (r *MediaRepository) UserStorage(ctx context.Context, userID uuid.UUID) (*models.StorageUsage, error) {
+	usage := &models.StorageUsage{
+		Projects:     []models.ProjectStorage{},
+		LargestFiles: []models.MediaStorage{},
+	}
+
+	err := r.db.QueryRow(ctx, mediaStorageSQL("m.owner_id = $1", ""), userID).
+		Scan(breakdownDest(&usage.StorageBreakdown)...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT s.*, p.name
+		FROM (`+mediaStorageSQL("m.owner_id = $1", "m.project_id")+`) s
+		LEFT JOIN projects p ON p.id = s.group_key
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byProject := map[uuid.UUID]int{} // Index in usage.Projects
+	for rows.Next() {
+		var ps models.ProjectStorage
+		dest := append([]any{&ps.ProjectID}, breakdownDest(&ps.StorageBreakdown)...)
+		if err := rows.Scan(append(dest, &ps.ProjectName)...); err != nil {
+			return nil, err
+		}
+		if ps.ProjectID != nil {
+			byProject[*ps.ProjectID] = len(usage.Projects)
+		}
+		usage.Projects = append(usage.Projects, ps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.addUserExports(ctx, userID, usage, byProject); err != nil {
+		return nil, err
+	}
+
+	sumUsedBytes(&usage.StorageBreakdown)
+	for i := range usage.Projects {
+		sumUsedBytes(&usage.Projects[i].StorageBreakdown)
+	}
+	sort.Slice(usage.Projects, func(i, j int) bool {
+		return usage.Projects[i].UsedBytes > usage.Projects[j].UsedBytes
+	})
+
+	usage.LargestFiles, err = r.largestFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// addUserExports adds the user's rendered exports to their usage, per
+// project (byProject indexes usage.Projects)
+func (r *MediaRepository) addUserExports(ctx context.Context, userID uuid.UUID, usage *models.StorageUsage, byProject map[uuid.UUID]int) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT e.project_id, p.name, SUM(e.size_bytes)::bigint
+		FROM exports e
+		INNER JOIN projects p ON p.id = e.project_id
+		WHERE e.user_id = $1
+		GROUP BY e.project_id, p.name
+	`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID uuid.UUID
+		var name string
+		var bytes int64
+		if err := rows.Scan(&projectID, &name, &bytes); err != nil {
+			return err
+		}
+		usage.ExportBytes += bytes
+
+		i, ok := byProject[projectID]
+		if !ok {
+			// Exported but has none of the user's files
+			i = len(usage.Projects)
+			usage.Projects = append(usage.Projects, models.ProjectStorage{ProjectID: &projectID, ProjectName: &name})
+		}
+		usage.Projects[i].ExportBytes += bytes
+	}
+	return rows.Err()
+}
+
+// largestFiles returns a user's biggest uploads, generated files included
+func (r *MediaRepository) largestFiles(ctx context.Context, userID uuid.UUID) ([]models.MediaStorage, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT f.id, f.filename, f.project_id,
+			f.size_bytes + f.proxy_bytes + f.stream_bytes + f.thumbnail_bytes + f.waveform_bytes + f.frame_bytes,
+			COALESCE(b.ref_count > 1, false)
+		FROM (
+			SELECT m.id, m.filename, m.project_id, m.size_bytes, m.content_hash,
+				`+mediaDerivedBytesSQL+`
+			FROM media_assets m
+			WHERE m.owner_id = $1
+		) f
+		LEFT JOIN media_blobs b ON b.sha256 = f.content_hash
+		ORDER BY 4 DESC, f.id
+		LIMIT $2
+	`, userID, largestFilesLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.MediaStorage{}
+	for rows.Next() {
+		var f models.MediaStorage
+		if err := rows.Scan(&f.MediaID, &f.Filename, &f.ProjectID, &f.Bytes, &f.Shared); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// ProjectStorage returns the space a project's files and exports take
+// up, whoever uploaded or rendered them
+func (r *MediaRepository) ProjectStorage(ctx context.Context, projectID uuid.UUID) (*models.StorageBreakdown, error) {
+	usage := &models.StorageBreakdown{}
+	err := r.db.QueryRow(ctx, mediaStorageSQL("m.project_id = $1", ""), projectID).
+		Scan(breakdownDest(usage)...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(size_bytes), 0)::bigint FROM exports WHERE project_id = $1
+	`, projectID).Scan(&usage.ExportBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	sumUsedBytes(usage)
+	return usage, nil
+}
+
+// HasContent reports whether a user already has an upload with the given
+// content, and whether a project (if not nil) already has a file with it
+// Uploading it again then takes no extra space there.
+func (r *MediaRepository) HasContent(ctx context.Context, sha256 string, userID uuid.UUID, projectID *uuid.UUID) (userHas, projectHas bool, err error) {
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM media_assets WHERE content_hash = $1 AND owner_id = $2),
+			EXISTS (SELECT 1 FROM media_assets WHERE content_hash = $1 AND project_id = $3)
+	`, sha256, userID, projectID).Scan(&userHas, &projectHas)
+	return userHas, projectHas, err
+}
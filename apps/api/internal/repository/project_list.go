@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"tempo/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded
+// or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Sort fields accepted by ListByUser
+const (
+	SortByName    = "name"
+	SortByCreated = "created"
+	SortByUpdated = "updated"
+)
+
+// Sort directions
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ProjectListOptions controls filtering, sorting and pagination for ListByUser
+//
+// Two pagination styles are supported:
+//   - Cursor (keyset): pass the NextCursor from the previous page. Stable even
+//     while projects are being created or updated.
+//   - Page (offset): kept for older clients. Ignored when Cursor is set.
+type ProjectListOptions struct {
+	Search  string     // Full-text search over name and description
+	Role    string     // Only projects where the user has this role
+	OwnerID *uuid.UUID // Only projects owned by this user
+
+	FolderID *uuid.UUID // Only projects in this (caller's) folder
+	Unfiled  bool       // Only projects not in any of the caller's folders
+	TagID    *uuid.UUID // Only projects with this tag
+
+	Sort  string // SortByName, SortByCreated or SortByUpdated (default)
+	Order string // SortAsc or SortDesc (default)
+
+	Cursor  string
+	Page    int
+	PerPage int
+}
+
+// ProjectListResult is one page of projects
+type ProjectListResult struct {
+	Projects   []models.Project
+	TotalCount int    // Total matches across all pages
+	NextCursor string // Empty on the last page
+}
+
+// projectCursor is the decoded form of a keyset cursor
+// It remembers the sort so a cursor can't be replayed against another order
+type projectCursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Name  string    `json:"n,omitempty"`
+	Time  time.Time `json:"t,omitempty"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// ListByUser returns the projects a user has access to
+//
+// Everything happens in ONE query: the CTE applies the filters and counts
+// the matches with a window function, then the outer SELECT applies the
+// cursor and LIMIT. We fetch one extra row to know if there's a next page.
+// The count is over the filters only, so it's the same on every page. An
+// empty page has no row to carry it, so then it's counted separately.
+func (r *ProjectRepository) ListByUser(ctx context.Context, userID uuid.UUID, opts ProjectListOptions) (*ProjectListResult, error) {
+	opts = normalizeListOptions(opts)
+
+	args := []interface{}{userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{
+		"c.user_id = $1",
+		"c.status = 'accepted'",
+		"p.is_deleted = false",
+	}
+	if q := toPrefixTSQuery(opts.Search); q != "" {
+		where = append(where, "p.search_vector @@ to_tsquery('simple', "+arg(q)+")")
+	}
+	if opts.Role != "" {
+		where = append(where, "c.role = "+arg(opts.Role))
+	}
+	if opts.OwnerID != nil {
+		where = append(where, "p.owner_id = "+arg(*opts.OwnerID))
+	}
+	if opts.FolderID != nil {
+		where = append(where, "pf.folder_id = "+arg(*opts.FolderID))
+	} else if opts.Unfiled {
+		where = append(where, "pf.folder_id IS NULL")
+	}
+	if opts.TagID != nil {
+		where = append(where, "EXISTS (SELECT 1 FROM project_tags pt WHERE pt.project_id = p.id AND pt.tag_id = "+arg(*opts.TagID)+")")
+	}
+
+	// The count query takes the filters' args only, not the cursor's
+	filterArgs := len(args)
+
+	sortColumn := map[string]string{
+		SortByName:    "name",
+		SortByCreated: "created_at",
+		SortByUpdated: "updated_at",
+	}[opts.Sort]
+
+	// Keyset condition: (sort_value, id) strictly after the cursor row
+	// Row comparison keeps ties on the sort column stable via the ID
+	outerWhere := "true"
+	offset := 0
+	if opts.Cursor != "" {
+		cur, err := decodeProjectCursor(opts.Cursor)
+		if err != nil || cur.Sort != opts.Sort || cur.Order != opts.Order {
+			return nil, ErrInvalidCursor
+		}
+		op := "<"
+		if opts.Order == SortAsc {
+			op = ">"
+		}
+		var value interface{} = cur.Time
+		if opts.Sort == SortByName {
+			value = cur.Name
+		}
+		outerWhere = fmt.Sprintf("(f.%s, f.id) %s (%s, %s)", sortColumn, op, arg(value), arg(cur.ID))
+	} else if opts.Page > 1 {
+		offset = (opts.Page - 1) * opts.PerPage
+	}
+
+	direction := strings.ToUpper(opts.Order)
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT
+				p.id, p.owner_id, p.name, p.description, p.thumbnail_url,
+				(SELECT m.poster_key FROM media_assets m WHERE m.id = p.thumbnail_media_id) AS thumbnail_key,
+				p.settings, p.is_deleted, p.created_at, p.updated_at,
+				c.role, pf.folder_id,
+				COUNT(*) OVER () AS total_count
+			FROM projects p
+			INNER JOIN collaborators c ON c.project_id = p.id
+			-- Folders are per user, so only join the caller's placement
+			LEFT JOIN project_folders pf ON pf.project_id = p.id AND pf.user_id = $1
+			WHERE %s
+		)
+		SELECT
+			f.id, f.owner_id, f.name, f.description, f.thumbnail_url, f.thumbnail_key,
+			f.settings, f.is_deleted, f.created_at, f.updated_at,
+			f.role, f.folder_id, f.total_count
+		FROM filtered f
+		WHERE %s
+		ORDER BY f.%s %s, f.id %s
+		LIMIT %s OFFSET %s
+	`, strings.Join(where, " AND "), outerWhere, sortColumn, direction, direction,
+		arg(opts.PerPage+1), arg(offset))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &ProjectListResult{Projects: []models.Project{}}
+	for rows.Next() {
+		var p models.Project
+		var settings []byte
+		err := rows.Scan(
+			&p.ID,
+			&p.OwnerID,
+			&p.Name,
+			&p.Description,
+			&p.ThumbnailURL,
+			&p.ThumbnailKey,
+			&settings,
+			&p.IsDeleted,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Role,
+			&p.FolderID,
+			&result.TotalCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Settings, p.SettingsUnreadable = readSettings(settings)
+		result.Projects = append(result.Projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Projects) == 0 {
+		count := fmt.Sprintf(projectCountQuery, strings.Join(where, " AND "))
+		if err := r.db.QueryRow(ctx, count, args[:filterArgs]...).Scan(&result.TotalCount); err != nil {
+			return nil, err
+		}
+	}
+
+	// The extra row only tells us there's more - don't return it
+	if len(result.Projects) > opts.PerPage {
+		result.Projects = result.Projects[:opts.PerPage]
+		last := result.Projects[len(result.Projects)-1]
+		result.NextCursor = encodeProjectCursor(opts, last)
+	}
+
+	if err := r.loadTags(ctx, result.Projects); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// projectCountQuery counts the projects matching ListByUser's filters
+// (the %s), with the same joins
+const projectCountQuery = `
+	SELECT COUNT(*)
+	FROM projects p
+	INNER JOIN collaborators c ON c.project_id = p.id
+	LEFT JOIN project_folders pf ON pf.project_id = p.id AND pf.user_id = $1
+	WHERE %s
+`
+
+// normalizeListOptions fills in defaults for missing or unknown values
+func normalizeListOptions(opts ProjectListOptions) ProjectListOptions {
+	switch opts.Sort {
+	case SortByName, SortByCreated, SortByUpdated:
+	default:
+		opts.Sort = SortByUpdated
+	}
+	if opts.Order != SortAsc && opts.Order != SortDesc {
+		// Names read naturally A→Z, dates newest first
+		if opts.Sort == SortByName {
+			opts.Order = SortAsc
+		} else {
+			opts.Order = SortDesc
+		}
+	}
+	if opts.PerPage <= 0 {
+		opts.PerPage = 20
+	}
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	return opts
+}
+
+func encodeProjectCursor(opts ProjectListOptions, last models.Project) string {
+	cur := projectCursor{Sort: opts.Sort, Order: opts.Order, ID: last.ID}
+	switch opts.Sort {
+	case SortByName:
+		cur.Name = last.Name
+	case SortByCreated:
+		cur.Time = last.CreatedAt
+	default:
+		cur.Time = last.UpdatedAt
+	}
+	// Marshalling a struct of strings/times/UUIDs can't fail
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProjectCursor(s string) (*projectCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur projectCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// toPrefixTSQuery turns free text into a tsquery where every word is a prefix
+// match, so "vac cl" finds "Vacation clips". Punctuation is dropped, which also
+// keeps tsquery operators (&, |, !, :) in user input from breaking the query.
+func toPrefixTSQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 
 	"github.com/google/uuid"
@@ -41,15 +42,16 @@ func (r *ProjectRepository) Create(ctx context.Context, ownerID uuid.UUID, name
 
 	// Create the project
 	err = tx.QueryRow(ctx, `
-		INSERT INTO projects (owner_id, name, description)
-		VALUES ($1, $2, $3)
-		RETURNING id, owner_id, name, description, thumbnail_url, settings, is_deleted, created_at, updated_at
-	`, ownerID, name, description).Scan(
+		INSERT INTO projects (owner_id, name, description, settings)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, owner_id, name, description, thumbnail_url, (SELECT poster_key FROM media_assets WHERE id = thumbnail_media_id), settings, is_deleted, created_at, updated_at
+	`, ownerID, name, description, models.DefaultProjectSettings()).Scan(
 		&project.ID,
 		&project.OwnerID,
 		&project.Name,
 		&project.Description,
 		&project.ThumbnailURL,
+		&project.ThumbnailKey,
 		&project.Settings,
 		&project.IsDeleted,
 		&project.CreatedAt,
@@ -81,17 +83,19 @@ func (r *ProjectRepository) Create(ctx context.Context, ownerID uuid.UUID, name
 // Also checks if the user has access
 func (r *ProjectRepository) GetByID(ctx context.Context, projectID, userID uuid.UUID) (*models.Project, error) {
 	project := &models.Project{}
+	var settings []byte
 
 	// JOIN with collaborators to:
 	// 1. Check user has access
 	// 2. Get user's role in one query
 	err := r.db.QueryRow(ctx, `
 		SELECT 
-			p.id, p.owner_id, p.name, p.description, p.thumbnail_url, 
+			p.id, p.owner_id, p.name, p.description, p.thumbnail_url, (SELECT m.poster_key FROM media_assets m WHERE m.id = p.thumbnail_media_id),
 			p.settings, p.is_deleted, p.created_at, p.updated_at,
-			c.role
+			c.role, pf.folder_id
 		FROM projects p
 		INNER JOIN collaborators c ON c.project_id = p.id
+		LEFT JOIN project_folders pf ON pf.project_id = p.id AND pf.user_id = c.user_id
 		WHERE p.id = $1 AND c.user_id = $2 AND c.status = 'accepted' AND p.is_deleted = false
 	`, projectID, userID).Scan(
 		&project.ID,
@@ -99,11 +103,13 @@ func (r *ProjectRepository) GetByID(ctx context.Context, projectID, userID uuid.
 		&project.Name,
 		&project.Description,
 		&project.ThumbnailURL,
-		&project.Settings,
+		&project.ThumbnailKey,
+		&settings,
 		&project.IsDeleted,
 		&project.CreatedAt,
 		&project.UpdatedAt,
 		&project.Role,
+		&project.FolderID,
 	)
 
 	if err != nil {
@@ -112,73 +118,279 @@ func (r *ProjectRepository) GetByID(ctx context.Context, projectID, userID uuid.
 		}
 		return nil, err
 	}
+	project.Settings, project.SettingsUnreadable = readSettings(settings)
+
+	projects := []models.Project{*project}
+	if err := r.loadTags(ctx, projects); err != nil {
+		return nil, err
+	}
+
+	return &projects[0], nil
+}
+
+// Update modifies a project (only if user has edit permission)
+func (r *ProjectRepository) Update(ctx context.Context, projectID, userID uuid.UUID, name, description *string) (*models.Project, error) {
+	// First check permissions
+	var role string
+	err := r.db.QueryRow(ctx, `
+		SELECT c.role FROM collaborators c
+		WHERE c.project_id = $1 AND c.user_id = $2 AND c.status = 'accepted'
+	`, projectID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotAuthorized
+		}
+		return nil, err
+	}
 
+	if !models.CanEdit(role) {
+		return nil, ErrNotAuthorized
+	}
+
+	// Update the project
+	project := &models.Project{}
+	var settings []byte
+	err = r.db.QueryRow(ctx, `
+		UPDATE projects
+		SET 
+			name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			updated_at = NOW()
+		WHERE id = $1 AND is_deleted = false
+		RETURNING id, owner_id, name, description, thumbnail_url, (SELECT poster_key FROM media_assets WHERE id = thumbnail_media_id), settings, is_deleted, created_at, updated_at
+	`, projectID, name, description).Scan(
+		&project.ID,
+		&project.OwnerID,
+		&project.Name,
+		&project.Description,
+		&project.ThumbnailURL,
+		&project.ThumbnailKey,
+		&settings,
+		&project.IsDeleted,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	project.Settings, project.SettingsUnreadable = readSettings(settings)
+
+	project.Role = role
 	return project, nil
 }
 
-// ListByUser returns all projects a user has access to
-func (r *ProjectRepository) ListByUser(ctx context.Context, userID uuid.UUID, page, perPage int) ([]models.Project, int, error) {
-	// Calculate offset for pagination
-	// Page 1, PerPage 10 → Offset 0
-	// Page 2, PerPage 10 → Offset 10
-	offset := (page - 1) * perPage
+// UpdateSettings changes a project's settings (only if user has edit permission)
+//
+// The apply callback receives the current settings and returns the new ones.
+// The row is locked (SELECT ... FOR UPDATE) between reading and writing, so
+// two people patching different fields at the same time don't lose an update.
+func (r *ProjectRepository) UpdateSettings(ctx context.Context, projectID, userID uuid.UUID, apply func(models.ProjectSettings) (models.ProjectSettings, error)) (*models.Project, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	// First, get total count
-	var totalCount int
-	err := r.db.QueryRow(ctx, `
-		SELECT COUNT(*)
+	var role string
+	var current models.ProjectSettings
+	err = tx.QueryRow(ctx, `
+		SELECT c.role, p.settings
 		FROM projects p
 		INNER JOIN collaborators c ON c.project_id = p.id
-		WHERE c.user_id = $1 AND c.status = 'accepted' AND p.is_deleted = false
-	`, userID).Scan(&totalCount)
+		WHERE p.id = $1 AND c.user_id = $2 AND c.status = 'accepted' AND p.is_deleted = false
+		FOR UPDATE OF p
+	`, projectID, userID).Scan(&role, &current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+
+	if !models.CanEdit(role) {
+		return nil, ErrNotAuthorized
+	}
+
+	updated, err := apply(current)
+	if err != nil {
+		return nil, err
+	}
+
+	project := &models.Project{}
+	err = tx.QueryRow(ctx, `
+		UPDATE projects
+		SET settings = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, owner_id, name, description, thumbnail_url, (SELECT poster_key FROM media_assets WHERE id = thumbnail_media_id), settings, is_deleted, created_at, updated_at
+	`, projectID, updated).Scan(
+		&project.ID,
+		&project.OwnerID,
+		&project.Name,
+		&project.Description,
+		&project.ThumbnailURL,
+		&project.ThumbnailKey,
+		&project.Settings,
+		&project.IsDeleted,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// Then get the page of results
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	project.Role = role
+	return project, nil
+}
+
+// MigrateSettings rewrites every settings document older than
+// models.CurrentSettingsVersion in the current format
+// Reads already upgrade on the fly, so this is only about keeping the stored
+// data tidy (and queryable with ->>). Safe to run on every startup.
+// Documents that can't be upgraded (damaged ones) are left as they are and
+// returned with the reason, so one bad row doesn't hold up the rest.
+func (r *ProjectRepository) MigrateSettings(ctx context.Context) (int, map[uuid.UUID]error, error) {
+	// Matches documents with a missing or older version
+	const outdated = `CASE
+		WHEN jsonb_typeof(settings->'version') = 'number'
+			THEN (settings->>'version')::numeric < $1
+		ELSE true
+	END`
+
 	rows, err := r.db.Query(ctx, `
-		SELECT 
-			p.id, p.owner_id, p.name, p.description, p.thumbnail_url,
-			p.settings, p.is_deleted, p.created_at, p.updated_at,
-			c.role
+		SELECT id, settings FROM projects WHERE `+outdated,
+		models.CurrentSettingsVersion)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	type pending struct {
+		id       uuid.UUID
+		settings models.ProjectSettings
+	}
+	var upgrades []pending
+	skipped := map[uuid.UUID]error{}
+	for rows.Next() {
+		var p pending
+		var raw []byte
+		if err := rows.Scan(&p.id, &raw); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		// Decoding runs the upgrade (see ProjectSettings.UnmarshalJSON)
+		if err := json.Unmarshal(raw, &p.settings); err != nil {
+			skipped[p.id] = err
+			continue
+		}
+		upgrades = append(upgrades, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	for _, p := range upgrades {
+		// Re-check the version so we never overwrite a PATCH that landed
+		// since the SELECT. Don't bump updated_at - nobody edited the project
+		if _, err := r.db.Exec(ctx, `
+			UPDATE projects SET settings = $2 WHERE id = $3 AND `+outdated,
+			models.CurrentSettingsVersion, p.settings, p.id); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return len(upgrades), skipped, nil
+}
+
+// GetTimeline returns a project's timeline (any collaborator can read it)
+func (r *ProjectRepository) GetTimeline(ctx context.Context, projectID, userID uuid.UUID) (*models.Timeline, error) {
+	timeline := &models.Timeline{}
+	err := r.db.QueryRow(ctx, `
+		SELECT p.timeline
 		FROM projects p
 		INNER JOIN collaborators c ON c.project_id = p.id
-		WHERE c.user_id = $1 AND c.status = 'accepted' AND p.is_deleted = false
-		ORDER BY p.updated_at DESC
-		LIMIT $2 OFFSET $3
-	`, userID, perPage, offset)
+		WHERE p.id = $1 AND c.user_id = $2 AND c.status = 'accepted' AND p.is_deleted = false
+	`, projectID, userID).Scan(timeline)
 	if err != nil {
-		return nil, 0, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
 	}
-	defer rows.Close()
 
-	projects := []models.Project{}
-	for rows.Next() {
-		var p models.Project
-		err := rows.Scan(
-			&p.ID,
-			&p.OwnerID,
-			&p.Name,
-			&p.Description,
-			&p.ThumbnailURL,
-			&p.Settings,
-			&p.IsDeleted,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-			&p.Role,
-		)
-		if err != nil {
-			return nil, 0, err
+	timeline.Normalize()
+	return timeline, nil
+}
+
+// UpdateTimeline replaces a project's timeline (only if user has edit permission)
+// pins are the catalog versions of the effects the timeline uses; effects
+// the project has already pinned keep their version.
+func (r *ProjectRepository) UpdateTimeline(ctx context.Context, projectID, userID uuid.UUID, timeline models.Timeline, pins models.EffectVersions) error {
+	var role string
+	err := r.db.QueryRow(ctx, `
+		SELECT c.role FROM collaborators c
+		WHERE c.project_id = $1 AND c.user_id = $2 AND c.status = 'accepted'
+	`, projectID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProjectNotFound
 		}
-		projects = append(projects, p)
+		return err
+	}
+
+	if !models.CanEdit(role) {
+		return ErrNotAuthorized
+	}
+
+	timeline.Normalize()
+	if pins == nil {
+		pins = models.EffectVersions{}
+	}
+	// jsonb || keeps the right-hand value for keys in both: existing pins win
+	result, err := r.db.Exec(ctx, `
+		UPDATE projects SET timeline = $2, effect_versions = $3 || effect_versions, updated_at = NOW()
+		WHERE id = $1 AND is_deleted = false
+	`, projectID, timeline, pins)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrProjectNotFound
 	}
 
-	return projects, totalCount, nil
+	return nil
 }
 
-// Update modifies a project (only if user has edit permission)
-func (r *ProjectRepository) Update(ctx context.Context, projectID, userID uuid.UUID, name, description *string) (*models.Project, error) {
-	// First check permissions
+// GetEffectVersions returns the effect versions a project is pinned to
+// (any collaborator can read them)
+func (r *ProjectRepository) GetEffectVersions(ctx context.Context, projectID, userID uuid.UUID) (models.EffectVersions, error) {
+	pins := models.EffectVersions{}
+	err := r.db.QueryRow(ctx, `
+		SELECT p.effect_versions
+		FROM projects p
+		INNER JOIN collaborators c ON c.project_id = p.id
+		WHERE p.id = $1 AND c.user_id = $2 AND c.status = 'accepted' AND p.is_deleted = false
+	`, projectID, userID).Scan(&pins)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return pins, nil
+}
+
+// PinEffectVersion pins one effect of a project to a catalog version
+// (only if user has edit permission)
+// The caller checks that the version exists.
+func (r *ProjectRepository) PinEffectVersion(ctx context.Context, projectID, userID uuid.UUID, effectID string, version int) (models.EffectVersions, error) {
 	var role string
 	err := r.db.QueryRow(ctx, `
 		SELECT c.role FROM collaborators c
@@ -186,7 +398,7 @@ func (r *ProjectRepository) Update(ctx context.Context, projectID, userID uuid.U
 	`, projectID, userID).Scan(&role)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrNotAuthorized
+			return nil, ErrProjectNotFound
 		}
 		return nil, err
 	}
@@ -195,38 +407,164 @@ func (r *ProjectRepository) Update(ctx context.Context, projectID, userID uuid.U
 		return nil, ErrNotAuthorized
 	}
 
-	// Update the project
-	project := &models.Project{}
+	pins := models.EffectVersions{}
 	err = r.db.QueryRow(ctx, `
 		UPDATE projects
-		SET 
-			name = COALESCE($2, name),
-			description = COALESCE($3, description),
-			updated_at = NOW()
+		SET effect_versions = effect_versions || $2, updated_at = NOW()
 		WHERE id = $1 AND is_deleted = false
-		RETURNING id, owner_id, name, description, thumbnail_url, settings, is_deleted, created_at, updated_at
-	`, projectID, name, description).Scan(
+		RETURNING effect_versions
+	`, projectID, models.EffectVersions{effectID: version}).Scan(&pins)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return pins, nil
+}
+
+// GetYjsState returns the saved collaboration document (nil if never saved)
+// Callers must check access first, e.g. with GetByID
+func (r *ProjectRepository) GetYjsState(ctx context.Context, projectID uuid.UUID) ([]byte, error) {
+	var state []byte
+	err := r.db.QueryRow(ctx, `
+		SELECT yjs_state FROM projects WHERE id = $1 AND is_deleted = false
+	`, projectID).Scan(&state)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetShared loads a project and its timeline WITHOUT an access check
+// Only for share links, after the link itself has been verified
+func (r *ProjectRepository) GetShared(ctx context.Context, projectID uuid.UUID) (*models.Project, *models.Timeline, error) {
+	project := &models.Project{}
+	timeline := &models.Timeline{}
+	err := r.db.QueryRow(ctx, `
+		SELECT
+			id, owner_id, name, description, thumbnail_url, (SELECT poster_key FROM media_assets WHERE id = thumbnail_media_id),
+			settings, is_deleted, created_at, updated_at,
+			timeline
+		FROM projects
+		WHERE id = $1 AND is_deleted = false
+	`, projectID).Scan(
 		&project.ID,
 		&project.OwnerID,
 		&project.Name,
 		&project.Description,
 		&project.ThumbnailURL,
+		&project.ThumbnailKey,
 		&project.Settings,
 		&project.IsDeleted,
 		&project.CreatedAt,
 		&project.UpdatedAt,
+		timeline,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrProjectNotFound
+			return nil, nil, ErrProjectNotFound
+		}
+		return nil, nil, err
+	}
+
+	timeline.Normalize()
+	return project, timeline, nil
+}
+
+// ImportedProject is everything needed to recreate a project from a bundle
+type ImportedProject struct {
+	Name        string
+	Description *string
+	Settings    models.ProjectSettings
+	Timeline    models.Timeline
+	YjsState    []byte
+
+	EffectVersions models.EffectVersions
+
+	// Team presets of the project, already checked against the catalog
+	Presets []models.EffectPreset
+}
+
+// Import creates a new project owned by ownerID with the given content
+// Same transaction shape as Create: project + owner collaborator row,
+// plus the project's team presets, made by the owner
+func (r *ProjectRepository) Import(ctx context.Context, ownerID uuid.UUID, in ImportedProject) (*models.Project, error) {
+	project := &models.Project{}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	in.Timeline.Normalize()
+	if in.EffectVersions == nil {
+		in.EffectVersions = models.EffectVersions{}
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO projects (owner_id, name, description, settings, timeline, yjs_state, effect_versions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, owner_id, name, description, thumbnail_url, (SELECT poster_key FROM media_assets WHERE id = thumbnail_media_id), settings, is_deleted, created_at, updated_at
+	`, ownerID, in.Name, in.Description, in.Settings, in.Timeline, in.YjsState, in.EffectVersions).Scan(
+		&project.ID,
+		&project.OwnerID,
+		&project.Name,
+		&project.Description,
+		&project.ThumbnailURL,
+		&project.ThumbnailKey,
+		&project.Settings,
+		&project.IsDeleted,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO collaborators (project_id, user_id, role, status)
+		VALUES ($1, $2, 'owner', 'accepted')
+	`, project.ID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, preset := range in.Presets {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO effect_presets
+				(created_by, effect_id, effect_version, name, description, tags, params, scope, project_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 'team', $8)
+		`, ownerID, preset.EffectID, preset.EffectVersion, preset.Name, preset.Description,
+			preset.Tags, preset.Params, project.ID)
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		return nil, err
 	}
 
-	project.Role = role
+	project.Role = models.RoleOwner
 	return project, nil
 }
 
+// SetDefaultThumbnail uses a video's poster frame as the project thumbnail
+// Only if the project has none yet: the first video to finish wins, and
+// a thumbnail someone picked is never replaced.
+func (r *ProjectRepository) SetDefaultThumbnail(ctx context.Context, projectID, mediaID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE projects
+		SET thumbnail_media_id = $2, updated_at = NOW()
+		WHERE id = $1 AND thumbnail_url IS NULL AND thumbnail_media_id IS NULL
+	`, projectID, mediaID)
+	return err
+}
+
 // Delete soft-deletes a project (only owner can delete)
 func (r *ProjectRepository) Delete(ctx context.Context, projectID, userID uuid.UUID) error {
 	// Check if user is owner
@@ -293,3 +631,55 @@ func (r *ProjectRepository) GetCollaborators(ctx context.Context, projectID uuid
 	return collaborators, nil
 }
 
+// loadTags fills in Tags for a batch of projects with a single query
+// (instead of one query per project - the classic "N+1" problem)
+func (r *ProjectRepository) loadTags(ctx context.Context, projects []models.Project) error {
+	if len(projects) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(projects))
+	index := make(map[uuid.UUID]int, len(projects))
+	for i, p := range projects {
+		ids[i] = p.ID
+		index[p.ID] = i
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT pt.project_id, t.id, t.created_by, t.name, t.color, t.created_at
+		FROM project_tags pt
+		INNER JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.project_id = ANY($1)
+		ORDER BY t.name
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID uuid.UUID
+		var t models.Tag
+		if err := rows.Scan(&projectID, &t.ID, &t.CreatedBy, &t.Name, &t.Color, &t.CreatedAt); err != nil {
+			return err
+		}
+		i := index[projectID]
+		projects[i].Tags = append(projects[i].Tags, t)
+	}
+
+	return rows.Err()
+}
+
+// readSettings decodes a settings document for display, reporting false
+// if it can't be read
+// A document written by a newer server, or damaged, reads as the defaults
+// rather than failing: one bad project mustn't break its owner's project
+// list. UpdateSettings reads strictly, so such a document is never
+// overwritten with the defaults.
+func readSettings(raw []byte) (models.ProjectSettings, bool) {
+	var settings models.ProjectSettings
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return models.DefaultProjectSettings(), true
+	}
+	return settings, false
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+// shareLinkColumns is the column list every share link query returns
+const shareLinkColumns = `
+	id, project_id, created_by, token_prefix, password_hash,
+	expires_at, revoked_at, view_count, last_viewed_at, created_at
+`
+
+// ShareLinkRepository handles share link database operations
+type ShareLinkRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewShareLinkRepository creates a new share link repository
+func NewShareLinkRepository(db *pgxpool.Pool) *ShareLinkRepository {
+	return &ShareLinkRepository{db: db}
+}
+
+// Create stores a new share link
+// Callers must check the user may manage the project first
+func (r *ShareLinkRepository) Create(ctx context.Context, projectID, createdBy uuid.UUID, tokenHash, tokenPrefix string, passwordHash *string, expiresAt *time.Time) (*models.ShareLink, error) {
+	row := r.db.QueryRow(ctx, `
+		INSERT INTO share_links (project_id, created_by, token_hash, token_prefix, password_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+shareLinkColumns,
+		projectID, createdBy, tokenHash, tokenPrefix, passwordHash, expiresAt)
+	return scanShareLink(row)
+}
+
+// ListByProject returns all of a project's links, newest first
+// Revoked and expired links are included so owners can see their history
+func (r *ShareLinkRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]models.ShareLink, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+shareLinkColumns+`
+		FROM share_links
+		WHERE project_id = $1
+		ORDER BY created_at DESC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+
+	return links, rows.Err()
+}
+
+// Revoke disables a link immediately
+// The row is kept (not deleted) so view counts stay visible
+func (r *ShareLinkRepository) Revoke(ctx context.Context, projectID, linkID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE share_links SET revoked_at = NOW()
+		WHERE id = $1 AND project_id = $2 AND revoked_at IS NULL
+	`, linkID, projectID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	return nil
+}
+
+// GetByTokenHash finds a link by the hash of its token
+// Links to deleted projects are treated as not found
+func (r *ShareLinkRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.ShareLink, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+shareLinkColumns+`
+		FROM share_links s
+		WHERE s.token_hash = $1
+			AND EXISTS (SELECT 1 FROM projects p WHERE p.id = s.project_id AND p.is_deleted = false)
+	`, tokenHash)
+	return scanShareLink(row)
+}
+
+// RecordView bumps a link's view counter
+// Done in SQL (view_count + 1) so concurrent views don't overwrite each other
+func (r *ShareLinkRepository) RecordView(ctx context.Context, linkID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE share_links
+		SET view_count = view_count + 1, last_viewed_at = NOW()
+		WHERE id = $1
+	`, linkID)
+	return err
+}
+
+// scanShareLink reads one row in shareLinkColumns order
+func scanShareLink(row pgx.Row) (*models.ShareLink, error) {
+	link := &models.ShareLink{}
+	err := row.Scan(
+		&link.ID,
+		&link.ProjectID,
+		&link.CreatedBy,
+		&link.TokenPrefix,
+		&link.PasswordHash,
+		&link.ExpiresAt,
+		&link.RevokedAt,
+		&link.ViewCount,
+		&link.LastViewedAt,
+		&link.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+
+	link.HasPassword = link.PasswordHash != nil
+	return link, nil
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("a tag with this name already exists")
+)
+
+// TagRepository handles tag database operations
+type TagRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewTagRepository creates a new tag repository
+func NewTagRepository(db *pgxpool.Pool) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// visibleTagsSQL selects the IDs of tags a user ($1) can see:
+// tags they created, plus tags on any project they collaborate on
+const visibleTagsSQL = `
+	SELECT t.id FROM tags t WHERE t.created_by = $1
+	UNION
+	SELECT pt.tag_id FROM project_tags pt
+	INNER JOIN collaborators c ON c.project_id = pt.project_id
+	WHERE c.user_id = $1 AND c.status = 'accepted'
+`
+
+// List returns every tag the user can see
+func (r *TagRepository) List(ctx context.Context, userID uuid.UUID) ([]models.Tag, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, created_by, name, color, created_at
+		FROM tags
+		WHERE id IN (`+visibleTagsSQL+`)
+		ORDER BY name, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.CreatedBy, &t.Name, &t.Color, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// Create makes a new tag
+func (r *TagRepository) Create(ctx context.Context, userID uuid.UUID, name string, color *string) (*models.Tag, error) {
+	tag := &models.Tag{}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO tags (created_by, name, color)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_by, name, color, created_at
+	`, userID, name, color).Scan(&tag.ID, &tag.CreatedBy, &tag.Name, &tag.Color, &tag.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrTagExists
+		}
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// Update renames or recolors a tag (only its creator can)
+func (r *TagRepository) Update(ctx context.Context, userID, tagID uuid.UUID, name, color *string) (*models.Tag, error) {
+	tag := &models.Tag{}
+	err := r.db.QueryRow(ctx, `
+		UPDATE tags
+		SET
+			name = COALESCE($3, name),
+			color = COALESCE($4, color)
+		WHERE id = $1 AND created_by = $2
+		RETURNING id, created_by, name, color, created_at
+	`, tagID, userID, name, color).Scan(&tag.ID, &tag.CreatedBy, &tag.Name, &tag.Color, &tag.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTagNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrTagExists
+		}
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// Delete removes a tag from every project it's on (only its creator can)
+func (r *TagRepository) Delete(ctx context.Context, userID, tagID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM tags WHERE id = $1 AND created_by = $2
+	`, tagID, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// AddToProject attaches a tag to a project
+// Requires edit access to the project, since everyone on it will see the tag
+func (r *TagRepository) AddToProject(ctx context.Context, userID, projectID, tagID uuid.UUID) error {
+	if err := r.checkCanEdit(ctx, userID, projectID); err != nil {
+		return err
+	}
+
+	var visible bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM (`+visibleTagsSQL+`) v WHERE v.id = $2)
+	`, userID, tagID).Scan(&visible)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return ErrTagNotFound
+	}
+
+	// Adding a tag twice is a no-op, not an error
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO project_tags (project_id, tag_id, added_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, tag_id) DO NOTHING
+	`, projectID, tagID, userID)
+	return err
+}
+
+// RemoveFromProject detaches a tag from a project
+func (r *TagRepository) RemoveFromProject(ctx context.Context, userID, projectID, tagID uuid.UUID) error {
+	if err := r.checkCanEdit(ctx, userID, projectID); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM project_tags WHERE project_id = $1 AND tag_id = $2
+	`, projectID, tagID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// checkCanEdit verifies the user has an editing role on a live project
+func (r *TagRepository) checkCanEdit(ctx context.Context, userID, projectID uuid.UUID) error {
+	var role string
+	err := r.db.QueryRow(ctx, `
+		SELECT c.role FROM collaborators c
+		INNER JOIN projects p ON p.id = c.project_id
+		WHERE c.project_id = $1 AND c.user_id = $2
+			AND c.status = 'accepted' AND p.is_deleted = false
+	`, projectID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProjectNotFound
+		}
+		return err
+	}
+
+	if !models.CanEdit(role) {
+		return ErrNotAuthorized
+	}
+
+	return nil
+}
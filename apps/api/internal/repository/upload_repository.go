@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"tempo/internal/models"
+)
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadComplete = errors.New("upload already completed")
+)
+
+// uploadColumns is the column list every upload query returns
+const uploadColumns = `
+	id, owner_id, project_id, filename, content_type, upload_length,
+	upload_offset, part_keys, media_id, expires_at, created_at, updated_at
+`
+
+// UploadRepository handles resumable upload database operations
+type UploadRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewUploadRepository creates a new upload repository
+func NewUploadRepository(db *pgxpool.Pool) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+// Create starts a new upload
+func (r *UploadRepository) Create(ctx context.Context, upload *models.Upload) (*models.Upload, error) {
+	row := r.db.QueryRow(ctx, `
+		INSERT INTO uploads (owner_id, project_id, filename, content_type, upload_length, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+uploadColumns,
+		upload.OwnerID, upload.ProjectID, upload.Filename, upload.ContentType, upload.Length, upload.ExpiresAt)
+	return scanUpload(row)
+}
+
+// CreateLinked records an upload that is complete from the start: the
+// client sent the hash of content the library has, and mediaID is the
+// file Link made of it
+func (r *UploadRepository) CreateLinked(ctx context.Context, upload *models.Upload, mediaID uuid.UUID) (*models.Upload, error) {
+	row := r.db.QueryRow(ctx, `
+		INSERT INTO uploads (owner_id, project_id, filename, content_type, upload_length, upload_offset, media_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7)
+		RETURNING `+uploadColumns,
+		upload.OwnerID, upload.ProjectID, upload.Filename, upload.ContentType, upload.Length, mediaID, upload.ExpiresAt)
+	return scanUpload(row)
+}
+
+// GetByID returns an upload owned by the user
+// Uploads are private to whoever started them
+func (r *UploadRepository) GetByID(ctx context.Context, uploadID, ownerID uuid.UUID) (*models.Upload, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+uploadColumns+`
+		FROM uploads
+		WHERE id = $1 AND owner_id = $2
+	`, uploadID, ownerID)
+	return scanUpload(row)
+}
+
+// PartKeys returns the parts stored so far for an upload, whoever owns it
+// Only for the orphan cleanup, which acts on behalf of the system.
+func (r *UploadRepository) PartKeys(ctx context.Context, uploadID uuid.UUID) ([]string, error) {
+	var keys []string
+	err := r.db.QueryRow(ctx, `
+		SELECT part_keys FROM uploads WHERE id = $1
+	`, uploadID).Scan(&keys)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	return keys, err
+}
+
+// AppendPart records a chunk stored at key, starting at offset
+//
+// CONCURRENCY: the WHERE clause only matches if nobody else appended since
+// the caller read the offset (optimistic locking). Two racing PATCH
+// requests can't both win; the loser gets ErrOffsetMismatch and must
+// delete the blob it wrote.
+func (r *UploadRepository) AppendPart(ctx context.Context, uploadID uuid.UUID, offset, size int64, key string, expiresAt time.Time) (*models.Upload, error) {
+	row := r.db.QueryRow(ctx, `
+		UPDATE uploads
+		SET upload_offset = upload_offset + $3,
+			part_keys = array_append(part_keys, $4),
+			expires_at = $5,
+			updated_at = NOW()
+		WHERE id = $1 AND upload_offset = $2 AND upload_offset + $3 <= upload_length
+		RETURNING `+uploadColumns,
+		uploadID, offset, size, key, expiresAt)
+	upload, err := scanUpload(row)
+	if errors.Is(err, ErrUploadNotFound) {
+		return nil, ErrOffsetMismatch
+	}
+	return upload, err
+}
+
+// Complete links a fully received upload to its media file
+// Fails with ErrUploadComplete if another request finished it first.
+func (r *UploadRepository) Complete(ctx context.Context, uploadID, mediaID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE uploads
+		SET media_id = $2, part_keys = '{}', updated_at = NOW()
+		WHERE id = $1 AND media_id IS NULL AND upload_offset = upload_length
+	`, uploadID, mediaID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUploadComplete
+	}
+
+	return nil
+}
+
+// Delete removes an upload and returns it so the caller can delete its parts
+func (r *UploadRepository) Delete(ctx context.Context, uploadID, ownerID uuid.UUID) (*models.Upload, error) {
+	row := r.db.QueryRow(ctx, `
+		DELETE FROM uploads
+		WHERE id = $1 AND owner_id = $2
+		RETURNING `+uploadColumns,
+		uploadID, ownerID)
+	return scanUpload(row)
+}
+
+// DeleteExpired removes up to limit uploads that expired before now
+// Returns them so the caller can delete their parts.
+func (r *UploadRepository) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]models.Upload, error) {
+	rows, err := r.db.Query(ctx, `
+		DELETE FROM uploads
+		WHERE id IN (
+			SELECT id FROM uploads WHERE expires_at < $1
+			ORDER BY expires_at
+			LIMIT $2
+		)
+		RETURNING `+uploadColumns,
+		now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []models.Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// scanUpload reads one row in uploadColumns order
+func scanUpload(row pgx.Row) (*models.Upload, error) {
+	u := &models.Upload{}
+	err := row.Scan(
+		&u.ID,
+		&u.OwnerID,
+		&u.ProjectID,
+		&u.Filename,
+		&u.ContentType,
+		&u.Length,
+		&u.Offset,
+		&u.PartKeys,
+		&u.MediaID,
+		&u.ExpiresAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps blobs in a directory on disk
+//
+// Used in development and single-server deployments. Presigned URLs point
+// back at this server (see ServeHTTP) and carry an HMAC signature, so they
+// behave like S3 ones: shareable, expiring, and impossible to forge.
+type LocalStore struct {
+	root       string
+	baseURL    string
+	signingKey []byte
+}
+
+// NewLocalStore creates a store rooted at dir
+// baseURL is where ServeHTTP is mounted, e.g. "http://localhost:8080/blobs"
+func NewLocalStore(dir, baseURL string, signingKey []byte) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		root:       dir,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signingKey: signingKey,
+	}, nil
+}
+
+// path maps a key to a file under root
+func (s *LocalStore) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// FilePath returns the absolute path of a blob's file
+func (s *LocalStore) FilePath(key string) (string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+// Put writes to a temp file first and renames it into place, so readers
+// never see a half-written blob and a failed upload leaves nothing behind
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, err
+	}
+
+	return s.Stat(ctx, key)
+}
+
+// Get opens a blob, seeking to the range start if there is one
+func (s *LocalStore) Get(ctx context.Context, key string, rng *Range) (io.ReadCloser, *ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	info := localInfo(key, st)
+
+	if rng == nil {
+		return f, info, nil
+	}
+
+	start, end, err := rng.resolve(info.Size)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return readCloser{io.LimitReader(f, end-start+1), f}, info, nil
+}
+
+// Stat returns a blob's size and modification time
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return localInfo(key, st), nil
+}
+
+// Delete removes a blob if it exists
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the directory tree under prefix
+// Temp files of Puts that never finished (the server crashed mid-write)
+// are listed too: no record points at them, so the orphan cleanup
+// removes them like any other unreferenced blob.
+func (s *LocalStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Start from the deepest directory the prefix names
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	start := filepath.Join(s.root, filepath.FromSlash(dir))
+
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		st, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // Deleted while we were walking
+		}
+		if err != nil {
+			return err
+		}
+		return fn(*localInfo(key, st))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Nothing was ever stored under the prefix
+	}
+	return err
+}
+
+// PresignGet returns a signed, expiring URL served by ServeHTTP
+func (s *LocalStore) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(key, expires))
+
+	return s.baseURL + "/" + escapeKey(key) + "?" + q.Encode(), nil
+}
+
+// ServeHTTP serves blobs for URLs made by PresignGet
+// Mount it with the base URL's path stripped, e.g.
+//
+//	r.Handle("/blobs/*", http.StripPrefix("/blobs/", store))
+//
+// http.ServeContent handles Range requests (206 Partial Content, with
+// Accept-Ranges on every response), so the browser can seek in long
+// videos without downloading them. S3 presigned URLs do the same.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	// Constant-time compare so the signature can't be guessed byte by byte
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "Link expired", http.StatusForbidden)
+		return
+	}
+
+	p, err := s.path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Playing a long video from the start can take far longer than the
+	// server's write timeout: lift it for this response (errors mean "not
+	// supported"). ServeContent doesn't watch the request context, so the
+	// timeout middleware can't cut it short either.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Blobs never change once written, so caches can keep them
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, path.Base(key), st.ModTime(), f)
+}
+
+// sign returns the hex HMAC-SHA256 of key and expiry
+func (s *LocalStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// localInfo builds ObjectInfo from a file
+// The filesystem has no content type, so it's derived from the extension
+func localInfo(key string, st fs.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        st.Size(),
+		ContentType: contentType,
+		ModTime:     st.ModTime(),
+	}
+}
+
+// escapeKey URL-encodes each segment of a key, keeping the slashes
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// readCloser pairs a (limited) reader with the file it must close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
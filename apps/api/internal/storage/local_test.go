@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestLocalServeOutlivesWriteTimeout serves a blob from a server whose
+// write timeout runs out before the response is written, as it does for
+// a long video on a slow connection
+func TestLocalServeOutlivesWriteTimeout(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	store, err := NewLocalStore(t.TempDir(), srv.URL+"/blobs", []byte("test key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/blobs/", http.StripPrefix("/blobs/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond) // Past the write timeout
+		store.ServeHTTP(w, r)
+	})))
+
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("frame"), 100000)
+	if _, err := store.Put(ctx, "media/clip.mp4", bytes.NewReader(data), PutOptions{Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := store.PresignGet(ctx, "media/clip.mp4", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+		t.Errorf("GET = %d with %d of %d bytes, %v", resp.StatusCode, len(got), len(data), err)
+	}
+}
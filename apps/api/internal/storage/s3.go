@@ -0,0 +1,448 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the chunk size for multipart uploads
+// S3's minimum is 5MB (except the last part). 16MB keeps memory bounded
+// while staying far below the 10,000-part limit for 500MB+ files.
+const s3PartSize = 16 << 20
+
+// S3Config configures an S3-compatible store
+type S3Config struct {
+	Endpoint        string // e.g. "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000" (MinIO)
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// UsePathStyle puts the bucket in the path (endpoint/bucket/key)
+	// instead of the host (bucket.endpoint/key). MinIO needs this.
+	UsePathStyle bool
+}
+
+// S3Store keeps blobs in an S3-compatible bucket
+//
+// WHY NOT THE AWS SDK?
+// We need six operations. Talking to the REST API directly with a small
+// Signature V4 implementation (sigv4.go) keeps the dependency tree small
+// and works the same against AWS, MinIO and R2.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store creates a store for the configured bucket
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		// No overall timeout: large uploads legitimately take minutes.
+		// Requests are bounded by their context instead.
+		client: &http.Client{},
+	}, nil
+}
+
+// objectURL returns the URL of a key (with optional query)
+func (s *S3Store) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.cfg.UsePathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return &u
+}
+
+// do signs and sends a request
+// body may be nil; size is its length, or -1 to stream it unsigned
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	if body != nil && size == 0 {
+		// net/http sends a non-nil body of length 0 chunked, which S3
+		// refuses for a PUT
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil && size >= 0 {
+		req.ContentLength = size
+	}
+
+	s.signer().signRequest(req, unsignedPayload, time.Now())
+	return s.client.Do(req)
+}
+
+// Put uploads in one request when the size is known and small enough,
+// otherwise as a multipart upload (one part in memory at a time)
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+
+	if opts.Size >= 0 && opts.Size <= s3PartSize {
+		if err := s.putObject(ctx, key, r, opts.Size, opts.ContentType); err != nil {
+			return nil, err
+		}
+		return s.Stat(ctx, key)
+	}
+
+	// Unknown or large size: read the first part to find out which we need
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if err := s.putObject(ctx, key, bytes.NewReader(buf[:n]), int64(n), opts.ContentType); err != nil {
+			return nil, err
+		}
+		return s.Stat(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.multipartUpload(ctx, key, buf, r, opts.ContentType); err != nil {
+		return nil, err
+	}
+	return s.Stat(ctx, key)
+}
+
+// putObject is a single PUT request
+func (s *S3Store) putObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, r, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// multipartUpload uploads first, then the rest of r, in s3PartSize parts
+// Aborts the upload on failure so S3 doesn't keep (and bill) the parts.
+func (s *S3Store) multipartUpload(ctx context.Context, key string, first []byte, r io.Reader, contentType string) error {
+	uploadID, err := s.createMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.uploadParts(ctx, key, uploadID, first, r)
+	if err == nil {
+		err = s.completeMultipartUpload(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		// Use a fresh context: the request's may be what got cancelled
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// completedPart is one entry of CompleteMultipartUpload
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Store) createMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", s3Error(resp)
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("s3: invalid CreateMultipartUpload response: %w", err)
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3Store) uploadParts(ctx context.Context, key, uploadID string, first []byte, r io.Reader) ([]completedPart, error) {
+	var parts []completedPart
+	buf := first
+	n := len(first)
+
+	for partNumber := 1; n > 0; partNumber++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do(ctx, http.MethodPut, key, query, bytes.NewReader(buf[:n]), int64(n), nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s3Error(resp)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+	}
+
+	return parts, nil
+}
+
+func (s *S3Store) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 can return 200 with an <Error> body if assembly fails late
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || bytes.Contains(data, []byte("<Error>")) {
+		return fmt.Errorf("s3: complete multipart upload failed (%d): %s", resp.StatusCode, data)
+	}
+	return nil
+}
+
+// Get downloads a blob, or a byte range of it
+func (s *S3Store) Get(ctx context.Context, key string, rng *Range) (io.ReadCloser, *ObjectInfo, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	if rng != nil {
+		header.Set("Range", rng.header())
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, 0, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, nil, ErrNotFound
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, nil, ErrInvalidRange
+	default:
+		defer resp.Body.Close()
+		return nil, nil, s3Error(resp)
+	}
+
+	info := s3Info(key, resp)
+	// For ranges, Content-Length is the range - the total is in Content-Range
+	if resp.StatusCode == http.StatusPartialContent {
+		if total, ok := totalFromContentRange(resp.Header.Get("Content-Range")); ok {
+			info.Size = total
+		}
+	}
+	return resp.Body, info, nil
+}
+
+// Stat is a HEAD request
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return s3Info(key, resp), nil
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, s3Error(resp)
+	}
+}
+
+// Delete removes a blob (S3 already treats missing keys as success)
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// List pages through ListObjectsV2 (up to 1000 keys per request)
+// S3 lists in key order, so keys in the same "directory" come out together.
+func (s *S3Store) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	}
+	for {
+		// An empty key addresses the bucket itself
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return s3Error(resp)
+		}
+
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3: invalid ListObjectsV2 response: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			// The listing doesn't include content types; nothing needs them
+			if err := fn(ObjectInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified}); err != nil {
+				return err
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// PresignGet builds a query-signed URL (no request is made)
+func (s *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	u := s.objectURL(key, nil)
+	return s.signer().presign(http.MethodGet, u, ttl, time.Now()), nil
+}
+
+func (s *S3Store) signer() sigV4Signer {
+	return sigV4Signer{
+		accessKey: s.cfg.AccessKeyID,
+		secretKey: s.cfg.SecretAccessKey,
+		region:    s.cfg.Region,
+		service:   "s3",
+	}
+}
+
+// s3Info reads object metadata from response headers
+func s3Info(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+// totalFromContentRange parses the total out of "bytes 0-99/12345"
+func totalFromContentRange(value string) (int64, bool) {
+	i := strings.LastIndex(value, "/")
+	if i < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(value[i+1:], 10, 64)
+	return total, err == nil
+}
+
+// s3Error turns an error response into a Go error
+func s3Error(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("s3: %s (%d): %s", body.Code, resp.StatusCode, body.Message)
+	}
+	return fmt.Errorf("s3: unexpected status %d", resp.StatusCode)
+}
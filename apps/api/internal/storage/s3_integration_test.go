@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The S3 store is tested against a real S3-compatible server when
+// S3_TEST_ENDPOINT is set, and skipped otherwise. With the compose file:
+//
+//	docker compose --profile s3 up -d minio minio-setup
+//	S3_TEST_ENDPOINT=http://localhost:9000 go test ./internal/storage/
+//
+// The bucket (S3_TEST_BUCKET, "tempo-test" by default) must exist; every
+// run works under its own prefix and deletes what it wrote.
+func newTestS3Store(t *testing.T) *S3Store {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	env := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        endpoint,
+		Region:          env("S3_TEST_REGION", "us-east-1"),
+		Bucket:          env("S3_TEST_BUCKET", "tempo-test"),
+		AccessKeyID:     env("S3_TEST_ACCESS_KEY_ID", "minio"),
+		SecretAccessKey: env("S3_TEST_SECRET_ACCESS_KEY", "minio123"),
+		UsePathStyle:    env("S3_TEST_USE_PATH_STYLE", "true") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testPrefix is a fresh prefix for one test, emptied when it ends
+func testPrefix(t *testing.T, store *S3Store) string {
+	prefix := "test/" + uuid.NewString() + "/"
+	t.Cleanup(func() {
+		ctx := context.Background()
+		var keys []string
+		_ = store.List(ctx, prefix, func(obj ObjectInfo) error {
+			keys = append(keys, obj.Key)
+			return nil
+		})
+		for _, key := range keys {
+			_ = store.Delete(ctx, key)
+		}
+	})
+	return prefix
+}
+
+// pattern returns n bytes that differ from part to part, so a part
+// stitched in the wrong place shows
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i/7 + i%251)
+	}
+	return b
+}
+
+func readAll(t *testing.T, rc io.ReadCloser) []byte {
+	t.Helper()
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	store := newTestS3Store(t)
+	prefix := testPrefix(t, store)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		size int
+		opts PutOptions
+	}{
+		{"known size, one request", 1000, PutOptions{ContentType: "text/plain", Size: 1000}},
+		{"unknown size, one request", 1000, PutOptions{ContentType: "text/plain", Size: -1}},
+		{"empty", 0, PutOptions{Size: 0}},
+		{"unknown size, multipart", s3PartSize + 1<<20, PutOptions{ContentType: "video/mp4", Size: -1}},
+		{"known size, multipart", 2*s3PartSize + 1, PutOptions{ContentType: "video/mp4", Size: 2*s3PartSize + 1}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := prefix + "blob-" + string(rune('a'+i))
+			data := pattern(tt.size)
+
+			// Hide the reader's type: net/http treats a *bytes.Reader specially
+			r := struct{ io.Reader }{bytes.NewReader(data)}
+			info, err := store.Put(ctx, key, r, tt.opts)
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if info.Size != int64(tt.size) {
+				t.Errorf("Put size = %d, want %d", info.Size, tt.size)
+			}
+
+			want := tt.opts.ContentType
+			if want == "" {
+				want = "application/octet-stream"
+			}
+			info, err = store.Stat(ctx, key)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Size != int64(tt.size) || info.ContentType != want || info.ModTime.IsZero() {
+				t.Errorf("Stat = %+v, want size %d, type %s", info, tt.size, want)
+			}
+
+			rc, info, err := store.Get(ctx, key, nil)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got := readAll(t, rc); !bytes.Equal(got, data) {
+				t.Errorf("Get returned %d bytes that differ from the %d stored", len(got), len(data))
+			}
+			if info.Size != int64(tt.size) {
+				t.Errorf("Get size = %d, want %d", info.Size, tt.size)
+			}
+		})
+	}
+}
+
+func TestS3StoreRanges(t *testing.T) {
+	store := newTestS3Store(t)
+	prefix := testPrefix(t, store)
+	ctx := context.Background()
+
+	key := prefix + "ranged"
+	data := pattern(s3PartSize + 100)
+	if _, err := store.Put(ctx, key, bytes.NewReader(data), PutOptions{Size: -1}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		rng        Range
+		start, end int // Expected bytes, end exclusive
+	}{
+		{"first bytes", Range{Start: 0, End: 9}, 0, 10},
+		{"across the part boundary", Range{Start: s3PartSize - 5, End: s3PartSize + 4}, s3PartSize - 5, s3PartSize + 5},
+		{"to the end", Range{Start: s3PartSize + 90, End: -1}, s3PartSize + 90, len(data)},
+		{"end past the size", Range{Start: s3PartSize + 95, End: 1 << 40}, s3PartSize + 95, len(data)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, info, err := store.Get(ctx, key, &tt.rng)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got := readAll(t, rc); !bytes.Equal(got, data[tt.start:tt.end]) {
+				t.Errorf("got %d bytes, want bytes %d-%d", len(got), tt.start, tt.end)
+			}
+			if info.Size != int64(len(data)) {
+				t.Errorf("info size = %d, want the whole blob's %d", info.Size, len(data))
+			}
+		})
+	}
+
+	if _, _, err := store.Get(ctx, key, &Range{Start: int64(len(data)) + 10, End: -1}); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("range past the end: %v, want ErrInvalidRange", err)
+	}
+}
+
+func TestS3StoreListAndDelete(t *testing.T) {
+	store := newTestS3Store(t)
+	prefix := testPrefix(t, store)
+	ctx := context.Background()
+
+	keys := []string{prefix + "a/1", prefix + "a/2", prefix + "b/with space+plus", prefix + "c"}
+	for _, key := range keys {
+		if _, err := store.Put(ctx, key, strings.NewReader(key), PutOptions{Size: int64(len(key))}); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	var listed []string
+	err := store.List(ctx, prefix+"a/", func(obj ObjectInfo) error {
+		listed = append(listed, obj.Key)
+		if obj.Size != int64(len(obj.Key)) {
+			t.Errorf("listed %s with size %d", obj.Key, obj.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if strings.Join(listed, ",") != keys[0]+","+keys[1] {
+		t.Errorf("List(a/) = %v", listed)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = store.List(ctx, prefix, func(ObjectInfo) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("List didn't stop at the callback's error: %v after %d", err, n)
+	}
+
+	if err := store.Delete(ctx, keys[2]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, keys[2]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete: %v, want ErrNotFound", err)
+	}
+	if _, _, err := store.Get(ctx, keys[2], nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, keys[2]); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestS3StorePresignGet(t *testing.T) {
+	store := newTestS3Store(t)
+	prefix := testPrefix(t, store)
+	ctx := context.Background()
+
+	key := prefix + "shared file.txt"
+	if _, err := store.Put(ctx, key, strings.NewReader("hello"), PutOptions{ContentType: "text/plain", Size: 5}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	signed, err := store.PresignGet(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET presigned URL: %v", err)
+	}
+	if body := readAll(t, resp.Body); resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, body)
+	}
+
+	// A tampered URL must be refused
+	resp, err = http.Get(strings.Replace(signed, "shared%20file", "other%20file", 1))
+	if err != nil {
+		t.Fatalf("GET tampered URL: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET tampered URL = %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,265 @@
+// Package storage keeps media bytes out of the API server's code paths
+//
+// WHY AN INTERFACE?
+// In development files live on local disk. In production they live in S3
+// (or anything that speaks the S3 API - MinIO, R2, GCS interop) behind a
+// CDN. Handlers only ever talk to BlobStore, so switching backends is a
+// config change, not a code change.
+//
+// Keys are slash-separated paths like "media/<id>.mp4". They are always
+// built by this package or by the server, never taken from user input.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound     = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+	ErrInvalidRange = errors.New("requested range not satisfiable")
+)
+
+// BlobStore stores and serves immutable blobs
+type BlobStore interface {
+	// Put streams r into key, replacing anything already there
+	// Memory use stays bounded however large the blob is.
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) (*ObjectInfo, error)
+
+	// Get opens a blob, or part of it when rng is not nil
+	// The returned info always describes the WHOLE blob.
+	Get(ctx context.Context, key string, rng *Range) (io.ReadCloser, *ObjectInfo, error)
+
+	// Stat returns a blob's metadata without reading it
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// Delete removes a blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List calls fn for every blob whose key starts with prefix
+	// Keys in the same "directory" come out together. An error from fn
+	// stops the listing and is returned. Used by the orphan cleanup.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+
+	// PresignGet returns a URL anyone can GET the blob from until ttl passes
+	// Lets browsers download straight from storage instead of through us.
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// PutOptions describes a blob being stored
+type PutOptions struct {
+	ContentType string
+	Size        int64 // -1 if unknown (the store then uploads in parts)
+}
+
+// ObjectInfo is a blob's metadata
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Range selects bytes Start..End of a blob, both inclusive
+// End = -1 means "to the end", like the HTTP header "bytes=100-"
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// resolve turns the range into absolute offsets for a blob of the given size
+func (r Range) resolve(size int64) (start, end int64, err error) {
+	end = r.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	if r.Start < 0 || r.Start > end {
+		return 0, 0, ErrInvalidRange
+	}
+	return r.Start, end, nil
+}
+
+// header formats the range as an HTTP Range header value
+func (r Range) header() string {
+	if r.End < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+}
+
+// FileStore is implemented by stores whose blobs are plain local files
+type FileStore interface {
+	FilePath(key string) (string, error)
+}
+
+// toolURLTTL is how long URLs handed to external tools stay valid
+const toolURLTTL = 2 * time.Hour
+
+// ToolInput returns where an external tool (ffprobe, ffmpeg) can read a
+// blob: the file itself for local storage, a presigned URL otherwise.
+// Both tools read http(s) and seek with range requests, so nothing has
+// to be downloaded first.
+func ToolInput(ctx context.Context, store BlobStore, key string) (string, error) {
+	if fs, ok := store.(FileStore); ok {
+		return fs.FilePath(key)
+	}
+	return store.PresignGet(ctx, key, toolURLTTL)
+}
+
+// PutFile stores a local file (e.g. one a tool wrote) at key
+// The size is known up front, so backends can upload it in one request.
+func PutFile(ctx context.Context, store BlobStore, key, path, contentType string) (*ObjectInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Put(ctx, key, f, PutOptions{
+		ContentType: contentType,
+		Size:        st.Size(),
+	})
+}
+
+// ValidateKey rejects keys that could escape the store's namespace
+// Backends call it on every operation as defense in depth.
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return ErrInvalidKey
+	}
+	if path.Clean(key) != key || key == "." || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// Key layout
+// Grouping by kind keeps the bucket browsable and lets lifecycle rules
+// (e.g. "expire exports after 30 days") target a prefix.
+
+// ContentKey is where an uploaded source file is stored: by the hex
+// SHA-256 of its bytes, so identical uploads share one blob
+func ContentKey(sha256, ext string) string {
+	return "media/sha256/" + sha256 + ext
+}
+
+// ParseContentKey returns the hash a ContentKey was built from
+func ParseContentKey(key string) (sha256 string, ok bool) {
+	name, ok := strings.CutPrefix(key, "media/sha256/")
+	if !ok {
+		return "", false
+	}
+	sha256, _, _ = strings.Cut(name, ".")
+	if len(sha256) != 64 || strings.Trim(sha256, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return sha256, true
+}
+
+// MediaKey is where source files were stored before deduplication
+// Still found in the storage_key of older records.
+func MediaKey(mediaID uuid.UUID, ext string) string {
+	return "media/" + mediaID.String() + ext
+}
+
+// ThumbnailKey is where a derived image for a media file is stored
+func ThumbnailKey(mediaID uuid.UUID, name string) string {
+	return "thumbnails/" + mediaID.String() + "/" + name
+}
+
+// WaveformKey is where a level of a media file's audio peaks is stored
+func WaveformKey(mediaID uuid.UUID, name string) string {
+	return "waveforms/" + mediaID.String() + "/" + name
+}
+
+// ProxyKey is where a low-resolution preview copy of a media file is stored
+func ProxyKey(mediaID uuid.UUID, name string) string {
+	return "proxies/" + mediaID.String() + "/" + name
+}
+
+// HLSKey is where a file of a media file's HLS package is stored
+// name is relative to the package, e.g. "720p/seg-00003.ts"
+func HLSKey(mediaID uuid.UUID, name string) string {
+	return "hls/" + mediaID.String() + "/" + name
+}
+
+// FrameKey is where a cached still frame of a media file is stored
+func FrameKey(mediaID uuid.UUID, name string) string {
+	return "frames/" + mediaID.String() + "/" + name
+}
+
+// UploadPartKey is where one chunk of a resumable upload is stored
+// partID is random so two racing requests never write the same key
+func UploadPartKey(uploadID, partID uuid.UUID) string {
+	return "uploads/" + uploadID.String() + "/" + partID.String()
+}
+
+// ExportKey is where a rendered export is stored
+func ExportKey(exportID, ext string) string {
+	return "exports/" + exportID + ext
+}
+
+// ConcatReader reads several blobs back to back as one stream
+// Each blob is only opened when the previous one is used up.
+type ConcatReader struct {
+	ctx   context.Context
+	store BlobStore
+	keys  []string
+	cur   io.ReadCloser
+}
+
+// NewConcatReader returns a reader over the given keys, in order
+func NewConcatReader(ctx context.Context, store BlobStore, keys []string) *ConcatReader {
+	return &ConcatReader{ctx: ctx, store: store, keys: keys}
+}
+
+func (c *ConcatReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, _, err := c.store.Get(c.ctx, c.keys[0], nil)
+			if err != nil {
+				return 0, err
+			}
+			c.cur = rc
+			c.keys = c.keys[1:]
+		}
+
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the blob currently being read
+func (c *ConcatReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	err := c.cur.Close()
+	c.cur = nil
+	return err
+}
@@ -10,6 +10,7 @@ import { UploadOverlay } from '@/components/UploadOverlay'
 import { ExportModal } from '@/components/ExportModal'
 import { useCollaboration } from '@/hooks/useCollaboration'
 import { useAuth } from '@/context/AuthContext'
+import type { GeneratedEffect } from '@/lib/api'
 
 export default function Home() {
   const [videoFile, setVideoFile] = useState<File | null>(null)
@@ -97,16 +98,15 @@ export default function Home() {
     setDuration(dur)
   }, [])
 
-  const handleAIGenerate = useCallback((prompt: string, effects: Array<{ type: string; params: Record<string, number> }>) => {
+  const handleAIGenerate = useCallback((prompt: string, effects: GeneratedEffect[]) => {
     console.log('AI Generate:', prompt, effects)
     if (effects.length > 0) {
       const firstEffect = effects[0]
       setSelectedEffect(firstEffect.type)
-      if (firstEffect.params.decay !== undefined && firstEffect.params.intensity !== undefined) {
-        setEffectParams({
-          decay: firstEffect.params.decay,
-          intensity: firstEffect.params.intensity,
-        })
+      // Only plain numbers drive the preview; keyframed values are left alone
+      const { decay, intensity } = firstEffect.params
+      if (typeof decay === 'number' && typeof intensity === 'number') {
+        setEffectParams({ decay, intensity })
       }
     }
   }, [setSelectedEffect, setEffectParams])
@@ -198,7 +198,7 @@ export function EffectPanel({ selectedEffect, onSelectEffect, onAIGenerate }: Ef
                 >
                   <span className="font-medium">{effect.type}</span>
                   <span className="text-tempo-text-muted ml-2">
-                    {Object.entries(effect.params).map(([k, v]) => `${k}: ${(v as number).toFixed(2)}`).join(', ')}
+                    {Object.entries(effect.params).map(([k, v]) => `${k}: ${typeof v === 'number' ? v.toFixed(2) : JSON.stringify(v)}`).join(', ')}
                   </span>
                 </button>
               ))}
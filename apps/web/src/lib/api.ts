@@ -43,7 +43,8 @@ export interface Effect {
   name: string
   startTime: number
   endTime: number
-  params: Record<string, number>
+  // Checked against the effect's ParamDefinitions when the timeline is saved
+  params: Record<string, ParamValue | ParamTrack>
 }
 
 export async function listProjects() {
@@ -132,14 +133,40 @@ export interface EffectDefinition {
   description: string
   category: string
   params: ParamDefinition[]
+  // Compound effects: the effects they expand to, in order
+  stack?: StackLayer[]
+}
+
+export interface StackLayer {
+  effect: string
+  version: number
+  params?: Record<string, ParamValue>
+  macros?: Record<string, string>
+}
+
+// JSON of each param type: float/int number, bool boolean, enum one of
+// options, color "#rrggbb[aa]", vec2 [x, y], curve [[x, y], ...]
+export type ParamValue = number | boolean | string | [number, number] | [number, number][]
+
+// Animated float, int and vec2 params hold a keyframe track instead of a value
+export interface ParamTrack {
+  keyframes: Keyframe[]
+}
+
+export interface Keyframe {
+  time: number // Seconds from the start of the clip
+  value: number | [number, number]
+  easing?: 'linear' | 'hold' | 'ease-in' | 'ease-out' | 'ease-in-out' | 'bezier'
+  bezier?: [number, number, number, number] // For easing "bezier", as in CSS cubic-bezier()
 }
 
 export interface ParamDefinition {
   name: string
-  type: string
-  min: number
-  max: number
-  default: number
+  type: 'float' | 'int' | 'bool' | 'enum' | 'color' | 'vec2' | 'curve'
+  min?: number
+  max?: number
+  options?: string[]
+  default: ParamValue
   description: string
 }
 
@@ -151,7 +178,7 @@ export async function listEffects() {
 // AI Generation
 export interface GeneratedEffect {
   type: string
-  params: Record<string, number>
+  params: Record<string, ParamValue | ParamTrack>
 }
 
 export interface GenerateEffectResponse {